@@ -0,0 +1,287 @@
+package backend
+
+// 配下のTWSNMP FCからノード、ポーリング、イベントログ、AI分析結果を取得する
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/client"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+type federationClientEnt struct {
+	mu            sync.Mutex // apiのトークンと取得処理を保護する
+	running       atomic.Bool
+	api           *client.TWSNMPApi
+	url           string
+	nextTime      int64
+	lastEventTime int64
+}
+
+var federationClients sync.Map
+
+func federationBackend(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	log.Println("start federation backend")
+	timer := time.NewTicker(time.Second * 10)
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("stop federation backend")
+			return
+		case <-timer.C:
+			now := time.Now().Unix()
+			for _, s := range datastore.GetFederationSites() {
+				if s.Disabled {
+					continue
+				}
+				fc := getFederationClient(s)
+				if fc.nextTime > now || !fc.running.CompareAndSwap(false, true) {
+					continue
+				}
+				fc.nextTime = now + int64(s.Interval)
+				// 応答しないサイトで他のサイトの取得が遅れないように並列に取得する
+				go func(s *datastore.FederationSiteEnt, fc *federationClientEnt) {
+					defer fc.running.Store(false)
+					updateFederationMap(s, fc)
+				}(s, fc)
+			}
+		}
+	}
+}
+
+func getFederationClient(s *datastore.FederationSiteEnt) *federationClientEnt {
+	if v, ok := federationClients.Load(s.ID); ok {
+		if fc, ok := v.(*federationClientEnt); ok && fc.url == s.URL {
+			return fc
+		}
+	}
+	fc := &federationClientEnt{
+		api:           client.NewClient(strings.TrimSuffix(s.URL, "/")),
+		url:           s.URL,
+		lastEventTime: time.Now().Add(-time.Hour).UnixNano(),
+	}
+	federationClients.Store(s.ID, fc)
+	return fc
+}
+
+// login : fc.muをロックして呼び出す
+func (fc *federationClientEnt) login(s *datastore.FederationSiteEnt) error {
+	fc.api.InsecureSkipVerify = s.InsecureSkipVerify
+	if fc.api.Token != "" {
+		return nil
+	}
+	if err := fc.api.Login(s.User, s.Password); err != nil {
+		return err
+	}
+	if fc.api.Token == "" {
+		return fmt.Errorf("login failed")
+	}
+	return nil
+}
+
+// updateFederationMap : 配下のTWSNMP FCからデータを取得してサブマップを更新する
+func updateFederationMap(s *datastore.FederationSiteEnt, fc *federationClientEnt) {
+	m := &datastore.FederationMapEnt{
+		SiteID:     s.ID,
+		SiteName:   s.Name,
+		UpdateTime: time.Now().UnixNano(),
+		Nodes:      []*datastore.FederationNodeEnt{},
+		Pollings:   []*datastore.FederationPollingEnt{},
+		AIList:     []*datastore.FederationAIEnt{},
+	}
+	fc.mu.Lock()
+	err := fetchFederationMap(s, fc, m)
+	if err != nil {
+		// トークンの期限切れに備えて次回は再ログインする
+		fc.api.Token = ""
+	}
+	fc.mu.Unlock()
+	if err != nil {
+		m.State = "unknown"
+		m.Error = err.Error()
+		if old := datastore.GetFederationMap(s.ID); old == nil || old.Error == "" {
+			datastore.AddEventLog(&datastore.EventLogEnt{
+				Type:     "federation",
+				Level:    "warn",
+				NodeName: s.Name,
+				Event:    fmt.Sprintf("配下のTWSNMP FCからの取得に失敗しました err=%v", err),
+			})
+		}
+		if old := datastore.GetFederationMap(s.ID); old != nil {
+			// 取得に失敗した場合は前回のデータを残す
+			m.Nodes = old.Nodes
+			m.Pollings = old.Pollings
+			m.AIList = old.AIList
+		}
+	}
+	datastore.SetFederationMap(m)
+}
+
+func fetchFederationMap(s *datastore.FederationSiteEnt, fc *federationClientEnt, m *datastore.FederationMapEnt) error {
+	if err := fc.login(s); err != nil {
+		return err
+	}
+	nodes, err := fc.api.GetNodes()
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		m.Nodes = append(m.Nodes, &datastore.FederationNodeEnt{
+			ID:    n.ID,
+			Name:  n.Name,
+			Descr: n.Descr,
+			Icon:  n.Icon,
+			State: n.State,
+			IP:    n.IP,
+			X:     n.X,
+			Y:     n.Y,
+		})
+		switch n.State {
+		case "high":
+			m.High++
+		case "low":
+			m.Low++
+		case "warn":
+			m.Warn++
+		case "normal":
+			m.Normal++
+		case "repair":
+			m.Repair++
+		default:
+			m.Unknown++
+		}
+	}
+	m.State = getFederationMapState(m)
+	pollings, err := fc.api.GetPollings()
+	if err != nil {
+		return err
+	}
+	for _, p := range pollings.Pollings {
+		m.Pollings = append(m.Pollings, &datastore.FederationPollingEnt{
+			ID:       p.ID,
+			NodeID:   p.NodeID,
+			Name:     p.Name,
+			Type:     p.Type,
+			Level:    p.Level,
+			State:    p.State,
+			LastTime: p.LastTime,
+		})
+	}
+	if ai, err := fc.api.GetAIList(); err == nil {
+		for _, a := range ai {
+			m.AIList = append(m.AIList, &datastore.FederationAIEnt{
+				ID:          a.ID,
+				NodeID:      a.NodeID,
+				NodeName:    a.NodeName,
+				PollingName: a.PollingName,
+				Score:       a.Score,
+				Count:       a.Count,
+				LastTime:    a.LastTime,
+			})
+		}
+	}
+	if s.ForwardLevel != "" {
+		// イベントログの転送に失敗してもマップは更新する、次回は同じ時刻から転送する
+		if err := forwardFederationEventLogs(s, fc); err != nil {
+			log.Printf("forward federation event logs site=%s err=%v", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func getFederationMapState(m *datastore.FederationMapEnt) string {
+	switch {
+	case m.High > 0:
+		return "high"
+	case m.Low > 0:
+		return "low"
+	case m.Warn > 0:
+		return "warn"
+	case m.Repair > 0:
+		return "repair"
+	case m.Normal > 0:
+		return "normal"
+	}
+	return "unknown"
+}
+
+// forwardFederationEventLogs : 配下のTWSNMP FCのイベントログを転送する
+func forwardFederationEventLogs(s *datastore.FederationSiteEnt, fc *federationClientEnt) error {
+	st := time.Unix(0, fc.lastEventTime)
+	logs, err := fc.api.GetEventLogs(&client.EventLogFilter{
+		StartDate: st.Format("2006-01-02"),
+		StartTime: st.Format("15:04"),
+	})
+	if err != nil {
+		return err
+	}
+	last := fc.lastEventTime
+	// 古い順に転送する
+	for i := len(logs.EventLogs) - 1; i >= 0; i-- {
+		l := logs.EventLogs[i]
+		if l.Time <= fc.lastEventTime {
+			continue
+		}
+		if l.Time > last {
+			last = l.Time
+		}
+		if !isFederationForwardLevel(s.ForwardLevel, l.Level) {
+			continue
+		}
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:     "federation",
+			Level:    l.Level,
+			NodeName: fmt.Sprintf("%s/%s", s.Name, l.NodeName),
+			Event:    fmt.Sprintf("[%s] %s", l.Type, l.Event),
+		})
+	}
+	fc.lastEventTime = last
+	return nil
+}
+
+func isFederationForwardLevel(fl, level string) bool {
+	switch fl {
+	case "all":
+		return true
+	case "warn":
+		return level == "high" || level == "low" || level == "warn"
+	case "low":
+		return level == "high" || level == "low"
+	case "high":
+		return level == "high"
+	}
+	return false
+}
+
+// GetFederationNodeLogs : 配下のTWSNMP FCからノードのイベントログを取得する
+func GetFederationNodeLogs(siteID, nodeID string) ([]*client.EventLogEnt, error) {
+	s := datastore.GetFederationSite(siteID)
+	if s == nil {
+		return nil, datastore.ErrInvalidID
+	}
+	fc := getFederationClient(s)
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if err := fc.login(s); err != nil {
+		return nil, err
+	}
+	st := time.Now().Add(-time.Hour * 24)
+	logs, err := fc.api.GetEventLogs(&client.EventLogFilter{
+		NodeID:    nodeID,
+		StartDate: st.Format("2006-01-02"),
+		StartTime: st.Format("15:04"),
+	})
+	if err != nil {
+		fc.api.Token = ""
+		return nil, err
+	}
+	return logs.EventLogs, nil
+}
@@ -305,6 +305,7 @@ func FindNeighborNetworksAndLines(n *datastore.NetworkEnt) *FindNeighborNetworks
 			rn.Community = n.Community
 			rn.Password = n.Password
 			rn.User = n.User
+			rn.CredentialID = n.CredentialID
 			rn.HPorts = n.HPorts
 			rn.Ports = []datastore.PortEnt{}
 			rn.Y = n.Y + n.H
@@ -808,9 +809,10 @@ func checkNetworkArpWatch(agent *gosnmp.GoSNMP) {
 }
 
 func getSNMPAgentForNetwork(n *datastore.NetworkEnt) *gosnmp.GoSNMP {
-	if strings.HasPrefix(n.SnmpMode, "v3") && n.User == "" {
+	cred := datastore.GetNetworkCredential(n)
+	if strings.HasPrefix(cred.SnmpMode, "v3") && cred.User == "" {
 		return nil
-	} else if n.Community == "" {
+	} else if cred.Community == "" {
 		return nil
 	}
 	port := uint16(161)
@@ -821,67 +823,13 @@ func getSNMPAgentForNetwork(n *datastore.NetworkEnt) *gosnmp.GoSNMP {
 		Target:    n.IP,
 		Port:      port,
 		Transport: "udp",
-		Community: n.Community,
+		Community: cred.Community,
 		Version:   gosnmp.Version2c,
 		Timeout:   time.Duration(datastore.MapConf.Timeout) * time.Second,
 		Retries:   datastore.MapConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch n.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	}
+	cred.SetSnmpAgent(agent)
 	return agent
 }
 
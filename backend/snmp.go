@@ -514,9 +514,10 @@ func getPortsBySNMP(n *datastore.NodeEnt) []*VPanelPortEnt {
 }
 
 func getSNMPAgent(n *datastore.NodeEnt) *gosnmp.GoSNMP {
-	if strings.HasPrefix(n.SnmpMode, "v3") && n.User == "" {
+	cred := datastore.GetNodeCredential(n, "snmp")
+	if strings.HasPrefix(cred.SnmpMode, "v3") && cred.User == "" {
 		return nil
-	} else if n.Community == "" {
+	} else if cred.Community == "" {
 		return nil
 	}
 	port := uint16(161)
@@ -527,67 +528,13 @@ func getSNMPAgent(n *datastore.NodeEnt) *gosnmp.GoSNMP {
 		Target:    n.IP,
 		Port:      port,
 		Transport: "udp",
-		Community: n.Community,
+		Community: cred.Community,
 		Version:   gosnmp.Version2c,
 		Timeout:   time.Duration(datastore.MapConf.Timeout) * time.Second,
 		Retries:   datastore.MapConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch n.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	}
+	cred.SetSnmpAgent(agent)
 	return agent
 }
 
@@ -4,6 +4,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
@@ -23,6 +24,8 @@ type VPanelPortEnt struct {
 	Admin        int64
 	Oper         int64
 	MAC          string
+	FlowKey      string // フローの集計のインタフェース(エクスポーターのIP:ifIndex)
+	FlowBytes    int64  // 過去1時間のフローのバイト数
 	pollingIndex string
 }
 
@@ -48,15 +51,62 @@ func GetVPanelPowerInfo(n *datastore.NodeEnt) bool {
 // 3.ラインの設定
 func GetVPanelPorts(n *datastore.NodeEnt) []*VPanelPortEnt {
 	// ポーリングから取得
-	if ports := getPortsFromPolling(n); len(ports) > 0 {
-		return ports
+	ports := getPortsFromPolling(n)
+	if len(ports) < 1 {
+		// SNMPで取得
+		ports = getPortsBySNMP(n)
 	}
-	// SNMPで取得
-	if ports := getPortsBySNMP(n); len(ports) > 0 {
-		return ports
+	if len(ports) < 1 {
+		// ラインから取得
+		ports = getPortsFromLine(n)
+	}
+	setVPanelFlowInfo(n, ports)
+	return ports
+}
+
+// setVPanelFlowInfo : フローを受信しているポートにフローの集計へのリンクを設定する
+func setVPanelFlowInfo(n *datastore.NodeEnt, ports []*VPanelPortEnt) {
+	if len(ports) < 1 {
+		return
+	}
+	et := time.Now().UnixNano()
+	st := time.Now().Add(-time.Hour).UnixNano()
+	m := datastore.GetFlowInterfaceBytes(st, et)
+	if len(m) < 1 {
+		return
+	}
+	// エクスポーターの送信元がノードのIPと違う場合もあるのでノードを検索する
+	portMap := make(map[int64]*VPanelPortEnt)
+	for _, p := range ports {
+		portMap[p.Index] = p
+	}
+	nodeIDs := make(map[string]string)
+	for k, b := range m {
+		i := strings.LastIndex(k, ":")
+		if i < 1 {
+			continue
+		}
+		idx, err := strconv.ParseInt(k[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		p, ok := portMap[idx]
+		if !ok || p.FlowBytes > b {
+			continue
+		}
+		ip := k[:i]
+		id, ok := nodeIDs[ip]
+		if !ok {
+			if fn := datastore.FindNodeFromIP(ip); fn != nil {
+				id = fn.ID
+			}
+			nodeIDs[ip] = id
+		}
+		if id == n.ID {
+			p.FlowKey = k
+			p.FlowBytes = b
+		}
 	}
-	// ラインから取得
-	return getPortsFromLine(n)
 }
 
 func getPortsFromPolling(n *datastore.NodeEnt) []*VPanelPortEnt {
@@ -0,0 +1,273 @@
+package datastore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ASNエントリ
+type asnEnt struct {
+	ASN uint
+	Org string
+}
+
+var (
+	asnDB       *geoip2.Reader
+	asnMap      sync.Map
+	asnPrefixes map[int]map[string]*asnEnt
+	asnMu       sync.RWMutex
+	asnMapCount atomic.Int64
+)
+
+// キャッシュするIPアドレスの最大数 超えた場合はクリアする
+const asnMapMax = 100000
+
+// UpdateASNDB : ASN DBを更新する。mmdb形式または経路表(RIB)のテキストファイル
+func UpdateASNDB(path string) error {
+	if r, err := geoip2.Open(path); err == nil {
+		r.Close()
+		DeleteASNDB()
+		dst := filepath.Join(dspath, "asn.mmdb")
+		if err := os.Rename(path, dst); err != nil {
+			return err
+		}
+		return openASNDB(dst)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	m, err := loadASNPrefixes(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	DeleteASNDB()
+	dst := filepath.Join(dspath, "asn.txt")
+	if err := os.Rename(path, dst); err != nil {
+		return err
+	}
+	setASNPrefixes(m)
+	return nil
+}
+
+// DeleteASNDB : ASN DBを削除する
+func DeleteASNDB() {
+	closeASNDB()
+	for _, n := range []string{"asn.mmdb", "asn.txt"} {
+		dst := filepath.Join(dspath, n)
+		if _, err := os.Stat(dst); err == nil {
+			os.Remove(dst)
+		}
+	}
+}
+
+func openASNFiles() {
+	p := filepath.Join(dspath, "asn.mmdb")
+	if _, err := os.Stat(p); err == nil {
+		openASNDB(p)
+		return
+	}
+	p = filepath.Join(dspath, "asn.txt")
+	if f, err := os.Open(p); err == nil {
+		if m, err := loadASNPrefixes(f); err == nil {
+			setASNPrefixes(m)
+		} else {
+			log.Printf("load asn prefixes err=%v", err)
+		}
+		f.Close()
+	}
+}
+
+func openASNDB(path string) error {
+	r, err := geoip2.Open(path)
+	if err != nil {
+		log.Printf("open asn db err=%v", err)
+		return err
+	}
+	asnMu.Lock()
+	asnDB = r
+	asnMu.Unlock()
+	clearASNCache()
+	md := r.Metadata()
+	MapConf.ASNInfo = fmt.Sprintf("%s %d.%d", md.DatabaseType, md.BinaryFormatMajorVersion, md.BinaryFormatMinorVersion)
+	return nil
+}
+
+func closeASNDB() {
+	asnMu.Lock()
+	if asnDB != nil {
+		asnDB.Close()
+	}
+	asnDB = nil
+	asnPrefixes = nil
+	asnMu.Unlock()
+	clearASNCache()
+	MapConf.ASNInfo = ""
+}
+
+func setASNPrefixes(m map[int]map[string]*asnEnt) {
+	n := 0
+	for _, e := range m {
+		n += len(e)
+	}
+	asnMu.Lock()
+	asnPrefixes = m
+	asnMu.Unlock()
+	clearASNCache()
+	MapConf.ASNInfo = fmt.Sprintf("RIB %d prefixes", n)
+}
+
+func clearASNCache() {
+	asnMap.Range(func(k, v interface{}) bool {
+		asnMap.Delete(k)
+		return true
+	})
+	asnMapCount.Store(0)
+}
+
+// loadASNPrefixes : 経路表のダンプを読み込む
+// 1行に "プレフィックス AS番号 組織名" またはbgpdump -m形式の
+// "TABLE_DUMP2|時刻|B|ピア|ピアAS|プレフィックス|ASパス|..." を記述する
+func loadASNPrefixes(r io.Reader) (map[int]map[string]*asnEnt, error) {
+	m := make(map[int]map[string]*asnEnt)
+	orgs := make(map[uint]string)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		var prefix, as, org string
+		if strings.Contains(l, "|") {
+			f := strings.Split(l, "|")
+			if len(f) < 7 {
+				continue
+			}
+			prefix = f[5]
+			path := strings.Fields(f[6])
+			if len(path) < 1 {
+				continue
+			}
+			// 最後のASが起点
+			as = strings.Trim(path[len(path)-1], "{}")
+			if i := strings.Index(as, ","); i > 0 {
+				as = as[:i]
+			}
+		} else {
+			f := strings.FieldsFunc(l, func(c rune) bool {
+				return c == ' ' || c == '\t' || c == ','
+			})
+			if len(f) < 2 {
+				continue
+			}
+			prefix = f[0]
+			as = f[1]
+			if len(f) > 2 {
+				org = strings.Join(f[2:], " ")
+			}
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(as), "AS"), 10, 32)
+		if err != nil {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			continue
+		}
+		if org != "" {
+			orgs[uint(asn)] = org
+		}
+		ones, bits := ipnet.Mask.Size()
+		if bits == 128 {
+			ones += 1000
+		}
+		if _, ok := m[ones]; !ok {
+			m[ones] = make(map[string]*asnEnt)
+		}
+		m[ones][ipnet.IP.String()] = &asnEnt{ASN: uint(asn)}
+		n++
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("no prefix")
+	}
+	// 組織名は同じAS番号の他の行からも補完する
+	for _, e := range m {
+		for _, a := range e {
+			a.Org = orgs[a.ASN]
+		}
+	}
+	return m, nil
+}
+
+func findASNPrefix(ip net.IP) *asnEnt {
+	if asnPrefixes == nil {
+		return nil
+	}
+	bits := 32
+	base := 0
+	if ip.To4() == nil {
+		bits = 128
+		base = 1000
+	} else {
+		ip = ip.To4()
+	}
+	for ones := bits; ones >= 0; ones-- {
+		e, ok := asnPrefixes[base+ones]
+		if !ok {
+			continue
+		}
+		k := ip.Mask(net.CIDRMask(ones, bits)).String()
+		if a, ok := e[k]; ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// GetASN : IPアドレスのAS番号と組織名を取得する
+func GetASN(sip string) (uint, string) {
+	if v, ok := asnMap.Load(sip); ok {
+		if a, ok := v.(*asnEnt); ok {
+			return a.ASN, a.Org
+		}
+	}
+	ip := net.ParseIP(sip)
+	if ip == nil || IsPrivateIP(ip) {
+		return 0, ""
+	}
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	if asnDB == nil && asnPrefixes == nil {
+		return 0, ""
+	}
+	a := &asnEnt{}
+	if asnDB != nil {
+		if r, err := asnDB.ASN(ip); err == nil {
+			a.ASN = r.AutonomousSystemNumber
+			a.Org = r.AutonomousSystemOrganization
+		}
+	} else if e := findASNPrefix(ip); e != nil {
+		a = e
+	}
+	if _, loaded := asnMap.LoadOrStore(sip, a); !loaded && asnMapCount.Add(1) > asnMapMax {
+		clearASNCache()
+	}
+	return a.ASN, a.Org
+}
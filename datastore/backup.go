@@ -22,13 +22,19 @@ type DBBackupEnt struct {
 	Mode       string
 	ConfigOnly bool
 	Generation int
+	// 増分バックアップ
+	Incremental  bool
+	FullInterval int
+	// バックアップ先 "" | s3
+	Destination string
+	S3          S3BackupConfEnt
 }
 
 func SaveBackup() error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
-	s, err := json.Marshal(Backup)
+	s, err := json.Marshal(encryptBackupSecret(Backup))
 	if err != nil {
 		return err
 	}
@@ -87,6 +93,30 @@ func CheckDBBackup() {
 		go func() {
 			log.Printf("start backup")
 			st := time.Now()
+			if Backup.Incremental {
+				defer func() {
+					DBStats.BackupStart = 0
+				}()
+				stopBackup = false
+				bs, err := backupSet()
+				if err != nil {
+					log.Printf("backup set err=%v", err)
+					AddEventLog(&EventLogEnt{
+						Type:  "system",
+						Level: "warn",
+						Event: fmt.Sprintf("増分バックアップ失敗 err=%v", err),
+					})
+					return
+				}
+				log.Printf("backup set id=%s type=%s dur=%v", bs.ID, bs.Type, time.Since(st))
+				AddEventLog(&EventLogEnt{
+					Type:  "system",
+					Level: "info",
+					Event: fmt.Sprintf("増分バックアップ終了 id=%s type=%s files=%d", bs.ID, bs.Type, len(bs.Files)),
+				})
+				DBStats.BackupTime = time.Now().UnixNano()
+				return
+			}
 			file := filepath.Join(dspath, "backup", "twsnmpfc.db."+time.Now().Format("20060102150405"))
 			if BackupPath != "" {
 				file = filepath.Join(BackupPath, "twsnmpfc.db."+time.Now().Format("20060102150405"))
@@ -103,6 +133,7 @@ func CheckDBBackup() {
 			if err := backupDB(file); err != nil {
 				log.Printf("backup err=%v", err)
 				os.RemoveAll(file)
+				os.RemoveAll(file + ".logdb")
 				AddEventLog(&EventLogEnt{
 					Type:  "system",
 					Level: "warn",
@@ -116,6 +147,29 @@ func CheckDBBackup() {
 				Level: "info",
 				Event: "バックアップ終了:" + file,
 			})
+			if Backup.Destination == "s3" {
+				if err := uploadBackupToS3(file); err != nil {
+					log.Printf("upload backup to s3 err=%v", err)
+					AddEventLog(&EventLogEnt{
+						Type:  "system",
+						Level: "warn",
+						Event: fmt.Sprintf("S3へのバックアップのアップロード失敗 err=%v", err),
+					})
+					return
+				}
+				// 全てのファイルをアップロードした後でローカルのディスクから削除する
+				os.Remove(file)
+				os.RemoveAll(file + ".logdb")
+				log.Printf("upload backup to s3 file=%s dur=%v", file, time.Since(st))
+				AddEventLog(&EventLogEnt{
+					Type:  "system",
+					Level: "info",
+					Event: fmt.Sprintf("S3へバックアップをアップロードしました bucket=%s", Backup.S3.Bucket),
+				})
+				DBStats.BackupTime = time.Now().UnixNano()
+				rotateS3Backup()
+				return
+			}
 			DBStats.BackupTime = time.Now().UnixNano()
 			rotateBackup()
 		}()
@@ -134,6 +188,13 @@ func backupDB(file string) error {
 		return fmt.Errorf("backup in progress")
 	}
 	os.Remove(file)
+	if !Backup.ConfigOnly {
+		// 日毎のログパーティションはファイル単位でコピーする
+		os.RemoveAll(file + ".logdb")
+		if err := backupLogParts(file + ".logdb"); err != nil {
+			return err
+		}
+	}
 	if CopyBackup && !Backup.ConfigOnly {
 		log.Println("backup copyfile mode")
 		return db.View(func(tx *bbolt.Tx) error {
@@ -168,7 +229,7 @@ func backupDB(file string) error {
 		mapConfTmp.EnableSyslogd = false
 		mapConfTmp.EnableTrapd = false
 		mapConfTmp.LogDays = 0
-		if s, err := json.Marshal(mapConfTmp); err == nil {
+		if s, err := json.Marshal(encryptMapConfSecret(mapConfTmp)); err == nil {
 			if b := dstTx.Bucket([]byte("config")); b != nil {
 				if err := b.Put([]byte("mapConf"), s); err != nil {
 					_ = dstTx.Rollback()
@@ -181,16 +242,27 @@ func backupDB(file string) error {
 }
 
 var configBuckets = map[string]bool{
-	"config":   true,
-	"nodes":    true,
-	"lines":    true,
-	"items":    true,
-	"networks": true,
-	"pollings": true,
-	"grok":     true,
-	"images":   true,
-	"certs":    true,
-	"memo":     true,
+	"config":                 true,
+	"nodes":                  true,
+	"lines":                  true,
+	"items":                  true,
+	"networks":               true,
+	"pollings":               true,
+	"credentials":            true,
+	"federation":             true,
+	"configArchive":          true,
+	"complianceRules":        true,
+	"complianceResults":      true,
+	"pollingTemplates":       true,
+	"pollingTemplateHistory": true,
+	"notifyTemplates":        true,
+	"threatFeeds":            true,
+	"sla":                    true,
+	"reportDefs":             true,
+	"grok":                   true,
+	"images":                 true,
+	"certs":                  true,
+	"memo":                   true,
 }
 
 func walkBucket(b *bbolt.Bucket, keypath [][]byte, k, v []byte, seq uint64) error {
@@ -302,10 +374,14 @@ func rotateBackup() {
 		} else {
 			log.Printf("delete backup file=%s", backup)
 		}
+		os.RemoveAll(backup + ".logdb")
 	}
 }
 
 func RestoreDB(ds, backup string) error {
+	if strings.HasPrefix(backup, "s3://") {
+		return restoreDBFromS3(ds, backup)
+	}
 	if BackupPath != "" {
 		return restoreDBWithPath(ds, backup)
 	}
@@ -322,7 +398,7 @@ func RestoreDB(ds, backup string) error {
 	if err := os.Rename(srcBackup, dbPath); err != nil {
 		return err
 	}
-	return nil
+	return restoreLogParts(ds, srcBackup)
 }
 
 func restoreDBWithPath(ds, backup string) error {
@@ -339,6 +415,29 @@ func restoreDBWithPath(ds, backup string) error {
 	if err := copyFile(srcBackup, dbPath); err != nil {
 		return err
 	}
+	return restoreLogParts(ds, srcBackup)
+}
+
+// restoreLogParts : バックアップにログパーティションがあれば置き換える
+func restoreLogParts(ds, srcBackup string) error {
+	src := srcBackup + ".logdb"
+	dirList, err := os.ReadDir(src)
+	if err != nil {
+		return nil
+	}
+	dst := filepath.Join(ds, logPartDirName)
+	os.RemoveAll(dst)
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	for _, d := range dirList {
+		if d.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, d.Name()), filepath.Join(dst, d.Name())); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -382,6 +481,9 @@ func CompactDB(ds, compact string) error {
 
 // 再起動後にも最終バックアップ時刻を表示するため
 func setLastBackupTime() {
+	if list, err := GetBackupSets(); err == nil && len(list) > 0 {
+		DBStats.BackupTime = list[len(list)-1].Time
+	}
 	path := BackupPath
 	if path == "" {
 		path = filepath.Join(dspath, "backup")
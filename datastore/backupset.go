@@ -0,0 +1,634 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// BackupSetEnt : 増分バックアップの1回分
+type BackupSetEnt struct {
+	ID    string // YYYYMMDDhhmmss
+	Time  int64
+	Type  string // full | incr
+	Base  string // 基準となるフルバックアップのID
+	Since int64  // ログを保存した開始時刻
+	Files []BackupFileEnt
+	// 設定のバケット毎のチェックサム 増分は前回から変更したバケットだけを保存する
+	Buckets map[string]string `json:",omitempty"`
+}
+
+// BackupFileEnt : バックアップセットに含まれるファイル
+type BackupFileEnt struct {
+	Name   string
+	Kind   string // config | logseg | logpart
+	Size   int64
+	SHA256 string
+}
+
+const backupSetTimeFormat = "20060102150405"
+
+func getBackupSetDir() string {
+	if BackupPath != "" {
+		return filepath.Join(BackupPath, "backupset")
+	}
+	return filepath.Join(dspath, "backup", "backupset")
+}
+
+func loadBackupSetManifest(dir string) ([]*BackupSetEnt, error) {
+	ret := []*BackupSetEnt{}
+	b, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return ret, err
+	}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return ret, err
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret, nil
+}
+
+func saveBackupSetManifest(dir string, list []*BackupSetEnt) error {
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "manifest.json.tmp")
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "manifest.json"))
+}
+
+// GetBackupSets : バックアップセットのリストを返す
+func GetBackupSets() ([]*BackupSetEnt, error) {
+	return loadBackupSetManifest(getBackupSetDir())
+}
+
+// backupSet : 設定とマップのスナップショットと前回からのログを保存する
+func backupSet() (*BackupSetEnt, error) {
+	if db == nil {
+		return nil, ErrDBNotOpen
+	}
+	dir := getBackupSetDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	list, err := loadBackupSetManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bs := &BackupSetEnt{
+		ID:   now.Format(backupSetTimeFormat),
+		Time: now.UnixNano(),
+		Type: "full",
+	}
+	bs.Base = bs.ID
+	var prevSums map[string]string
+	if len(list) > 0 {
+		last := list[len(list)-1]
+		fullInterval := Backup.FullInterval
+		if fullInterval < 1 {
+			fullInterval = 7
+		}
+		if base := findBackupSet(list, last.Base); base != nil &&
+			now.Sub(time.Unix(0, base.Time)) < time.Duration(fullInterval)*24*time.Hour {
+			bs.Type = "incr"
+			bs.Base = base.ID
+			// 書き込み待ちのログを取りこぼさないように1分重ねる
+			bs.Since = last.Time - int64(time.Minute)
+			prevSums = last.Buckets
+		}
+	}
+	setDir := filepath.Join(dir, bs.ID)
+	if err := os.MkdirAll(setDir, 0700); err != nil {
+		return nil, err
+	}
+	if bs.Buckets, err = backupConfigSnapshot(filepath.Join(setDir, "config.db"), prevSums); err != nil {
+		os.RemoveAll(setDir)
+		return nil, err
+	}
+	if err := backupLogSegment(filepath.Join(setDir, "logseg.db"), bs.Since); err != nil {
+		os.RemoveAll(setDir)
+		return nil, err
+	}
+	if err := backupChangedLogParts(filepath.Join(setDir, logPartDirName), bs.Since); err != nil {
+		os.RemoveAll(setDir)
+		return nil, err
+	}
+	if bs.Files, err = makeBackupFileList(setDir); err != nil {
+		os.RemoveAll(setDir)
+		return nil, err
+	}
+	list = append(list, bs)
+	if err := saveBackupSetManifest(dir, list); err != nil {
+		return nil, err
+	}
+	rotateBackupSet(dir)
+	if Backup.Destination == "s3" {
+		if err := uploadBackupSetToS3(dir, bs); err != nil {
+			return bs, err
+		}
+	}
+	return bs, nil
+}
+
+func findBackupSet(list []*BackupSetEnt, id string) *BackupSetEnt {
+	for _, bs := range list {
+		if bs.ID == id {
+			return bs
+		}
+	}
+	return nil
+}
+
+// backupConfigSnapshot : 設定とマップのバケットをコピーする
+// prevにチェックサムがある場合は変更したバケットだけをコピーする
+func backupConfigSnapshot(file string, prev map[string]string) (map[string]string, error) {
+	dst, err := bbolt.Open(file, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+	sums := make(map[string]string)
+	err = db.View(func(srcTx *bbolt.Tx) error {
+		return dst.Update(func(dstTx *bbolt.Tx) error {
+			for name := range configBuckets {
+				if stopBackup {
+					return fmt.Errorf("stop backup")
+				}
+				sb := srcTx.Bucket([]byte(name))
+				if sb == nil {
+					continue
+				}
+				sums[name] = bucketSHA256(sb)
+				if prev != nil && prev[name] == sums[name] {
+					continue
+				}
+				nb, err := dstTx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+				if err := copyBucket(sb, nb); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return sums, err
+}
+
+// bucketSHA256 : バケットの内容のチェックサム
+func bucketSHA256(b *bbolt.Bucket) string {
+	h := sha256.New()
+	var f func(b *bbolt.Bucket)
+	f = func(b *bbolt.Bucket) {
+		fmt.Fprintf(h, "%d:", b.Sequence())
+		b.ForEach(func(k, v []byte) error {
+			fmt.Fprintf(h, "%d:%s", len(k), k)
+			if v == nil {
+				h.Write([]byte{0})
+				f(b.Bucket(k))
+				h.Write([]byte{1})
+				return nil
+			}
+			fmt.Fprintf(h, "%d:%s", len(v), v)
+			return nil
+		})
+	}
+	f(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func copyBucket(src, dst *bbolt.Bucket) error {
+	dst.FillPercent = 1.0
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nb, err := dst.CreateBucketIfNotExists(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(src.Bucket(k), nb)
+		}
+		return dst.Put(k, v)
+	})
+}
+
+// backupLogSegment : since以降のイベントログとポーリングログを保存する
+func backupLogSegment(file string, since int64) error {
+	dst, err := bbolt.Open(file, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	sk := []byte(fmt.Sprintf("%016x", since))
+	return db.View(func(srcTx *bbolt.Tx) error {
+		return dst.Update(func(dstTx *bbolt.Tx) error {
+			if sb := srcTx.Bucket([]byte("logs")); sb != nil {
+				nb, err := dstTx.CreateBucketIfNotExists([]byte("logs"))
+				if err != nil {
+					return err
+				}
+				if err := copyBucketSince(sb, nb, sk); err != nil {
+					return err
+				}
+			}
+			sb := srcTx.Bucket([]byte("pollingLogs"))
+			if sb == nil {
+				return nil
+			}
+			nb, err := dstTx.CreateBucketIfNotExists([]byte("pollingLogs"))
+			if err != nil {
+				return err
+			}
+			return sb.ForEachBucket(func(k []byte) error {
+				pb, err := nb.CreateBucketIfNotExists(k)
+				if err != nil {
+					return err
+				}
+				return copyBucketSince(sb.Bucket(k), pb, sk)
+			})
+		})
+	})
+}
+
+func copyBucketSince(src, dst *bbolt.Bucket, sk []byte) error {
+	dst.FillPercent = 1.0
+	c := src.Cursor()
+	for k, v := c.Seek(sk); k != nil; k, v = c.Next() {
+		if stopBackup {
+			return fmt.Errorf("stop backup")
+		}
+		if v == nil {
+			continue
+		}
+		if err := dst.Put(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupChangedLogParts : since以降に更新されたログパーティションをコピーする
+func backupChangedLogParts(dir string, since int64) error {
+	for _, day := range getLogPartDays() {
+		fi, err := os.Stat(getLogPartPath(day))
+		if err != nil {
+			continue
+		}
+		if since > 0 && fi.ModTime().UnixNano() < since {
+			continue
+		}
+		if stopBackup {
+			return fmt.Errorf("stop backup")
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		d, err := openLogPart(day, false)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+		err = d.View(func(tx *bbolt.Tx) error {
+			return tx.CopyFile(filepath.Join(dir, day+".db"), 0600)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func makeBackupFileList(setDir string) ([]BackupFileEnt, error) {
+	ret := []BackupFileEnt{}
+	err := filepath.Walk(setDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(setDir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		kind := "config"
+		if name == "logseg.db" {
+			kind = "logseg"
+		} else if strings.HasPrefix(name, logPartDirName) {
+			kind = "logpart"
+		}
+		ret = append(ret, BackupFileEnt{
+			Name:   filepath.ToSlash(name),
+			Kind:   kind,
+			Size:   info.Size(),
+			SHA256: sum,
+		})
+		return nil
+	})
+	return ret, err
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rotateBackupSet : 世代数を超えた古いフルバックアップとその増分を削除する
+func rotateBackupSet(dir string) {
+	list, err := loadBackupSetManifest(dir)
+	if err != nil {
+		log.Printf("rotate backup set err=%v", err)
+		return
+	}
+	fulls := []string{}
+	for _, bs := range list {
+		if bs.Type == "full" {
+			fulls = append(fulls, bs.ID)
+		}
+	}
+	if len(fulls) <= Backup.Generation+1 {
+		return
+	}
+	keepFrom := fulls[len(fulls)-(Backup.Generation+1)]
+	newList := []*BackupSetEnt{}
+	delIDs := []string{}
+	for _, bs := range list {
+		if bs.Base < keepFrom {
+			if err := os.RemoveAll(filepath.Join(dir, bs.ID)); err != nil {
+				log.Printf("delete backup set id=%s err=%v", bs.ID, err)
+			} else {
+				log.Printf("delete backup set id=%s", bs.ID)
+			}
+			delIDs = append(delIDs, bs.ID)
+			continue
+		}
+		newList = append(newList, bs)
+	}
+	if err := saveBackupSetManifest(dir, newList); err != nil {
+		log.Printf("rotate backup set err=%v", err)
+	}
+	if Backup.Destination == "s3" {
+		removeS3BackupSets(delIDs)
+	}
+}
+
+// getBackupSetChain : 指定時刻以前の最新のバックアップまでのフルと増分のリストを返す
+func getBackupSetChain(list []*BackupSetEnt, at string) ([]*BackupSetEnt, error) {
+	var target *BackupSetEnt
+	for _, bs := range list {
+		if bs.ID <= at {
+			target = bs
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("no backup set before %s", at)
+	}
+	chain := []*BackupSetEnt{}
+	for _, bs := range list {
+		if bs.Base == target.Base && bs.ID <= target.ID {
+			chain = append(chain, bs)
+		}
+	}
+	if len(chain) < 1 || chain[0].Type != "full" {
+		return nil, fmt.Errorf("full backup %s not found", target.Base)
+	}
+	return chain, nil
+}
+
+// VerifyBackupSet : バックアップセットのファイルのチェックサムを確認する
+func VerifyBackupSet(id string) error {
+	dir := getBackupSetDir()
+	list, err := loadBackupSetManifest(dir)
+	if err != nil {
+		return err
+	}
+	bs := findBackupSet(list, id)
+	if bs == nil {
+		return ErrInvalidID
+	}
+	return verifyBackupSet(dir, bs)
+}
+
+func verifyBackupSet(dir string, bs *BackupSetEnt) error {
+	for _, f := range bs.Files {
+		sum, err := fileSHA256(filepath.Join(dir, bs.ID, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return err
+		}
+		if sum != f.SHA256 {
+			return fmt.Errorf("checksum mismatch set=%s file=%s", bs.ID, f.Name)
+		}
+	}
+	return nil
+}
+
+// normBackupSetTime : RFC3339形式の時刻をバックアップセットのIDの形式にする
+func normBackupSetTime(at string) string {
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t.Local().Format(backupSetTimeFormat)
+	}
+	return at
+}
+
+// RestoreBackupSet : 指定した時刻のバックアップセットからデータストアを再構築する
+// atはYYYYMMDDhhmmssまたはRFC3339形式
+// s3://bucket/prefix/時刻の場合はS3のバックアップセットをダウンロードしてから再構築する
+func RestoreBackupSet(ds, at string) error {
+	dspath = ds
+	dir := getBackupSetDir()
+	if strings.HasPrefix(at, "s3://") {
+		var err error
+		dir, at, err = downloadBackupSetFromS3(ds, at)
+		if dir != "" {
+			defer os.RemoveAll(dir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	at = normBackupSetTime(at)
+	list, err := loadBackupSetManifest(dir)
+	if err != nil {
+		return err
+	}
+	chain, err := getBackupSetChain(list, at)
+	if err != nil {
+		return err
+	}
+	for _, bs := range chain {
+		if err := verifyBackupSet(dir, bs); err != nil {
+			return err
+		}
+		log.Printf("verify backup set id=%s type=%s ok", bs.ID, bs.Type)
+	}
+	target := chain[len(chain)-1]
+	tmpDB := filepath.Join(ds, "twsnmpfc.db.restore")
+	os.Remove(tmpDB)
+	if err := copyFile(filepath.Join(dir, chain[0].ID, "config.db"), tmpDB); err != nil {
+		return err
+	}
+	if err := applyConfigSnapshots(tmpDB, dir, chain[1:]); err != nil {
+		os.Remove(tmpDB)
+		return err
+	}
+	if err := mergeLogSegments(tmpDB, dir, chain); err != nil {
+		os.Remove(tmpDB)
+		return err
+	}
+	tmpLogDir := filepath.Join(ds, logPartDirName+".restore")
+	os.RemoveAll(tmpLogDir)
+	if err := os.MkdirAll(tmpLogDir, 0700); err != nil {
+		return err
+	}
+	// 日毎のパーティションは最新のコピーを使う
+	parts := make(map[string]string)
+	for _, bs := range chain {
+		for _, f := range bs.Files {
+			if f.Kind == "logpart" {
+				parts[filepath.Base(f.Name)] = filepath.Join(dir, bs.ID, filepath.FromSlash(f.Name))
+			}
+		}
+	}
+	for name, src := range parts {
+		if err := copyFile(src, filepath.Join(tmpLogDir, name)); err != nil {
+			os.RemoveAll(tmpLogDir)
+			os.Remove(tmpDB)
+			return err
+		}
+	}
+	// 現在のデータストアを退避して置き換える
+	suffix := ".old." + time.Now().Format(backupSetTimeFormat)
+	dbPath := filepath.Join(ds, "twsnmpfc.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+suffix); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpDB, dbPath); err != nil {
+		return err
+	}
+	logDir := filepath.Join(ds, logPartDirName)
+	if _, err := os.Stat(logDir); err == nil {
+		if err := os.Rename(logDir, logDir+suffix); err != nil {
+			return err
+		}
+	}
+	log.Printf("restore backup set id=%s sets=%d logparts=%d", target.ID, len(chain), len(parts))
+	return os.Rename(tmpLogDir, logDir)
+}
+
+// applyConfigSnapshots : 増分で変更したバケットを置き換え、削除したバケットを削除する
+func applyConfigSnapshots(file, dir string, incrs []*BackupSetEnt) error {
+	if len(incrs) < 1 {
+		return nil
+	}
+	dst, err := bbolt.Open(file, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	for _, bs := range incrs {
+		src, err := bbolt.Open(filepath.Join(dir, bs.ID, "config.db"), 0400, &bbolt.Options{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		err = src.View(func(srcTx *bbolt.Tx) error {
+			return dst.Update(func(dstTx *bbolt.Tx) error {
+				if bs.Buckets != nil {
+					for name := range configBuckets {
+						if _, ok := bs.Buckets[name]; ok || dstTx.Bucket([]byte(name)) == nil {
+							continue
+						}
+						if err := dstTx.DeleteBucket([]byte(name)); err != nil {
+							return err
+						}
+					}
+				}
+				return srcTx.ForEach(func(name []byte, sb *bbolt.Bucket) error {
+					if dstTx.Bucket(name) != nil {
+						if err := dstTx.DeleteBucket(name); err != nil {
+							return err
+						}
+					}
+					nb, err := dstTx.CreateBucket(name)
+					if err != nil {
+						return err
+					}
+					return copyBucket(sb, nb)
+				})
+			})
+		})
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeLogSegments(file, dir string, chain []*BackupSetEnt) error {
+	dst, err := bbolt.Open(file, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	for _, bs := range chain {
+		seg := filepath.Join(dir, bs.ID, "logseg.db")
+		if _, err := os.Stat(seg); err != nil {
+			continue
+		}
+		src, err := bbolt.Open(seg, 0400, &bbolt.Options{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		err = src.View(func(srcTx *bbolt.Tx) error {
+			return dst.Update(func(dstTx *bbolt.Tx) error {
+				return srcTx.ForEach(func(name []byte, sb *bbolt.Bucket) error {
+					nb, err := dstTx.CreateBucketIfNotExists(name)
+					if err != nil {
+						return err
+					}
+					return copyBucket(sb, nb)
+				})
+			})
+		})
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package datastore
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CapacityThreshold : 容量計画で警告する使用率(%)
+const CapacityThreshold = 80.0
+
+// CapacityEnt : インターフェース毎の容量計画レポート
+type CapacityEnt struct {
+	PollingID    string
+	PollingName  string
+	NodeID       string
+	NodeName     string
+	IfIndex      int
+	IfName       string
+	Speed        float64 // bps
+	InP95        float64 // bps
+	OutP95       float64 // bps
+	InPeak       float64 // bps
+	OutPeak      float64 // bps
+	P95Util      float64 // %
+	PeakUtil     float64 // %
+	Trend        float64 // 1日あたりの使用率の増加(%)
+	DaysTo80     float64 // 80%に達するまでの日数 0:到達済み -1:予測できない
+	ForecastTime int64   // 80%に達する予測日時
+	Samples      int
+}
+
+// getCapacityKeys : 通信量ポーリングの受信、送信のキーとbpsへの倍率
+func getCapacityKeys(p *PollingEnt) (string, string, float64, bool) {
+	switch {
+	case p.Type == "snmp" && p.Mode == "traffic":
+		// SNMPの通信量はバイト/秒
+		return "bps", "obps", 8.0, true
+	case p.Type == "sflow":
+		return "inBps", "outBps", 1.0, true
+	}
+	return "", "", 0, false
+}
+
+// 容量計画レポートのキャッシュ(ログの読み込みに時間がかかるため)
+type capacityCacheEnt struct {
+	days int
+	time time.Time
+	list []*CapacityEnt
+}
+
+var capacityCache *capacityCacheEnt
+var capacityCacheMu sync.Mutex
+
+// 容量計画レポートを作り直す間隔
+const capacityCacheTTL = time.Hour
+
+// GetCapacityReport : 通信量ポーリングのログから容量計画レポートを作成する
+// 同じ期間のレポートは1時間キャッシュする、返したリストは変更しないこと
+func GetCapacityReport(days int) []*CapacityEnt {
+	if days < 1 {
+		days = 30
+	}
+	capacityCacheMu.Lock()
+	defer capacityCacheMu.Unlock()
+	if c := capacityCache; c != nil && c.days == days && time.Since(c.time) < capacityCacheTTL {
+		return c.list
+	}
+	ret := makeCapacityReport(days)
+	capacityCache = &capacityCacheEnt{days: days, time: time.Now(), list: ret}
+	return ret
+}
+
+func makeCapacityReport(days int) []*CapacityEnt {
+	et := time.Now()
+	st := et.AddDate(0, 0, -days)
+	ret := []*CapacityEnt{}
+	list := []*PollingEnt{}
+	ForEachPollings(func(p *PollingEnt) bool {
+		if _, _, _, ok := getCapacityKeys(p); ok {
+			list = append(list, p)
+		}
+		return true
+	})
+	for _, p := range list {
+		if e := getPollingCapacity(p, st, et); e != nil {
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].DaysTo80 != ret[j].DaysTo80 {
+			if ret[i].DaysTo80 < 0 {
+				return false
+			}
+			if ret[j].DaysTo80 < 0 {
+				return true
+			}
+			return ret[i].DaysTo80 < ret[j].DaysTo80
+		}
+		return ret[i].P95Util > ret[j].P95Util
+	})
+	return ret
+}
+
+func getPollingCapacity(p *PollingEnt, st, et time.Time) *CapacityEnt {
+	n := GetNode(p.NodeID)
+	if n == nil {
+		return nil
+	}
+	inKey, outKey, mul, _ := getCapacityKeys(p)
+	e := &CapacityEnt{
+		PollingID:   p.ID,
+		PollingName: p.Name,
+		NodeID:      n.ID,
+		NodeName:    n.Name,
+		DaysTo80:    -1,
+	}
+	e.IfIndex = getCapacityIfIndex(p)
+	inList := []float64{}
+	outList := []float64{}
+	daily := make(map[int][]float64)
+	ForEachPollingLog(st.UnixNano(), et.UnixNano(), p.ID, func(l *PollingLogEnt) bool {
+		in, ok1 := getCapacityValue(l.Result, inKey)
+		out, ok2 := getCapacityValue(l.Result, outKey)
+		if !ok1 || !ok2 {
+			return true
+		}
+		in *= mul
+		out *= mul
+		inList = append(inList, in)
+		outList = append(outList, out)
+		d := int(time.Unix(0, l.Time).Sub(st).Hours() / 24)
+		daily[d] = append(daily[d], math.Max(in, out))
+		if s, ok := getCapacityValue(l.Result, "ifSpeed"); ok && s > 0 {
+			e.Speed = s
+		}
+		return true
+	})
+	if len(inList) < 1 {
+		return nil
+	}
+	e.Samples = len(inList)
+	e.InP95 = Percentile(inList, 95)
+	e.OutP95 = Percentile(outList, 95)
+	e.InPeak = Percentile(inList, 100)
+	e.OutPeak = Percentile(outList, 100)
+	e.IfName, e.Speed = getCapacityIfInfo(n, e.IfIndex, e.Speed)
+	if e.Speed <= 0 {
+		return e
+	}
+	e.P95Util = math.Max(e.InP95, e.OutP95) * 100.0 / e.Speed
+	e.PeakUtil = math.Max(e.InPeak, e.OutPeak) * 100.0 / e.Speed
+	// 日毎の95パーセンタイルの使用率の線形回帰で予測する
+	xs := []float64{}
+	ys := []float64{}
+	for d, l := range daily {
+		xs = append(xs, float64(d))
+		ys = append(ys, Percentile(l, 95)*100.0/e.Speed)
+	}
+	a, b, ok := LinearRegression(xs, ys)
+	if !ok {
+		if e.P95Util >= CapacityThreshold {
+			e.DaysTo80 = 0
+		}
+		return e
+	}
+	e.Trend = b
+	x := et.Sub(st).Hours() / 24
+	y := a + b*x
+	if y >= CapacityThreshold || e.P95Util >= CapacityThreshold {
+		e.DaysTo80 = 0
+		e.ForecastTime = et.UnixNano()
+	} else if b > 0 {
+		e.DaysTo80 = (CapacityThreshold - y) / b
+		e.ForecastTime = et.Add(time.Duration(e.DaysTo80 * float64(24*time.Hour))).UnixNano()
+	}
+	return e
+}
+
+var capacityIndexPrefix = regexp.MustCompile(`^\s*(\d+)`)
+var capacityIndexName = regexp.MustCompile(`\((\d+)\)$`)
+
+// getCapacityIfIndex : ポーリングのパラメータからインターフェースのインデックスを取得する
+// sFlowは"エージェント:インデックス"、SNMPは先頭の数字、なければ自動登録した名前の"(インデックス)"
+func getCapacityIfIndex(p *PollingEnt) int {
+	params := p.Params
+	if p.Type == "sflow" {
+		if i := strings.LastIndex(params, ":"); i > 0 {
+			params = params[i+1:]
+		}
+	}
+	a := capacityIndexPrefix.FindStringSubmatch(params)
+	if a == nil {
+		a = capacityIndexName.FindStringSubmatch(strings.TrimSpace(p.Name))
+	}
+	if a != nil {
+		if i, err := strconv.Atoi(a[1]); err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+func getCapacityValue(r map[string]interface{}, k string) (float64, bool) {
+	if v, ok := r[k]; ok {
+		if f, ok := v.(float64); ok && !math.IsNaN(f) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// getCapacityIfInfo : インターフェースの名前と速度をポート情報から取得する
+func getCapacityIfInfo(n *NodeEnt, index int, speed float64) (string, float64) {
+	name := ""
+	find := func(l *[]IfPortEnt) bool {
+		if l == nil {
+			return false
+		}
+		for _, p := range *l {
+			if p.IfIndex == index {
+				name = p.Name
+				if speed <= 0 {
+					speed = float64(p.Speed)
+				}
+				return true
+			}
+		}
+		return false
+	}
+	if !find(GetIfPortTable(n.ID)) {
+		ForEachNetworks(func(nw *NetworkEnt) bool {
+			return !(nw.IP == n.IP && find(GetIfPortTable(nw.ID)))
+		})
+	}
+	return name, speed
+}
+
+// Percentile : パーセンタイル値(最近傍法)
+func Percentile(list []float64, p float64) float64 {
+	if len(list) < 1 {
+		return 0
+	}
+	l := make([]float64, len(list))
+	copy(l, list)
+	sort.Float64s(l)
+	i := int(math.Ceil(p/100.0*float64(len(l)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(l) {
+		i = len(l) - 1
+	}
+	return l[i]
+}
+
+// LinearRegression : 最小二乗法で y = a + bx を求める(3点以上必要)
+func LinearRegression(xs, ys []float64) (float64, float64, bool) {
+	n := float64(len(xs))
+	if len(xs) < 3 || len(xs) != len(ys) {
+		return 0, 0, false
+	}
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0, 0, false
+	}
+	b := (n*sxy - sx*sy) / d
+	a := (sy - b*sx) / n
+	return a, b, true
+}
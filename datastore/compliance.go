@@ -0,0 +1,292 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ComplianceRuleEnt : 機器の設定のコンプライアンスルール
+type ComplianceRuleEnt struct {
+	ID          string
+	Name        string
+	Descr       string
+	Mode        string // match | notmatch | script
+	Pattern     string // 正規表現
+	Script      string // JavaScript(trueなら準拠)
+	Level       string // 違反時のイベントのレベル
+	NodeID      string // 対象のノード(空は全て)
+	Icon        string // 対象のアイコン(空は全て)
+	SysObjectID string // 対象のsysObjectID(前方一致、空は全て)
+	Disabled    bool
+}
+
+// ComplianceResultEnt : ノード毎のコンプライアンスルールのチェック結果
+type ComplianceResultEnt struct {
+	NodeID     string
+	RuleID     string
+	Compliant  bool
+	Error      string
+	ConfigTime int64
+	CheckTime  int64
+}
+
+// ComplianceReportEnt : ノード毎のコンプライアンスレポート
+type ComplianceReportEnt struct {
+	NodeID    string
+	NodeName  string
+	IP        string
+	Compliant bool
+	CheckTime int64
+	Violation []string // 違反したルール名
+}
+
+var complianceRules sync.Map
+var complianceResults sync.Map
+
+func loadCompliance() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte("complianceRules")); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var r ComplianceRuleEnt
+				if err := json.Unmarshal(v, &r); err == nil {
+					complianceRules.Store(r.ID, &r)
+				}
+				return nil
+			})
+		}
+		if b := tx.Bucket([]byte("complianceResults")); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var r ComplianceResultEnt
+				if err := json.Unmarshal(v, &r); err == nil {
+					complianceResults.Store(string(k), &r)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// UpdateComplianceRule : コンプライアンスルールを追加または更新する
+func UpdateComplianceRule(r *ComplianceRuleEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	switch r.Mode {
+	case "match", "notmatch":
+		if r.Pattern == "" {
+			return ErrInvalidParams
+		}
+	case "script":
+		if r.Script == "" {
+			return ErrInvalidParams
+		}
+	default:
+		return ErrInvalidParams
+	}
+	if r.Level == "" {
+		r.Level = "warn"
+	}
+	if r.ID == "" {
+		for {
+			r.ID = makeKey()
+			if _, ok := complianceRules.Load(r.ID); !ok {
+				break
+			}
+		}
+	} else if _, ok := complianceRules.Load(r.ID); !ok {
+		return ErrInvalidID
+	}
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("complianceRules"))
+		return b.Put([]byte(r.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	complianceRules.Store(r.ID, r)
+	log.Printf("UpdateComplianceRule name=%s dur=%v", r.Name, time.Since(st))
+	return nil
+}
+
+// DeleteComplianceRule : コンプライアンスルールとその結果を削除する
+func DeleteComplianceRule(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := complianceRules.Load(id); !ok {
+		return ErrInvalidID
+	}
+	complianceRules.Delete(id)
+	keys := []string{}
+	complianceResults.Range(func(k, v any) bool {
+		if r, ok := v.(*ComplianceResultEnt); ok && r.RuleID == id {
+			keys = append(keys, k.(string))
+		}
+		return true
+	})
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("complianceRules"))
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		rb := tx.Bucket([]byte("complianceResults"))
+		for _, k := range keys {
+			complianceResults.Delete(k)
+			rb.Delete([]byte(k))
+		}
+		return nil
+	})
+}
+
+// GetComplianceRule : IDでコンプライアンスルールを取得する
+func GetComplianceRule(id string) *ComplianceRuleEnt {
+	if v, ok := complianceRules.Load(id); ok {
+		return v.(*ComplianceRuleEnt)
+	}
+	return nil
+}
+
+// GetComplianceRules : コンプライアンスルールを名前順に取得する
+func GetComplianceRules() []*ComplianceRuleEnt {
+	ret := []*ComplianceRuleEnt{}
+	complianceRules.Range(func(_, v any) bool {
+		ret = append(ret, v.(*ComplianceRuleEnt))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// IsComplianceRuleTarget : ノードがルールの対象か判断する
+func IsComplianceRuleTarget(r *ComplianceRuleEnt, n *NodeEnt) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.NodeID != "" && r.NodeID != n.ID {
+		return false
+	}
+	if r.Icon != "" && r.Icon != n.Icon {
+		return false
+	}
+	if r.SysObjectID != "" && !strings.HasPrefix(n.SysObjectID, r.SysObjectID) {
+		return false
+	}
+	return true
+}
+
+func getComplianceResultKey(nodeID, ruleID string) string {
+	return fmt.Sprintf("%s:%s", nodeID, ruleID)
+}
+
+// GetComplianceResult : ノードとルールのチェック結果を取得する
+func GetComplianceResult(nodeID, ruleID string) *ComplianceResultEnt {
+	if v, ok := complianceResults.Load(getComplianceResultKey(nodeID, ruleID)); ok {
+		return v.(*ComplianceResultEnt)
+	}
+	return nil
+}
+
+// SetComplianceResult : ノードとルールのチェック結果を保存する
+func SetComplianceResult(r *ComplianceResultEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	k := getComplianceResultKey(r.NodeID, r.RuleID)
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	complianceResults.Store(k, r)
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("complianceResults"))
+		return b.Put([]byte(k), j)
+	})
+}
+
+// DeleteComplianceResults : ノードのチェック結果を削除する
+func DeleteComplianceResults(nodeID string) {
+	keys := []string{}
+	complianceResults.Range(func(k, v any) bool {
+		if r, ok := v.(*ComplianceResultEnt); ok && r.NodeID == nodeID {
+			keys = append(keys, k.(string))
+		}
+		return true
+	})
+	if len(keys) < 1 || db == nil {
+		return
+	}
+	db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("complianceResults"))
+		for _, k := range keys {
+			complianceResults.Delete(k)
+			b.Delete([]byte(k))
+		}
+		return nil
+	})
+}
+
+// GetComplianceReport : ノード毎のコンプライアンスの状態を取得する
+// チェックしたことのないノードは含まない
+func GetComplianceReport() []*ComplianceReportEnt {
+	m := make(map[string]*ComplianceReportEnt)
+	complianceResults.Range(func(_, v any) bool {
+		r := v.(*ComplianceResultEnt)
+		rule := GetComplianceRule(r.RuleID)
+		if rule == nil || rule.Disabled {
+			return true
+		}
+		n := GetNode(r.NodeID)
+		if n == nil {
+			return true
+		}
+		e, ok := m[r.NodeID]
+		if !ok {
+			e = &ComplianceReportEnt{
+				NodeID:    n.ID,
+				NodeName:  n.Name,
+				IP:        n.IP,
+				Compliant: true,
+				Violation: []string{},
+			}
+			m[r.NodeID] = e
+		}
+		if !r.Compliant {
+			e.Compliant = false
+			e.Violation = append(e.Violation, rule.Name)
+		}
+		if r.CheckTime > e.CheckTime {
+			e.CheckTime = r.CheckTime
+		}
+		return true
+	})
+	ret := []*ComplianceReportEnt{}
+	for _, e := range m {
+		sort.Strings(e.Violation)
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Compliant != ret[j].Compliant {
+			return !ret[i].Compliant
+		}
+		return ret[i].NodeName < ret[j].NodeName
+	})
+	return ret
+}
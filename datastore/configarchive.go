@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"go.etcd.io/bbolt"
+)
+
+// ConfigArchiveEnt : 機器の設定のバックアップ
+type ConfigArchiveEnt struct {
+	Time      int64 // UnixNano()
+	NodeID    string
+	PollingID string
+	Hash      string
+	Size      int
+	Config    string `json:",omitempty"`
+}
+
+// ConfigArchiveGeneration : ノード毎に保存する設定の世代数
+var ConfigArchiveGeneration = 100
+
+func getConfigArchiveHash(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// AddConfigArchive : 前回と設定が異なる場合に保存する
+// 保存した場合は前回の設定を返す(初回はnil)
+func AddConfigArchive(c *ConfigArchiveEnt) (bool, *ConfigArchiveEnt, error) {
+	if db == nil {
+		return false, nil, ErrDBNotOpen
+	}
+	if c.Time == 0 {
+		c.Time = time.Now().UnixNano()
+	}
+	c.Hash = getConfigArchiveHash(c.Config)
+	c.Size = len(c.Config)
+	last := GetLastConfigArchive(c.NodeID)
+	if last != nil && last.Hash == c.Hash {
+		return false, last, nil
+	}
+	j, err := json.Marshal(c)
+	if err != nil {
+		return false, last, err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("configArchive"))
+		if b == nil {
+			return fmt.Errorf("bucket configArchive is nil")
+		}
+		nb, err := b.CreateBucketIfNotExists([]byte(c.NodeID))
+		if err != nil {
+			return err
+		}
+		if err := nb.Put([]byte(fmt.Sprintf("%016x", c.Time)), j); err != nil {
+			return err
+		}
+		// 古い世代を削除する
+		keys := [][]byte{}
+		nb.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		for i := 0; i < len(keys)-ConfigArchiveGeneration; i++ {
+			if err := nb.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err == nil, last, err
+}
+
+// GetLastConfigArchive : ノードの最新の設定を取得する
+func GetLastConfigArchive(nodeID string) *ConfigArchiveEnt {
+	var ret *ConfigArchiveEnt
+	if db == nil {
+		return nil
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		nb := getConfigArchiveBucket(tx, nodeID)
+		if nb == nil {
+			return nil
+		}
+		if _, v := nb.Cursor().Last(); v != nil {
+			var c ConfigArchiveEnt
+			if err := json.Unmarshal(v, &c); err == nil {
+				ret = &c
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// GetConfigArchive : 指定した時刻のノードの設定を取得する
+func GetConfigArchive(nodeID string, t int64) *ConfigArchiveEnt {
+	var ret *ConfigArchiveEnt
+	if db == nil {
+		return nil
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		nb := getConfigArchiveBucket(tx, nodeID)
+		if nb == nil {
+			return nil
+		}
+		if v := nb.Get([]byte(fmt.Sprintf("%016x", t))); v != nil {
+			var c ConfigArchiveEnt
+			if err := json.Unmarshal(v, &c); err == nil {
+				ret = &c
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// GetConfigArchiveList : ノードの設定の履歴を新しい順に取得する(設定の内容は含まない)
+func GetConfigArchiveList(nodeID string) []*ConfigArchiveEnt {
+	ret := []*ConfigArchiveEnt{}
+	if db == nil {
+		return ret
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		nb := getConfigArchiveBucket(tx, nodeID)
+		if nb == nil {
+			return nil
+		}
+		cr := nb.Cursor()
+		for k, v := cr.Last(); k != nil; k, v = cr.Prev() {
+			var c ConfigArchiveEnt
+			if err := json.Unmarshal(v, &c); err == nil {
+				c.Config = ""
+				ret = append(ret, &c)
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// DeleteConfigArchive : ノードの設定の履歴を削除する
+func DeleteConfigArchive(nodeID string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("configArchive"))
+		if b == nil || b.Bucket([]byte(nodeID)) == nil {
+			return nil
+		}
+		return b.DeleteBucket([]byte(nodeID))
+	})
+}
+
+// DiffConfigArchive : ノードの2つの世代の設定のunified diffを返す
+// t2が0の場合は最新の設定と比較する
+func DiffConfigArchive(nodeID string, t1, t2 int64) (string, error) {
+	c1 := GetConfigArchive(nodeID, t1)
+	if c1 == nil {
+		return "", ErrInvalidID
+	}
+	var c2 *ConfigArchiveEnt
+	if t2 == 0 {
+		c2 = GetLastConfigArchive(nodeID)
+	} else {
+		c2 = GetConfigArchive(nodeID, t2)
+	}
+	if c2 == nil {
+		return "", ErrInvalidID
+	}
+	return MakeConfigDiff(c1, c2)
+}
+
+// MakeConfigDiff : 2つの設定のunified diffを作成する
+func MakeConfigDiff(c1, c2 *ConfigArchiveEnt) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(c1.Config),
+		B:        difflib.SplitLines(c2.Config),
+		FromFile: time.Unix(0, c1.Time).Format(time.RFC3339),
+		ToFile:   time.Unix(0, c2.Time).Format(time.RFC3339),
+		Context:  3,
+	})
+}
+
+func getConfigArchiveBucket(tx *bbolt.Tx, nodeID string) *bbolt.Bucket {
+	b := tx.Bucket([]byte("configArchive"))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte(nodeID))
+}
+
+// NormalizeConfig : 改行コードと行末の空白を揃える
+func NormalizeConfig(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
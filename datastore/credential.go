@@ -0,0 +1,311 @@
+package datastore
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"go.etcd.io/bbolt"
+)
+
+// CredentialEnt : ノード、ネットワーク、ポーリングで共有する認証情報のプロファイル
+type CredentialEnt struct {
+	ID         string
+	Name       string
+	Type       string // snmp | ssh | gnmi | http | vmware
+	Descr      string
+	SnmpMode   string
+	Community  string
+	User       string
+	Password   string
+	PrivateKey string // SSHのクライアント鍵(PEM)
+	Token      string // HTTPのBearerトークン
+	Encoding   string // gNMIのエンコーディング
+}
+
+// CredentialTypes : 認証情報プロファイルの種別
+var CredentialTypes = []string{"snmp", "ssh", "gnmi", "http", "vmware"}
+
+var credentialProfiles sync.Map
+
+func loadCredentials() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("credentials"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var c CredentialEnt
+			if err := json.Unmarshal(v, &c); err == nil {
+				decryptCredentialSecret(&c)
+				credentialProfiles.Store(c.ID, &c)
+			}
+			return nil
+		})
+	})
+}
+
+func saveCredential(c *CredentialEnt) error {
+	s, err := json.Marshal(encryptCredentialSecret(c))
+	if err != nil {
+		return err
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("credentials"))
+		return b.Put([]byte(c.ID), s)
+	})
+}
+
+// AddCredential : 認証情報プロファイルを追加する
+func AddCredential(c *CredentialEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if !validCredential(c) {
+		return ErrInvalidParams
+	}
+	for {
+		c.ID = makeKey()
+		if _, ok := credentialProfiles.Load(c.ID); !ok {
+			break
+		}
+	}
+	if err := saveCredential(c); err != nil {
+		return err
+	}
+	credentialProfiles.Store(c.ID, c)
+	log.Printf("AddCredential name=%s dur=%v", c.Name, time.Since(st))
+	return nil
+}
+
+// UpdateCredential : 認証情報プロファイルを更新する、参照しているノードは次回の利用時から新しい値を使う
+func UpdateCredential(c *CredentialEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := credentialProfiles.Load(c.ID); !ok {
+		return ErrInvalidID
+	}
+	if !validCredential(c) {
+		return ErrInvalidParams
+	}
+	if err := saveCredential(c); err != nil {
+		return err
+	}
+	credentialProfiles.Store(c.ID, c)
+	if c.ID == MapConf.CredentialID {
+		RestartSnmpTrapd = true
+	}
+	log.Printf("UpdateCredential name=%s dur=%v", c.Name, time.Since(st))
+	return nil
+}
+
+// DeleteCredential : 認証情報プロファイルを削除して、ノードとネットワークの参照を外す
+func DeleteCredential(id string) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := credentialProfiles.Load(id); !ok {
+		return ErrInvalidID
+	}
+	db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("credentials"))
+		return b.Delete([]byte(id))
+	})
+	credentialProfiles.Delete(id)
+	ForEachNodes(func(n *NodeEnt) bool {
+		for t, cid := range n.Credentials {
+			if cid == id {
+				delete(n.Credentials, t)
+				UpdateNode(n)
+			}
+		}
+		return true
+	})
+	ForEachNetworks(func(n *NetworkEnt) bool {
+		if n.CredentialID == id {
+			n.CredentialID = ""
+			UpdateNetwork(n)
+		}
+		return true
+	})
+	if MapConf.CredentialID == id {
+		MapConf.CredentialID = ""
+		SaveMapConf()
+	}
+	log.Printf("DeleteCredential dur=%v", time.Since(st))
+	return nil
+}
+
+// GetCredential : IDで認証情報プロファイルを取得する
+func GetCredential(id string) *CredentialEnt {
+	if id == "" {
+		return nil
+	}
+	if v, ok := credentialProfiles.Load(id); ok {
+		if c, ok := v.(*CredentialEnt); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// GetCredentials : 認証情報プロファイルのリストを名前順で取得する
+func GetCredentials() []*CredentialEnt {
+	ret := []*CredentialEnt{}
+	credentialProfiles.Range(func(_, v interface{}) bool {
+		if c, ok := v.(*CredentialEnt); ok {
+			ret = append(ret, c)
+		}
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func isCredentialType(t string) bool {
+	for _, ct := range CredentialTypes {
+		if ct == t {
+			return true
+		}
+	}
+	return false
+}
+
+// validCredential : 種別と種別毎の必須項目を確認する
+func validCredential(c *CredentialEnt) bool {
+	if !isCredentialType(c.Type) {
+		return false
+	}
+	switch c.Type {
+	case "snmp":
+		if c.SnmpMode == "" || c.SnmpMode == "v2c" {
+			return true
+		}
+		_, ok := snmpV3Modes[c.SnmpMode]
+		return ok && c.User != ""
+	case "ssh", "vmware":
+		return c.User != ""
+	}
+	return true
+}
+
+// snmpV3Mode : SNMPv3のモード毎の認証と暗号化の方式
+type snmpV3Mode struct {
+	flags gosnmp.SnmpV3MsgFlags
+	auth  gosnmp.SnmpV3AuthProtocol
+	priv  gosnmp.SnmpV3PrivProtocol
+}
+
+var snmpV3Modes = map[string]snmpV3Mode{
+	"v3auth":         {flags: gosnmp.AuthNoPriv, auth: gosnmp.SHA},
+	"v3authpriv":     {flags: gosnmp.AuthPriv, auth: gosnmp.SHA, priv: gosnmp.AES},
+	"v3authprivex":   {flags: gosnmp.AuthPriv, auth: gosnmp.SHA256, priv: gosnmp.AES256},
+	"v3sha256aes128": {flags: gosnmp.AuthPriv, auth: gosnmp.SHA256, priv: gosnmp.AES},
+	"v3sha512aes256": {flags: gosnmp.AuthPriv, auth: gosnmp.SHA512, priv: gosnmp.AES256},
+}
+
+// SetSnmpAgentAuth : SNMPのモードに合わせてエージェントのバージョンと認証を設定する
+// SNMPv3以外はSNMPv2cのコミュニティーを設定する
+func SetSnmpAgentAuth(agent *gosnmp.GoSNMP, mode, community, user, password string) {
+	m, ok := snmpV3Modes[mode]
+	if !ok {
+		agent.Version = gosnmp.Version2c
+		agent.Community = community
+		return
+	}
+	agent.Version = gosnmp.Version3
+	agent.SecurityModel = gosnmp.UserSecurityModel
+	agent.MsgFlags = m.flags
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:                 user,
+		AuthenticationProtocol:   m.auth,
+		AuthenticationPassphrase: password,
+	}
+	if m.flags == gosnmp.AuthPriv {
+		sp.PrivacyProtocol = m.priv
+		sp.PrivacyPassphrase = password
+	}
+	agent.SecurityParameters = sp
+}
+
+// SetSnmpAgent : SNMPの認証情報をエージェントに設定する
+func (c *CredentialEnt) SetSnmpAgent(agent *gosnmp.GoSNMP) {
+	SetSnmpAgentAuth(agent, c.SnmpMode, c.Community, c.User, c.Password)
+}
+
+// ValidNodeCredentials : ノードが参照するプロファイルが存在して種別が一致するか確認する
+func ValidNodeCredentials(m map[string]string) bool {
+	for t, id := range m {
+		if id == "" {
+			continue
+		}
+		if c := GetCredential(id); c == nil || c.Type != t {
+			return false
+		}
+	}
+	return true
+}
+
+// GetNodeCredential : ノードの認証情報を取得する
+// プロファイルを参照していない場合はノードに設定した値を使う
+func GetNodeCredential(n *NodeEnt, t string) *CredentialEnt {
+	if c := GetCredential(n.Credentials[t]); c != nil && c.Type == t {
+		return c
+	}
+	c := &CredentialEnt{Type: t}
+	switch t {
+	case "snmp":
+		c.SnmpMode = n.SnmpMode
+		c.Community = n.Community
+		c.User = n.User
+		c.Password = n.Password
+	case "gnmi":
+		c.User = n.GNMIUser
+		c.Password = n.GNMIPassword
+		c.Encoding = n.GNMIEncoding
+	default:
+		c.User = n.User
+		c.Password = n.Password
+	}
+	return c
+}
+
+// GetNetworkCredential : ネットワークのSNMPの認証情報を取得する
+func GetNetworkCredential(n *NetworkEnt) *CredentialEnt {
+	if c := GetCredential(n.CredentialID); c != nil && c.Type == "snmp" {
+		return c
+	}
+	return &CredentialEnt{
+		Type:      "snmp",
+		SnmpMode:  n.SnmpMode,
+		Community: n.Community,
+		User:      n.User,
+		Password:  n.Password,
+	}
+}
+
+// GetMapCredential : 自動発見とTRAP受信で使うSNMPの認証情報を取得する
+func GetMapCredential() *CredentialEnt {
+	if c := GetCredential(MapConf.CredentialID); c != nil && c.Type == "snmp" {
+		return c
+	}
+	return &CredentialEnt{
+		Type:      "snmp",
+		SnmpMode:  MapConf.SnmpMode,
+		Community: MapConf.Community,
+		User:      MapConf.SnmpUser,
+		Password:  MapConf.SnmpPassword,
+	}
+}
@@ -208,6 +208,7 @@ func loadDataFromFS(fs http.FileSystem) error {
 	if _, err := os.Stat(p); err == nil {
 		openGeoIP(p)
 	}
+	openASNFiles()
 	loadGrokMap()
 	if r, err := fs.Open("/conf/polling.json"); err == nil {
 		if b, err := io.ReadAll(r); err == nil && len(b) > 0 {
@@ -231,6 +232,7 @@ func loadDataFromFS(fs http.FileSystem) error {
 	loadMailTemplateToMap("test", fs)
 	loadMailTemplateToMap("notify", fs)
 	loadMailTemplateToMap("report", fs)
+	loadMailTemplateToMap("sla", fs)
 	checkImageIcons()
 	return nil
 }
@@ -263,6 +265,12 @@ func openDB(path string) error {
 		db.Close()
 		return err
 	}
+	log.Println("initSecretKey")
+	err = initSecretKey()
+	if err != nil {
+		db.Close()
+		return err
+	}
 	log.Println("loadConf")
 	err = loadConf()
 	if err != nil {
@@ -275,7 +283,66 @@ func openDB(path string) error {
 		db.Close()
 		return err
 	}
+	log.Println("loadCredentials")
+	err = loadCredentials()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadFederationSites")
+	err = loadFederationSites()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadCustomPollingTemplates")
+	err = loadCustomPollingTemplates()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadNotifyTemplates")
+	err = loadNotifyTemplates()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadTickets")
+	err = loadTickets()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadThreatFeeds")
+	err = loadThreatFeeds()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadSLAs")
+	err = loadSLAs()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadReportDefs")
+	err = loadReportDefs()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	log.Println("loadCompliance")
+	err = loadCompliance()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if secretDecryptFailed {
+		db.Close()
+		return ErrDecryptSecret
+	}
 	migrateMapSize()
+	migrateSecret()
 	log.Println("setupInfluxdb")
 	err = setupInfluxdb()
 	if err != nil {
@@ -297,6 +364,8 @@ func initDB() error {
 	buckets := []string{"config", "nodes", "items", "lines", "networks", "pollings", "logs", "pollingLogs",
 		"syslog", "trap", "netflow", "ipfix", "arplog", "arp", "ai", "report", "grok", "images",
 		"sflow", "sflowCounter", "certs", "memo", "otelTrace", "otelMetric", "mqttStat",
+		"credentials", "federation", "configArchive", "complianceRules", "complianceResults", "remoteExec", "pollingTemplates", "pollingTemplateHistory",
+		"notifyTemplates", "tickets", "flowTopNMin", "flowTopNHour", "threatFeeds", "sla", "reportDefs",
 	}
 	reports := []string{"devices", "users", "flows", "fumbleFlows", "servers", "ips",
 		"ether", "dns", "radius", "tls", "cert",
@@ -336,6 +405,7 @@ func CloseDB() {
 	if err := saveAllPollings(); err != nil {
 		log.Printf("saveAllPollings err=%v", err)
 	}
+	closeLogParts()
 	db.Close()
 	db = nil
 }
@@ -2,12 +2,19 @@ package datastore
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"net/http"
+
+	"github.com/gosnmp/gosnmp"
+	"go.etcd.io/bbolt"
+	"gopkg.in/yaml.v2"
 )
 
 func getTmpDBFile() (string, error) {
@@ -202,4 +209,1077 @@ func TestMigrateMapSize(t *testing.T) {
 	CloseDB()
 }
 
+func TestLogPartition(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
 
+	now := time.Now()
+	old := now.AddDate(0, 0, -20)
+	prev := now.AddDate(0, 0, -1)
+	SaveLogBuffer([]*LogEnt{
+		{Time: old.UnixNano(), Type: "syslog", Log: "old"},
+		{Time: prev.UnixNano(), Type: "syslog", Log: "prev"},
+		{Time: now.UnixNano(), Type: "syslog", Log: "now"},
+		{Time: now.UnixNano(), Type: "trap", Log: "trap"},
+		{Time: old.UnixNano(), Type: "trap", Log: "oldtrap"},
+	})
+	if days := getLogPartDays(); len(days) != 3 {
+		t.Fatalf("expected 3 partitions, got %v", days)
+	}
+	list := []string{}
+	ForEachLog(old.UnixNano()-1, now.UnixNano()+1, "syslog", func(l *LogEnt) bool {
+		list = append(list, l.Log)
+		return true
+	})
+	if strings.Join(list, ",") != "old,prev,now" {
+		t.Errorf("ForEachLog got %v", list)
+	}
+	list = []string{}
+	ForEachLogReverse(old.UnixNano()-1, now.UnixNano()+1, "syslog", func(l *LogEnt) bool {
+		list = append(list, l.Log)
+		return len(list) < 2
+	})
+	if strings.Join(list, ",") != "now,prev" {
+		t.Errorf("ForEachLogReverse got %v", list)
+	}
+	// 種類を指定した場合は他の種類のログを残す
+	if c := deleteOldLogPartType(getLogPartDir(), "syslog", 14); c != 1 {
+		t.Errorf("expected 1 deleted syslog, got %d", c)
+	}
+	list = []string{}
+	ForEachLog(old.UnixNano()-1, now.UnixNano()+1, "trap", func(l *LogEnt) bool {
+		list = append(list, l.Log)
+		return true
+	})
+	if strings.Join(list, ",") != "oldtrap,trap" {
+		t.Errorf("ForEachLog trap got %v", list)
+	}
+	if c := deleteOldLogParts(getLogPartDir(), 14); c != 1 {
+		t.Errorf("expected 1 deleted partition, got %d", c)
+	}
+	list = []string{}
+	ForEachLastLog("syslog", func(l *LogEnt) bool {
+		list = append(list, l.Log)
+		return true
+	})
+	if strings.Join(list, ",") != "now,prev" {
+		t.Errorf("ForEachLastLog got %v", list)
+	}
+	prevDay := logPartDay(prev.UnixNano())
+	muLogParts.Lock()
+	logPartUsed[prevDay] = now.Add(-logPartIdleTimeout * 2)
+	muLogParts.Unlock()
+	closeIdleLogParts()
+	muLogParts.Lock()
+	_, open := logParts[prevDay]
+	muLogParts.Unlock()
+	if open {
+		t.Errorf("idle partition %s not closed", prevDay)
+	}
+	// バケットがないパーティションにも作成する
+	d, err := openLogPart(prevDay, false)
+	if err != nil || d == nil {
+		t.Fatalf("reopen partition err=%v", err)
+	}
+	d.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket([]byte("trap"))
+	})
+	DeleteLogs("trap")
+	d.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("trap")) == nil {
+			t.Error("trap bucket not created")
+		}
+		return nil
+	})
+	CloseDB()
+}
+
+func TestBackupSet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	MapConf.MapName = "Full"
+	if err := SaveMapConf(); err != nil {
+		t.Fatal(err)
+	}
+	SaveLogBuffer([]*LogEnt{{Time: time.Now().UnixNano(), Type: "syslog", Log: "first"}})
+	full, err := backupSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Type != "full" {
+		t.Errorf("expected full backup, got %s", full.Type)
+	}
+	time.Sleep(time.Second * 2)
+	MapConf.MapName = "Incr"
+	if err := SaveMapConf(); err != nil {
+		t.Fatal(err)
+	}
+	incr, err := backupSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incr.Type != "incr" || incr.Base != full.ID {
+		t.Errorf("expected incr backup on %s, got %+v", full.ID, incr)
+	}
+	if err := VerifyBackupSet(incr.ID); err != nil {
+		t.Fatal(err)
+	}
+	// 増分は変更したバケットだけを保存する
+	changed := []string{}
+	if d, err := bbolt.Open(filepath.Join(getBackupSetDir(), incr.ID, "config.db"), 0400, &bbolt.Options{ReadOnly: true}); err == nil {
+		d.View(func(tx *bbolt.Tx) error {
+			return tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+				changed = append(changed, string(name))
+				return nil
+			})
+		})
+		d.Close()
+	}
+	if strings.Join(changed, ",") != "config" {
+		t.Errorf("incr config buckets=%v", changed)
+	}
+	CloseDB()
+	if err := RestoreBackupSet(td, incr.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != nil {
+		t.Fatal(err)
+	}
+	if MapConf.MapName != "Incr" {
+		t.Errorf("restored incr MapName = '%s'", MapConf.MapName)
+	}
+	CloseDB()
+	// 退避するファイル名が重ならないようにする
+	time.Sleep(time.Second)
+	if err := RestoreBackupSet(td, full.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != nil {
+		t.Fatal(err)
+	}
+	if MapConf.MapName != "Full" {
+		t.Errorf("restored MapName = '%s'", MapConf.MapName)
+	}
+	count := 0
+	ForEachLastLog("syslog", func(l *LogEnt) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Errorf("restored syslog count=%d", count)
+	}
+	CloseDB()
+}
+
+func TestS3BackupHelpers(t *testing.T) {
+	bucket, key, err := parseS3URL("s3://twsnmp/site1/twsnmpfc.db.20261019030000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "twsnmp" || key != "site1/twsnmpfc.db.20261019030000" {
+		t.Errorf("parseS3URL bucket=%s key=%s", bucket, key)
+	}
+	if _, _, err := parseS3URL("http://twsnmp/site1"); err == nil {
+		t.Error("parseS3URL should fail for http scheme")
+	}
+	bucket, prefix, at, err := parseS3BackupSetURL("s3://twsnmp/site1/20261019030000")
+	if err != nil || bucket != "twsnmp" || prefix != "site1" || at != "20261019030000" {
+		t.Errorf("parseS3BackupSetURL bucket=%s prefix=%s at=%s err=%v", bucket, prefix, at, err)
+	}
+	if _, prefix, _, err := parseS3BackupSetURL("s3://twsnmp/20261019030000"); err != nil || prefix != "" {
+		t.Errorf("parseS3BackupSetURL prefix=%s err=%v", prefix, err)
+	}
+	if _, _, _, err := parseS3BackupSetURL("s3://twsnmp/"); err == nil {
+		t.Error("parseS3BackupSetURL should fail without time")
+	}
+	del := selectS3Rotation([]string{
+		"twsnmpfc.db.20261019030000",
+		"twsnmpfc.db.20261017030000",
+		"twsnmpfc.db.20261018030000",
+	}, 1)
+	if len(del) != 1 || del[0] != "twsnmpfc.db.20261017030000" {
+		t.Errorf("selectS3Rotation got %v", del)
+	}
+	if del := selectS3Rotation([]string{"twsnmpfc.db.20261019030000"}, 1); len(del) != 0 {
+		t.Errorf("selectS3Rotation got %v", del)
+	}
+}
+
+func TestSecretMigration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	MasterPassword = ""
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	n := &NodeEnt{Name: "secret", IP: "192.168.1.1", Community: "private"}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	CloseDB()
+	MasterPassword = "test"
+	defer func() { MasterPassword = "" }()
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != nil {
+		t.Fatal(err)
+	}
+	if nn := GetNode(n.ID); nn == nil || nn.Community != "private" {
+		t.Fatalf("loaded node=%+v", nn)
+	}
+	raw := ""
+	db.View(func(tx *bbolt.Tx) error {
+		raw = string(tx.Bucket([]byte("nodes")).Get([]byte(n.ID)))
+		return nil
+	})
+	if strings.Contains(raw, "private") || !strings.Contains(raw, "enc:v1:") {
+		t.Errorf("node secret not encrypted %s", raw)
+	}
+	CloseDB()
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != nil {
+		t.Fatal(err)
+	}
+	if nn := GetNode(n.ID); nn == nil || nn.Community != "private" {
+		t.Errorf("decrypted node=%+v", nn)
+	}
+	CloseDB()
+	// 違うマスターパスワードでは起動しない
+	MasterPassword = "wrong"
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != ErrDecryptSecret {
+		t.Errorf("open with wrong password err=%v", err)
+	}
+	if s := encryptSecret("enc:v1:abc"); s != "enc:v1:abc" {
+		t.Errorf("encrypted secret changed %s", s)
+	}
+}
+
+func TestCredentialProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	defer CloseDB()
+	if err := AddCredential(&CredentialEnt{Name: "bad", Type: "unknown"}); err == nil {
+		t.Error("add credential with invalid type")
+	}
+	if err := AddCredential(&CredentialEnt{Name: "nouser", Type: "snmp", SnmpMode: "v3auth"}); err == nil {
+		t.Error("add v3 credential without user")
+	}
+	c := &CredentialEnt{Name: "v3", Type: "snmp", SnmpMode: "v3authpriv", User: "admin", Password: "pass1"}
+	if err := AddCredential(c); err != nil {
+		t.Fatal(err)
+	}
+	if ValidNodeCredentials(map[string]string{"ssh": c.ID}) {
+		t.Error("snmp profile accepted for ssh")
+	}
+	agent := &gosnmp.GoSNMP{}
+	c.SetSnmpAgent(agent)
+	if sp, ok := agent.SecurityParameters.(*gosnmp.UsmSecurityParameters); !ok || agent.Version != gosnmp.Version3 ||
+		sp.UserName != "admin" || sp.PrivacyProtocol != gosnmp.AES {
+		t.Errorf("snmp agent=%+v", agent)
+	}
+	n := &NodeEnt{Name: "cred", IP: "192.168.1.2", Community: "public", Credentials: map[string]string{"snmp": c.ID}}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	if r := GetNodeCredential(n, "snmp"); r.User != "admin" || r.Password != "pass1" {
+		t.Errorf("resolved credential=%+v", r)
+	}
+	if r := GetNodeCredential(n, "ssh"); r.User != "" || r.Type != "ssh" {
+		t.Errorf("fallback credential=%+v", r)
+	}
+	c2 := *c
+	c2.Password = "pass2"
+	if err := UpdateCredential(&c2); err != nil {
+		t.Fatal(err)
+	}
+	if r := GetNodeCredential(n, "snmp"); r.Password != "pass2" {
+		t.Errorf("updated credential=%+v", r)
+	}
+	if err := DeleteCredential(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := GetNodeCredential(n, "snmp"); r.Community != "public" || n.Credentials["snmp"] != "" {
+		t.Errorf("credential after delete=%+v node=%+v", r, n.Credentials)
+	}
+}
+
+func TestFederationSite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	defer CloseDB()
+	if err := UpdateFederationSite(&FederationSiteEnt{Name: "no url"}); err == nil {
+		t.Error("update federation site without url")
+	}
+	s := &FederationSiteEnt{Name: "site1", URL: "http://192.168.1.10:8080", User: "twsnmp", Password: "twsnmp"}
+	if err := UpdateFederationSite(s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Interval != 60 || GetFederationSite(s.ID) == nil {
+		t.Errorf("federation site=%+v", s)
+	}
+	SetFederationMap(&FederationMapEnt{SiteID: s.ID, State: "normal"})
+	if m := GetFederationMap(s.ID); m == nil || m.State != "normal" {
+		t.Errorf("federation map=%+v", m)
+	}
+	if err := DeleteFederationSite(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(GetFederationSites()) != 0 || GetFederationMap(s.ID) != nil {
+		t.Error("federation site not deleted")
+	}
+}
+
+func TestConfigArchive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	defer CloseDB()
+	c1 := &ConfigArchiveEnt{NodeID: "n1", Config: "hostname r1\nip route 0.0.0.0 0.0.0.0 192.168.1.1\n"}
+	if changed, last, err := AddConfigArchive(c1); err != nil || !changed || last != nil {
+		t.Fatalf("first archive changed=%v last=%v err=%v", changed, last, err)
+	}
+	if changed, _, err := AddConfigArchive(&ConfigArchiveEnt{NodeID: "n1", Config: c1.Config}); err != nil || changed {
+		t.Errorf("same config saved changed=%v err=%v", changed, err)
+	}
+	c2 := &ConfigArchiveEnt{NodeID: "n1", Config: "hostname r1\nip route 0.0.0.0 0.0.0.0 192.168.1.254\n"}
+	changed, last, err := AddConfigArchive(c2)
+	if err != nil || !changed || last == nil || last.Hash != c1.Hash {
+		t.Fatalf("second archive changed=%v last=%v err=%v", changed, last, err)
+	}
+	list := GetConfigArchiveList("n1")
+	if len(list) != 2 || list[0].Time != c2.Time || list[0].Config != "" {
+		t.Errorf("config archive list=%+v", list)
+	}
+	diff, err := DiffConfigArchive("n1", c1.Time, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "-ip route 0.0.0.0 0.0.0.0 192.168.1.1\n") ||
+		!strings.Contains(diff, "+ip route 0.0.0.0 0.0.0.0 192.168.1.254\n") {
+		t.Errorf("config diff=%s", diff)
+	}
+	// 複数の古い世代をまとめて削除する
+	ConfigArchiveGeneration = 1
+	defer func() { ConfigArchiveGeneration = 100 }()
+	AddConfigArchive(&ConfigArchiveEnt{NodeID: "n1", Config: "hostname r2\n"})
+	if list := GetConfigArchiveList("n1"); len(list) != 1 || GetConfigArchive("n1", c1.Time) != nil {
+		t.Errorf("old generation not removed len=%d", len(list))
+	}
+	if l := GetLastConfigArchive("n1"); l == nil || l.Config != "hostname r2\n" {
+		t.Errorf("latest generation removed %+v", l)
+	}
+	DeleteConfigArchive("n1")
+	if GetLastConfigArchive("n1") != nil {
+		t.Error("config archive not deleted")
+	}
+}
+
+func TestComplianceRule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	defer CloseDB()
+	if err := UpdateComplianceRule(&ComplianceRuleEnt{Name: "no pattern", Mode: "match"}); err == nil {
+		t.Error("update rule without pattern")
+	}
+	r := &ComplianceRuleEnt{Name: "ntp", Mode: "match", Pattern: "^ntp server", SysObjectID: ".1.3.6.1.4.1.9."}
+	if err := UpdateComplianceRule(r); err != nil {
+		t.Fatal(err)
+	}
+	n := &NodeEnt{Name: "router1", IP: "192.168.1.1", SysObjectID: ".1.3.6.1.4.1.9.1.1"}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	if !IsComplianceRuleTarget(r, n) || IsComplianceRuleTarget(r, &NodeEnt{SysObjectID: ".1.3.6.1.4.1.2636.1"}) {
+		t.Error("compliance rule target")
+	}
+	SetComplianceResult(&ComplianceResultEnt{NodeID: n.ID, RuleID: r.ID, Compliant: false, CheckTime: time.Now().UnixNano()})
+	rep := GetComplianceReport()
+	if len(rep) != 1 || rep[0].Compliant || len(rep[0].Violation) != 1 || rep[0].Violation[0] != "ntp" {
+		t.Errorf("compliance report=%+v", rep)
+	}
+	if err := DeleteComplianceRule(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(GetComplianceReport()) != 0 || GetComplianceResult(n.ID, r.ID) != nil {
+		t.Error("compliance result not deleted")
+	}
+}
+
+func TestRemoteExecJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	defer CloseDB()
+	RemoteExecJobMax = 3
+	defer func() { RemoteExecJobMax = 100 }()
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		j := &RemoteExecJobEnt{
+			ID:      fmt.Sprintf("%016x", i+1),
+			Type:    "ssh",
+			Command: "show version",
+			State:   "done",
+			Results: []*RemoteExecResultEnt{{NodeID: "n1", Output: "ok"}},
+		}
+		if err := SaveRemoteExecJob(j); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, j.ID)
+	}
+	list := GetRemoteExecJobs()
+	if len(list) != 3 || list[0].ID != ids[4] || list[0].Results != nil {
+		t.Errorf("remote exec jobs=%+v", list)
+	}
+	if j := GetRemoteExecJob(ids[4]); j == nil || len(j.Results) != 1 {
+		t.Errorf("remote exec job=%+v", j)
+	}
+	if GetRemoteExecJob(ids[0]) != nil {
+		t.Error("old remote exec job not removed")
+	}
+	DeleteRemoteExecJob(ids[4])
+	if GetRemoteExecJob(ids[4]) != nil {
+		t.Error("remote exec job not deleted")
+	}
+	// 実行中の結果は終了時にまとめて保存し、古いジョブはまとめて削除する
+	RemoteExecJobMax = 1
+	j := &RemoteExecJobEnt{ID: fmt.Sprintf("%016x", 10), Type: "ssh", Command: "show version"}
+	if err := StartRemoteExecJob(j); err != nil {
+		t.Fatal(err)
+	}
+	AddRemoteExecResult(j, &RemoteExecResultEnt{NodeID: "n1", Output: "ok"})
+	if r := GetRemoteExecJob(j.ID); r == nil || r.State != "running" || len(r.Results) != 1 {
+		t.Errorf("running remote exec job=%+v", r)
+	}
+	if err := EndRemoteExecJob(j); err != nil {
+		t.Fatal(err)
+	}
+	list = GetRemoteExecJobs()
+	if len(list) != 1 || list[0].ID != j.ID || list[0].State != "done" {
+		t.Errorf("remote exec jobs after end=%+v", list)
+	}
+}
+
+func TestCustomPollingTemplate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	var builtin *PollingTemplateEnt
+	ForEachPollingTemplate(func(pt *PollingTemplateEnt) bool {
+		builtin = pt
+		return false
+	})
+	if builtin == nil || builtin.Custom {
+		t.Fatal("no builtin polling template")
+	}
+	if err := UpdatePollingTemplate(&PollingTemplateEnt{ID: builtin.ID, Name: "x", Type: "ping"}); err == nil {
+		t.Error("builtin polling template updated")
+	}
+	pt := &PollingTemplateEnt{Name: "in-house cpu", Type: "snmp", Mode: "get", MatchSysObjectID: ".1.3.6.1.4.1.9.", MatchService: "ssh,https"}
+	if err := UpdatePollingTemplate(pt); err != nil {
+		t.Fatal(err)
+	}
+	if pt.Version != 1 || !pt.Custom {
+		t.Errorf("polling template=%+v", pt)
+	}
+	if err := UpdatePollingTemplate(&PollingTemplateEnt{ID: pt.ID, Name: pt.Name, Type: pt.Type, Script: "true", MatchSysObjectID: pt.MatchSysObjectID, MatchService: pt.MatchService}); err != nil {
+		t.Fatal(err)
+	}
+	if p := GetPollingTemplate(pt.ID); p == nil || p.Version != 2 {
+		t.Errorf("polling template version=%+v", p)
+	}
+	if h := GetPollingTemplateHistory(pt.ID); len(h) != 1 || h[0].Version != 1 || h[0].Script != "" {
+		t.Errorf("polling template history=%+v", h)
+	}
+	if r, err := RestorePollingTemplate(pt.ID, 1); err != nil || r.Version != 3 || r.Script != "" {
+		t.Errorf("restore polling template=%+v err=%v", r, err)
+	}
+	if h := GetPollingTemplateHistory(pt.ID); len(h) != 2 || h[0].Version != 2 || h[0].Script != "true" {
+		t.Errorf("polling template history after restore=%+v", h)
+	}
+	// YAMLでもJSONと同じキーで取り込めること
+	y, err := yaml.Marshal([]*PollingTemplateEnt{GetPollingTemplate(pt.ID)})
+	if err != nil || !strings.Contains(string(y), "MatchSysObjectID:") {
+		t.Errorf("yaml=%s err=%v", y, err)
+	}
+	yl := []*PollingTemplateEnt{}
+	if err := yaml.Unmarshal(y, &yl); err != nil || len(yl) != 1 || yl[0].MatchService != pt.MatchService || yl[0].Version != 3 {
+		t.Errorf("yaml round trip=%+v err=%v", yl, err)
+	}
+	n := &NodeEnt{SysObjectID: ".1.3.6.1.4.1.9.1.1", Icon: "hdd"}
+	p := GetPollingTemplate(pt.ID)
+	if !MatchPollingTemplate(p, n, map[string]bool{"ssh": true}) {
+		t.Error("polling template not matched")
+	}
+	if MatchPollingTemplate(p, n, map[string]bool{"http": true}) || MatchPollingTemplate(builtin, n, nil) {
+		t.Error("polling template matched")
+	}
+	// 古いバージョンは取り込まない
+	if c, err := ImportPollingTemplates([]*PollingTemplateEnt{
+		{Name: pt.Name, Type: pt.Type, Version: 1},
+		{Name: "new", Type: "ping", Version: 3},
+	}); err != nil || c != 1 {
+		t.Errorf("import polling template count=%d err=%v", c, err)
+	}
+	if c, _ := ImportPollingTemplates([]*PollingTemplateEnt{{Name: pt.Name, Type: pt.Type, Version: 5}}); c != 1 || GetPollingTemplate(pt.ID).Version != 5 {
+		t.Errorf("import polling template newer version count=%d", c)
+	}
+	CloseDB()
+	pollingTemplateList.Delete(pt.ID)
+	if err := openDB(filepath.Join(td, "twsnmpfc.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+	if p := GetPollingTemplate(pt.ID); p == nil || !p.Custom || p.Version != 5 {
+		t.Errorf("custom polling template not loaded=%+v", p)
+	}
+	if err := DeletePollingTemplate(pt.ID); err != nil || GetPollingTemplate(pt.ID) != nil {
+		t.Errorf("delete polling template err=%v", err)
+	}
+}
+
+func TestMatchTagSelector(t *testing.T) {
+	tags := []string{"core", "tokyo"}
+	tests := []struct {
+		sel string
+		ok  bool
+	}{
+		{"", true},
+		{"core", true},
+		{"core,tokyo", true},
+		{"core !tokyo", false},
+		{"!edge", true},
+		{"group:hq", true},
+		{"group:hq/server", true},
+		{"group:hq/serv", false},
+		{"group:branch,core", false},
+	}
+	for _, tc := range tests {
+		if r := MatchTagSelector(tc.sel, tags, "hq/server/rack1"); r != tc.ok {
+			t.Errorf("MatchTagSelector(%q)=%v", tc.sel, r)
+		}
+	}
+	if r := NormalizeTags([]string{" b", "a", "", "b", "x y"}); len(r) != 2 || r[0] != "a" || r[1] != "b" {
+		t.Errorf("NormalizeTags=%v", r)
+	}
+	if g := NormalizeGroup("/hq// server/"); g != "hq/server" {
+		t.Errorf("NormalizeGroup=%s", g)
+	}
+}
+
+func TestASNPrefixes(t *testing.T) {
+	rib := `# prefix asn org
+1.0.0.0/24 13335 CLOUDFLARENET
+1.0.0.0/16 AS2519 VECTANT
+TABLE_DUMP2|1700000000|B|192.0.2.1|64500|8.8.8.0/24|64500 3356 15169|IGP
+2001:db8::/32 64496 DOC-NET
+`
+	m, err := loadASNPrefixes(strings.NewReader(rib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setASNPrefixes(m)
+	defer closeASNDB()
+	tests := []struct {
+		ip  string
+		asn uint
+		org string
+	}{
+		{"1.0.0.1", 13335, "CLOUDFLARENET"},
+		{"1.0.1.1", 2519, "VECTANT"},
+		{"8.8.8.8", 15169, ""},
+		{"2001:db8::1", 64496, "DOC-NET"},
+		{"9.9.9.9", 0, ""},
+		{"192.168.1.1", 0, ""},
+	}
+	for _, tc := range tests {
+		if asn, org := GetASN(tc.ip); asn != tc.asn || org != tc.org {
+			t.Errorf("GetASN(%s)=%d,%s", tc.ip, asn, org)
+		}
+	}
+	// 最大数を超えたらキャッシュをクリアする
+	asnMapCount.Store(asnMapMax)
+	GetASN("1.0.0.2")
+	if _, ok := asnMap.Load("1.0.0.1"); ok || asnMapCount.Load() != 0 {
+		t.Errorf("asn cache not cleared count=%d", asnMapCount.Load())
+	}
+}
+
+func TestThreatFeed(t *testing.T) {
+	feeds := []struct {
+		f    *ThreatFeedEnt
+		data string
+		n    int
+	}{
+		{&ThreatFeedEnt{ID: "t", Name: "text"}, "# comment\n203.0.113.5\n198.51.100.0/24 c2\nevil.example.com\n", 3},
+		{&ThreatFeedEnt{ID: "c", Name: "csv", Format: "csv"}, "type,indicator\nmd5,44d88612fea8a8f36de82e1278abb02f\nurl,http://bad.example.net/x\n", 2},
+		{&ThreatFeedEnt{ID: "s", Name: "stix"}, `{"type":"bundle","objects":[
+{"type":"indicator","pattern_type":"stix","pattern":"[ipv4-addr:value = '192.0.2.66'] OR [domain-name:value = 'stix.example.org']"},
+{"type":"indicator","pattern":"[file:hashes.'SHA-256' = 'E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855']"},
+{"type":"ipv4-addr","value":"192.0.2.77"}]}`, 4},
+	}
+	for _, e := range feeds {
+		threatFeeds.Store(e.f.ID, e.f)
+		if n, err := SetThreatFeedData(e.f.ID, []byte(e.data)); err != nil || n != e.n {
+			t.Errorf("SetThreatFeedData(%s)=%d,%v", e.f.Name, n, err)
+		}
+	}
+	defer func() {
+		for _, e := range feeds {
+			threatFeeds.Delete(e.f.ID)
+			threatIndicators.Delete(e.f.ID)
+		}
+	}()
+	if !HasThreatIndicators() {
+		t.Fatal("HasThreatIndicators")
+	}
+	if r := MatchThreatIP("198.51.100.9"); len(r) != 1 || r[0] != "text" {
+		t.Errorf("MatchThreatIP=%v", r)
+	}
+	if r := MatchThreatIP("192.0.2.77"); len(r) != 1 || r[0] != "stix" {
+		t.Errorf("MatchThreatIP=%v", r)
+	}
+	if r := MatchThreatDomain("www.evil.example.com."); len(r) != 1 {
+		t.Errorf("MatchThreatDomain=%v", r)
+	}
+	if r := MatchThreatDomain("bad.example.net"); len(r) != 1 || r[0] != "csv" {
+		t.Errorf("MatchThreatDomain=%v", r)
+	}
+	if r := MatchThreatDomain("example.com"); len(r) != 0 {
+		t.Errorf("MatchThreatDomain=%v", r)
+	}
+	if r := MatchThreatHash("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"); len(r) != 1 {
+		t.Errorf("MatchThreatHash=%v", r)
+	}
+	if v, r := FindThreatIndicator("Accepted password for root from 203.0.113.5 port 22"); v != "203.0.113.5" || len(r) != 1 {
+		t.Errorf("FindThreatIndicator=%s,%v", v, r)
+	}
+	if v, r := FindThreatIndicator("connect to stix.example.org:443 failed"); v != "stix.example.org" || len(r) != 1 {
+		t.Errorf("FindThreatIndicator=%s,%v", v, r)
+	}
+	if _, r := FindThreatIndicator("normal message from 10.0.0.1"); len(r) != 0 {
+		t.Errorf("FindThreatIndicator=%v", r)
+	}
+	// 読み込みの状態は元のフィードを変更せずに記録する
+	SetThreatFeedError("t", fmt.Errorf("timeout"))
+	if f := GetThreatFeed("t"); f == feeds[0].f || f.Count != 3 || f.Error != "timeout" || feeds[0].f.Error != "" {
+		t.Errorf("SetThreatFeedError=%+v", f)
+	}
+}
+
+func TestNotifyRule(t *testing.T) {
+	db := &NotifyRuleEnt{ID: "db", Name: "db", NodeFilter: "^db", PollingType: "tcp,ping", Level: "low"}
+	sw := &NotifyRuleEnt{ID: "sw", Name: "sw", EventType: "polling", NodeFilter: "^sw", Level: "warn", Continue: true}
+	all := &NotifyRuleEnt{ID: "all", Name: "all", NodeFilter: "^sw", Level: "high"}
+	setNotifyRules([]*NotifyRuleEnt{db, sw, all})
+	defer setNotifyRules([]*NotifyRuleEnt{})
+	tests := []struct {
+		l     EventLogEnt
+		rules string
+		def   bool
+	}{
+		{EventLogEnt{Type: "polling", Level: "low", NodeName: "db1", Event: "ポーリング状態変化:PING監視(ping):normal"}, "db", false},
+		{EventLogEnt{Type: "polling", Level: "warn", NodeName: "db1", Event: "ポーリング状態変化:PING監視(ping):normal"}, "", true},
+		{EventLogEnt{Type: "polling", Level: "repair", NodeName: "db1", Event: "ポーリング状態変化:HTTP(http):high"}, "", true},
+		{EventLogEnt{Type: "polling", Level: "repair", NodeName: "db1", Event: "ポーリング状態変化:TCP(tcp):high"}, "db", false},
+		{EventLogEnt{Type: "polling", Level: "high", NodeName: "sw1", Event: "ポーリング状態変化:PING監視(ping):normal"}, "sw,all", false},
+		{EventLogEnt{Type: "polling", Level: "warn", NodeName: "sw1", Event: "ポーリング状態変化:PING監視(ping):normal"}, "sw", false},
+		{EventLogEnt{Type: "system", Level: "high", NodeName: "sw1", Event: "test"}, "all", false},
+	}
+	for i, tc := range tests {
+		rules, def := GetNotifyRoutes(&tc.l)
+		ids := []string{}
+		for _, r := range rules {
+			ids = append(ids, r.ID)
+		}
+		if strings.Join(ids, ",") != tc.rules || def != tc.def {
+			t.Errorf("GetNotifyRoutes %d rules=%v default=%v", i, ids, def)
+		}
+	}
+}
+
+func TestFlowTopN(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		e := &FlowTopNEnt{
+			Time: now.Add(time.Duration(i-3) * time.Minute).UnixNano(),
+			Stats: map[string]*FlowTopNStats{
+				"": {Bytes: 300, Flows: 3,
+					Src: []*FlowTopNItem{{Key: "192.168.1.1", Bytes: 200, Flows: 2}, {Key: "192.168.1.2", Bytes: 100, Flows: 1}}},
+				"10.0.0.1:2": {Bytes: 100, Flows: 1,
+					Src: []*FlowTopNItem{{Key: "192.168.1.2", Bytes: 100, Flows: 1}}},
+			},
+		}
+		if err := SaveFlowTopN(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 最初の1分を除く
+	r, err := GetFlowTopN(now.Add(-2*time.Minute).UnixNano(), now.UnixNano(), "", "src", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Hour || r.Bytes != 600 || len(r.Items) != 1 || r.Items[0].Key != "192.168.1.1" || r.Items[0].Bytes != 400 {
+		t.Errorf("flow topN=%+v items=%+v", r, r.Items)
+	}
+	r, _ = GetFlowTopN(now.Add(-time.Hour).UnixNano(), now.UnixNano(), "10.0.0.1:2", "src", 10)
+	if r.Bytes != 300 || len(r.Items) != 1 || r.Items[0].Flows != 3 {
+		t.Errorf("flow topN iface=%+v", r)
+	}
+	if _, err := GetFlowTopN(0, now.UnixNano(), "", "bad", 10); err == nil {
+		t.Error("flow topN invalid dim")
+	}
+	if m := GetFlowInterfaceBytes(now.Add(-time.Hour).UnixNano(), now.UnixNano()); len(m) != 1 || m["10.0.0.1:2"] != 300 {
+		t.Errorf("flow interface bytes=%v", m)
+	}
+	n := &NodeEnt{Name: "router", IP: "10.0.0.1"}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPolling(&PollingEnt{Name: "port", NodeID: n.ID, Type: "snmp", Mode: "ifOperStatus", Filter: "2:Gi0/2", Params: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if fi := GetFlowInterface("10.0.0.1:2"); fi.NodeID != n.ID || fi.IfIndex != 2 || fi.IfName != "Gi0/2" {
+		t.Errorf("flow interface=%+v", fi)
+	}
+	UpdateIfPortTable(n.ID, &[]IfPortEnt{{IfIndex: 2, Name: "GigabitEthernet0/2"}})
+	if fi := GetFlowInterface("10.0.0.1:2"); fi.IfName != "GigabitEthernet0/2" {
+		t.Errorf("flow interface from ifPort=%+v", fi)
+	}
+	// 1時間ごとの集計の場合も保存前の現在の時間を含む
+	ht := time.Now().Truncate(time.Hour)
+	SaveFlowTopN(&FlowTopNEnt{Time: ht.Add(-time.Hour).UnixNano(), Hour: true, Stats: map[string]*FlowTopNStats{
+		"10.0.0.9:1": {Bytes: 1000, Flows: 1, Src: []*FlowTopNItem{{Key: "192.168.9.1", Bytes: 1000, Flows: 1}}},
+	}})
+	SaveFlowTopN(&FlowTopNEnt{Time: ht.UnixNano(), Stats: map[string]*FlowTopNStats{
+		"10.0.0.9:1": {Bytes: 10, Flows: 1, Src: []*FlowTopNItem{{Key: "192.168.9.2", Bytes: 10, Flows: 1}}},
+	}})
+	r, _ = GetFlowTopN(ht.AddDate(0, 0, -3).UnixNano(), time.Now().Add(time.Minute).UnixNano(), "10.0.0.9:1", "src", 10)
+	if !r.Hour || r.Bytes != 1010 || len(r.Items) != 2 {
+		t.Errorf("flow topN hour with current=%+v", r)
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	if p := Percentile([]float64{5, 1, 4, 2, 3}, 95); p != 5 {
+		t.Errorf("Percentile=%f", p)
+	}
+	if a, b, ok := LinearRegression([]float64{0, 1, 2}, []float64{1, 3, 5}); !ok || a != 1 || b != 2 {
+		t.Errorf("LinearRegression=%f,%f,%v", a, b, ok)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	n := &NodeEnt{Name: "router", IP: "10.0.0.1"}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	p := &PollingEnt{Name: "traffic", NodeID: n.ID, Type: "snmp", Mode: "traffic", Params: "2"}
+	if err := AddPolling(p); err != nil {
+		t.Fatal(err)
+	}
+	UpdateIfPortTable(n.ID, &[]IfPortEnt{{IfIndex: 2, Name: "Gi0/2", Speed: 1000 * 1000 * 1000}})
+	// 10日前から1日5%ずつ増加(10%から55%)
+	now := time.Now()
+	list := []*PollingLogEnt{}
+	for d := 0; d < 10; d++ {
+		util := 10.0 + float64(d)*5.0
+		for h := 0; h < 4; h++ {
+			list = append(list, &PollingLogEnt{
+				Time:      now.Add(time.Duration(d-10)*24*time.Hour + time.Duration(h)*time.Hour + 30*time.Minute).UnixNano(),
+				PollingID: p.ID,
+				Result:    map[string]interface{}{"bps": util * 1000 * 1000 * 1000 / 8 / 100, "obps": 0.0},
+			})
+		}
+	}
+	savePollingLogList(list)
+	r := GetCapacityReport(30)
+	if len(r) != 1 {
+		t.Fatalf("capacity report len=%d", len(r))
+	}
+	e := r[0]
+	if e.IfName != "Gi0/2" || e.Samples != 40 || e.PeakUtil < 54.9 || e.PeakUtil > 55.1 || e.P95Util < 54.9 {
+		t.Errorf("capacity=%+v", e)
+	}
+	if e.Trend < 4.9 || e.Trend > 5.1 || e.DaysTo80 < 3 || e.DaysTo80 > 6 || e.ForecastTime <= now.UnixNano() {
+		t.Errorf("capacity forecast=%+v", e)
+	}
+	if r2 := GetCapacityReport(30); len(r2) != 1 || r2[0] != e {
+		t.Error("capacity report not cached")
+	}
+	for _, c := range []struct {
+		p   *PollingEnt
+		idx int
+	}{
+		{&PollingEnt{Type: "snmp", Params: "12"}, 12},
+		{&PollingEnt{Type: "snmp", Params: "3:Gi0/3"}, 3},
+		{&PollingEnt{Type: "snmp", Params: "", Name: "SNMP通信量測定 : Gi0/5(5)"}, 5},
+		{&PollingEnt{Type: "sflow", Params: "10.0.0.1:7"}, 7},
+		{&PollingEnt{Type: "sflow", Params: "8"}, 8},
+	} {
+		if i := getCapacityIfIndex(c.p); i != c.idx {
+			t.Errorf("capacity if index %+v=%d", c.p, i)
+		}
+	}
+}
+
+func TestSLAReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	Yasumi = "2025-9-15,敬老の日\n2025-9-23,秋分の日\n"
+	n := &NodeEnt{Name: "server", IP: "10.0.0.2", Group: "tokyo/dc1"}
+	if err := AddNode(n); err != nil {
+		t.Fatal(err)
+	}
+	p := &PollingEnt{Name: "ping", NodeID: n.ID, Type: "ping", LogMode: LogModeOnChange}
+	if err := AddPolling(p); err != nil {
+		t.Fatal(err)
+	}
+	at := func(d, h, m int) int64 {
+		return time.Date(2025, 9, d, h, m, 0, 0, time.Local).UnixNano()
+	}
+	savePollingLogList([]*PollingLogEnt{
+		{Time: time.Date(2025, 8, 31, 12, 0, 0, 0, time.Local).UnixNano(), PollingID: p.ID, State: "normal"},
+		{Time: at(10, 10, 0), PollingID: p.ID, State: "high"},
+		{Time: at(10, 11, 0), PollingID: p.ID, State: "repair"},
+		{Time: at(20, 0, 0), PollingID: p.ID, State: "low"},
+		{Time: at(20, 0, 30), PollingID: p.ID, State: "normal"},
+	})
+	s := &SLAEnt{
+		Name:     "server",
+		Scope:    "group",
+		TargetID: "tokyo",
+		Target:   99.9,
+		Maintenance: []SLAMaintenanceEnt{
+			{Start: at(20, 0, 0), End: at(20, 1, 0), Descr: "update"},
+		},
+	}
+	if err := UpdateSLA(s); err != nil {
+		t.Fatal(err)
+	}
+	month := time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local)
+	r, err := GetSLAReport(s.ID, month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Pollings) != 1 || r.ServiceMin != 30*24*60-60 || r.MaintenanceMin != 60 ||
+		r.DownMin != 60 || r.Failures != 1 || r.MTTR != 60 || r.Met {
+		t.Errorf("sla report=%+v", r)
+	}
+	if r.Availability < 99.86 || r.Availability > 99.87 || len(r.Outages) != 1 || r.Outages[0].Start != at(10, 10, 0) {
+		t.Errorf("sla availability=%f outages=%v", r.Availability, r.Outages)
+	}
+	// 平日9時から18時で休日を除く
+	s.BusinessHours = true
+	s.StartTime = "09:00"
+	s.EndTime = "18:00"
+	s.ExcludeHolidays = true
+	s.Target = 99.0
+	if err := UpdateSLA(s); err != nil {
+		t.Fatal(err)
+	}
+	r, err = GetSLAReport(s.ID, month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ServiceMin != 20*9*60 || r.DownMin != 60 || r.MaintenanceMin != 0 || !r.Met {
+		t.Errorf("sla business hours report=%+v", r)
+	}
+	// 送信済みの月は画面からの更新で変更しない
+	lr := GetSLA(s.ID).LastReport
+	if err := UpdateSLA(&SLAEnt{ID: s.ID, Name: s.Name, Scope: s.Scope, TargetID: s.TargetID, Target: s.Target, LastReport: "2099-01"}); err != nil || GetSLA(s.ID).LastReport != lr {
+		t.Errorf("sla last report=%s err=%v", GetSLA(s.ID).LastReport, err)
+	}
+	if err := DeleteSLA(s.ID); err != nil || GetSLA(s.ID) != nil {
+		t.Errorf("delete sla err=%v", err)
+	}
+}
+
+func TestReportDef(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	statikFS := http.Dir("../")
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	wg := &sync.WaitGroup{}
+	Init(ctx, td, statikFS, wg)
+	defer cancel()
+	if err := UpdateReportDef(&ReportDefEnt{Name: "bad", Schedule: "hourly"}); err == nil {
+		t.Error("invalid schedule accepted")
+	}
+	if err := UpdateReportDef(&ReportDefEnt{Name: "bad", Schedule: "daily", Sections: []string{"unknown"}}); err == nil {
+		t.Error("invalid section accepted")
+	}
+	d := &ReportDefEnt{Name: "monthly", Schedule: "monthly", Day: 31, Hour: 8, Sections: []string{"map", "sla"}}
+	if err := UpdateReportDef(d); err != nil {
+		t.Fatal(err)
+	}
+	w := &ReportDefEnt{Name: "weekly", Schedule: "weekly", Weekday: int(time.Monday), Hour: 9}
+	if err := UpdateReportDef(w); err != nil {
+		t.Fatal(err)
+	}
+	if l := GetReportDefs(); len(l) != 2 || l[0].Name != "monthly" {
+		t.Errorf("GetReportDefs=%v", l)
+	}
+	// 2025/9/30は火曜日で9月の月末
+	now := time.Date(2025, 9, 30, 8, 30, 0, 0, time.Local)
+	if !IsReportDefDue(d, now) {
+		t.Error("monthly report not due at end of month")
+	}
+	if IsReportDefDue(d, now.Add(-time.Hour)) {
+		t.Error("monthly report due before hour")
+	}
+	if IsReportDefDue(w, now) || !IsReportDefDue(w, now.AddDate(0, 0, -1).Add(time.Hour)) {
+		t.Error("weekly report schedule mismatch")
+	}
+	if err := SetReportDefLastSend(d.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if IsReportDefDue(d, now.Add(time.Hour)) {
+		t.Error("monthly report due twice a day")
+	}
+	// 停止中に送信できなかった週次のレポートは次の日に送信する
+	if err := SetReportDefLastSend(w.ID, time.Date(2025, 9, 22, 9, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	if w = GetReportDef(w.ID); !IsReportDefDue(w, now) {
+		t.Error("missed weekly report not due")
+	}
+	if err := SetReportDefLastSend(w.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if w = GetReportDef(w.ID); IsReportDefDue(w, now.Add(time.Hour)) {
+		t.Error("missed weekly report due twice")
+	}
+	if GetReportDefWindow(w, now) != 7*24*time.Hour {
+		t.Errorf("weekly window=%v", GetReportDefWindow(w, now))
+	}
+	if GetReportDefWindow(d, now) != 31*24*time.Hour {
+		t.Errorf("monthly window=%v", GetReportDefWindow(d, now))
+	}
+	if err := DeleteReportDef(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	if GetReportDef(w.ID) != nil {
+		t.Error("report def not deleted")
+	}
+}
+
+func TestSFlowIfCounter(t *testing.T) {
+	UpdateSFlowIfCounter(&SFlowIfCounterEnt{Agent: "192.0.2.1", Index: 2, InOctets: 100, Time: 1})
+	defer sflowIfMap.Delete(getSFlowIfKey("192.0.2.1", 2))
+	if l := GetSFlowIfIndexes("192.0.2.1"); len(l) != 1 || l[0] != 2 {
+		t.Errorf("sflow if indexes=%v", l)
+	}
+	ForEachUncheckedSFlowIf(func(agent string, index int) bool {
+		// 確認中に新しいサンプルを受信する
+		UpdateSFlowIfCounter(&SFlowIfCounterEnt{Agent: agent, Index: index, InOctets: 200, Time: 2})
+		return true
+	})
+	prev, last := GetSFlowIfCounter("192.0.2.1", 2)
+	if prev == nil || last == nil || prev.InOctets != 100 || last.InOctets != 200 {
+		t.Errorf("sflow sample overwritten prev=%+v last=%+v", prev, last)
+	}
+	n := 0
+	ForEachUncheckedSFlowIf(func(agent string, index int) bool {
+		n++
+		return true
+	})
+	UpdateSFlowIfCounter(&SFlowIfCounterEnt{Agent: "192.0.2.1", Index: 2, InOctets: 300, Time: 3})
+	ForEachUncheckedSFlowIf(func(agent string, index int) bool {
+		n++
+		return true
+	})
+	if n != 0 {
+		t.Errorf("checked sflow if called=%d", n)
+	}
+}
@@ -0,0 +1,190 @@
+package datastore
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// FederationSiteEnt : 配下のTWSNMP FCの接続先
+type FederationSiteEnt struct {
+	ID                 string
+	Name               string
+	URL                string
+	User               string
+	Password           string
+	InsecureSkipVerify bool
+	Interval           int    // 取得間隔(秒)
+	ForwardLevel       string // 転送するイベントログのレベル "" | all | warn | low | high
+	Disabled           bool
+}
+
+// FederationNodeEnt : 配下のTWSNMP FCのノード(読み取り専用)
+type FederationNodeEnt struct {
+	ID    string
+	Name  string
+	Descr string
+	Icon  string
+	State string
+	IP    string
+	X     int
+	Y     int
+}
+
+// FederationPollingEnt : 配下のTWSNMP FCのポーリング(読み取り専用)
+type FederationPollingEnt struct {
+	ID       string
+	NodeID   string
+	Name     string
+	Type     string
+	Level    string
+	State    string
+	LastTime int64
+}
+
+// FederationAIEnt : 配下のTWSNMP FCのAI分析結果
+type FederationAIEnt struct {
+	ID          string
+	NodeID      string
+	NodeName    string
+	PollingName string
+	Score       float64
+	Count       int
+	LastTime    int64
+}
+
+// FederationMapEnt : 配下のTWSNMP FCから取得したサブマップ
+type FederationMapEnt struct {
+	SiteID     string
+	SiteName   string
+	State      string
+	Error      string
+	UpdateTime int64
+	High       int
+	Low        int
+	Warn       int
+	Normal     int
+	Repair     int
+	Unknown    int
+	Nodes      []*FederationNodeEnt
+	Pollings   []*FederationPollingEnt
+	AIList     []*FederationAIEnt
+}
+
+var federationSites sync.Map
+var federationMaps sync.Map
+
+func loadFederationSites() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("federation"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s FederationSiteEnt
+			if err := json.Unmarshal(v, &s); err == nil {
+				s.Password = decryptSecret(s.Password)
+				federationSites.Store(s.ID, &s)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdateFederationSite : 配下のTWSNMP FCの接続先を追加または更新する
+func UpdateFederationSite(s *FederationSiteEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if s.URL == "" {
+		return ErrInvalidParams
+	}
+	if s.ID == "" {
+		for {
+			s.ID = makeKey()
+			if _, ok := federationSites.Load(s.ID); !ok {
+				break
+			}
+		}
+	} else if _, ok := federationSites.Load(s.ID); !ok {
+		return ErrInvalidID
+	}
+	if s.Interval < 60 {
+		s.Interval = 60
+	}
+	es := *s
+	es.Password = encryptSecret(s.Password)
+	j, err := json.Marshal(&es)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("federation"))
+		return b.Put([]byte(s.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	federationSites.Store(s.ID, s)
+	log.Printf("UpdateFederationSite name=%s dur=%v", s.Name, time.Since(st))
+	return nil
+}
+
+// DeleteFederationSite : 配下のTWSNMP FCの接続先を削除する
+func DeleteFederationSite(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := federationSites.Load(id); !ok {
+		return ErrInvalidID
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("federation"))
+		return b.Delete([]byte(id))
+	})
+	federationSites.Delete(id)
+	federationMaps.Delete(id)
+	return err
+}
+
+// GetFederationSite : IDで配下のTWSNMP FCの接続先を取得する
+func GetFederationSite(id string) *FederationSiteEnt {
+	if v, ok := federationSites.Load(id); ok {
+		return v.(*FederationSiteEnt)
+	}
+	return nil
+}
+
+// GetFederationSites : 配下のTWSNMP FCの接続先を名前順に取得する
+func GetFederationSites() []*FederationSiteEnt {
+	ret := []*FederationSiteEnt{}
+	federationSites.Range(func(_, v any) bool {
+		ret = append(ret, v.(*FederationSiteEnt))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// SetFederationMap : 配下のTWSNMP FCから取得したサブマップを保存する(メモリのみ)
+func SetFederationMap(m *FederationMapEnt) {
+	federationMaps.Store(m.SiteID, m)
+}
+
+// GetFederationMap : 配下のTWSNMP FCのサブマップを取得する
+func GetFederationMap(id string) *FederationMapEnt {
+	if v, ok := federationMaps.Load(id); ok {
+		return v.(*FederationMapEnt)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// FlowTopNItem : フローの上位N件の項目
+type FlowTopNItem struct {
+	Key     string
+	Bytes   int64
+	Packets int64
+	Flows   int64
+}
+
+// FlowTopNStats : 期間内のフローの集計(項目別の上位N件)
+type FlowTopNStats struct {
+	Bytes    int64
+	Packets  int64
+	Flows    int64
+	InBytes  int64 // インタフェースの受信(ingress)
+	OutBytes int64 // インタフェースの送信(egress)
+	Src      []*FlowTopNItem
+	Dst      []*FlowTopNItem
+	Service  []*FlowTopNItem
+	AS       []*FlowTopNItem
+	If       []*FlowTopNItem // 全体の集計の場合だけ
+}
+
+// FlowTopNEnt : 1分または1時間ごとのフローの集計
+// Statsのキーはインタフェース(エクスポーターのIP:ifIndex)、空欄は全体
+type FlowTopNEnt struct {
+	Time  int64
+	Hour  bool
+	Stats map[string]*FlowTopNStats
+}
+
+// FlowTopNSize : 期間ごとに保存する上位の件数
+var FlowTopNSize = 20
+
+// FlowTopNMinuteDays : 1分ごとの集計を保存する日数
+var FlowTopNMinuteDays = 2
+
+func flowTopNBucket(hour bool) string {
+	if hour {
+		return "flowTopNHour"
+	}
+	return "flowTopNMin"
+}
+
+// SaveFlowTopN : フローの集計を保存する
+func SaveFlowTopN(e *FlowTopNEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	j, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(flowTopNBucket(e.Hour)))
+		if b == nil {
+			return fmt.Errorf("bucket flowTopN not found")
+		}
+		return b.Put([]byte(fmt.Sprintf("%016x", e.Time)), j)
+	})
+}
+
+// ForEachFlowTopN : 期間内のフローの集計を順番に処理する
+func ForEachFlowTopN(hour bool, st, et int64, f func(*FlowTopNEnt) bool) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(flowTopNBucket(hour)))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		sk := fmt.Sprintf("%016x", st)
+		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
+			var e FlowTopNEnt
+			if err := json.Unmarshal(v, &e); err != nil {
+				continue
+			}
+			if e.Time >= et {
+				break
+			}
+			if !f(&e) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// FlowTopNResultEnt : フローの上位N件の検索結果
+type FlowTopNResultEnt struct {
+	Start    int64
+	End      int64
+	Hour     bool
+	Bytes    int64
+	Packets  int64
+	Flows    int64
+	InBytes  int64
+	OutBytes int64
+	Items    []*FlowTopNItem
+}
+
+// GetFlowTopN : 期間内のインタフェースの項目別(src,dst,service,as,if)の上位N件
+// 1分ごとの集計がない古い期間は1時間ごとの集計を使う
+func GetFlowTopN(st, et int64, iface, dim string, n int) (*FlowTopNResultEnt, error) {
+	switch dim {
+	case "src", "dst", "service", "as", "if":
+	default:
+		return nil, ErrInvalidParams
+	}
+	if n < 1 {
+		n = 10
+	}
+	r := &FlowTopNResultEnt{Start: st, End: et, Items: []*FlowTopNItem{}}
+	r.Hour = st < time.Now().AddDate(0, 0, -FlowTopNMinuteDays).UnixNano()
+	if r.Hour {
+		// 時間単位に合わせる
+		st = time.Unix(0, st).Truncate(time.Hour).UnixNano()
+	}
+	m := make(map[string]*FlowTopNItem)
+	f := func(e *FlowTopNEnt) bool {
+		s, ok := e.Stats[iface]
+		if !ok {
+			return true
+		}
+		r.Bytes += s.Bytes
+		r.Packets += s.Packets
+		r.Flows += s.Flows
+		r.InBytes += s.InBytes
+		r.OutBytes += s.OutBytes
+		for _, i := range s.getItems(dim) {
+			if t, ok := m[i.Key]; ok {
+				t.Bytes += i.Bytes
+				t.Packets += i.Packets
+				t.Flows += i.Flows
+			} else {
+				c := *i
+				m[i.Key] = &c
+			}
+		}
+		return true
+	}
+	if r.Hour {
+		// 集計中の時間は1分ごとの集計を使う
+		ht := time.Now().Truncate(time.Hour).UnixNano()
+		if err := ForEachFlowTopN(true, st, min(et, ht), f); err != nil {
+			return nil, err
+		}
+		if et > ht {
+			if err := ForEachFlowTopN(false, ht, et, f); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := ForEachFlowTopN(false, st, et, f); err != nil {
+		return nil, err
+	}
+	for _, i := range m {
+		r.Items = append(r.Items, i)
+	}
+	SortFlowTopNItems(r.Items)
+	if len(r.Items) > n {
+		r.Items = r.Items[:n]
+	}
+	return r, nil
+}
+
+func (s *FlowTopNStats) getItems(dim string) []*FlowTopNItem {
+	switch dim {
+	case "src":
+		return s.Src
+	case "dst":
+		return s.Dst
+	case "service":
+		return s.Service
+	case "as":
+		return s.AS
+	case "if":
+		return s.If
+	}
+	return nil
+}
+
+// SortFlowTopNItems : バイト数の多い順に並べる
+func SortFlowTopNItems(l []*FlowTopNItem) {
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Bytes != l[j].Bytes {
+			return l[i].Bytes > l[j].Bytes
+		}
+		return l[i].Key < l[j].Key
+	})
+}
+
+// DeleteOldFlowTopN : 保存期間を過ぎたフローの集計を削除する
+func DeleteOldFlowTopN() {
+	if db == nil {
+		return
+	}
+	st := time.Now()
+	_, m := deleteOldLog(flowTopNBucket(false), FlowTopNMinuteDays)
+	days := MapConf.LogDays
+	if days < 1 {
+		days = 14
+	}
+	_, h := deleteOldLog(flowTopNBucket(true), days)
+	if m+h > 0 {
+		log.Printf("DeleteOldFlowTopN min=%d hour=%d dur=%v", m, h, time.Since(st))
+	}
+}
+
+// GetFlowInterfaceBytes : 期間内のインタフェースごとのフローのバイト数
+func GetFlowInterfaceBytes(st, et int64) map[string]int64 {
+	m := make(map[string]int64)
+	hour := st < time.Now().AddDate(0, 0, -FlowTopNMinuteDays).UnixNano()
+	ForEachFlowTopN(hour, st, et, func(e *FlowTopNEnt) bool {
+		for k, s := range e.Stats {
+			if k != "" {
+				m[k] += s.Bytes
+			}
+		}
+		return true
+	})
+	return m
+}
+
+// FlowInterfaceEnt : フローのインタフェース(エクスポーターのIP:ifIndex)に対応するノードとポート
+type FlowInterfaceEnt struct {
+	Key      string
+	NodeID   string
+	NodeName string
+	IfIndex  int
+	IfName   string
+}
+
+// GetFlowInterface : エクスポーターのIP:ifIndexからノードとポートの名前を調べる
+// ポートの名前はインタフェースのレポートかifOperStatusのポーリングから取得する
+func GetFlowInterface(key string) *FlowInterfaceEnt {
+	r := &FlowInterfaceEnt{Key: key}
+	i := strings.LastIndex(key, ":")
+	if i < 1 {
+		return r
+	}
+	r.IfIndex, _ = strconv.Atoi(key[i+1:])
+	n := FindNodeFromIP(key[:i])
+	if n == nil {
+		return r
+	}
+	r.NodeID = n.ID
+	r.NodeName = n.Name
+	if l := GetIfPortTable(n.ID); l != nil {
+		for _, e := range *l {
+			if e.IfIndex == r.IfIndex {
+				r.IfName = e.Name
+				return r
+			}
+		}
+	}
+	prefix := fmt.Sprintf("%d:", r.IfIndex)
+	ForEachPollings(func(p *PollingEnt) bool {
+		if p.NodeID == n.ID && p.Type == "snmp" && p.Mode == "ifOperStatus" && strings.HasPrefix(p.Filter, prefix) {
+			r.IfName = strings.TrimPrefix(p.Filter, prefix)
+			return false
+		}
+		return true
+	})
+	return r
+}
@@ -131,100 +131,142 @@ func ForEachLastLog(t string, f func(*LogEnt) bool) error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
+	if IsLogPartType(t) {
+		cont, err := forEachLogPart(0, time.Now().AddDate(1, 0, 0).UnixNano(), true, t, func(b *bbolt.Bucket) bool {
+			return forEachLastLogInBucket(b, f)
+		})
+		if err != nil || !cont {
+			return err
+		}
+	}
 	return db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(t))
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		for k, v := c.Last(); k != nil; k, v = c.Prev() {
-			if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
-				v = deCompressLog(v)
-			}
-			var e LogEnt
-			err := json.Unmarshal(v, &e)
-			if err != nil {
-				continue
-			}
-			if !f(&e) {
-				break
-			}
-		}
+		forEachLastLogInBucket(b, f)
 		return nil
 	})
 }
 
+func forEachLastLogInBucket(b *bbolt.Bucket, f func(*LogEnt) bool) bool {
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
+			v = deCompressLog(v)
+		}
+		var e LogEnt
+		err := json.Unmarshal(v, &e)
+		if err != nil {
+			continue
+		}
+		if !f(&e) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachLog : 期間内のログを古い順に処理する。
+// 日毎のパーティションに保存するログは、移行前の古いバケットの後にパーティションを順番に検索する。
 func ForEachLog(st, et int64, t string, f func(*LogEnt) bool) error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
-	sk := fmt.Sprintf("%016x", st)
-	return db.View(func(tx *bbolt.Tx) error {
+	cont := true
+	err := db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(t))
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
-			if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
-				v = deCompressLog(v)
-			}
-			var e LogEnt
-			err := json.Unmarshal(v, &e)
-			if err != nil {
-				log.Printf("ForEachLog v=%s err=%v", v, err)
-				continue
-			}
-			if e.Time < st || e.Time > et {
-				break
-			}
-			if !f(&e) {
-				break
-			}
-		}
+		cont = forEachLogInBucket(b, st, et, f)
 		return nil
 	})
+	if err != nil || !cont || !IsLogPartType(t) {
+		return err
+	}
+	_, err = forEachLogPart(st, et, false, t, func(b *bbolt.Bucket) bool {
+		return forEachLogInBucket(b, st, et, f)
+	})
+	return err
 }
 
+func forEachLogInBucket(b *bbolt.Bucket, st, et int64, f func(*LogEnt) bool) bool {
+	sk := fmt.Sprintf("%016x", st)
+	c := b.Cursor()
+	for k, v := c.Seek([]byte(sk)); k != nil; k, v = c.Next() {
+		if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
+			v = deCompressLog(v)
+		}
+		var e LogEnt
+		err := json.Unmarshal(v, &e)
+		if err != nil {
+			log.Printf("ForEachLog v=%s err=%v", v, err)
+			continue
+		}
+		if e.Time < st || e.Time > et {
+			break
+		}
+		if !f(&e) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachLogReverse : 期間内のログを新しい順に処理する。
 func ForEachLogReverse(st, et int64, t string, f func(*LogEnt) bool) error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
-	ek := fmt.Sprintf("%016x", et)
+	if IsLogPartType(t) {
+		cont, err := forEachLogPart(st, et, true, t, func(b *bbolt.Bucket) bool {
+			return forEachLogInBucketReverse(b, st, et, f)
+		})
+		if err != nil || !cont {
+			return err
+		}
+	}
 	return db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(t))
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		k, v := c.Seek([]byte(ek))
-		// et (ek) より後ろにいる、または末尾に達した場合は一歩手前へ
-		if k == nil {
-			k, v = c.Last()
-		} else if string(k) > ek {
-			k, v = c.Prev()
-		}
-		for ; k != nil; k, v = c.Prev() {
-			if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
-				v = deCompressLog(v)
-			}
-			var e LogEnt
-			err := json.Unmarshal(v, &e)
-			if err != nil {
-				log.Printf("ForEachLog v=%s err=%v", v, err)
-				continue
-			}
-			if e.Time < st || e.Time > et {
-				break
-			}
-			if !f(&e) {
-				break
-			}
-		}
+		forEachLogInBucketReverse(b, st, et, f)
 		return nil
 	})
 }
 
+func forEachLogInBucketReverse(b *bbolt.Bucket, st, et int64, f func(*LogEnt) bool) bool {
+	ek := fmt.Sprintf("%016x", et)
+	c := b.Cursor()
+	k, v := c.Seek([]byte(ek))
+	// et (ek) より後ろにいる、または末尾に達した場合は一歩手前へ
+	if k == nil {
+		k, v = c.Last()
+	} else if string(k) > ek {
+		k, v = c.Prev()
+	}
+	for ; k != nil; k, v = c.Prev() {
+		if bytes.HasSuffix(v, []byte{0, 0, 255, 255}) {
+			v = deCompressLog(v)
+		}
+		var e LogEnt
+		err := json.Unmarshal(v, &e)
+		if err != nil {
+			log.Printf("ForEachLog v=%s err=%v", v, err)
+			continue
+		}
+		if e.Time < st || e.Time > et {
+			break
+		}
+		if !f(&e) {
+			return false
+		}
+	}
+	return true
+}
+
 func deleteOldLog(bucket string, days int) (bool, int) {
 	s := time.Now()
 	done := true
@@ -304,6 +346,11 @@ func deleteOldLogs() {
 	doneMap := make(map[string]bool)
 	doneCount := 0
 	delCount := 0
+	// 日毎のパーティションはファイルごと削除する
+	if c := deleteOldLogParts(getLogPartDir(), MapConf.LogDays); c > 0 {
+		log.Printf("deleteOldLogs delParts=%d", c)
+	}
+	closeIdleLogParts()
 	lt := time.Now().Unix() + 55
 	for doneCount < len(buckets) && lt > time.Now().Unix() {
 		for _, b := range buckets {
@@ -341,6 +388,7 @@ func DeleteAllLogs() {
 			return nil
 		})
 	}
+	deleteAllLogParts()
 	log.Printf("DeleteAllLogs dur=%v", time.Since(st))
 }
 
@@ -356,6 +404,9 @@ func DeleteLogs(b string) {
 				tx.CreateBucketIfNotExists([]byte(b))
 				return nil
 			})
+			if IsLogPartType(b) {
+				deleteLogPartBucket(b)
+			}
 			log.Printf("DeleteLogs bucket=%s dur=%v", b, time.Since(st))
 			return
 		}
@@ -375,6 +426,7 @@ func DeleteArp() {
 			return nil
 		})
 	}
+	deleteLogPartBucket("arplog")
 	log.Printf("DeleteArp dur=%v", time.Since(st))
 }
 
@@ -478,12 +530,29 @@ func savePollingLogList(list []*PollingLogEnt) {
 	log.Printf("save polling log count=%d,dur=%v", len(list), time.Since(st))
 }
 
+// SaveLogBuffer : ログを日毎のパーティションに保存する
 func SaveLogBuffer(logBuffer []*LogEnt) {
 	if db == nil {
 		return
 	}
 	st := time.Now()
-	db.Batch(func(tx *bbolt.Tx) error {
+	dayMap := make(map[string][]*LogEnt)
+	for _, l := range logBuffer {
+		day := logPartDay(l.Time)
+		dayMap[day] = append(dayMap[day], l)
+	}
+	for day, list := range dayMap {
+		d, err := openLogPart(day, true)
+		if err != nil {
+			log.Printf("SaveLogBuffer day=%s err=%v", day, err)
+			continue
+		}
+		saveLogBufferToDB(d, list, st)
+	}
+}
+
+func saveLogBufferToDB(d *bbolt.DB, logBuffer []*LogEnt, st time.Time) {
+	d.Batch(func(tx *bbolt.Tx) error {
 		if time.Since(st) > time.Duration(time.Second) {
 			log.Printf("SaveLogBuffer batch over 1sec dur=%v", time.Since(st))
 		}
@@ -599,9 +668,11 @@ func DeleteOldLogBatch(ds, t string) {
 	}
 	delCount := 0
 	s := time.Now()
+	logPartDir := filepath.Join(ds, logPartDirName)
 	switch t {
 	case "all":
 		delCount += deleteOldPollingLog(MapConf.LogDays)
+		delCount += deleteOldLogParts(logPartDir, MapConf.LogDays)
 		buckets := []string{"logs", "syslog", "trap", "netflow", "ipfix", "sflow", "sflowCounter"}
 		for _, b := range buckets {
 			log.Printf("start delete %s", b)
@@ -619,6 +690,10 @@ func DeleteOldLogBatch(ds, t string) {
 	case "polling":
 		delCount += deleteOldPollingLog(MapConf.LogDays)
 	case "logs", "syslog", "trap", "netflow", "ipfix", "sflow", "sflowCounter":
+		if t != "logs" {
+			// パーティションには他の種類のログもあるので指定した種類だけ削除する
+			delCount += deleteOldLogPartType(logPartDir, t, MapConf.LogDays)
+		}
 		log.Printf("start delete %s log", t)
 		for {
 			done, c := deleteOldLog(t, MapConf.LogDays)
@@ -656,5 +731,5 @@ func ClearAllLogOnDB(ds string) error {
 			return nil
 		})
 	}
-	return nil
+	return os.RemoveAll(filepath.Join(ds, logPartDirName))
 }
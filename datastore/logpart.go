@@ -0,0 +1,352 @@
+package datastore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 日毎のパーティションファイルに保存するログの種類
+var logPartBuckets = []string{"syslog", "trap", "netflow", "ipfix", "arplog", "sflow", "sflowCounter"}
+
+var (
+	muLogParts  sync.Mutex
+	logParts    = make(map[string]*bbolt.DB)
+	logPartUsed = make(map[string]time.Time)
+)
+
+const logPartDirName = "logdb"
+
+// 使われていないパーティションを閉じるまでの時間
+const logPartIdleTimeout = time.Minute * 10
+
+// IsLogPartType : 日毎のパーティションに保存するログの種類か判定する
+func IsLogPartType(t string) bool {
+	for _, b := range logPartBuckets {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+func getLogPartDir() string {
+	return filepath.Join(dspath, logPartDirName)
+}
+
+func getLogPartPath(day string) string {
+	return filepath.Join(getLogPartDir(), day+".db")
+}
+
+// logPartDay : 時刻からパーティションの日付(YYYYMMDD)を求める
+func logPartDay(t int64) string {
+	return time.Unix(0, t).Format("20060102")
+}
+
+// openLogPart : パーティションのDBを開く、createがfalseの場合はファイルがなければnilを返す
+func openLogPart(day string, create bool) (*bbolt.DB, error) {
+	muLogParts.Lock()
+	defer muLogParts.Unlock()
+	if d, ok := logParts[day]; ok {
+		logPartUsed[day] = time.Now()
+		return d, nil
+	}
+	path := getLogPartPath(day)
+	if !create {
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+	} else if err := os.MkdirAll(getLogPartDir(), 0700); err != nil {
+		return nil, err
+	}
+	d, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		err = d.Update(func(tx *bbolt.Tx) error {
+			for _, b := range logPartBuckets {
+				if _, err := tx.CreateBucketIfNotExists([]byte(b)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	logParts[day] = d
+	logPartUsed[day] = time.Now()
+	return d, nil
+}
+
+// getLogPartDays : 保存されているパーティションの日付リストを古い順に返す
+func getLogPartDays() []string {
+	return listLogPartDays(getLogPartDir())
+}
+
+func listLogPartDays(dir string) []string {
+	ret := []string{}
+	dirList, err := os.ReadDir(dir)
+	if err != nil {
+		return ret
+	}
+	for _, d := range dirList {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".db") {
+			continue
+		}
+		day := strings.TrimSuffix(d.Name(), ".db")
+		if _, err := time.Parse("20060102", day); err != nil {
+			continue
+		}
+		ret = append(ret, day)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// forEachLogPart : st,etの期間に該当するパーティションの指定した種類のログを順番に処理する
+// fがfalseを返した場合は途中で終了してfalseを返す
+func forEachLogPart(st, et int64, reverse bool, t string, f func(*bbolt.Bucket) bool) (bool, error) {
+	sd := logPartDay(st)
+	ed := logPartDay(et)
+	days := getLogPartDays()
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	}
+	for _, day := range days {
+		if day < sd || day > ed {
+			continue
+		}
+		d, err := openLogPart(day, false)
+		if err != nil {
+			log.Printf("open log partition day=%s err=%v", day, err)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		cont := true
+		err = d.View(func(tx *bbolt.Tx) error {
+			if b := tx.Bucket([]byte(t)); b != nil {
+				cont = f(b)
+			}
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("log partition day=%s err=%v", day, err)
+		}
+		if !cont {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func closeLogParts() {
+	muLogParts.Lock()
+	defer muLogParts.Unlock()
+	for day, d := range logParts {
+		d.Close()
+		delete(logParts, day)
+		delete(logPartUsed, day)
+	}
+}
+
+// closeIdleLogParts : 当日以外で使われていないパーティションを閉じる
+func closeIdleLogParts() {
+	today := logPartDay(time.Now().UnixNano())
+	muLogParts.Lock()
+	defer muLogParts.Unlock()
+	for day, d := range logParts {
+		if day == today || time.Since(logPartUsed[day]) < logPartIdleTimeout {
+			continue
+		}
+		d.Close()
+		delete(logParts, day)
+		delete(logPartUsed, day)
+	}
+}
+
+// dropLogPart : パーティションのファイルを削除する
+func dropLogPart(dir, day string) error {
+	muLogParts.Lock()
+	defer muLogParts.Unlock()
+	if d, ok := logParts[day]; ok {
+		d.Close()
+		delete(logParts, day)
+		delete(logPartUsed, day)
+	}
+	return os.Remove(filepath.Join(dir, day+".db"))
+}
+
+// deleteOldLogParts : 保存期間を過ぎたパーティションをファイルごと削除する
+func deleteOldLogParts(dir string, days int) int {
+	if days < 1 {
+		return 0
+	}
+	st := time.Now()
+	limit := time.Now().AddDate(0, 0, -days).Format("20060102")
+	delCount := 0
+	for _, day := range listLogPartDays(dir) {
+		if day >= limit {
+			break
+		}
+		if err := dropLogPart(dir, day); err != nil {
+			log.Printf("delete log partition day=%s err=%v", day, err)
+			continue
+		}
+		delCount++
+	}
+	if delCount > 0 {
+		log.Printf("delete old log partitions count=%d dur=%v", delCount, time.Since(st))
+	}
+	return delCount
+}
+
+// deleteOldLogPartType : 保存期間を過ぎたパーティションから指定した種類のログを削除する
+// 他の種類のログがなくなったパーティションはファイルごと削除する
+func deleteOldLogPartType(dir, t string, days int) int {
+	if days < 1 {
+		return 0
+	}
+	st := time.Now()
+	limit := time.Now().AddDate(0, 0, -days).Format("20060102")
+	delCount := 0
+	for _, day := range listLogPartDays(dir) {
+		if day >= limit {
+			break
+		}
+		c, empty, err := deleteLogPartType(dir, day, t)
+		if err != nil {
+			log.Printf("delete log partition day=%s type=%s err=%v", day, t, err)
+			continue
+		}
+		delCount += c
+		if empty {
+			if err := dropLogPart(dir, day); err != nil {
+				log.Printf("delete log partition day=%s err=%v", day, err)
+			}
+		}
+	}
+	if delCount > 0 {
+		log.Printf("delete old %s log in partitions count=%d dur=%v", t, delCount, time.Since(st))
+	}
+	return delCount
+}
+
+// deleteLogPartType : パーティションの指定した種類のログを削除して、ログが残っていないか返す
+func deleteLogPartType(dir, day, t string) (int, bool, error) {
+	muLogParts.Lock()
+	defer muLogParts.Unlock()
+	d, ok := logParts[day]
+	if !ok {
+		var err error
+		d, err = bbolt.Open(filepath.Join(dir, day+".db"), 0600, &bbolt.Options{Timeout: time.Second * 5})
+		if err != nil {
+			return 0, false, err
+		}
+		defer d.Close()
+	}
+	count := 0
+	empty := true
+	err := d.Update(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte(t)); b != nil {
+			count = b.Stats().KeyN
+			if err := tx.DeleteBucket([]byte(t)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(t)); err != nil {
+			return err
+		}
+		for _, n := range logPartBuckets {
+			if b := tx.Bucket([]byte(n)); b != nil && b.Stats().KeyN > 0 {
+				empty = false
+			}
+		}
+		return nil
+	})
+	return count, empty, err
+}
+
+// deleteAllLogParts : 全てのパーティションを削除する
+func deleteAllLogParts() {
+	for _, day := range getLogPartDays() {
+		if err := dropLogPart(getLogPartDir(), day); err != nil {
+			log.Printf("delete log partition day=%s err=%v", day, err)
+		}
+	}
+}
+
+// deleteLogPartBucket : 全てのパーティションから指定した種類のログを削除する
+func deleteLogPartBucket(t string) {
+	for _, day := range getLogPartDays() {
+		d, err := openLogPart(day, false)
+		if err != nil || d == nil {
+			continue
+		}
+		err = d.Batch(func(tx *bbolt.Tx) error {
+			// バケットがない場合も作成する
+			if err := tx.DeleteBucket([]byte(t)); err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+			_, err := tx.CreateBucketIfNotExists([]byte(t))
+			return err
+		})
+		if err != nil {
+			log.Printf("delete log partition bucket day=%s type=%s err=%v", day, t, err)
+		}
+	}
+}
+
+// getLogPartSize : パーティションの合計サイズと数を返す
+func getLogPartSize() (int64, int) {
+	var size int64
+	days := getLogPartDays()
+	for _, day := range days {
+		if fi, err := os.Stat(getLogPartPath(day)); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size, len(days)
+}
+
+// backupLogParts : パーティションをバックアップ先のディレクトリにコピーする
+func backupLogParts(dir string) error {
+	days := getLogPartDays()
+	if len(days) < 1 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, day := range days {
+		if stopBackup {
+			return fmt.Errorf("stop backup")
+		}
+		d, err := openLogPart(day, false)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+		err = d.View(func(tx *bbolt.Tx) error {
+			return tx.CopyFile(filepath.Join(dir, day+".db"), 0600)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
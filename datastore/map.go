@@ -39,6 +39,7 @@ type MapConfEnt struct {
 	Community       string
 	SnmpUser        string
 	SnmpPassword    string
+	CredentialID    string
 	PublicKey       string
 	PrivateKey      string
 	EnableSyslogd   bool
@@ -56,6 +57,7 @@ type MapConfEnt struct {
 	AIThreshold     int
 	AIMode          string
 	GeoIPInfo       string
+	ASNInfo         string
 	FontSize        int
 	AutoCharCode    bool
 	DisableOperLog  bool
@@ -70,6 +72,13 @@ type MapConfEnt struct {
 	LLMAPIKey   string
 	LLMModel    string
 	NodeLock    bool
+	// SNMPポーリング
+	DisableSnmpBatch  bool // 同じノードのポーリングをまとめて取得しない
+	SnmpMaxConcurrent int  // ノード毎の同時実行数 0は既定値(2)
+	SnmpRateLimit     int  // ノード毎の1秒間の最大リクエスト数 0は制限なし
+	// MCPからの一括リモート実行
+	EnableMCPRemoteExec   bool   // 既定は無効
+	MCPRemoteExecCommands string // 許可するSSHコマンドとSNMP SETのオブジェクト名(改行区切り、末尾の*は前方一致)
 }
 
 func initConf() {
@@ -114,6 +123,7 @@ func loadConf() error {
 		if err := json.Unmarshal(v, &MapConf); err != nil {
 			return err
 		}
+		decryptMapConfSecret(&MapConf)
 		v = b.Get([]byte("discoverConf"))
 		if v == nil {
 			return nil
@@ -121,6 +131,8 @@ func loadConf() error {
 		if err := json.Unmarshal(v, &DiscoverConf); err != nil {
 			return err
 		}
+		loadNotifyRules(b)
+		loadTicketConf(b)
 		v = b.Get([]byte("notifyConf"))
 		if v == nil {
 			return nil
@@ -128,6 +140,7 @@ func loadConf() error {
 		if err := json.Unmarshal(v, &NotifyConf); err != nil {
 			return err
 		}
+		decryptNotifyConfSecret(&NotifyConf)
 		v = b.Get([]byte("notifySchedule"))
 		if v != nil {
 			if err := json.Unmarshal(v, &NotifySchedule); err != nil {
@@ -140,6 +153,7 @@ func loadConf() error {
 			if err := json.Unmarshal(v, &Backup); err != nil {
 				log.Printf("load conf err=%v", err)
 			}
+			decryptBackupSecret(&Backup)
 		}
 		v = b.Get([]byte("influxdbConf"))
 		if v != nil {
@@ -289,7 +303,7 @@ func SaveMapConf() error {
 		return ErrDBNotOpen
 	}
 	checkArpWatchRange()
-	s, err := json.Marshal(MapConf)
+	s, err := json.Marshal(encryptMapConfSecret(MapConf))
 	if err != nil {
 		return err
 	}
@@ -605,5 +619,3 @@ func migrateMapSize() {
 		log.Printf("End migrate map size successfully")
 	}
 }
-
-
@@ -34,14 +34,16 @@ type NetworkEnt struct {
 	PortWatch bool
 	HPorts    int
 	SnmpPort  int
-	X         int
-	Y         int
-	W         int
-	H         int
-	SystemID  string
-	Error     string
-	LLDP      bool
-	Ports     []PortEnt
+	// CredentialID : SNMPの認証情報プロファイル
+	CredentialID string
+	X            int
+	Y            int
+	W            int
+	H            int
+	SystemID     string
+	Error        string
+	LLDP         bool
+	Ports        []PortEnt
 }
 
 func AddNetwork(n *NetworkEnt) error {
@@ -56,7 +58,7 @@ func AddNetwork(n *NetworkEnt) error {
 		return ErrDBNotOpen
 	}
 	checkNetwork(n)
-	s, err := json.Marshal(n)
+	s, err := json.Marshal(encryptNetworkSecret(n))
 	if err != nil {
 		return err
 	}
@@ -78,7 +80,7 @@ func UpdateNetwork(n *NetworkEnt) error {
 		return ErrInvalidID
 	}
 	checkNetwork(n)
-	s, err := json.Marshal(n)
+	s, err := json.Marshal(encryptNetworkSecret(n))
 	if err != nil {
 		return err
 	}
@@ -36,6 +36,10 @@ type NodeEnt struct {
 	AutoAck      bool
 	HPorts       int
 	SnmpPort     int
+	Credentials  map[string]string // 種別毎の認証情報プロファイルID
+	SysObjectID  string
+	Tags         []string
+	Group        string // 階層化したグループ(例 本社/サーバー室)
 }
 
 func loadMapData() error {
@@ -50,6 +54,7 @@ func loadMapData() error {
 		_ = b.ForEach(func(k, v []byte) error {
 			var n NodeEnt
 			if err := json.Unmarshal(v, &n); err == nil {
+				decryptNodeSecret(&n)
 				nodes.Store(n.ID, &n)
 			}
 			return nil
@@ -69,6 +74,7 @@ func loadMapData() error {
 			_ = b.ForEach(func(k, v []byte) error {
 				var n NetworkEnt
 				if err := json.Unmarshal(v, &n); err == nil {
+					decryptNetworkSecret(&n)
 					networks.Store(n.ID, &n)
 				}
 				return nil
@@ -119,7 +125,7 @@ func AddNode(n *NodeEnt) error {
 		}
 	}
 	setIPv6AndMAC(n)
-	s, err := json.Marshal(n)
+	s, err := json.Marshal(encryptNodeSecret(n))
 	if err != nil {
 		return err
 	}
@@ -137,7 +143,7 @@ func UpdateNode(n *NodeEnt) error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
-	s, err := json.Marshal(n)
+	s, err := json.Marshal(encryptNodeSecret(n))
 	if err != nil {
 		return err
 	}
@@ -207,6 +213,8 @@ func DeleteNode(nodeID string) error {
 		return true
 	})
 	DeletePollings(delList)
+	DeleteConfigArchive(nodeID)
+	DeleteComplianceResults(nodeID)
 	log.Printf("DeletNode dur=%v", time.Since(st))
 	return nil
 }
@@ -287,7 +295,7 @@ func saveAllNodes() error {
 		b := tx.Bucket([]byte("nodes"))
 		nodes.Range(func(_, p interface{}) bool {
 			pn := p.(*NodeEnt)
-			s, err := json.Marshal(pn)
+			s, err := json.Marshal(encryptNodeSecret(pn))
 			if err == nil {
 				b.Put([]byte(pn.ID), s)
 			}
@@ -305,7 +313,7 @@ func saveAllNodes() error {
 		b = tx.Bucket([]byte("networks"))
 		networks.Range(func(_, p interface{}) bool {
 			n := p.(*NetworkEnt)
-			s, err := json.Marshal(n)
+			s, err := json.Marshal(encryptNetworkSecret(n))
 			if err == nil {
 				b.Put([]byte(n.ID), s)
 			}
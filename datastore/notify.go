@@ -27,6 +27,8 @@ type NotifyConfEnt struct {
 	Level              string
 	Report             bool
 	ReportLLMSummary   bool
+	ReportPDF          bool // 定期レポートにPDFを添付する
+	ReportCSV          bool // 定期レポートにCSVを添付する
 	CheckUpdate        bool
 	NotifyRepair       bool
 	NotifyLowScore     bool
@@ -36,6 +38,7 @@ type NotifyConfEnt struct {
 	ChatType           string
 	ChatWebhookURL     string
 	ExecCmd            string
+	TagFilter          string // 通知するノードのタグのセレクタ
 	//
 	InsecureCipherSuites bool
 	WebHookNotify        string
@@ -53,7 +56,7 @@ func SaveNotifyConf() error {
 	if db == nil {
 		return ErrDBNotOpen
 	}
-	s, err := json.Marshal(NotifyConf)
+	s, err := json.Marshal(encryptNotifyConfSecret(NotifyConf))
 	if err != nil {
 		return err
 	}
@@ -81,7 +84,7 @@ func SaveNotifyOAuth2Token(token *oauth2.Token) error {
 		if b == nil {
 			return fmt.Errorf("bucket config is nil")
 		}
-		return b.Put([]byte("notifyOAuth2Token"), s)
+		return b.Put([]byte("notifyOAuth2Token"), []byte(encryptSecret(string(s))))
 	})
 }
 
@@ -103,7 +106,7 @@ func loadNotifyOAuth2Token(b *bbolt.Bucket) {
 	v := b.Get([]byte("notifyOAuth2Token"))
 	if v != nil {
 		var t oauth2.Token
-		if err := json.Unmarshal(v, &t); err == nil {
+		if err := json.Unmarshal([]byte(decryptSecret(string(v))), &t); err == nil {
 			notifyOAuth2Token = &t
 		}
 	}
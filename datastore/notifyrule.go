@@ -0,0 +1,202 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// NotifyRuleEnt : 通知の振り分けルール
+type NotifyRuleEnt struct {
+	ID          string
+	Name        string
+	Disabled    bool
+	NodeFilter  string // ノード名の正規表現
+	TagFilter   string // ノードのタグのセレクタ
+	PollingType string // ポーリングの種別(カンマ区切り、いずれか)
+	EventType   string // イベントの種別(カンマ区切り、いずれか)
+	Level       string // 通知するレベル(high,low,warn)
+	Continue    bool   // 一致した後も次のルールを評価する
+	// 通知先
+	MailTo         string
+	ChatWebhookURL string
+	WebHookURL     string
+	ExecCmd        string
+	MqttBroker     string
+	MqttTopic      string
+	MqttUser       string
+	MqttPassword   string
+}
+
+// 通知の振り分けルール(順番に評価する)と正規表現のキャッシュ
+var notifyRules = []*NotifyRuleEnt{}
+var notifyRuleRegexp = make(map[string]*regexp.Regexp)
+var notifyRuleMu sync.RWMutex
+
+// GetNotifyRules : 通知の振り分けルール(順番に評価する)
+// 返したリストは変更しないこと
+func GetNotifyRules() []*NotifyRuleEnt {
+	notifyRuleMu.RLock()
+	defer notifyRuleMu.RUnlock()
+	return notifyRules
+}
+
+func loadNotifyRules(b *bbolt.Bucket) {
+	v := b.Get([]byte("notifyRules"))
+	if v == nil {
+		return
+	}
+	list := []*NotifyRuleEnt{}
+	if err := json.Unmarshal(v, &list); err != nil {
+		log.Printf("load notify rules err=%v", err)
+		return
+	}
+	for _, r := range list {
+		r.MqttPassword = decryptSecret(r.MqttPassword)
+	}
+	setNotifyRules(list)
+}
+
+// SaveNotifyRules : 通知の振り分けルールを入れ替えて保存する
+func SaveNotifyRules(list []*NotifyRuleEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	save := []NotifyRuleEnt{}
+	for _, r := range list {
+		if r.Name == "" || getLevelNum(r.Level) > 2 {
+			return ErrInvalidParams
+		}
+		if r.NodeFilter != "" {
+			if _, err := regexp.Compile(r.NodeFilter); err != nil {
+				return err
+			}
+		}
+		if r.ID == "" {
+			r.ID = makeKey()
+		}
+		e := *r
+		e.MqttPassword = encryptSecret(r.MqttPassword)
+		save = append(save, e)
+	}
+	s, err := json.Marshal(save)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("config"))
+		if b == nil {
+			return fmt.Errorf("bucket config is nil")
+		}
+		return b.Put([]byte("notifyRules"), s)
+	})
+	if err != nil {
+		return err
+	}
+	setNotifyRules(list)
+	log.Printf("SaveNotifyRules len=%d dur=%v", len(list), time.Since(st))
+	return nil
+}
+
+func setNotifyRules(list []*NotifyRuleEnt) {
+	m := make(map[string]*regexp.Regexp)
+	for _, r := range list {
+		if r.NodeFilter != "" {
+			if re, err := regexp.Compile(r.NodeFilter); err == nil {
+				m[r.NodeFilter] = re
+			}
+		}
+	}
+	notifyRuleMu.Lock()
+	notifyRuleRegexp = m
+	notifyRules = list
+	notifyRuleMu.Unlock()
+}
+
+var pollingEventTypePat = regexp.MustCompile(`\(([-a-zA-Z0-9]+)\):[a-z]+$`)
+
+// MatchNotifyRule : イベントログが通知の振り分けルールの条件に一致するか判断する
+// レベルは復帰の場合は復帰前の状態で判断する
+func MatchNotifyRule(r *NotifyRuleEnt, l *EventLogEnt) bool {
+	if r.Disabled {
+		return false
+	}
+	level := l.Level
+	if level == "repair" {
+		a := strings.Split(l.Event, ":")
+		level = a[len(a)-1]
+	}
+	if getLevelNum(level) > getLevelNum(r.Level) {
+		return false
+	}
+	if r.EventType != "" && !matchCommaList(r.EventType, l.Type) {
+		return false
+	}
+	if r.PollingType != "" {
+		if l.Type != "polling" {
+			return false
+		}
+		a := pollingEventTypePat.FindStringSubmatch(l.Event)
+		if len(a) != 2 || !matchCommaList(r.PollingType, a[1]) {
+			return false
+		}
+	}
+	if r.NodeFilter != "" {
+		notifyRuleMu.RLock()
+		re, ok := notifyRuleRegexp[r.NodeFilter]
+		notifyRuleMu.RUnlock()
+		if !ok || !re.MatchString(l.NodeName) {
+			return false
+		}
+	}
+	if r.TagFilter != "" {
+		n := GetNode(l.NodeID)
+		if n == nil || !NodeMatchTagSelector(n, r.TagFilter) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetNotifyRoutes : イベントログを通知するルールのリスト
+// どのルールにも一致しない場合は全体の設定で通知する(defaultがtrue)
+func GetNotifyRoutes(l *EventLogEnt) (rules []*NotifyRuleEnt, def bool) {
+	for _, r := range GetNotifyRules() {
+		if !MatchNotifyRule(r, l) {
+			continue
+		}
+		rules = append(rules, r)
+		if !r.Continue {
+			return rules, false
+		}
+	}
+	return rules, len(rules) < 1
+}
+
+func matchCommaList(list, s string) bool {
+	for _, e := range strings.Split(list, ",") {
+		if strings.TrimSpace(e) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func getLevelNum(l string) int {
+	switch l {
+	case "high":
+		return 0
+	case "low":
+		return 1
+	case "warn":
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// NotifyTemplateEnt : 通知先ごとのメッセージのテンプレート
+type NotifyTemplateEnt struct {
+	ID         string
+	Name       string
+	Dest       string // mail|chat|webhook
+	EventType  string // イベントの種別(カンマ区切り、空欄は全て)
+	Subject    string // メールの件名、チャットのタイトル
+	Body       string // Goのテンプレート(HTMLメールはhtml/template)
+	Disabled   bool
+	UpdateTime int64
+}
+
+var notifyTemplates sync.Map
+
+func loadNotifyTemplates() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("notifyTemplates"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var t NotifyTemplateEnt
+			if err := json.Unmarshal(v, &t); err == nil {
+				notifyTemplates.Store(t.ID, &t)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdateNotifyTemplate : 通知テンプレートを追加または更新する
+func UpdateNotifyTemplate(t *NotifyTemplateEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	switch t.Dest {
+	case "mail", "chat", "webhook":
+	default:
+		return ErrInvalidParams
+	}
+	if t.Name == "" || t.Body == "" {
+		return ErrInvalidParams
+	}
+	if t.ID == "" {
+		t.ID = makeKey()
+	}
+	t.UpdateTime = time.Now().UnixNano()
+	j, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("notifyTemplates"))
+		return b.Put([]byte(t.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	notifyTemplates.Store(t.ID, t)
+	log.Printf("UpdateNotifyTemplate name=%s dur=%v", t.Name, time.Since(st))
+	return nil
+}
+
+// DeleteNotifyTemplate : 通知テンプレートを削除する
+func DeleteNotifyTemplate(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := notifyTemplates.Load(id); !ok {
+		return ErrInvalidID
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("notifyTemplates"))
+		return b.Delete([]byte(id))
+	})
+	notifyTemplates.Delete(id)
+	return err
+}
+
+func GetNotifyTemplate(id string) *NotifyTemplateEnt {
+	if v, ok := notifyTemplates.Load(id); ok {
+		return v.(*NotifyTemplateEnt)
+	}
+	return nil
+}
+
+func ForEachNotifyTemplates(f func(*NotifyTemplateEnt) bool) {
+	notifyTemplates.Range(func(_, v any) bool {
+		return f(v.(*NotifyTemplateEnt))
+	})
+}
+
+// FindNotifyTemplate : 通知先とイベントの種別に合うテンプレートを探す
+// 種別を指定したテンプレートを優先する、なければnil
+func FindNotifyTemplate(dest, eventType string) *NotifyTemplateEnt {
+	var def *NotifyTemplateEnt
+	var ret *NotifyTemplateEnt
+	ForEachNotifyTemplates(func(t *NotifyTemplateEnt) bool {
+		if t.Disabled || t.Dest != dest {
+			return true
+		}
+		if t.EventType == "" {
+			if def == nil || def.Name > t.Name {
+				def = t
+			}
+			return true
+		}
+		if eventType != "" && matchCommaList(t.EventType, eventType) {
+			if ret == nil || ret.Name > t.Name {
+				ret = t
+			}
+		}
+		return true
+	})
+	if ret != nil {
+		return ret
+	}
+	return def
+}
+
+// GetCommonEventType : イベントログの種別が全て同じならその種別
+func GetCommonEventType(list []*EventLogEnt) string {
+	t := ""
+	for i, l := range list {
+		if i == 0 {
+			t = l.Type
+		} else if t != l.Type {
+			return ""
+		}
+	}
+	return strings.TrimSpace(t)
+}
@@ -35,6 +35,8 @@ type PollingEnt struct {
 	MqttURL      string
 	MqttTopic    string
 	MqttCols     string
+	Tags         []string
+	Group        string
 }
 
 type PollingLogEnt struct {
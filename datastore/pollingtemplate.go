@@ -1,41 +1,54 @@
 package datastore
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
 )
 
+// PollingTemplateEnt : ポーリングテンプレート
+// YAMLのキーはJSONと同じ名前にしてエクスポートしたものを同じように取り込めるようにする
 type PollingTemplateEnt struct {
-	ID        string
-	Name      string
-	Level     string
-	Type      string
-	Mode      string
-	Params    string
-	Filter    string
-	Extractor string
-	Script    string
-	Descr     string
-	AutoMode  string
+	ID        string `yaml:"ID"`
+	Name      string `yaml:"Name"`
+	Level     string `yaml:"Level"`
+	Type      string `yaml:"Type"`
+	Mode      string `yaml:"Mode"`
+	Params    string `yaml:"Params"`
+	Filter    string `yaml:"Filter"`
+	Extractor string `yaml:"Extractor"`
+	Script    string `yaml:"Script"`
+	Descr     string `yaml:"Descr"`
+	AutoMode  string `yaml:"AutoMode"`
+	// 自動発見で適用するノードの条件(全て空なら自動適用しない)
+	MatchSysObjectID string `yaml:"MatchSysObjectID"` // sysObjectIDの前方一致(カンマ区切り)
+	MatchService     string `yaml:"MatchService"`     // 発見したサービス(カンマ区切り、いずれか)
+	MatchIcon        string `yaml:"MatchIcon"`        // アイコン(カンマ区切り、いずれか)
+	Custom           bool   `yaml:"Custom"`           // ユーザーが作成したテンプレート
+	Version          int    `yaml:"Version"`
+	UpdateTime       int64  `yaml:"UpdateTime"`
 }
 
-var pollingTemplateList = make(map[string]*PollingTemplateEnt)
+var pollingTemplateList sync.Map
 
 func GetPollingTemplate(id string) *PollingTemplateEnt {
-	if pt, ok := pollingTemplateList[id]; ok {
-		return pt
+	if v, ok := pollingTemplateList.Load(id); ok {
+		return v.(*PollingTemplateEnt)
 	}
 	return nil
 }
 
 func ForEachPollingTemplate(f func(*PollingTemplateEnt) bool) {
-	for _, pt := range pollingTemplateList {
-		if !f(pt) {
-			break
-		}
-	}
+	pollingTemplateList.Range(func(_, v any) bool {
+		return f(v.(*PollingTemplateEnt))
+	})
 }
 
 func loadPollingTemplate(js []byte) error {
@@ -46,12 +59,285 @@ func loadPollingTemplate(js []byte) error {
 	for i := range list {
 		if list[i].ID == "" {
 			list[i].ID = getID(&list[i])
-			pollingTemplateList[list[i].ID] = &list[i]
+			list[i].Custom = false
+			pollingTemplateList.Store(list[i].ID, &list[i])
+		}
+	}
+	return nil
+}
+
+func loadCustomPollingTemplates() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("pollingTemplates"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var pt PollingTemplateEnt
+			if err := json.Unmarshal(v, &pt); err == nil {
+				pt.Custom = true
+				pollingTemplateList.Store(pt.ID, &pt)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdatePollingTemplate : ユーザーのポーリングテンプレートを追加または更新する
+func UpdatePollingTemplate(pt *PollingTemplateEnt) error {
+	st := time.Now()
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if pt.Name == "" || pt.Type == "" {
+		return ErrInvalidParams
+	}
+	var prev *PollingTemplateEnt
+	if pt.ID == "" {
+		for {
+			pt.ID = makeKey()
+			if _, ok := pollingTemplateList.Load(pt.ID); !ok {
+				break
+			}
+		}
+		if pt.Version < 1 {
+			pt.Version = 1
+		}
+	} else {
+		old := GetPollingTemplate(pt.ID)
+		if old == nil {
+			return ErrInvalidID
+		}
+		if !old.Custom {
+			// 内蔵のテンプレートは変更できない
+			return ErrInvalidParams
+		}
+		if pt.Version <= old.Version {
+			pt.Version = old.Version + 1
+		}
+		prev = old
+	}
+	pt.Custom = true
+	pt.UpdateTime = time.Now().UnixNano()
+	j, err := json.Marshal(pt)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		if prev != nil {
+			if err := savePollingTemplateHistory(tx, prev); err != nil {
+				return err
+			}
+		}
+		b := tx.Bucket([]byte("pollingTemplates"))
+		return b.Put([]byte(pt.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	pollingTemplateList.Store(pt.ID, pt)
+	log.Printf("UpdatePollingTemplate name=%s version=%d dur=%v", pt.Name, pt.Version, time.Since(st))
+	return nil
+}
+
+// DeletePollingTemplate : ユーザーのポーリングテンプレートを削除する
+func DeletePollingTemplate(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	pt := GetPollingTemplate(id)
+	if pt == nil {
+		return ErrInvalidID
+	}
+	if !pt.Custom {
+		return ErrInvalidParams
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		if err := deletePollingTemplateHistory(tx, id); err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte("pollingTemplates"))
+		return b.Delete([]byte(id))
+	})
+	pollingTemplateList.Delete(id)
+	return err
+}
+
+// 保存する以前のバージョンの数
+const maxPollingTemplateHistory = 20
+
+// pollingTemplateHistoryKey : 以前のバージョンのキー(ID:バージョン)
+func pollingTemplateHistoryKey(id string, version int) []byte {
+	return []byte(fmt.Sprintf("%s:%08d", id, version))
+}
+
+// savePollingTemplateHistory : 更新前のバージョンを保存して古いものを削除する
+func savePollingTemplateHistory(tx *bbolt.Tx, pt *PollingTemplateEnt) error {
+	b := tx.Bucket([]byte("pollingTemplateHistory"))
+	if b == nil {
+		return nil
+	}
+	j, err := json.Marshal(pt)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(pollingTemplateHistoryKey(pt.ID, pt.Version), j); err != nil {
+		return err
+	}
+	keys := [][]byte{}
+	prefix := []byte(pt.ID + ":")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for i := 0; i < len(keys)-maxPollingTemplateHistory; i++ {
+		if err := b.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deletePollingTemplateHistory(tx *bbolt.Tx, id string) error {
+	b := tx.Bucket([]byte("pollingTemplateHistory"))
+	if b == nil {
+		return nil
+	}
+	keys := [][]byte{}
+	prefix := []byte(id + ":")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// GetPollingTemplateHistory : ユーザーのポーリングテンプレートの以前のバージョンを新しい順に返す
+func GetPollingTemplateHistory(id string) []*PollingTemplateEnt {
+	ret := []*PollingTemplateEnt{}
+	if db == nil {
+		return ret
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("pollingTemplateHistory"))
+		if b == nil {
+			return nil
+		}
+		prefix := []byte(id + ":")
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var pt PollingTemplateEnt
+			if err := json.Unmarshal(v, &pt); err == nil {
+				ret = append([]*PollingTemplateEnt{&pt}, ret...)
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// RestorePollingTemplate : 以前のバージョンの内容を新しいバージョンとして保存する
+func RestorePollingTemplate(id string, version int) (*PollingTemplateEnt, error) {
+	for _, old := range GetPollingTemplateHistory(id) {
+		if old.Version == version {
+			pt := *old
+			if err := UpdatePollingTemplate(&pt); err != nil {
+				return nil, err
+			}
+			return &pt, nil
+		}
+	}
+	return nil, ErrInvalidID
+}
+
+// ImportPollingTemplates : 他の環境からエクスポートしたテンプレートを取り込む
+// 同じ名前と種別のユーザーのテンプレートがあれば、バージョンが新しい場合だけ更新する
+// 追加または更新した数を返す
+func ImportPollingTemplates(list []*PollingTemplateEnt) (int, error) {
+	n := 0
+	for _, pt := range list {
+		var old *PollingTemplateEnt
+		ForEachPollingTemplate(func(p *PollingTemplateEnt) bool {
+			if p.Custom && p.Name == pt.Name && p.Type == pt.Type {
+				old = p
+				return false
+			}
+			return true
+		})
+		if old == nil {
+			pt.ID = ""
+		} else {
+			if pt.Version <= old.Version {
+				continue
+			}
+			pt.ID = old.ID
+		}
+		if err := UpdatePollingTemplate(pt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// HasPollingTemplateMatch : 自動発見で適用する条件があるか
+func HasPollingTemplateMatch(pt *PollingTemplateEnt) bool {
+	return pt.MatchSysObjectID != "" || pt.MatchService != "" || pt.MatchIcon != ""
+}
+
+// MatchPollingTemplate : ノードが自動発見で適用する条件に一致するか判断する
+// 指定した条件は全て満たす必要がある
+func MatchPollingTemplate(pt *PollingTemplateEnt, n *NodeEnt, services map[string]bool) bool {
+	if !HasPollingTemplateMatch(pt) || pt.AutoMode == "disable" {
+		return false
+	}
+	if pt.MatchSysObjectID != "" {
+		hit := false
+		for _, p := range strings.Split(pt.MatchSysObjectID, ",") {
+			if p = strings.TrimSpace(p); p != "" && strings.HasPrefix(n.SysObjectID, p) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+	if pt.MatchService != "" {
+		hit := false
+		for _, s := range strings.Split(pt.MatchService, ",") {
+			if services[strings.TrimSpace(s)] {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+	if pt.MatchIcon != "" {
+		hit := false
+		for _, i := range strings.Split(pt.MatchIcon, ",") {
+			if strings.TrimSpace(i) == n.Icon {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return false
+		}
+	}
+	return true
+}
+
 func getID(t *PollingTemplateEnt) string {
 	s := t.Name + t.Type + t.Mode + t.Level + t.Params + t.Filter + t.Extractor + t.Script
 	h := sha256.New()
@@ -0,0 +1,177 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// RemoteExecJobEnt : 複数のノードに対するコマンド一括実行のジョブ
+type RemoteExecJobEnt struct {
+	ID          string
+	User        string
+	Type        string // ssh | snmpset
+	Command     string // SSHで実行するコマンド
+	Port        string // SSHのポート
+	Name        string // SNMP SETのオブジェクト名
+	ValueType   string // SNMP SETの値の型 integer | string
+	Value       string // SNMP SETの値
+	NodeIDs     []string
+	Concurrency int
+	State       string // running | done
+	StartTime   int64
+	EndTime     int64
+	Results     []*RemoteExecResultEnt `json:",omitempty"`
+}
+
+// RemoteExecResultEnt : ノード毎の実行結果
+type RemoteExecResultEnt struct {
+	NodeID   string
+	NodeName string
+	IP       string
+	ExitCode int
+	Output   string
+	Error    string
+	Time     int64
+}
+
+// RemoteExecJobMax : 保存するジョブの最大数
+var RemoteExecJobMax = 100
+
+// 実行中のジョブ 結果は終了時にまとめて保存する
+var (
+	muRemoteExec   sync.Mutex
+	remoteExecJobs = make(map[string]*RemoteExecJobEnt)
+)
+
+// NewRemoteExecJobID : 時刻順に並ぶジョブのIDを作成する
+func NewRemoteExecJobID() string {
+	return fmt.Sprintf("%016x", time.Now().UnixNano())
+}
+
+// SaveRemoteExecJob : ジョブを保存する、古いジョブは削除する
+func SaveRemoteExecJob(j *RemoteExecJobEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	s, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("remoteExec"))
+		if err := b.Put([]byte(j.ID), s); err != nil {
+			return err
+		}
+		keys := [][]byte{}
+		b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		for i := 0; i < len(keys)-RemoteExecJobMax; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StartRemoteExecJob : 実行中のジョブとして保存する
+func StartRemoteExecJob(j *RemoteExecJobEnt) error {
+	j.State = "running"
+	if err := SaveRemoteExecJob(j); err != nil {
+		return err
+	}
+	muRemoteExec.Lock()
+	remoteExecJobs[j.ID] = j
+	muRemoteExec.Unlock()
+	return nil
+}
+
+// AddRemoteExecResult : 実行中のジョブにノードの結果を追加する
+func AddRemoteExecResult(j *RemoteExecJobEnt, r *RemoteExecResultEnt) {
+	muRemoteExec.Lock()
+	j.Results = append(j.Results, r)
+	muRemoteExec.Unlock()
+}
+
+// EndRemoteExecJob : ジョブを終了して結果を保存する
+func EndRemoteExecJob(j *RemoteExecJobEnt) error {
+	muRemoteExec.Lock()
+	j.State = "done"
+	j.EndTime = time.Now().UnixNano()
+	delete(remoteExecJobs, j.ID)
+	muRemoteExec.Unlock()
+	return SaveRemoteExecJob(j)
+}
+
+// getRunningRemoteExecJob : 実行中のジョブのコピーを返す
+func getRunningRemoteExecJob(id string) *RemoteExecJobEnt {
+	muRemoteExec.Lock()
+	defer muRemoteExec.Unlock()
+	j, ok := remoteExecJobs[id]
+	if !ok {
+		return nil
+	}
+	r := *j
+	r.Results = append([]*RemoteExecResultEnt{}, j.Results...)
+	return &r
+}
+
+// GetRemoteExecJob : IDでジョブを取得する
+func GetRemoteExecJob(id string) *RemoteExecJobEnt {
+	if j := getRunningRemoteExecJob(id); j != nil {
+		return j
+	}
+	var ret *RemoteExecJobEnt
+	if db == nil {
+		return nil
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("remoteExec"))
+		if v := b.Get([]byte(id)); v != nil {
+			var j RemoteExecJobEnt
+			if err := json.Unmarshal(v, &j); err == nil {
+				ret = &j
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// GetRemoteExecJobs : ジョブのリストを新しい順に取得する(実行結果は含まない)
+func GetRemoteExecJobs() []*RemoteExecJobEnt {
+	ret := []*RemoteExecJobEnt{}
+	if db == nil {
+		return ret
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("remoteExec"))
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var j RemoteExecJobEnt
+			if err := json.Unmarshal(v, &j); err == nil {
+				j.Results = nil
+				ret = append(ret, &j)
+			}
+		}
+		return nil
+	})
+	return ret
+}
+
+// DeleteRemoteExecJob : ジョブを削除する
+func DeleteRemoteExecJob(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("remoteExec"))
+		return b.Delete([]byte(id))
+	})
+}
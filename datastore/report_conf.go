@@ -11,6 +11,7 @@ import (
 
 type ReportConfEnt struct {
 	DenyCountries       []string
+	DenyASNs            []string
 	DenyServices        []string
 	AllowDNS            string
 	AllowDHCP           string
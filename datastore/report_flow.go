@@ -16,6 +16,8 @@ type ServerEnt struct {
 	ServerName   string
 	ServerNodeID string
 	Loc          string
+	ASN          uint
+	ASOrg        string
 	Score        float64
 	ValidScore   bool
 	Penalty      int64
@@ -37,9 +39,13 @@ type FlowEnt struct {
 	ClientName   string
 	ClientNodeID string
 	ClientLoc    string
+	ClientASN    uint
+	ClientASOrg  string
 	ServerName   string
 	ServerNodeID string
 	ServerLoc    string
+	ServerASN    uint
+	ServerASOrg  string
 	Score        float64
 	ValidScore   bool
 	Penalty      int64
@@ -13,6 +13,8 @@ type IPReportEnt struct {
 	Name       string
 	NodeID     string
 	Loc        string
+	ASN        uint
+	ASOrg      string
 	Vendor     string
 	Count      int64
 	Change     int64
@@ -0,0 +1,235 @@
+package datastore
+
+// 定期レポートの定義(スケジュール、宛先、項目)
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ReportSections : レポートに含めることができる項目
+var ReportSections = []string{
+	"llm", "map", "db", "resource", "logs", "sensor", "ai",
+	"compliance", "capacity", "sla", "devices", "users", "ips", "wifi", "bluetooth",
+}
+
+// ReportDefEnt : レポートの定義
+type ReportDefEnt struct {
+	ID         string
+	Name       string
+	Schedule   string   // daily | weekly | monthly
+	Weekday    int      // 週次の曜日 0:日曜〜6:土曜
+	Day        int      // 月次の日 1〜31(月末より後は月末)
+	Hour       int      // 送信する時刻(時)
+	MailTo     string   // 空は通知設定の送信先
+	Sections   []string // 空は全て
+	NodeFilter string   // ノードのタグセレクタ
+	Window     int      // 集計期間(時間) 0はスケジュールの間隔
+	PDF        bool
+	CSV        bool
+	Disabled   bool
+	LastSend   int64
+}
+
+var reportDefs sync.Map
+
+func loadReportDefs() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("reportDefs"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var d ReportDefEnt
+			if err := json.Unmarshal(v, &d); err == nil {
+				reportDefs.Store(d.ID, &d)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdateReportDef : レポートの定義を追加または更新する
+func UpdateReportDef(d *ReportDefEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if d.Name == "" || d.Hour < 0 || d.Hour > 23 || d.Window < 0 {
+		return ErrInvalidParams
+	}
+	switch d.Schedule {
+	case "daily":
+	case "weekly":
+		if d.Weekday < 0 || d.Weekday > 6 {
+			return ErrInvalidParams
+		}
+	case "monthly":
+		if d.Day < 1 || d.Day > 31 {
+			return ErrInvalidParams
+		}
+	default:
+		return ErrInvalidParams
+	}
+	for _, s := range d.Sections {
+		if !isReportSection(s) {
+			return ErrInvalidParams
+		}
+	}
+	if d.ID == "" {
+		for {
+			d.ID = makeKey()
+			if _, ok := reportDefs.Load(d.ID); !ok {
+				break
+			}
+		}
+	} else if _, ok := reportDefs.Load(d.ID); !ok {
+		return ErrInvalidID
+	}
+	return saveReportDef(d)
+}
+
+func saveReportDef(d *ReportDefEnt) error {
+	j, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("reportDefs"))
+		return b.Put([]byte(d.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	reportDefs.Store(d.ID, d)
+	return nil
+}
+
+func isReportSection(s string) bool {
+	for _, e := range ReportSections {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteReportDef : レポートの定義を削除する
+func DeleteReportDef(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := reportDefs.Load(id); !ok {
+		return ErrInvalidID
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("reportDefs"))
+		return b.Delete([]byte(id))
+	})
+	reportDefs.Delete(id)
+	return err
+}
+
+// GetReportDef : IDでレポートの定義を取得する
+func GetReportDef(id string) *ReportDefEnt {
+	if v, ok := reportDefs.Load(id); ok {
+		return v.(*ReportDefEnt)
+	}
+	return nil
+}
+
+// GetReportDefs : レポートの定義を名前順に取得する
+func GetReportDefs() []*ReportDefEnt {
+	ret := []*ReportDefEnt{}
+	reportDefs.Range(func(_, v any) bool {
+		ret = append(ret, v.(*ReportDefEnt))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// SetReportDefLastSend : レポートを送信した日時を記録する
+func SetReportDefLastSend(id string, t time.Time) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	d := GetReportDef(id)
+	if d == nil {
+		return ErrInvalidID
+	}
+	d.LastSend = t.UnixNano()
+	return saveReportDef(d)
+}
+
+// IsReportDefDue : レポートを送信する日時になったか判断する
+// 停止中に送信できなかった週次と月次のレポートは起動後に送信する
+func IsReportDefDue(d *ReportDefEnt, now time.Time) bool {
+	if d.Disabled {
+		return false
+	}
+	due := getReportDefLastDue(d, now)
+	if due.IsZero() || d.LastSend >= due.UnixNano() {
+		return false
+	}
+	if due.Year() == now.Year() && due.YearDay() == now.YearDay() {
+		return true
+	}
+	return d.LastSend > 0 && d.Schedule != "daily"
+}
+
+// getReportDefLastDue : 現在より前で最後に送信する予定だった日時
+func getReportDefLastDue(d *ReportDefEnt, now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), d.Hour, 0, 0, 0, now.Location())
+	switch d.Schedule {
+	case "daily":
+		if t.After(now) {
+			t = t.AddDate(0, 0, -1)
+		}
+		return t
+	case "weekly":
+		for i := 0; i < 8; i++ {
+			if int(t.Weekday()) == d.Weekday && !t.After(now) {
+				return t
+			}
+			t = t.AddDate(0, 0, -1)
+		}
+	case "monthly":
+		for i := 0; i < 2; i++ {
+			y, m := now.Year(), now.Month()-time.Month(i)
+			day := d.Day
+			// 月末より後の日は月末に送信する
+			last := time.Date(y, m+1, 0, 0, 0, 0, 0, now.Location()).Day()
+			if day > last {
+				day = last
+			}
+			t = time.Date(y, m, day, d.Hour, 0, 0, 0, now.Location())
+			if !t.After(now) {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// GetReportDefWindow : レポートの集計期間
+func GetReportDefWindow(d *ReportDefEnt, now time.Time) time.Duration {
+	if d.Window > 0 {
+		return time.Duration(d.Window) * time.Hour
+	}
+	switch d.Schedule {
+	case "weekly":
+		return 7 * 24 * time.Hour
+	case "monthly":
+		return now.Sub(now.AddDate(0, -1, 0))
+	}
+	return 24 * time.Hour
+}
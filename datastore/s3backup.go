@@ -0,0 +1,379 @@
+package datastore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// S3BackupConfEnt : S3互換ストレージのバックアップ先
+type S3BackupConfEnt struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+	SSE       string // "" | s3 | kms | c
+	SSEKey    string // SSE=kmsの場合はKey ID、SSE=cの場合はBase64の鍵
+}
+
+// S3RestoreConf : 起動時のリストアで使うS3の接続先(コマンドライン/環境変数から設定)
+var S3RestoreConf S3BackupConfEnt
+
+const s3PartSize = 64 * 1024 * 1024
+
+func newS3Client(c *S3BackupConfEnt) (*minio.Client, error) {
+	if c.Endpoint == "" {
+		return nil, fmt.Errorf("no s3 endpoint")
+	}
+	var creds *credentials.Credentials
+	if c.AccessKey != "" {
+		creds = credentials.NewStaticV4(c.AccessKey, c.SecretKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		})
+	}
+	return minio.New(c.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: c.UseSSL,
+		Region: c.Region,
+	})
+}
+
+func getS3SSE(c *S3BackupConfEnt) (encrypt.ServerSide, error) {
+	switch c.SSE {
+	case "":
+		return nil, nil
+	case "s3":
+		return encrypt.NewSSE(), nil
+	case "kms":
+		return encrypt.NewSSEKMS(c.SSEKey, nil)
+	case "c":
+		key, err := base64.StdEncoding.DecodeString(c.SSEKey)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
+	}
+	return nil, fmt.Errorf("invalid sse type %s", c.SSE)
+}
+
+func getS3ObjectName(c *S3BackupConfEnt, name string) string {
+	p := strings.Trim(c.Prefix, "/")
+	if p == "" {
+		return name
+	}
+	return p + "/" + name
+}
+
+// uploadBackupToS3 : バックアップファイルとログパーティションをS3にアップロードする
+// 全てのファイルをアップロードできなかった場合はエラーを返す
+func uploadBackupToS3(file string) error {
+	name := filepath.Base(file)
+	objs := [][2]string{{name, file}}
+	logDir := file + ".logdb"
+	dirList, err := os.ReadDir(logDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, d := range dirList {
+		if d.IsDir() {
+			continue
+		}
+		objs = append(objs, [2]string{name + ".logdb/" + d.Name(), filepath.Join(logDir, d.Name())})
+	}
+	return putS3Objects(objs)
+}
+
+// uploadBackupSetToS3 : バックアップセットのファイルとマニフェストをS3にアップロードする
+// 次の増分の基準とリストアに使うため、ローカルのバックアップセットは残す
+func uploadBackupSetToS3(dir string, bs *BackupSetEnt) error {
+	objs := [][2]string{}
+	for _, f := range bs.Files {
+		objs = append(objs, [2]string{
+			"backupset/" + bs.ID + "/" + f.Name,
+			filepath.Join(dir, bs.ID, filepath.FromSlash(f.Name)),
+		})
+	}
+	objs = append(objs, [2]string{"backupset/manifest.json", filepath.Join(dir, "manifest.json")})
+	return putS3Objects(objs)
+}
+
+// putS3Objects : オブジェクト名とファイルのペアを順番にアップロードする
+func putS3Objects(objs [][2]string) error {
+	c := &Backup.S3
+	client, err := newS3Client(c)
+	if err != nil {
+		return err
+	}
+	sse, err := getS3SSE(c)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	opts := minio.PutObjectOptions{
+		ContentType:          "application/octet-stream",
+		PartSize:             s3PartSize,
+		ServerSideEncryption: sse,
+	}
+	for _, o := range objs {
+		if stopBackup {
+			return fmt.Errorf("stop backup")
+		}
+		if _, err := client.FPutObject(ctx, c.Bucket, getS3ObjectName(c, o[0]), o[1], opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeS3BackupSets : S3上の削除したバックアップセットを削除する
+func removeS3BackupSets(ids []string) {
+	if len(ids) < 1 {
+		return
+	}
+	c := &Backup.S3
+	client, err := newS3Client(c)
+	if err != nil {
+		log.Printf("rotate s3 backup set err=%v", err)
+		return
+	}
+	ctx := context.Background()
+	for _, id := range ids {
+		prefix := getS3ObjectName(c, "backupset/"+id+"/")
+		for o := range client.ListObjects(ctx, c.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if o.Err != nil {
+				log.Printf("rotate s3 backup set err=%v", o.Err)
+				break
+			}
+			if err := client.RemoveObject(ctx, c.Bucket, o.Key, minio.RemoveObjectOptions{}); err != nil {
+				log.Printf("delete s3 backup key=%s err=%v", o.Key, err)
+			}
+		}
+	}
+}
+
+// selectS3Rotation : 世代を超えた削除対象のバックアップ名を返す
+func selectS3Rotation(names []string, gen int) []string {
+	if gen+1 >= len(names) {
+		return []string{}
+	}
+	sort.Strings(names)
+	return names[:len(names)-(gen+1)]
+}
+
+// rotateS3Backup : S3上の古いバックアップを削除する
+func rotateS3Backup() {
+	c := &Backup.S3
+	client, err := newS3Client(c)
+	if err != nil {
+		log.Printf("rotate s3 backup err=%v", err)
+		return
+	}
+	ctx := context.Background()
+	prefix := getS3ObjectName(c, "twsnmpfc.db.")
+	names := []string{}
+	objects := make(map[string][]string)
+	for o := range client.ListObjects(ctx, c.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if o.Err != nil {
+			log.Printf("rotate s3 backup err=%v", o.Err)
+			return
+		}
+		name := path.Base(o.Key)
+		if i := strings.Index(o.Key, ".logdb/"); i > 0 {
+			name = path.Base(o.Key[:i])
+		} else {
+			names = append(names, name)
+		}
+		objects[name] = append(objects[name], o.Key)
+	}
+	for _, name := range selectS3Rotation(names, Backup.Generation) {
+		for _, key := range objects[name] {
+			if err := client.RemoveObject(ctx, c.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+				log.Printf("delete s3 backup key=%s err=%v", key, err)
+			} else {
+				log.Printf("delete s3 backup key=%s", key)
+			}
+		}
+	}
+}
+
+// parseS3URL : s3://bucket/prefix/objectを分解する
+func parseS3URL(s string) (string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid s3 url %s", s)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// restoreDBFromS3 : S3のバックアップからDBをリストアする
+// オブジェクト名を省略した場合は、プレフィックス内の最新のバックアップを使う
+func restoreDBFromS3(ds, s3url string) error {
+	bucket, key, err := parseS3URL(s3url)
+	if err != nil {
+		return err
+	}
+	c := S3RestoreConf
+	c.Bucket = bucket
+	client, err := newS3Client(&c)
+	if err != nil {
+		return err
+	}
+	sse, err := getS3SSE(&c)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if !strings.HasPrefix(path.Base(key), "twsnmpfc.db.") {
+		prefix := strings.TrimSuffix(key, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		key = ""
+		for o := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix + "twsnmpfc.db."}) {
+			if o.Err != nil {
+				return o.Err
+			}
+			if strings.HasSuffix(o.Key, "/") {
+				continue
+			}
+			if o.Key > key {
+				key = o.Key
+			}
+		}
+		if key == "" {
+			return fmt.Errorf("no backup in %s", s3url)
+		}
+	}
+	log.Printf("restore from s3 bucket=%s key=%s", bucket, key)
+	getOpts := minio.GetObjectOptions{}
+	if c.SSE == "c" {
+		getOpts.ServerSideEncryption = sse
+	}
+	tmpDB := filepath.Join(ds, "twsnmpfc.db.restore")
+	os.Remove(tmpDB)
+	if err := client.FGetObject(ctx, bucket, key, tmpDB, getOpts); err != nil {
+		return err
+	}
+	tmpLogDir := filepath.Join(ds, logPartDirName+".restore")
+	os.RemoveAll(tmpLogDir)
+	for o := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: key + ".logdb/", Recursive: true}) {
+		if o.Err != nil {
+			return o.Err
+		}
+		if err := client.FGetObject(ctx, bucket, o.Key, filepath.Join(tmpLogDir, path.Base(o.Key)), getOpts); err != nil {
+			return err
+		}
+	}
+	suffix := ".old." + time.Now().Format("20060102150405")
+	dbPath := filepath.Join(ds, "twsnmpfc.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := os.Rename(dbPath, dbPath+suffix); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpDB, dbPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(tmpLogDir); err != nil {
+		return nil
+	}
+	logDir := filepath.Join(ds, logPartDirName)
+	if _, err := os.Stat(logDir); err == nil {
+		if err := os.Rename(logDir, logDir+suffix); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmpLogDir, logDir)
+}
+
+// parseS3BackupSetURL : s3://bucket/prefix/時刻を分解する
+func parseS3BackupSetURL(s string) (string, string, string, error) {
+	bucket, key, err := parseS3URL(s)
+	if err != nil {
+		return "", "", "", err
+	}
+	at := path.Base(key)
+	if key == "" || at == "/" || at == "." {
+		return "", "", "", fmt.Errorf("no restore time in %s", s)
+	}
+	prefix := path.Dir(key)
+	if prefix == "." {
+		prefix = ""
+	}
+	return bucket, prefix, normBackupSetTime(at), nil
+}
+
+// downloadBackupSetFromS3 : リストアに必要なS3のバックアップセットとマニフェストをダウンロードする
+// ダウンロードしたディレクトリとリストアする時刻を返す
+func downloadBackupSetFromS3(ds, s3url string) (string, string, error) {
+	bucket, prefix, at, err := parseS3BackupSetURL(s3url)
+	if err != nil {
+		return "", "", err
+	}
+	c := S3RestoreConf
+	c.Bucket = bucket
+	c.Prefix = prefix
+	client, err := newS3Client(&c)
+	if err != nil {
+		return "", "", err
+	}
+	sse, err := getS3SSE(&c)
+	if err != nil {
+		return "", "", err
+	}
+	getOpts := minio.GetObjectOptions{}
+	if c.SSE == "c" {
+		getOpts.ServerSideEncryption = sse
+	}
+	ctx := context.Background()
+	dir := filepath.Join(ds, "backupset.restore")
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := client.FGetObject(ctx, bucket, getS3ObjectName(&c, "backupset/manifest.json"), filepath.Join(dir, "manifest.json"), getOpts); err != nil {
+		return dir, "", err
+	}
+	list, err := loadBackupSetManifest(dir)
+	if err != nil {
+		return dir, "", err
+	}
+	chain, err := getBackupSetChain(list, at)
+	if err != nil {
+		return dir, "", err
+	}
+	for _, bs := range chain {
+		for _, f := range bs.Files {
+			dst := filepath.Join(dir, bs.ID, filepath.FromSlash(f.Name))
+			if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+				return dir, "", err
+			}
+			if err := client.FGetObject(ctx, bucket, getS3ObjectName(&c, "backupset/"+bs.ID+"/"+f.Name), dst, getOpts); err != nil {
+				return dir, "", err
+			}
+		}
+		log.Printf("download backup set from s3 id=%s files=%d", bs.ID, len(bs.Files))
+	}
+	return dir, at, nil
+}
@@ -0,0 +1,209 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+
+	"github.com/twsnmp/twsnmpfc/security"
+	"go.etcd.io/bbolt"
+)
+
+// MasterPassword : 秘密情報の暗号化キーを生成するマスターパスワード(空の場合は暗号化しない)
+var MasterPassword string
+
+// DefaultMasterPassword : 起動パラメータのマスターパスワードの既定値(公開されているので安全ではない)
+const DefaultMasterPassword = "twsnmpfc!"
+
+var secretKey []byte
+var secretMigrate bool
+var secretDecryptFailed bool
+
+// ErrDecryptSecret : マスターパスワードが違うなどで秘密情報を復号できない
+var ErrDecryptSecret = fmt.Errorf("decrypt secret failed, check master password")
+
+// initSecretKey : マスターパスワードとDBに保存したソルトから暗号化キーを生成する
+func initSecretKey() error {
+	secretKey = nil
+	secretMigrate = false
+	secretDecryptFailed = false
+	if MasterPassword == "" {
+		return nil
+	}
+	if MasterPassword == DefaultMasterPassword {
+		log.Println("warning: secrets are encrypted with the default master password, set -password")
+	}
+	var salt []byte
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("config"))
+		if v := b.Get([]byte("secretSalt")); len(v) > 0 {
+			salt = append([]byte{}, v...)
+			return nil
+		}
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		return b.Put([]byte("secretSalt"), salt)
+	})
+	if err != nil {
+		return err
+	}
+	secretKey, err = security.DeriveSecretKey(MasterPassword, salt)
+	return err
+}
+
+// encryptSecret : 秘密情報を暗号化する
+func encryptSecret(s string) string {
+	if secretKey == nil || s == "" || security.IsEncryptedSecret(s) {
+		// 復号できなかった暗号文はそのまま保存する
+		return s
+	}
+	e, err := security.EncryptSecret(secretKey, s)
+	if err != nil {
+		log.Printf("encrypt secret err=%v", err)
+		return s
+	}
+	return e
+}
+
+// decryptSecret : 秘密情報を復号する、平文の場合は移行対象にする
+// 復号できない場合は保存し直しても消えないように暗号文のまま返す
+func decryptSecret(s string) string {
+	if secretKey == nil || s == "" {
+		return s
+	}
+	if !security.IsEncryptedSecret(s) {
+		secretMigrate = true
+		return s
+	}
+	p, err := security.DecryptSecret(secretKey, s)
+	if err != nil {
+		log.Printf("decrypt secret err=%v", err)
+		secretDecryptFailed = true
+		return s
+	}
+	return p
+}
+
+func encryptNodeSecret(n *NodeEnt) *NodeEnt {
+	if secretKey == nil {
+		return n
+	}
+	r := *n
+	r.Community = encryptSecret(n.Community)
+	r.Password = encryptSecret(n.Password)
+	r.GNMIPassword = encryptSecret(n.GNMIPassword)
+	return &r
+}
+
+func decryptNodeSecret(n *NodeEnt) {
+	n.Community = decryptSecret(n.Community)
+	n.Password = decryptSecret(n.Password)
+	n.GNMIPassword = decryptSecret(n.GNMIPassword)
+}
+
+func encryptNetworkSecret(n *NetworkEnt) *NetworkEnt {
+	if secretKey == nil {
+		return n
+	}
+	r := *n
+	r.Community = encryptSecret(n.Community)
+	r.Password = encryptSecret(n.Password)
+	return &r
+}
+
+func decryptNetworkSecret(n *NetworkEnt) {
+	n.Community = decryptSecret(n.Community)
+	n.Password = decryptSecret(n.Password)
+}
+
+func encryptMapConfSecret(m MapConfEnt) MapConfEnt {
+	m.Community = encryptSecret(m.Community)
+	m.SnmpPassword = encryptSecret(m.SnmpPassword)
+	m.LLMAPIKey = encryptSecret(m.LLMAPIKey)
+	return m
+}
+
+func decryptMapConfSecret(m *MapConfEnt) {
+	m.Community = decryptSecret(m.Community)
+	m.SnmpPassword = decryptSecret(m.SnmpPassword)
+	m.LLMAPIKey = decryptSecret(m.LLMAPIKey)
+}
+
+func encryptNotifyConfSecret(n NotifyConfEnt) NotifyConfEnt {
+	n.Password = encryptSecret(n.Password)
+	n.ClientSecret = encryptSecret(n.ClientSecret)
+	return n
+}
+
+func decryptNotifyConfSecret(n *NotifyConfEnt) {
+	n.Password = decryptSecret(n.Password)
+	n.ClientSecret = decryptSecret(n.ClientSecret)
+}
+
+func encryptBackupSecret(b DBBackupEnt) DBBackupEnt {
+	b.S3.SecretKey = encryptSecret(b.S3.SecretKey)
+	b.S3.SSEKey = encryptSecret(b.S3.SSEKey)
+	return b
+}
+
+func decryptBackupSecret(b *DBBackupEnt) {
+	b.S3.SecretKey = decryptSecret(b.S3.SecretKey)
+	b.S3.SSEKey = decryptSecret(b.S3.SSEKey)
+}
+
+func encryptCredentialSecret(c *CredentialEnt) *CredentialEnt {
+	if secretKey == nil {
+		return c
+	}
+	r := *c
+	r.Community = encryptSecret(c.Community)
+	r.Password = encryptSecret(c.Password)
+	r.PrivateKey = encryptSecret(c.PrivateKey)
+	r.Token = encryptSecret(c.Token)
+	return &r
+}
+
+func decryptCredentialSecret(c *CredentialEnt) {
+	c.Community = decryptSecret(c.Community)
+	c.Password = decryptSecret(c.Password)
+	c.PrivateKey = decryptSecret(c.PrivateKey)
+	c.Token = decryptSecret(c.Token)
+}
+
+// migrateSecret : 平文で保存されている秘密情報を暗号化して保存し直す
+func migrateSecret() {
+	if !secretMigrate {
+		return
+	}
+	secretMigrate = false
+	log.Println("migrate plaintext secrets")
+	if err := SaveMapConf(); err != nil {
+		log.Printf("migrate secret err=%v", err)
+	}
+	if err := SaveNotifyConf(); err != nil {
+		log.Printf("migrate secret err=%v", err)
+	}
+	if err := SaveBackup(); err != nil {
+		log.Printf("migrate secret err=%v", err)
+	}
+	if t := GetNotifyOAuth2Token(); t != nil {
+		if err := SaveNotifyOAuth2Token(t); err != nil {
+			log.Printf("migrate secret err=%v", err)
+		}
+	}
+	if err := saveAllNodes(); err != nil {
+		log.Printf("migrate secret err=%v", err)
+	}
+	for _, s := range GetFederationSites() {
+		if err := UpdateFederationSite(s); err != nil {
+			log.Printf("migrate secret err=%v", err)
+		}
+	}
+	for _, c := range GetCredentials() {
+		if err := saveCredential(c); err != nil {
+			log.Printf("migrate secret err=%v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SFlowIfCounterEnt : sFlowのインターフェースカウンターのサンプル
+type SFlowIfCounterEnt struct {
+	Agent       string
+	Index       int
+	Speed       uint64
+	Status      uint32
+	InOctets    uint64
+	OutOctets   uint64
+	InPackets   uint64
+	OutPackets  uint64
+	InErrors    uint64
+	OutErrors   uint64
+	InDiscards  uint64
+	OutDiscards uint64
+	Time        int64
+}
+
+// 直前と最新のサンプル(更新時は置き換える)
+type sflowIfEnt struct {
+	Prev    *SFlowIfCounterEnt
+	Last    *SFlowIfCounterEnt
+	Checked bool
+}
+
+var sflowIfMap sync.Map
+var sflowIfMu sync.Mutex
+
+func getSFlowIfKey(agent string, index int) string {
+	return fmt.Sprintf("%s:%d", agent, index)
+}
+
+// UpdateSFlowIfCounter : 受信したカウンターサンプルを記録する
+func UpdateSFlowIfCounter(c *SFlowIfCounterEnt) {
+	k := getSFlowIfKey(c.Agent, c.Index)
+	e := &sflowIfEnt{Last: c}
+	sflowIfMu.Lock()
+	defer sflowIfMu.Unlock()
+	if v, ok := sflowIfMap.Load(k); ok {
+		o := v.(*sflowIfEnt)
+		e.Prev = o.Last
+		e.Checked = o.Checked
+	}
+	sflowIfMap.Store(k, e)
+}
+
+// GetSFlowIfCounter : 直前と最新のカウンターサンプルを取得する
+func GetSFlowIfCounter(agent string, index int) (*SFlowIfCounterEnt, *SFlowIfCounterEnt) {
+	if v, ok := sflowIfMap.Load(getSFlowIfKey(agent, index)); ok {
+		e := v.(*sflowIfEnt)
+		return e.Prev, e.Last
+	}
+	return nil, nil
+}
+
+// GetSFlowIfIndexes : エージェントのインターフェース番号のリスト
+func GetSFlowIfIndexes(agent string) []int {
+	ret := []int{}
+	sflowIfMap.Range(func(_, v any) bool {
+		e := v.(*sflowIfEnt)
+		if e.Last.Agent == agent {
+			ret = append(ret, e.Last.Index)
+		}
+		return true
+	})
+	sort.Ints(ret)
+	return ret
+}
+
+// ForEachUncheckedSFlowIf : 自動登録を確認していないインターフェースを処理する
+// fがtrueを返すと確認済みにする
+func ForEachUncheckedSFlowIf(f func(agent string, index int) bool) {
+	sflowIfMap.Range(func(k, v any) bool {
+		e := v.(*sflowIfEnt)
+		if e.Checked || !f(e.Last.Agent, e.Last.Index) {
+			return true
+		}
+		// 処理中に受信した新しいサンプルを上書きしないように最新のものを確認済みにする
+		sflowIfMu.Lock()
+		if v, ok := sflowIfMap.Load(k); ok {
+			c := *v.(*sflowIfEnt)
+			c.Checked = true
+			sflowIfMap.Store(k, &c)
+		}
+		sflowIfMu.Unlock()
+		return true
+	})
+}
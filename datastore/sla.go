@@ -0,0 +1,540 @@
+package datastore
+
+// SLA(稼働率の目標)の定義と月次の稼働率の計算
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// SLAEnt : SLAの定義
+type SLAEnt struct {
+	ID              string
+	Name            string
+	Scope           string  // node | polling | group
+	TargetID        string  // ノードID、ポーリングIDまたはグループ
+	Target          float64 // 目標稼働率(%)
+	BusinessHours   bool    // 営業時間だけを対象にする
+	StartTime       string  // 営業開始時刻 "09:00"
+	EndTime         string  // 営業終了時刻 "18:00"
+	Weekdays        []int   // 営業日の曜日 0:日曜〜6:土曜 空は月〜金
+	ExcludeHolidays bool    // 休日(Yasumi)を対象外にする
+	Maintenance     []SLAMaintenanceEnt
+	MailTo          string // 月次レポートの送信先(空は通知設定の送信先)
+	Disabled        bool
+	LastReport      string // 月次レポートを送信した月 "2006-01"
+}
+
+// SLAMaintenanceEnt : SLAの対象外にする計画停止の期間
+type SLAMaintenanceEnt struct {
+	Start int64 // UnixNano()
+	End   int64 // UnixNano()
+	Descr string
+}
+
+// SLAReportEnt : SLAの月次レポート
+type SLAReportEnt struct {
+	SLAID          string
+	Name           string
+	Scope          string
+	TargetName     string
+	Month          string // "2006-01"
+	Start          int64
+	End            int64
+	Target         float64
+	Availability   float64 // 稼働率(%) -1:データなし
+	Met            bool
+	ServiceMin     int // 対象時間(分)
+	UpMin          int
+	DownMin        int
+	UnknownMin     int
+	MaintenanceMin int
+	Failures       int
+	MTTR           float64 // 平均復旧時間(分)
+	MTBF           float64 // 平均故障間隔(分)
+	Pollings       []*SLAPollingReportEnt
+	Outages        []*SLAOutageEnt
+}
+
+// SLAPollingReportEnt : ポーリング毎の稼働率
+type SLAPollingReportEnt struct {
+	PollingID    string
+	PollingName  string
+	NodeName     string
+	Availability float64
+	UpMin        int
+	DownMin      int
+	Failures     int
+}
+
+// SLAOutageEnt : 停止期間
+type SLAOutageEnt struct {
+	Start    int64
+	End      int64
+	Duration int // 分
+}
+
+// レポートに記録する停止期間の最大数
+const maxSLAOutages = 100
+
+// 分毎の状態
+const (
+	slaUnknown = iota
+	slaUp
+	slaDown
+)
+
+var slaMap sync.Map
+
+func loadSLAs() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sla"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var s SLAEnt
+			if err := json.Unmarshal(v, &s); err == nil {
+				slaMap.Store(s.ID, &s)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdateSLA : SLAを追加または更新する
+func UpdateSLA(s *SLAEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	switch s.Scope {
+	case "node", "polling", "group":
+	default:
+		return ErrInvalidParams
+	}
+	if s.TargetID == "" || s.Target <= 0 || s.Target > 100 {
+		return ErrInvalidParams
+	}
+	if s.BusinessHours {
+		if _, err := parseSLAClock(s.StartTime); err != nil {
+			return err
+		}
+		if _, err := parseSLAClock(s.EndTime); err != nil {
+			return err
+		}
+	}
+	if s.ID == "" {
+		for {
+			s.ID = makeKey()
+			if _, ok := slaMap.Load(s.ID); !ok {
+				break
+			}
+		}
+		// 月次レポートは作成した月の分から送信する
+		now := time.Now()
+		s.LastReport = time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local).Format("2006-01")
+	} else {
+		old := GetSLA(s.ID)
+		if old == nil {
+			return ErrInvalidID
+		}
+		// 送信済みの月は送信処理だけで更新する
+		s.LastReport = old.LastReport
+	}
+	return saveSLA(s)
+}
+
+func saveSLA(s *SLAEnt) error {
+	j, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sla"))
+		return b.Put([]byte(s.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	slaMap.Store(s.ID, s)
+	return nil
+}
+
+// SetSLALastReport : 月次レポートを送信した月を記録する
+func SetSLALastReport(id, month string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	s := GetSLA(id)
+	if s == nil {
+		return ErrInvalidID
+	}
+	s.LastReport = month
+	return saveSLA(s)
+}
+
+// DeleteSLA : SLAを削除する
+func DeleteSLA(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := slaMap.Load(id); !ok {
+		return ErrInvalidID
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("sla"))
+		return b.Delete([]byte(id))
+	})
+	slaMap.Delete(id)
+	return err
+}
+
+// GetSLA : IDでSLAを取得する
+func GetSLA(id string) *SLAEnt {
+	if v, ok := slaMap.Load(id); ok {
+		return v.(*SLAEnt)
+	}
+	return nil
+}
+
+// GetSLAs : SLAを名前順に取得する
+func GetSLAs() []*SLAEnt {
+	ret := []*SLAEnt{}
+	slaMap.Range(func(_, v any) bool {
+		ret = append(ret, v.(*SLAEnt))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// parseSLAClock : "15:04"形式の時刻を0時からの分に変換する
+func parseSLAClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// getHolidayMap : 休日の定義(Yasumi)を日付のマップにする
+func getHolidayMap() map[string]bool {
+	ret := make(map[string]bool)
+	for _, l := range strings.Split(Yasumi, "\n") {
+		a := strings.SplitN(strings.TrimSpace(l), ",", 2)
+		if len(a) < 1 || a[0] == "" {
+			continue
+		}
+		if t, err := time.ParseInLocation("2006-1-2", a[0], time.Local); err == nil {
+			ret[t.Format("2006-01-02")] = true
+		}
+	}
+	return ret
+}
+
+// getSLAPollings : SLAの対象のポーリング
+func getSLAPollings(s *SLAEnt) []*PollingEnt {
+	ret := []*PollingEnt{}
+	switch s.Scope {
+	case "polling":
+		if p := GetPolling(s.TargetID); p != nil {
+			ret = append(ret, p)
+		}
+	case "node":
+		ForEachPollings(func(p *PollingEnt) bool {
+			if p.NodeID == s.TargetID {
+				ret = append(ret, p)
+			}
+			return true
+		})
+	case "group":
+		sel := "group:" + s.TargetID
+		ForEachPollings(func(p *PollingEnt) bool {
+			if PollingMatchTagSelector(p, sel) {
+				ret = append(ret, p)
+			}
+			return true
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func getSLATargetName(s *SLAEnt) string {
+	switch s.Scope {
+	case "polling":
+		if p := GetPolling(s.TargetID); p != nil {
+			if n := GetNode(p.NodeID); n != nil {
+				return n.Name + ":" + p.Name
+			}
+			return p.Name
+		}
+	case "node":
+		if n := GetNode(s.TargetID); n != nil {
+			return n.Name
+		}
+	}
+	return s.TargetID
+}
+
+// GetSLAReport : 指定した月のSLAレポートを作成する。当月は現在までを集計する
+func GetSLAReport(id string, month time.Time) (*SLAReportEnt, error) {
+	s := GetSLA(id)
+	if s == nil {
+		return nil, ErrInvalidID
+	}
+	st := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+	et := st.AddDate(0, 1, 0)
+	now := time.Now()
+	if et.After(now) {
+		et = now.Truncate(time.Minute)
+	}
+	if !et.After(st) {
+		return nil, fmt.Errorf("invalid month")
+	}
+	r := &SLAReportEnt{
+		SLAID:        s.ID,
+		Name:         s.Name,
+		Scope:        s.Scope,
+		TargetName:   getSLATargetName(s),
+		Month:        st.Format("2006-01"),
+		Start:        st.UnixNano(),
+		End:          et.UnixNano(),
+		Target:       s.Target,
+		Availability: -1,
+		Pollings:     []*SLAPollingReportEnt{},
+		Outages:      []*SLAOutageEnt{},
+	}
+	mask := makeSLAMask(s, st, et, r)
+	total := make([]int8, len(mask))
+	for _, p := range getSLAPollings(s) {
+		states := getSLAPollingStates(p, st, et, len(mask))
+		pr := &SLAPollingReportEnt{
+			PollingID:   p.ID,
+			PollingName: p.Name,
+		}
+		if n := GetNode(p.NodeID); n != nil {
+			pr.NodeName = n.Name
+		}
+		pr.UpMin, pr.DownMin, pr.Failures, _ = countSLAStates(states, mask, st)
+		pr.Availability = slaAvailability(pr.UpMin, pr.DownMin)
+		r.Pollings = append(r.Pollings, pr)
+		// 一つでも停止していれば停止とする
+		for i, v := range states {
+			if v > total[i] {
+				total[i] = v
+			}
+		}
+	}
+	r.UpMin, r.DownMin, r.Failures, r.Outages = countSLAStates(total, mask, st)
+	r.UnknownMin = r.ServiceMin - r.UpMin - r.DownMin
+	r.Availability = slaAvailability(r.UpMin, r.DownMin)
+	r.Met = r.Availability >= 0 && r.Availability >= r.Target
+	if r.Failures > 0 {
+		r.MTTR = float64(r.DownMin) / float64(r.Failures)
+		r.MTBF = float64(r.UpMin) / float64(r.Failures)
+	} else {
+		r.MTBF = float64(r.UpMin)
+	}
+	return r, nil
+}
+
+func slaAvailability(up, down int) float64 {
+	if up+down < 1 {
+		return -1
+	}
+	return float64(up) * 100.0 / float64(up+down)
+}
+
+// makeSLAMask : 分毎にSLAの対象時間かどうかを判断する
+func makeSLAMask(s *SLAEnt, st, et time.Time, r *SLAReportEnt) []bool {
+	n := int(et.Sub(st) / time.Minute)
+	mask := make([]bool, n)
+	var start, end int
+	if s.BusinessHours {
+		start, _ = parseSLAClock(s.StartTime)
+		end, _ = parseSLAClock(s.EndTime)
+	}
+	weekdays := make(map[int]bool)
+	for _, w := range s.Weekdays {
+		weekdays[w] = true
+	}
+	if len(weekdays) < 1 {
+		for w := 1; w <= 5; w++ {
+			weekdays[w] = true
+		}
+	}
+	holidays := map[string]bool{}
+	if s.ExcludeHolidays {
+		holidays = getHolidayMap()
+	}
+	for i := range mask {
+		t := st.Add(time.Duration(i) * time.Minute)
+		if s.BusinessHours {
+			if !weekdays[int(t.Weekday())] {
+				continue
+			}
+			m := t.Hour()*60 + t.Minute()
+			if start < end {
+				if m < start || m >= end {
+					continue
+				}
+			} else if m < start && m >= end {
+				// 日付をまたぐ営業時間
+				continue
+			}
+		}
+		if holidays[t.Format("2006-01-02")] {
+			continue
+		}
+		mask[i] = true
+	}
+	for _, m := range s.Maintenance {
+		for i := range mask {
+			t := st.Add(time.Duration(i) * time.Minute).UnixNano()
+			if mask[i] && t >= m.Start && t < m.End {
+				mask[i] = false
+				r.MaintenanceMin++
+			}
+		}
+	}
+	for _, v := range mask {
+		if v {
+			r.ServiceMin++
+		}
+	}
+	return mask
+}
+
+// slaStateOf : ポーリングの状態を稼働、停止に分類する
+func slaStateOf(state string) int8 {
+	switch state {
+	case "normal", "repair":
+		return slaUp
+	case "high", "low", "warn":
+		return slaDown
+	}
+	return slaUnknown
+}
+
+type slaChange struct {
+	time  int64
+	state int8
+}
+
+// getSLAPollingStates : ポーリングの状態の変化から分毎の状態を作成する
+// ポーリングログがあればポーリングログ、なければイベントログの状態変化を使う
+func getSLAPollingStates(p *PollingEnt, st, et time.Time, n int) []int8 {
+	init := int8(slaUnknown)
+	changes := []slaChange{}
+	if p.LogMode != LogModeNone {
+		ForEachPollingLog(0, st.UnixNano()-1, p.ID, func(l *PollingLogEnt) bool {
+			init = slaStateOf(l.State)
+			return false
+		})
+		ForEachPollingLog(st.UnixNano(), et.UnixNano(), p.ID, func(l *PollingLogEnt) bool {
+			changes = append(changes, slaChange{time: l.Time, state: slaStateOf(l.State)})
+			return true
+		})
+	}
+	if p.LogMode == LogModeNone || (len(changes) < 1 && init == slaUnknown) {
+		init, changes = getSLAEventChanges(p, st, et)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].time < changes[j].time
+	})
+	states := make([]int8, n)
+	cur := init
+	j := 0
+	for i := range states {
+		s := st.Add(time.Duration(i) * time.Minute).UnixNano()
+		for ; j < len(changes) && changes[j].time <= s; j++ {
+			cur = changes[j].state
+		}
+		// その分の間に停止があれば停止とする
+		t := s + int64(time.Minute)
+		worst := cur
+		for ; j < len(changes) && changes[j].time < t; j++ {
+			cur = changes[j].state
+			if cur > worst {
+				worst = cur
+			}
+		}
+		states[i] = worst
+	}
+	return states
+}
+
+// getSLAEventChanges : イベントログのポーリング状態変化から状態の変化を取得する
+func getSLAEventChanges(p *PollingEnt, st, et time.Time) (int8, []slaChange) {
+	prefix := fmt.Sprintf("ポーリング状態変化:%s(%s):", p.Name, p.Type)
+	changes := []slaChange{}
+	init := int8(-1)
+	// 新しい順に読むので最後に見つけた変化の前の状態が期間の最初の状態
+	ForEachLastEventLog(st.UnixNano(), func(l *EventLogEnt) bool {
+		if l.Type != "polling" || l.NodeID != p.NodeID || !strings.HasPrefix(l.Event, prefix) {
+			return true
+		}
+		init = slaStateOf(strings.TrimPrefix(l.Event, prefix))
+		if l.Time < et.UnixNano() {
+			changes = append(changes, slaChange{time: l.Time, state: slaStateOf(l.Level)})
+		}
+		return true
+	})
+	if init < 0 {
+		// 期間以降に変化がなければ現在の状態が続いている
+		init = slaStateOf(p.State)
+	}
+	return init, changes
+}
+
+// countSLAStates : 対象時間の稼働、停止の時間と停止回数を集計する
+func countSLAStates(states []int8, mask []bool, st time.Time) (int, int, int, []*SLAOutageEnt) {
+	up := 0
+	down := 0
+	failures := 0
+	outages := []*SLAOutageEnt{}
+	var cur *SLAOutageEnt
+	last := int8(slaUnknown)
+	for i, v := range states {
+		if !mask[i] {
+			continue
+		}
+		t := st.Add(time.Duration(i) * time.Minute).UnixNano()
+		switch v {
+		case slaUp:
+			up++
+		case slaDown:
+			down++
+			if last != slaDown {
+				failures++
+				cur = nil
+				if len(outages) < maxSLAOutages {
+					cur = &SLAOutageEnt{Start: t}
+					outages = append(outages, cur)
+				}
+			}
+			if cur != nil {
+				cur.End = t + int64(time.Minute)
+				cur.Duration++
+			}
+		default:
+			continue
+		}
+		last = v
+	}
+	return up, down, failures, outages
+}
@@ -21,6 +21,9 @@ type DBStatsEnt struct {
 	PeakSpeed   float64
 	BackupTime  int64
 	BackupStart int64
+	// 日毎のログパーティション
+	LogPartSize  int64
+	LogPartCount int
 }
 
 type DBStatsLogEnt struct {
@@ -41,6 +44,7 @@ func UpdateDBStats() {
 		return nil
 	})
 	DBStats.Size = dbSize
+	DBStats.LogPartSize, DBStats.LogPartCount = getLogPartSize()
 	DBStats.TotalWrite = int64(s.TxStats.Write)
 	DBStats.Write = int64(d.TxStats.Write)
 	if DBStats.PeakWrite < DBStats.Write {
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"sort"
+	"strings"
+)
+
+// TagEnt : タグとグループの利用数
+type TagEnt struct {
+	Name     string
+	Group    bool
+	Nodes    int
+	Pollings int
+}
+
+// MatchTagSelector : タグとグループがセレクタに一致するか判断する
+// セレクタはカンマまたは空白区切りの条件で全てを満たす必要がある
+//
+//	tag        タグを持つ
+//	!tag       タグを持たない
+//	group:a/b  グループa/bまたはその配下
+func MatchTagSelector(sel string, tags []string, group string) bool {
+	for _, t := range strings.FieldsFunc(sel, func(r rune) bool { return r == ',' || r == ' ' }) {
+		switch {
+		case strings.HasPrefix(t, "group:"):
+			g := strings.Trim(strings.TrimPrefix(t, "group:"), "/")
+			if group != g && !strings.HasPrefix(group, g+"/") {
+				return false
+			}
+		case strings.HasPrefix(t, "!"):
+			if hasTag(tags, t[1:]) {
+				return false
+			}
+		default:
+			if !hasTag(tags, t) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasTag(tags []string, t string) bool {
+	for _, e := range tags {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeMatchTagSelector : ノードがセレクタに一致するか判断する
+func NodeMatchTagSelector(n *NodeEnt, sel string) bool {
+	if sel == "" {
+		return true
+	}
+	return MatchTagSelector(sel, n.Tags, n.Group)
+}
+
+// PollingMatchTagSelector : ポーリングがセレクタに一致するか判断する
+// ポーリングのタグにはノードのタグを含める、グループは未設定ならノードのグループ
+func PollingMatchTagSelector(p *PollingEnt, sel string) bool {
+	if sel == "" {
+		return true
+	}
+	tags := p.Tags
+	group := p.Group
+	if n := GetNode(p.NodeID); n != nil {
+		tags = append(append([]string{}, p.Tags...), n.Tags...)
+		if group == "" {
+			group = n.Group
+		}
+	}
+	return MatchTagSelector(sel, tags, group)
+}
+
+// NormalizeTags : タグの空白を除いて重複を削除する
+func NormalizeTags(tags []string) []string {
+	ret := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || strings.ContainsAny(t, ", ") || hasTag(ret, t) {
+			continue
+		}
+		ret = append(ret, t)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NormalizeGroup : グループのパスを正規化する
+func NormalizeGroup(g string) string {
+	a := []string{}
+	for _, e := range strings.Split(g, "/") {
+		if e = strings.TrimSpace(e); e != "" {
+			a = append(a, e)
+		}
+	}
+	return strings.Join(a, "/")
+}
+
+// GetTagList : 利用しているタグとグループのリスト
+func GetTagList() []*TagEnt {
+	m := make(map[string]*TagEnt)
+	get := func(name string, group bool) *TagEnt {
+		k := name
+		if group {
+			k = "group:" + name
+		}
+		if e, ok := m[k]; ok {
+			return e
+		}
+		e := &TagEnt{Name: name, Group: group}
+		m[k] = e
+		return e
+	}
+	addGroup := func(g string, node bool) {
+		// 上位のグループも数える
+		a := strings.Split(g, "/")
+		for i := range a {
+			e := get(strings.Join(a[:i+1], "/"), true)
+			if node {
+				e.Nodes++
+			} else {
+				e.Pollings++
+			}
+		}
+	}
+	ForEachNodes(func(n *NodeEnt) bool {
+		for _, t := range n.Tags {
+			get(t, false).Nodes++
+		}
+		if n.Group != "" {
+			addGroup(n.Group, true)
+		}
+		return true
+	})
+	ForEachPollings(func(p *PollingEnt) bool {
+		for _, t := range p.Tags {
+			get(t, false).Pollings++
+		}
+		if p.Group != "" {
+			addGroup(p.Group, false)
+		}
+		return true
+	})
+	ret := []*TagEnt{}
+	for _, e := range m {
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Group != ret[j].Group {
+			return ret[i].Group
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
@@ -0,0 +1,458 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ThreatFeedEnt : 脅威情報フィードの設定
+type ThreatFeedEnt struct {
+	ID         string
+	Name       string
+	Source     string // URLまたはThreatFeedDirのファイル名
+	Format     string // "" (自動) | text | csv | stix
+	Interval   int    // 更新間隔(分)
+	Disabled   bool
+	Count      int
+	LastUpdate int64
+	Error      string
+}
+
+// 脅威情報フィードの指標
+type threatIndicatorSet struct {
+	ips     map[string]bool
+	nets    []*net.IPNet
+	domains map[string]bool
+	hashes  map[string]bool
+}
+
+// 保存したフィードは変更せずにコピーを入れ替える
+var threatFeeds sync.Map
+var threatFeedMu sync.Mutex
+var threatIndicators sync.Map
+
+// ThreatFeedDir : ファイルから読み込む脅威情報フィードを置くディレクトリ
+func ThreatFeedDir() string {
+	return filepath.Join(dspath, "threatfeeds")
+}
+
+func loadThreatFeeds() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("threatFeeds"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var f ThreatFeedEnt
+			if err := json.Unmarshal(v, &f); err == nil {
+				f.Count = 0
+				f.LastUpdate = 0
+				f.Error = ""
+				threatFeeds.Store(f.ID, &f)
+			}
+			return nil
+		})
+	})
+}
+
+// UpdateThreatFeed : 脅威情報フィードを追加または更新する
+func UpdateThreatFeed(f *ThreatFeedEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if f.Source == "" {
+		return ErrInvalidParams
+	}
+	if f.ID == "" {
+		for {
+			f.ID = makeKey()
+			if _, ok := threatFeeds.Load(f.ID); !ok {
+				break
+			}
+		}
+	} else if _, ok := threatFeeds.Load(f.ID); !ok {
+		return ErrInvalidID
+	}
+	if f.Interval < 10 {
+		f.Interval = 60
+	}
+	j, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	err = db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("threatFeeds"))
+		return b.Put([]byte(f.ID), j)
+	})
+	if err != nil {
+		return err
+	}
+	threatFeedMu.Lock()
+	if old := GetThreatFeed(f.ID); old != nil {
+		// 読み込みの状態は残す
+		f.Count = old.Count
+		f.LastUpdate = old.LastUpdate
+		f.Error = old.Error
+	}
+	threatFeeds.Store(f.ID, f)
+	threatFeedMu.Unlock()
+	if f.Disabled {
+		threatIndicators.Delete(f.ID)
+	}
+	return nil
+}
+
+// DeleteThreatFeed : 脅威情報フィードを削除する
+func DeleteThreatFeed(id string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	if _, ok := threatFeeds.Load(id); !ok {
+		return ErrInvalidID
+	}
+	err := db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("threatFeeds"))
+		return b.Delete([]byte(id))
+	})
+	threatFeeds.Delete(id)
+	threatIndicators.Delete(id)
+	return err
+}
+
+// GetThreatFeed : IDで脅威情報フィードを取得する
+func GetThreatFeed(id string) *ThreatFeedEnt {
+	if v, ok := threatFeeds.Load(id); ok {
+		return v.(*ThreatFeedEnt)
+	}
+	return nil
+}
+
+// GetThreatFeeds : 脅威情報フィードを名前順に取得する
+func GetThreatFeeds() []*ThreatFeedEnt {
+	ret := []*ThreatFeedEnt{}
+	threatFeeds.Range(func(_, v any) bool {
+		ret = append(ret, v.(*ThreatFeedEnt))
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// SetThreatFeedData : フィードの内容を解析して指標を登録する
+func SetThreatFeedData(id string, data []byte) (int, error) {
+	f := GetThreatFeed(id)
+	if f == nil {
+		return 0, ErrInvalidID
+	}
+	s, n, err := parseThreatFeed(data, f.Format)
+	if err != nil {
+		SetThreatFeedError(id, err)
+		return 0, err
+	}
+	setThreatFeedState(id, n, "")
+	threatIndicators.Store(id, s)
+	log.Printf("threat feed name=%s count=%d", f.Name, n)
+	return n, nil
+}
+
+// SetThreatFeedError : フィードの取得エラーを記録する
+func SetThreatFeedError(id string, err error) {
+	setThreatFeedState(id, -1, err.Error())
+}
+
+// setThreatFeedState : 読み込みの結果を記録する countが負の場合は件数を変更しない
+func setThreatFeedState(id string, count int, e string) {
+	threatFeedMu.Lock()
+	defer threatFeedMu.Unlock()
+	f := GetThreatFeed(id)
+	if f == nil {
+		return
+	}
+	c := *f
+	c.LastUpdate = time.Now().UnixNano()
+	c.Error = e
+	if count >= 0 {
+		c.Count = count
+	}
+	threatFeeds.Store(id, &c)
+}
+
+// HasThreatIndicators : 脅威情報の指標が登録されているか
+func HasThreatIndicators() bool {
+	r := false
+	threatIndicators.Range(func(_, _ any) bool {
+		r = true
+		return false
+	})
+	return r
+}
+
+func matchThreat(check func(s *threatIndicatorSet) bool) []string {
+	ret := []string{}
+	threatIndicators.Range(func(k, v any) bool {
+		if check(v.(*threatIndicatorSet)) {
+			if f := GetThreatFeed(k.(string)); f != nil {
+				ret = append(ret, f.Name)
+			}
+		}
+		return true
+	})
+	sort.Strings(ret)
+	return ret
+}
+
+// MatchThreatIP : IPアドレスに一致する脅威情報フィード名を返す
+func MatchThreatIP(sip string) []string {
+	ip := net.ParseIP(sip)
+	if ip == nil {
+		return []string{}
+	}
+	k := ip.String()
+	return matchThreat(func(s *threatIndicatorSet) bool {
+		if s.ips[k] {
+			return true
+		}
+		for _, n := range s.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// MatchThreatDomain : ドメイン名(上位ドメインを含む)に一致する脅威情報フィード名を返す
+func MatchThreatDomain(d string) []string {
+	d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+	if d == "" {
+		return []string{}
+	}
+	return matchThreat(func(s *threatIndicatorSet) bool {
+		for n := d; n != ""; {
+			if s.domains[n] {
+				return true
+			}
+			i := strings.Index(n, ".")
+			if i < 0 {
+				break
+			}
+			n = n[i+1:]
+		}
+		return false
+	})
+}
+
+// MatchThreatHash : ハッシュ値に一致する脅威情報フィード名を返す
+func MatchThreatHash(h string) []string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	return matchThreat(func(s *threatIndicatorSet) bool {
+		return s.hashes[h]
+	})
+}
+
+// FindThreatIndicator : テキストに含まれる指標を探して最初に一致したものを返す
+func FindThreatIndicator(text string) (string, []string) {
+	for _, t := range strings.FieldsFunc(text, func(c rune) bool {
+		return !(c == '.' || c == ':' || c == '-' || c == '_' ||
+			(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'))
+	}) {
+		t = strings.Trim(t, ".:-_")
+		list := []string{t}
+		if strings.Contains(t, ":") && net.ParseIP(t) == nil {
+			// host:port形式
+			list = append(list, strings.Split(t, ":")...)
+		}
+		for _, e := range list {
+			var feeds []string
+			switch typ, v := classifyThreatIndicator(e); typ {
+			case "ip":
+				feeds = MatchThreatIP(v)
+			case "domain":
+				feeds = MatchThreatDomain(v)
+			case "hash":
+				feeds = MatchThreatHash(v)
+			}
+			if len(feeds) > 0 {
+				return e, feeds
+			}
+		}
+	}
+	return "", []string{}
+}
+
+var hashReg = regexp.MustCompile(`^([0-9a-f]{32}|[0-9a-f]{40}|[0-9a-f]{64})$`)
+var domainReg = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_-]*[a-z0-9])?\.)+[a-z][a-z0-9-]*[a-z0-9]$`)
+
+// classifyThreatIndicator : 指標の種別(ip|net|domain|hash)を判定する
+func classifyThreatIndicator(v string) (string, string) {
+	v = strings.Trim(strings.TrimSpace(v), "\"'")
+	if v == "" {
+		return "", ""
+	}
+	if strings.Contains(v, "://") {
+		if u, err := url.Parse(v); err == nil && u.Hostname() != "" {
+			v = u.Hostname()
+		}
+	}
+	if ip := net.ParseIP(v); ip != nil {
+		return "ip", ip.String()
+	}
+	if strings.Contains(v, "/") {
+		if _, n, err := net.ParseCIDR(v); err == nil {
+			return "net", n.String()
+		}
+		return "", ""
+	}
+	v = strings.ToLower(v)
+	if hashReg.MatchString(v) {
+		return "hash", v
+	}
+	v = strings.TrimPrefix(strings.TrimSuffix(v, "."), "*.")
+	if domainReg.MatchString(v) {
+		return "domain", v
+	}
+	return "", ""
+}
+
+func (s *threatIndicatorSet) add(v string) bool {
+	typ, v := classifyThreatIndicator(v)
+	switch typ {
+	case "ip":
+		s.ips[v] = true
+	case "net":
+		if _, n, err := net.ParseCIDR(v); err == nil {
+			s.nets = append(s.nets, n)
+		}
+	case "domain":
+		s.domains[v] = true
+	case "hash":
+		s.hashes[v] = true
+	default:
+		return false
+	}
+	return true
+}
+
+// parseThreatFeed : テキスト、CSV、STIX 2.1バンドルから指標を取り出す
+func parseThreatFeed(data []byte, format string) (*threatIndicatorSet, int, error) {
+	s := &threatIndicatorSet{
+		ips:     make(map[string]bool),
+		domains: make(map[string]bool),
+		hashes:  make(map[string]bool),
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		t := bytes.TrimSpace(data)
+		if bytes.HasPrefix(t, []byte("{")) {
+			format = "stix"
+		} else {
+			format = "text"
+		}
+	}
+	n := 0
+	switch format {
+	case "stix":
+		var err error
+		if n, err = parseThreatSTIX(s, data); err != nil {
+			return nil, 0, err
+		}
+	case "csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		r.Comment = '#'
+		for {
+			rec, err := r.Read()
+			if err != nil {
+				break
+			}
+			// 最初に指標として解釈できる列を使う
+			for _, v := range rec {
+				if s.add(v) {
+					n++
+					break
+				}
+			}
+		}
+	case "text":
+		for _, l := range strings.Split(string(data), "\n") {
+			l = strings.TrimSpace(l)
+			if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, ";") {
+				continue
+			}
+			if f := strings.Fields(l); len(f) > 0 && s.add(f[0]) {
+				n++
+			}
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown format %s", format)
+	}
+	if n < 1 {
+		return nil, 0, fmt.Errorf("no indicator")
+	}
+	return s, n, nil
+}
+
+var stixPatternReg = regexp.MustCompile(`([a-z0-9-]+):(value|hashes\.'?[A-Za-z0-9-]+'?)\s*=\s*'([^']*)'`)
+
+func parseThreatSTIX(s *threatIndicatorSet, data []byte) (int, error) {
+	var bundle struct {
+		Type    string                   `json:"type"`
+		Objects []map[string]interface{} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return 0, err
+	}
+	if bundle.Type != "bundle" {
+		return 0, fmt.Errorf("not stix bundle")
+	}
+	n := 0
+	for _, o := range bundle.Objects {
+		switch t, _ := o["type"].(string); t {
+		case "indicator":
+			if pt, ok := o["pattern_type"].(string); ok && pt != "stix" {
+				continue
+			}
+			p, _ := o["pattern"].(string)
+			for _, m := range stixPatternReg.FindAllStringSubmatch(p, -1) {
+				switch m[1] {
+				case "ipv4-addr", "ipv6-addr", "domain-name", "url", "file":
+					if s.add(m[3]) {
+						n++
+					}
+				}
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name", "url":
+			if v, ok := o["value"].(string); ok && s.add(v) {
+				n++
+			}
+		case "file":
+			if h, ok := o["hashes"].(map[string]interface{}); ok {
+				for _, v := range h {
+					if v, ok := v.(string); ok && s.add(v) {
+						n++
+					}
+				}
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// TicketConfEnt : 外部のチケット管理システムとの連携の設定
+// URLとBodyはGoのテンプレート(.TicketIDでチケットのIDを参照できる)
+type TicketConfEnt struct {
+	Enable             bool
+	Level              string // チケットを作成するレベル(high,low,warn)
+	Headers            string // 1行に1つ "名前: 値"
+	User               string // Basic認証
+	Password           string
+	Token              string // Bearerトークン
+	InsecureSkipVerify bool
+	CreateURL          string
+	CreateMethod       string
+	CreateBody         string
+	IDPath             string // 作成時の応答からチケットIDを取り出すJSONのパス(例 key,iid,result.sys_id)
+	CommentURL         string
+	CommentMethod      string
+	CommentBody        string
+	CloseURL           string
+	CloseMethod        string
+	CloseBody          string
+	CloseDelay         int // 復帰後に閉じるまでの時間(分)、この間に再発生した場合はコメントを追加する
+}
+
+// TicketEnt : ポーリングの障害に対応するチケット
+type TicketEnt struct {
+	PollingID  string
+	NodeID     string
+	TicketID   string
+	State      string // open|closing
+	Level      string
+	OpenTime   int64
+	UpdateTime int64
+	CloseAt    int64
+	Comments   int
+	Error      string
+}
+
+var TicketConf TicketConfEnt
+
+var tickets sync.Map
+
+func loadTicketConf(b *bbolt.Bucket) {
+	v := b.Get([]byte("ticketConf"))
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(v, &TicketConf); err != nil {
+		log.Printf("load ticket conf err=%v", err)
+		return
+	}
+	TicketConf.Password = decryptSecret(TicketConf.Password)
+	TicketConf.Token = decryptSecret(TicketConf.Token)
+}
+
+// SaveTicketConf : チケット連携の設定を保存する
+func SaveTicketConf() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	c := TicketConf
+	c.Password = encryptSecret(c.Password)
+	c.Token = encryptSecret(c.Token)
+	s, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("config"))
+		if b == nil {
+			return fmt.Errorf("bucket config is nil")
+		}
+		return b.Put([]byte("ticketConf"), s)
+	})
+}
+
+func loadTickets() error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	return db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("tickets"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var t TicketEnt
+			if err := json.Unmarshal(v, &t); err == nil {
+				tickets.Store(t.PollingID, &t)
+			}
+			return nil
+		})
+	})
+}
+
+// GetTicket : ポーリングのチケット
+func GetTicket(pollingID string) *TicketEnt {
+	if v, ok := tickets.Load(pollingID); ok {
+		return v.(*TicketEnt)
+	}
+	return nil
+}
+
+// SaveTicket : チケットを保存する
+func SaveTicket(t *TicketEnt) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	t.UpdateTime = time.Now().UnixNano()
+	j, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	tickets.Store(t.PollingID, t)
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("tickets"))
+		return b.Put([]byte(t.PollingID), j)
+	})
+}
+
+// DeleteTicket : 閉じたチケットを削除する
+func DeleteTicket(pollingID string) error {
+	if db == nil {
+		return ErrDBNotOpen
+	}
+	tickets.Delete(pollingID)
+	return db.Batch(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("tickets"))
+		return b.Delete([]byte(pollingID))
+	})
+}
+
+func ForEachTickets(f func(*TicketEnt) bool) {
+	tickets.Range(func(_, v any) bool {
+		return f(v.(*TicketEnt))
+	})
+}
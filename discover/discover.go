@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -273,71 +274,18 @@ func GetDiscoverIPRange() []DiscoverIPRangeEnt {
 }
 
 func getSnmpInfo(t string, dent *discoverInfoEnt) {
+	cred := datastore.GetMapCredential()
 	agent := &gosnmp.GoSNMP{
 		Target:    t,
 		Port:      161,
 		Transport: "udp",
-		Community: datastore.MapConf.Community,
+		Community: cred.Community,
 		Version:   gosnmp.Version2c,
 		Timeout:   time.Duration(datastore.DiscoverConf.Timeout) * time.Second,
 		Retries:   datastore.DiscoverConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch datastore.MapConf.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	}
+	cred.SetSnmpAgent(agent)
 	err := agent.Connect()
 	if err != nil {
 		log.Printf("discover err=%v", err)
@@ -401,10 +349,8 @@ func addFoundNode(dent *discoverInfoEnt) {
 		}
 	}
 	if dent.SysObjectID != "" {
-		n.SnmpMode = datastore.MapConf.SnmpMode
-		n.User = datastore.MapConf.SnmpUser
-		n.Password = datastore.MapConf.SnmpPassword
-		n.Community = datastore.MapConf.Community
+		n.SysObjectID = dent.SysObjectID
+		setDiscoverCredential(&n)
 		n.Icon = "hdd"
 		n.Descr += " / snmp対応"
 	}
@@ -437,19 +383,21 @@ func addFoundNode(dent *discoverInfoEnt) {
 	if datastore.DiscoverConf.AddNetwork && datastore.FindNetworkByIP(n.IP) == nil {
 		if _, ok := dent.ServerList["lldp"]; ok {
 			datastore.AddNetwork(&datastore.NetworkEnt{
-				Name:      n.Name,
-				IP:        n.IP,
-				X:         n.X + GRID,
-				Y:         n.Y,
-				SnmpMode:  n.SnmpMode,
-				Community: n.Community,
-				User:      n.User,
-				Password:  n.Password,
-				HPorts:    24,
-				Ports:     []datastore.PortEnt{},
+				Name:         n.Name,
+				IP:           n.IP,
+				X:            n.X + GRID,
+				Y:            n.Y,
+				SnmpMode:     n.SnmpMode,
+				Community:    n.Community,
+				User:         n.User,
+				Password:     n.Password,
+				CredentialID: n.Credentials["snmp"],
+				HPorts:       24,
+				Ports:        []datastore.PortEnt{},
 			})
 		}
 	}
+	autoAddMatchedPollings(&n, dent)
 	if len(datastore.DiscoverConf.AutoAddPollings) < 1 {
 		return
 	}
@@ -460,17 +408,31 @@ func addFoundNode(dent *discoverInfoEnt) {
 	autoAddPollings(&n)
 }
 
+// setDiscoverCredential : 発見したノードにSNMPの認証情報を設定する
+// プロファイルを指定している場合は参照だけを設定する
+func setDiscoverCredential(n *datastore.NodeEnt) {
+	if c := datastore.GetCredential(datastore.MapConf.CredentialID); c != nil {
+		n.SnmpMode = c.SnmpMode
+		n.Credentials = map[string]string{"snmp": c.ID}
+		return
+	}
+	n.SnmpMode = datastore.MapConf.SnmpMode
+	n.User = datastore.MapConf.SnmpUser
+	n.Password = datastore.MapConf.SnmpPassword
+	n.Community = datastore.MapConf.Community
+}
+
 func updateNode(n *datastore.NodeEnt, dent *discoverInfoEnt) {
 	if n.Name == n.IP {
 		if dent.SysName != "" {
 			n.Name = dent.SysName
 		}
 	}
-	if dent.SysObjectID != "" && n.User == "" && n.Community == "" {
-		n.SnmpMode = datastore.MapConf.SnmpMode
-		n.User = datastore.MapConf.SnmpUser
-		n.Password = datastore.MapConf.SnmpPassword
-		n.Community = datastore.MapConf.Community
+	if dent.SysObjectID != "" {
+		n.SysObjectID = dent.SysObjectID
+	}
+	if dent.SysObjectID != "" && n.User == "" && n.Community == "" && n.Credentials["snmp"] == "" {
+		setDiscoverCredential(n)
 		if n.Icon == "desktop" {
 			n.Icon = "hdd"
 			n.Descr += " / snmp対応"
@@ -486,16 +448,17 @@ func updateNode(n *datastore.NodeEnt, dent *discoverInfoEnt) {
 	if datastore.DiscoverConf.AddNetwork && datastore.FindNetworkByIP(n.IP) == nil {
 		if _, ok := dent.ServerList["lldp"]; ok {
 			datastore.AddNetwork(&datastore.NetworkEnt{
-				Name:      n.Name,
-				IP:        n.IP,
-				X:         n.X + GRID,
-				Y:         n.Y,
-				SnmpMode:  n.SnmpMode,
-				Community: n.Community,
-				User:      n.User,
-				Password:  n.Password,
-				HPorts:    24,
-				Ports:     []datastore.PortEnt{},
+				Name:         n.Name,
+				IP:           n.IP,
+				X:            n.X + GRID,
+				Y:            n.Y,
+				SnmpMode:     n.SnmpMode,
+				Community:    n.Community,
+				User:         n.User,
+				Password:     n.Password,
+				CredentialID: n.Credentials["snmp"],
+				HPorts:       24,
+				Ports:        []datastore.PortEnt{},
 			})
 		}
 	}
@@ -516,35 +479,55 @@ func autoAddPollings(n *datastore.NodeEnt) {
 			log.Printf("add polling template not found id=%s", id)
 			continue
 		}
-		if pt.AutoMode == "disable" {
-			continue
+		if err := addPollingByTemplate(n, pt); err != nil {
+			log.Printf("discover err=%v", err)
+			return
 		}
-		if pt.AutoMode != "" {
-			// インデックスの展開などを行う並列で処理する
-			go polling.AutoAddPolling(n, pt)
-			continue
+	}
+}
+
+// autoAddMatchedPollings : 条件に一致するテンプレートのポーリングを追加する
+func autoAddMatchedPollings(n *datastore.NodeEnt, dent *discoverInfoEnt) {
+	datastore.ForEachPollingTemplate(func(pt *datastore.PollingTemplateEnt) bool {
+		if slices.Contains(datastore.DiscoverConf.AutoAddPollings, pt.ID) {
+			return true
 		}
-		p := new(datastore.PollingEnt)
-		p.Name = pt.Name
-		p.NodeID = n.ID
-		p.Type = pt.Type
-		p.Params = pt.Params
-		p.Mode = pt.Mode
-		p.Script = pt.Script
-		p.Extractor = pt.Extractor
-		p.Filter = pt.Filter
-		p.Level = pt.Level
-		p.PollInt = datastore.MapConf.PollInt
-		p.Timeout = datastore.MapConf.Timeout
-		p.Retry = datastore.MapConf.Timeout
-		p.LogMode = 0
-		p.NextTime = 0
-		p.State = "unknown"
-		if err := datastore.AddPollingWithDupCheck(p); err != nil {
+		if !datastore.MatchPollingTemplate(pt, n, dent.ServerList) {
+			return true
+		}
+		if err := addPollingByTemplate(n, pt); err != nil {
 			log.Printf("discover err=%v", err)
-			return
 		}
+		return true
+	})
+}
+
+func addPollingByTemplate(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt) error {
+	if pt.AutoMode == "disable" {
+		return nil
+	}
+	if pt.AutoMode != "" {
+		// インデックスの展開などを行う並列で処理する
+		go polling.AutoAddPolling(n, pt)
+		return nil
 	}
+	p := new(datastore.PollingEnt)
+	p.Name = pt.Name
+	p.NodeID = n.ID
+	p.Type = pt.Type
+	p.Params = pt.Params
+	p.Mode = pt.Mode
+	p.Script = pt.Script
+	p.Extractor = pt.Extractor
+	p.Filter = pt.Filter
+	p.Level = pt.Level
+	p.PollInt = datastore.MapConf.PollInt
+	p.Timeout = datastore.MapConf.Timeout
+	p.Retry = datastore.MapConf.Retry
+	p.LogMode = 0
+	p.NextTime = 0
+	p.State = "unknown"
+	return datastore.AddPollingWithDupCheck(p)
 }
 
 func addBasicPolling(dent *discoverInfoEnt, n *datastore.NodeEnt) {
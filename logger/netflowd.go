@@ -82,12 +82,12 @@ func netflowd(stopCh chan bool) {
 				}
 				switch p := m.(type) {
 				case *netflow5.Packet:
-					logNetflow(p)
+					logNetflow(remote.IP.String(), p)
 					report.UpdateSensor(remote.IP.String(), "netflow", len(p.Records))
 				case *netflow9.Packet:
-					report.UpdateSensor(remote.IP.String(), "netflow9", logNetflow9(p))
+					report.UpdateSensor(remote.IP.String(), "netflow9", logNetflow9(remote.IP.String(), p))
 				case *ipfix.Message:
-					report.UpdateSensor(remote.IP.String(), "ipfix", logIPFIX(p))
+					report.UpdateSensor(remote.IP.String(), "ipfix", logIPFIX(remote.IP.String(), p))
 				default:
 					log.Printf("not suppoted netflow p=%+v", p)
 				}
@@ -96,7 +96,7 @@ func netflowd(stopCh chan bool) {
 	}
 }
 
-func logIPFIX(p *ipfix.Message) int {
+func logIPFIX(exporter string, p *ipfix.Message) int {
 	r := 0
 	for _, ds := range p.DataSets {
 		if ds.Records == nil {
@@ -139,6 +139,7 @@ func logIPFIX(p *ipfix.Message) int {
 				Type: "ipfix",
 				Log:  string(s),
 			}
+			reportFlowStatsFromRecord(exporter, record)
 			if _, ok := record["sourceIPv4Address"]; ok {
 				defer func() {
 					if r := recover(); r != nil {
@@ -230,7 +231,7 @@ func logIPFIX(p *ipfix.Message) int {
 	return r
 }
 
-func logNetflow(p *netflow5.Packet) {
+func logNetflow(exporter string, p *netflow5.Packet) {
 	var record = make(map[string]interface{})
 	for _, r := range p.Records {
 		record["srcAddr"] = r.SrcAddr
@@ -260,6 +261,20 @@ func logNetflow(p *netflow5.Packet) {
 			Type: "netflow",
 			Log:  string(s),
 		}
+		report.ReportFlowStats(&report.FlowStatsEnt{
+			Exporter: exporter,
+			SrcIP:    r.SrcAddr.String(),
+			SrcPort:  int(r.SrcPort),
+			DstIP:    r.DstAddr.String(),
+			DstPort:  int(r.DstPort),
+			Prot:     int(r.Protocol),
+			SrcAS:    int(r.SrcAS),
+			DstAS:    int(r.DstAS),
+			InIf:     int(r.Input),
+			OutIf:    int(r.Output),
+			Packets:  int64(r.Packets),
+			Bytes:    int64(r.Bytes),
+		})
 		if v, ok := record["srcAddr"]; ok && v != nil {
 			defer func() {
 				if r := recover(); r != nil {
@@ -283,7 +298,7 @@ func logNetflow(p *netflow5.Packet) {
 	}
 }
 
-func logNetflow9(p *netflow9.Packet) int {
+func logNetflow9(exporter string, p *netflow9.Packet) int {
 	r := 0
 	for _, ds := range p.DataFlowSets {
 		if ds.Records == nil {
@@ -324,6 +339,7 @@ func logNetflow9(p *netflow9.Packet) int {
 				Type: "ipfix",
 				Log:  string(s),
 			}
+			reportFlowStatsFromRecord(exporter, record)
 			if _, ok := record["sourceIPv4Address"]; ok {
 				defer func() {
 					if r := recover(); r != nil {
@@ -401,3 +417,51 @@ func logNetflow9(p *netflow9.Packet) int {
 	}
 	return r
 }
+
+// reportFlowStatsFromRecord : IPFIX/NetFlow v9のレコードを上位N件の集計に加える
+func reportFlowStatsFromRecord(exporter string, record map[string]interface{}) {
+	f := &report.FlowStatsEnt{
+		Exporter: exporter,
+		Prot:     int(getFlowRecordInt(record, "protocolIdentifier")),
+		SrcPort:  int(getFlowRecordInt(record, "sourceTransportPort")),
+		DstPort:  int(getFlowRecordInt(record, "destinationTransportPort")),
+		SrcAS:    int(getFlowRecordInt(record, "bgpSourceAsNumber")),
+		DstAS:    int(getFlowRecordInt(record, "bgpDestinationAsNumber")),
+		InIf:     int(getFlowRecordInt(record, "ingressInterface")),
+		OutIf:    int(getFlowRecordInt(record, "egressInterface")),
+		Packets:  getFlowRecordInt(record, "packetDeltaCount"),
+		Bytes:    getFlowRecordInt(record, "octetDeltaCount"),
+	}
+	for _, k := range []string{"sourceIPv4Address", "sourceIPv6Address"} {
+		if ip, ok := record[k].(net.IP); ok {
+			f.SrcIP = ip.String()
+		}
+	}
+	for _, k := range []string{"destinationIPv4Address", "destinationIPv6Address"} {
+		if ip, ok := record[k].(net.IP); ok {
+			f.DstIP = ip.String()
+		}
+	}
+	if f.SrcIP == "" || f.DstIP == "" {
+		return
+	}
+	report.ReportFlowStats(f)
+}
+
+func getFlowRecordInt(record map[string]interface{}, k string) int64 {
+	switch v := record[k].(type) {
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
@@ -98,6 +98,7 @@ func sflowd(stopCh chan bool) {
 								continue
 							}
 							sFlowCounter("GenericInterfaceCounter", raIP, string(s))
+							sFlowIfCounter(raIP, &csr)
 						default:
 							log.Printf("sflow unknown counter sample %v", csr)
 							continue
@@ -264,6 +265,25 @@ func rawPacketFlow(r *sflow.RawPacketFlow, reason int) {
 	)
 }
 
+// sFlowIfCounter : インターフェースのカウンターをポーリング用に記録する
+func sFlowIfCounter(r string, c *sflow.GenericInterfaceCounters) {
+	datastore.UpdateSFlowIfCounter(&datastore.SFlowIfCounterEnt{
+		Agent:       r,
+		Index:       int(c.Index),
+		Speed:       c.Speed,
+		Status:      c.Status,
+		InOctets:    c.InOctets,
+		OutOctets:   c.OutOctets,
+		InPackets:   uint64(c.InUnicastPackets) + uint64(c.InMulticastPackets) + uint64(c.InBroadcastPackets),
+		OutPackets:  uint64(c.OutUnicastPackets) + uint64(c.OutMulticastPackets) + uint64(c.OutBroadcastPackets),
+		InErrors:    uint64(c.InErrors),
+		OutErrors:   uint64(c.OutErrors),
+		InDiscards:  uint64(c.InDiscards),
+		OutDiscards: uint64(c.OutDiscards),
+		Time:        time.Now().UnixNano(),
+	})
+}
+
 func sFlowCounter(t, r, d string) {
 	record := datastore.SFlowCounterEnt{
 		Type:   t,
@@ -28,65 +28,8 @@ func snmptrapd(stopCh chan bool) {
 	log.Printf("start snmp trapd")
 	tl := gosnmp.NewTrapListener()
 	tl.Params = &gosnmp.GoSNMP{}
-	switch datastore.MapConf.SnmpMode {
-	case "v3auth":
-		tl.Params.Version = gosnmp.Version3
-		tl.Params.SecurityModel = gosnmp.UserSecurityModel
-		tl.Params.MsgFlags = gosnmp.AuthNoPriv
-		tl.Params.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-		}
-	case "v3authpriv":
-		tl.Params.Version = gosnmp.Version3
-		tl.Params.SecurityModel = gosnmp.UserSecurityModel
-		tl.Params.MsgFlags = gosnmp.AuthPriv
-		tl.Params.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3authprivex":
-		tl.Params.Version = gosnmp.Version3
-		tl.Params.SecurityModel = gosnmp.UserSecurityModel
-		tl.Params.MsgFlags = gosnmp.AuthPriv
-		tl.Params.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3sha256aes128":
-		tl.Params.Version = gosnmp.Version3
-		tl.Params.SecurityModel = gosnmp.UserSecurityModel
-		tl.Params.MsgFlags = gosnmp.AuthPriv
-		tl.Params.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	case "v3sha512aes256":
-		tl.Params.Version = gosnmp.Version3
-		tl.Params.SecurityModel = gosnmp.UserSecurityModel
-		tl.Params.MsgFlags = gosnmp.AuthPriv
-		tl.Params.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 datastore.MapConf.SnmpUser,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: datastore.MapConf.SnmpPassword,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        datastore.MapConf.SnmpPassword,
-		}
-	default:
-		// SNMPv2c
-		tl.Params.Version = gosnmp.Version2c
-		tl.Params.Community = datastore.MapConf.Community
-	}
+	cred := datastore.GetMapCredential()
+	cred.SetSnmpAgent(tl.Params)
 	tl.OnNewTrap = func(s *gosnmp.SnmpPacket, u *net.UDPAddr) {
 		var record = make(map[string]interface{})
 		record["FromAddress"] = u.String()
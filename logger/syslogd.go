@@ -66,6 +66,7 @@ func syslogd(stopCh chan bool) {
 							report.ReportTWSdrPower(sl)
 						}
 					}
+					report.CheckThreatSyslog(sl)
 					logCh <- &datastore.LogEnt{
 						Time: time.Now().UnixNano(),
 						Type: "syslog",
@@ -43,6 +43,7 @@ var local bool
 var cpuprofile string
 var memprofile string
 var restore string
+var restoreAt string
 var pingMode string
 var timeout int
 var compact string
@@ -51,6 +52,13 @@ var deleteOldLog string
 var clearLog bool
 
 var copyBackup bool
+var s3Endpoint string
+var s3AccessKey string
+var s3SecretKey string
+var s3Region string
+var s3UseSSL bool
+var s3SSE string
+var s3SSEKey string
 var version = "vx.x.x"
 var commit = ""
 
@@ -93,10 +101,11 @@ var mqttUsers = ""
 
 func init() {
 	flag.StringVar(&dataStorePath, "datastore", "./datastore", "Path to Data Store directory")
-	flag.StringVar(&password, "password", "twsnmpfc!", "Master Password")
+	flag.StringVar(&password, "password", datastore.DefaultMasterPassword, "Master Password")
 	flag.StringVar(&port, "port", "8080", "port")
 	flag.StringVar(&host, "host", "", "Host Name for TLS Cert")
 	flag.StringVar(&restore, "restore", "", "Restore DB file name")
+	flag.StringVar(&restoreAt, "restoreAt", "", "Restore datastore from backup set at time(YYYYMMDDhhmmss or RFC3339, s3://bucket/prefix/time for S3)")
 	flag.StringVar(&ip, "ip", "", "IP Address for TLS Cert")
 	flag.StringVar(&pingMode, "ping", "", "ping mode icmp or udp")
 	flag.BoolVar(&tls, "tls", false, "Use TLS")
@@ -110,6 +119,13 @@ func init() {
 	flag.BoolVar(&clearLog, "clearLog", false, "Clear all logs")
 	flag.BoolVar(&datastore.CheckPollingLog, "checkPollingLog", false, "Check and convert old polling logs")
 	flag.BoolVar(&copyBackup, "copybackup", false, "Use copy mode on backup")
+	flag.StringVar(&s3Endpoint, "s3Endpoint", "", "S3 endpoint for restore from s3://bucket/prefix")
+	flag.StringVar(&s3AccessKey, "s3AccessKey", "", "S3 access key for restore")
+	flag.StringVar(&s3SecretKey, "s3SecretKey", "", "S3 secret key for restore")
+	flag.StringVar(&s3Region, "s3Region", "", "S3 region for restore")
+	flag.BoolVar(&s3UseSSL, "s3UseSSL", false, "Use TLS for S3 endpoint")
+	flag.StringVar(&s3SSE, "s3SSE", "", "S3 server side encryption for restore (s3 | kms | c)")
+	flag.StringVar(&s3SSEKey, "s3SSEKey", "", "S3 SSE-C key(base64) for restore")
 	flag.IntVar(&trapPort, "trapPort", 162, "snmp trap port")
 	flag.IntVar(&netflowPort, "netflowPort", 2055, "netflow port")
 	flag.IntVar(&syslogPort, "syslogPort", 514, "syslog port")
@@ -161,7 +177,7 @@ func main() {
 	log.Println("config")
 	flag.VisitAll(func(f *flag.Flag) {
 		// password以外の起動パラメータ、環境変数をログに記録
-		if f.Name != "password" {
+		if f.Name != "password" && f.Name != "s3SecretKey" && f.Name != "s3SSEKey" {
 			log.Printf("%s='%s'", f.Name, f.Value.String())
 		}
 	})
@@ -193,6 +209,15 @@ func main() {
 	datastore.ClientCert = clientCert
 	datastore.ClientKey = clientKey
 	datastore.CACert = caCert
+	datastore.S3RestoreConf = datastore.S3BackupConfEnt{
+		Endpoint:  s3Endpoint,
+		AccessKey: s3AccessKey,
+		SecretKey: s3SecretKey,
+		Region:    s3Region,
+		UseSSL:    s3UseSSL,
+		SSE:       s3SSE,
+		SSEKey:    s3SSEKey,
+	}
 	if restore != "" {
 		if err := datastore.RestoreDB(dataStorePath, restore); err != nil {
 			log.Fatalf("restore db err=%v", err)
@@ -201,6 +226,14 @@ func main() {
 		}
 		os.Exit(0)
 	}
+	if restoreAt != "" {
+		if err := datastore.RestoreBackupSet(dataStorePath, restoreAt); err != nil {
+			log.Fatalf("restore backup set err=%v", err)
+		} else {
+			log.Println("restore backup set done")
+		}
+		os.Exit(0)
+	}
 	if compact != "" {
 		st := time.Now()
 		if err := datastore.CompactDB(dataStorePath, compact); err != nil {
@@ -241,6 +274,7 @@ func main() {
 	log.SetOutput(new(logWriter))
 	var err error
 	statikFS := embedded.FS()
+	datastore.MasterPassword = password
 	log.Println("call datastore.Init")
 	wg := &sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -252,6 +286,13 @@ func main() {
 		Level: "info",
 		Event: "TWSNMP FC起動",
 	})
+	if password == datastore.DefaultMasterPassword {
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:  "system",
+			Level: "warn",
+			Event: "既定のマスターパスワードで秘密情報を暗号化しています。-passwordで変更してください",
+		})
+	}
 	log.Println("call ping.Start")
 	if err = ping.Start(ctx, wg, pingMode); err != nil {
 		log.Fatalf("start ping err=%v", err)
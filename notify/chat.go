@@ -85,12 +85,14 @@ func SendChat(c *datastore.NotifyConfEnt, title, level, message string) error {
 }
 
 // sendNotifyDiscord : Discordへ通知メッセージを送信する
-func sendNotifyDiscord(l *datastore.EventLogEnt) {
-	if datastore.NotifyConf.ChatWebhookURL == "" {
+func sendNotifyDiscord(l *datastore.EventLogEnt, level, webhookURL string) {
+	if webhookURL == "" {
 		return
 	}
-
-	nl := getLevelNum(datastore.NotifyConf.Level)
+	c := datastore.NotifyConf
+	c.ChatType = "discord"
+	c.ChatWebhookURL = webhookURL
+	nl := getLevelNum(level)
 	if nl == 3 {
 		return
 	}
@@ -109,7 +111,7 @@ func sendNotifyDiscord(l *datastore.EventLogEnt) {
 		}
 		// 復帰を通知する
 		title, message := getChatMessage(l, true)
-		if err := SendChat(&datastore.NotifyConf, title, "repair", message); err != nil {
+		if err := SendChat(&c, title, "repair", message); err != nil {
 			log.Printf("send discord error=%v", err)
 			datastore.AddEventLog(&datastore.EventLogEnt{
 				Type:     "system",
@@ -134,7 +136,7 @@ func sendNotifyDiscord(l *datastore.EventLogEnt) {
 		return
 	}
 	title, message := getChatMessage(l, false)
-	if err := SendChat(&datastore.NotifyConf, title, l.Level, message); err != nil {
+	if err := SendChat(&c, title, l.Level, message); err != nil {
 		log.Printf("send discord error=%v", err)
 		datastore.AddEventLog(&datastore.EventLogEnt{
 			Type:     "system",
@@ -159,7 +161,14 @@ func getChatMessage(l *datastore.EventLogEnt, repair bool) (string, string) {
 	if repair {
 		subtitle = "復帰"
 	}
-	return fmt.Sprintf("%s(%s)", datastore.NotifyConf.Subject, subtitle),
+	title := fmt.Sprintf("%s(%s)", datastore.NotifyConf.Subject, subtitle)
+	if ts, tb, ok := applyNotifyTemplate("chat", title, repair, []*datastore.EventLogEnt{l}); ok {
+		if ts != "" {
+			title = ts
+		}
+		return title, tb
+	}
+	return title,
 		fmt.Sprintf(
 			`発生日時: %s
 状態: %s
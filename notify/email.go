@@ -17,8 +17,12 @@ import (
 )
 
 func canSendMail() bool {
+	return canSendMailTo(datastore.NotifyConf.MailTo)
+}
+
+func canSendMailTo(mailTo string) bool {
 	if datastore.NotifyConf.MailFrom == "" ||
-		datastore.NotifyConf.MailTo == "" {
+		mailTo == "" {
 		return false
 	}
 	switch datastore.NotifyConf.Provider {
@@ -32,17 +36,17 @@ func canSendMail() bool {
 	return true
 }
 
-func sendNotifyMail(list []*datastore.EventLogEnt) {
-	if !canSendMail() {
+func sendNotifyMail(list []*datastore.EventLogEnt, level, mailTo string) {
+	if !canSendMailTo(mailTo) {
 		return
 	}
-	nl := getLevelNum(datastore.NotifyConf.Level)
+	nl := getLevelNum(level)
 	if nl == 3 {
 		return
 	}
 	nd := getNotifyData(list, nl)
 	if nd.failureBody != "" {
-		err := sendMail(nd.failureSubject, nd.failureBody)
+		err := sendMailTo(mailTo, nd.failureSubject, nd.failureBody)
 		r := ""
 		level := "info"
 		if err != nil {
@@ -57,7 +61,7 @@ func sendNotifyMail(list []*datastore.EventLogEnt) {
 		})
 	}
 	if nd.repairBody != "" {
-		err := sendMail(nd.repairSubject, nd.repairBody)
+		err := sendMailTo(mailTo, nd.repairSubject, nd.repairBody)
 		r := ""
 		if err != nil {
 			log.Printf("send mail err=%v", err)
@@ -78,21 +82,47 @@ func SendActionMail(subject, body string) {
 	}
 }
 
-func sendMail(subject, body string) error {
-	if !canSendMail() {
+func sendMail(subject, body string, attachments ...mailAttachment) error {
+	return sendMailTo(datastore.NotifyConf.MailTo, subject, body, attachments...)
+}
+
+// mailAttachment : メールの添付ファイル
+type mailAttachment struct {
+	Name string
+	Data []byte
+}
+
+// sendMailTo : 宛先を指定してメールを送信する
+func sendMailTo(mailTo, subject, body string, attachments ...mailAttachment) error {
+	if !canSendMailTo(mailTo) {
 		return nil
 	}
 	switch datastore.NotifyConf.Provider {
 	case "google":
-		return sendMailOAuth2("smtp.gmail.com", subject, body)
+		return sendMailOAuth2("smtp.gmail.com", mailTo, subject, body, attachments...)
 	case "microsoft":
-		return sendMailOAuth2("smtp-mail.outlook.com", subject, body)
+		return sendMailOAuth2("smtp-mail.outlook.com", mailTo, subject, body, attachments...)
 	default:
-		return sendMailSMTP(subject, body)
+		return sendMailSMTP(mailTo, subject, body, attachments...)
+	}
+}
+
+// setMailBody : 本文と添付ファイルを設定する
+func setMailBody(message *mail.Msg, body string, attachments []mailAttachment) error {
+	if datastore.NotifyConf.HTMLMail {
+		message.SetBodyString(mail.TypeTextHTML, body)
+	} else {
+		message.SetBodyString(mail.TypeTextPlain, body)
+	}
+	for _, a := range attachments {
+		if err := message.AttachReader(a.Name, bytes.NewReader(a.Data)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func sendMailSMTP(subject, body string) error {
+func sendMailSMTP(mailTo, subject, body string, attachments ...mailAttachment) error {
 	host, portStr, err := net.SplitHostPort(datastore.NotifyConf.MailServer)
 	var port int
 	if err != nil {
@@ -142,7 +172,7 @@ func sendMailSMTP(subject, body string) error {
 		log.Printf("send mail err=%v", err)
 		return err
 	}
-	for _, rcpt := range strings.Split(datastore.NotifyConf.MailTo, ",") {
+	for _, rcpt := range strings.Split(mailTo, ",") {
 		if !strings.Contains(rcpt, "@") {
 			continue
 		}
@@ -153,17 +183,16 @@ func sendMailSMTP(subject, body string) error {
 	}
 
 	message.Subject(subject)
-	if datastore.NotifyConf.HTMLMail {
-		message.SetBodyString(mail.TypeTextHTML, body)
-	} else {
-		message.SetBodyString(mail.TypeTextPlain, body)
+	if err := setMailBody(message, body, attachments); err != nil {
+		log.Printf("send mail err=%v", err)
+		return err
 	}
 
 	if err := client.DialAndSend(message); err != nil {
 		log.Printf("send mail err=%v", err)
 		return err
 	}
-	log.Printf("send mail to %s", datastore.NotifyConf.MailTo)
+	log.Printf("send mail to %s", mailTo)
 	return nil
 }
 
@@ -264,7 +293,7 @@ func sendTestMailSMTP(testConf *datastore.NotifyConfEnt) error {
 	return nil
 }
 
-func sendMailOAuth2(server, subject, body string) error {
+func sendMailOAuth2(server, mailTo, subject, body string, attachments ...mailAttachment) error {
 	token := getNotifyOAuth2Token()
 	if token == nil {
 		return fmt.Errorf("oauth2 token not found")
@@ -280,7 +309,7 @@ func sendMailOAuth2(server, subject, body string) error {
 	if err := message.From(datastore.NotifyConf.MailFrom); err != nil {
 		return err
 	}
-	for _, rcpt := range strings.Split(datastore.NotifyConf.MailTo, ",") {
+	for _, rcpt := range strings.Split(mailTo, ",") {
 		if !strings.Contains(rcpt, "@") {
 			continue
 		}
@@ -290,10 +319,8 @@ func sendMailOAuth2(server, subject, body string) error {
 	}
 
 	message.Subject(subject)
-	if datastore.NotifyConf.HTMLMail {
-		message.SetBodyString(mail.TypeTextHTML, body)
-	} else {
-		message.SetBodyString(mail.TypeTextPlain, body)
+	if err := setMailBody(message, body, attachments); err != nil {
+		return err
 	}
 	return client.DialAndSend(message)
 }
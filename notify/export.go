@@ -0,0 +1,290 @@
+package notify
+
+// 定期レポートのPDFとCSVの出力
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// PDFの表に出力する最大行数
+const maxPDFTableRows = 50
+
+// ExportReport : 定期レポートのPDF、CSVまたは全てをまとめたZIPを作成する
+// ファイル名、Content-Type、内容を返す
+func ExportReport(typ string) (string, string, []byte, error) {
+	return exportReport(typ, defaultReportParams())
+}
+
+// ExportReportDef : レポートの定義に従ったPDF、CSVまたはZIPを作成する
+func ExportReportDef(typ, id string) (string, string, []byte, error) {
+	d := datastore.GetReportDef(id)
+	if d == nil {
+		return "", "", nil, datastore.ErrInvalidID
+	}
+	return exportReport(typ, newReportParams(d))
+}
+
+func exportReport(typ string, rp *reportParams) (string, string, []byte, error) {
+	day := time.Now().Format("20060102")
+	switch typ {
+	case "pdf":
+		return "report_" + day + ".pdf", "application/pdf", reportPDF(rp), nil
+	case "devices", "users", "ips", "ai":
+		return typ + "_" + day + ".csv", "text/csv", reportCSV(typ, rp), nil
+	case "zip":
+		b := new(bytes.Buffer)
+		w := zip.NewWriter(b)
+		all := *rp
+		all.pdf = true
+		all.csv = true
+		for _, a := range getReportAttachments(&all) {
+			f, err := w.Create(a.Name)
+			if err != nil {
+				return "", "", nil, err
+			}
+			if _, err := f.Write(a.Data); err != nil {
+				return "", "", nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return "", "", nil, err
+		}
+		return "report_" + day + ".zip", "application/zip", b.Bytes(), nil
+	}
+	return "", "", nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// getReportAttachments : 定期レポートに添付するファイル
+func getReportAttachments(rp *reportParams) []mailAttachment {
+	ret := []mailAttachment{}
+	day := time.Now().Format("20060102")
+	if rp.pdf {
+		ret = append(ret, mailAttachment{Name: "report_" + day + ".pdf", Data: reportPDF(rp)})
+	}
+	if rp.csv {
+		for _, t := range []string{"devices", "users", "ips", "ai"} {
+			if rp.has(t) {
+				ret = append(ret, mailAttachment{Name: t + "_" + day + ".csv", Data: reportCSV(t, rp)})
+			}
+		}
+	}
+	return ret
+}
+
+func formatCSVTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(0, t).Format(time.RFC3339)
+}
+
+// reportCSV : デバイス、ユーザー、IPアドレス、AI分析のリストのCSV
+func reportCSV(typ string, rp *reportParams) []byte {
+	b := new(bytes.Buffer)
+	// Excelで開けるようにBOMを付ける
+	b.WriteString("\xef\xbb\xbf")
+	w := csv.NewWriter(b)
+	switch typ {
+	case "devices":
+		w.Write([]string{"MAC", "Name", "IP", "Vendor", "Score", "FirstTime", "LastTime"})
+		datastore.ForEachDevices(func(d *datastore.DeviceEnt) bool {
+			w.Write([]string{d.ID, d.Name, d.IP, d.Vendor, formatScore(d.Score),
+				formatCSVTime(d.FirstTime), formatCSVTime(d.LastTime)})
+			return true
+		})
+	case "users":
+		w.Write([]string{"UserID", "Server", "ServerName", "Clients", "Total", "Ok", "Score", "FirstTime", "LastTime"})
+		datastore.ForEachUsers(func(u *datastore.UserEnt) bool {
+			w.Write([]string{u.UserID, u.Server, u.ServerName, fmt.Sprint(len(u.ClientMap)),
+				fmt.Sprint(u.Total), fmt.Sprint(u.Ok), formatScore(u.Score),
+				formatCSVTime(u.FirstTime), formatCSVTime(u.LastTime)})
+			return true
+		})
+	case "ips":
+		w.Write([]string{"IP", "Name", "MAC", "Vendor", "Loc", "ASN", "ASOrg", "Count", "Change", "Score", "FirstTime", "LastTime"})
+		datastore.ForEachIPReport(func(i *datastore.IPReportEnt) bool {
+			w.Write([]string{i.IP, i.Name, i.MAC, i.Vendor, i.Loc, fmt.Sprint(i.ASN), i.ASOrg,
+				fmt.Sprint(i.Count), fmt.Sprint(i.Change), formatScore(i.Score),
+				formatCSVTime(i.FirstTime), formatCSVTime(i.LastTime)})
+			return true
+		})
+	case "ai":
+		w.Write([]string{"Score", "Node", "Polling", "Count", "LastTime"})
+		for _, a := range getAIList(rp) {
+			w.Write([]string{formatScore(a.LastScore), a.NodeName, a.PollingName, fmt.Sprint(a.Count), formatCSVTime(a.LastTime)})
+		}
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// reportPDF : 定期レポートのPDF
+func reportPDF(rp *reportParams) []byte {
+	title := fmt.Sprintf("%s(%s) at %s", datastore.NotifyConf.Subject, rp.title, time.Now().Format("2006/01/02 15:04:05"))
+	p := newPDF()
+	p.title(title)
+	info, _ := getReportInfo(rp)
+	rows := [][]string{}
+	for _, i := range info {
+		rows = append(rows, []string{i.Name, i.Value})
+	}
+	if len(rows) > 0 {
+		p.heading("【マップ情報】")
+		p.table([]string{"項目", "値"}, rows, []float64{1, 3})
+	}
+	if rp.has("resource") {
+		p.heading("【システムリソース】")
+		addResourceCharts(p)
+	}
+	if rp.has("map") {
+		p.heading("【ポーリング】")
+		addPollingCharts(p, rp)
+	}
+	if l := getAIList(rp); rp.has("ai") && len(l) > 0 {
+		rows = [][]string{}
+		for _, a := range l {
+			rows = append(rows, []string{formatScore(a.LastScore), a.NodeName, a.PollingName, fmt.Sprint(a.Count), formatAITime(a.LastTime)})
+		}
+		p.heading("【AI分析情報】")
+		p.table([]string{"異常スコア", "ノード", "ポーリング", "データ数", "最終確認"}, limitPDFRows(rows), []float64{1, 2, 3, 1, 2})
+	}
+	if l := getSensorList(); rp.has("sensor") && len(l) > 0 {
+		rows = [][]string{}
+		for _, s := range l {
+			rows = append(rows, []string{levelName(s.State), s.Host, s.Type, s.Param, formatCount(s.Total), formatLogTime(s.LastTime)})
+		}
+		p.heading("【センサー情報】")
+		p.table([]string{"状態", "ホスト", "種別", "パラメータ", "総数", "最終確認"}, limitPDFRows(rows), []float64{1, 2, 1.5, 2, 1, 2})
+	}
+	if l := getCapacityList(rp); rp.has("capacity") && len(l) > 0 {
+		rows = [][]string{}
+		for _, e := range l {
+			rows = append(rows, []string{e.NodeName, e.PollingName, formatBps(e.Speed), formatPercent(e.P95Util),
+				formatPercent(e.PeakUtil), formatDays(e.DaysTo80)})
+		}
+		p.heading("【容量計画(90日以内に使用率80%到達予測)】")
+		p.table([]string{"ノード", "ポーリング", "速度", "95%値", "ピーク", "80%到達"}, limitPDFRows(rows), []float64{2, 3, 1.5, 1, 1, 2})
+	}
+	if l := getReportSLAList(rp); rp.has("sla") && len(l) > 0 {
+		rows = [][]string{}
+		for _, r := range l {
+			rows = append(rows, []string{r.Name, r.TargetName, formatAvailability(r.Target), formatAvailability(r.Availability),
+				formatMinutes(r.DownMin), fmt.Sprint(r.Failures), slaResult(r)})
+		}
+		p.heading("【SLA(今月)】")
+		p.table([]string{"SLA", "対象", "目標", "稼働率", "停止時間", "停止回数", "結果"}, limitPDFRows(rows), []float64{2, 2, 1, 1, 1.5, 1, 1})
+	}
+	nd, bd := getDeviceList(rp)
+	deviceRows := func(l []*datastore.DeviceEnt) [][]string {
+		rows := [][]string{}
+		for _, d := range l {
+			rows = append(rows, []string{formatScore(d.Score), d.Name, d.IP, d.ID, d.Vendor, formatLogTime(d.FirstTime)})
+		}
+		return limitPDFRows(rows)
+	}
+	deviceHeader := []string{"スコア", "名前", "IP", "MAC", "ベンダー", "初回確認"}
+	deviceWidth := []float64{1, 2, 1.5, 1.8, 2.5, 2}
+	if rp.has("devices") && rp.newInfo && len(nd) > 0 {
+		p.heading(fmt.Sprintf("【%s以内に新しく発見したデバイス】", rp.period(48*time.Hour)))
+		p.table(deviceHeader, deviceRows(nd), deviceWidth)
+	}
+	if rp.has("devices") && rp.lowScore && len(bd) > 0 {
+		sort.Slice(bd, func(i, j int) bool {
+			return bd[i].Score < bd[j].Score
+		})
+		p.heading("【信用スコアが下位10%のデバイス】")
+		p.table(deviceHeader, deviceRows(bd), deviceWidth)
+	}
+	return p.bytes()
+}
+
+func limitPDFRows(rows [][]string) [][]string {
+	if len(rows) > maxPDFTableRows {
+		return rows[:maxPDFTableRows]
+	}
+	return rows
+}
+
+// addResourceCharts : システムリソースのグラフ
+func addResourceCharts(p *pdfDoc) {
+	if len(datastore.MonitorDataes) < 2 {
+		p.paragraph("データがありません", 9)
+		return
+	}
+	labels := []string{}
+	cpu := []float64{}
+	mem := []float64{}
+	disk := []float64{}
+	load := []float64{}
+	for _, m := range datastore.MonitorDataes {
+		labels = append(labels, time.Unix(m.At, 0).Format("01/02 15:04"))
+		cpu = append(cpu, m.CPU)
+		mem = append(mem, m.Mem)
+		disk = append(disk, m.Disk)
+		load = append(load, m.Load)
+	}
+	p.lineChart("CPU/メモリ/ディスク使用率(%)", labels, []pdfSeries{
+		{Name: "CPU", Color: [3]float64{0.9, 0.2, 0.2}, Values: cpu},
+		{Name: "Memory", Color: [3]float64{0.2, 0.4, 0.9}, Values: mem},
+		{Name: "Disk", Color: [3]float64{0.2, 0.7, 0.2}, Values: disk},
+	}, 100)
+	p.lineChart("システム負荷", labels, []pdfSeries{
+		{Name: "Load", Color: [3]float64{0.6, 0.3, 0.8}, Values: load},
+	}, 0)
+}
+
+// addPollingCharts : ポーリングの状態別の数と過去24時間の状態変化のグラフ
+func addPollingCharts(p *pdfDoc, rp *reportParams) {
+	states := []string{"high", "low", "warn", "normal", "repair", "unknown"}
+	colors := [][3]float64{
+		{0.89, 0.10, 0.11},
+		{0.98, 0.60, 0.60},
+		{0.87, 0.87, 0.13},
+		{0.20, 0.63, 0.17},
+		{0.12, 0.47, 0.71},
+		{0.7, 0.7, 0.7},
+	}
+	count := make(map[string]float64)
+	datastore.ForEachPollings(func(pe *datastore.PollingEnt) bool {
+		if !rp.matchNode(pe.NodeID) {
+			return true
+		}
+		count[pe.State]++
+		return true
+	})
+	labels := []string{}
+	values := []float64{}
+	for _, s := range states {
+		labels = append(labels, levelName(s))
+		values = append(values, count[s])
+	}
+	p.barChart("状態別のポーリング数", labels, values, colors)
+	// 1時間毎の障害の状態変化の数
+	now := time.Now().Truncate(time.Hour)
+	st := now.Add(-23 * time.Hour)
+	hours := make([]float64, 24)
+	datastore.ForEachLastEventLog(st.UnixNano(), func(l *datastore.EventLogEnt) bool {
+		if l.Type != "polling" || !rp.matchNode(l.NodeID) {
+			return true
+		}
+		switch l.Level {
+		case "high", "low", "warn":
+			if i := int(time.Unix(0, l.Time).Sub(st).Hours()); i >= 0 && i < 24 {
+				hours[i]++
+			}
+		}
+		return true
+	})
+	hl := []string{}
+	for i := range hours {
+		hl = append(hl, st.Add(time.Duration(i)*time.Hour).Format("15"))
+	}
+	p.barChart("1時間毎のポーリング障害数(24時間)", hl, hours, nil)
+}
@@ -49,6 +49,7 @@ func notifyBackend(ctx context.Context, wg *sync.WaitGroup) {
 				lastLog = checkNotify(lastLog)
 			}
 			checkExecCmd()
+			checkTickets()
 			if datastore.NotifyConf.Report &&
 				lastSendReport.Day() != time.Now().Day() &&
 				len(datastore.DBStatsLog) > 1 &&
@@ -56,6 +57,10 @@ func notifyBackend(ctx context.Context, wg *sync.WaitGroup) {
 				lastSendReport = time.Now()
 				sendReport()
 			}
+			if datastore.NotifyConf.Report {
+				checkSLAReport()
+			}
+			checkReportDefs()
 		}
 	}
 }
@@ -74,7 +79,15 @@ func getLevelNum(l string) int {
 
 func checkNotify(last int64) int64 {
 	exAll := datastore.NotifySchedule[""]
+	// タグで指定した除外スケジュール(メンテナンス時間)
+	exTags := map[string]string{}
+	for k, v := range datastore.NotifySchedule {
+		if sel, ok := strings.CutPrefix(k, "tag:"); ok && sel != "" && v != "" {
+			exTags[sel] = v
+		}
+	}
 	list := []*datastore.EventLogEnt{}
+	ruleLists := make(map[string][]*datastore.EventLogEnt)
 	lastLogTime := int64(0)
 	skip := 0
 	datastore.ForEachLastEventLog(last, func(l *datastore.EventLogEnt) bool {
@@ -90,14 +103,40 @@ func checkNotify(last int64) int64 {
 				skip++
 				return true
 			}
+			if n := datastore.GetNode(l.NodeID); n != nil {
+				for sel, sc := range exTags {
+					if datastore.NodeMatchTagSelector(n, sel) && isExcludeTime(sc, l.Time) {
+						skip++
+						return true
+					}
+				}
+			}
+		}
+		// 振り分けルールに一致したものはルールの通知先へ
+		rules, def := datastore.GetNotifyRoutes(l)
+		for _, r := range rules {
+			ruleLists[r.ID] = append(ruleLists[r.ID], l)
+		}
+		if !def {
+			return true
+		}
+		// タグのフィルターは既定の通知先だけに適用する
+		if n := datastore.GetNode(l.NodeID); n != nil && !datastore.NodeMatchTagSelector(n, datastore.NotifyConf.TagFilter) {
+			skip++
+			return true
 		}
 		list = append(list, l)
 		return true
 	})
-	log.Printf("check notify last=%v next=%v len=%d skip=%d", time.Unix(0, last), time.Unix(0, lastLogTime), len(list), skip)
+	log.Printf("check notify last=%v next=%v len=%d rules=%d skip=%d", time.Unix(0, last), time.Unix(0, lastLogTime), len(list), len(ruleLists), skip)
 	if len(list) > 0 {
-		sendNotifyMail(list)
-		webhookNotify(list)
+		sendNotifyMail(list, datastore.NotifyConf.Level, datastore.NotifyConf.MailTo)
+		webhookNotify(list, datastore.NotifyConf.Level, datastore.NotifyConf.WebHookNotify)
+	}
+	for _, r := range datastore.GetNotifyRules() {
+		if rl, ok := ruleLists[r.ID]; ok {
+			sendRuleNotify(r, rl)
+		}
 	}
 	if lastLogTime > 0 {
 		return lastLogTime
@@ -178,18 +217,32 @@ func getNotifyData(list []*datastore.EventLogEnt, nl int) notifyData {
 	f, r := "", ""
 	fs, rs := "", ""
 	if len(failure) > 0 {
-		f = eventLogListToString(false, failure)
 		fs = datastore.NotifyConf.Subject + "(障害)"
 		if datastore.NotifyConf.AddNodeName {
 			fs += ":" + getNodes(fNodeMap)
 		}
+		if ts, tb, ok := applyNotifyTemplate("mail", datastore.NotifyConf.Subject+"(障害)", false, failure); ok {
+			f = tb
+			if ts != "" {
+				fs = ts
+			}
+		} else {
+			f = eventLogListToString(false, failure)
+		}
 	}
 	if len(repair) > 0 {
-		r = eventLogListToString(true, repair)
 		rs = datastore.NotifyConf.Subject + "(復帰)"
 		if datastore.NotifyConf.AddNodeName {
 			rs += ":" + getNodes(rNodeMap)
 		}
+		if ts, tb, ok := applyNotifyTemplate("mail", datastore.NotifyConf.Subject+"(復帰)", true, repair); ok {
+			r = tb
+			if ts != "" {
+				rs = ts
+			}
+		} else {
+			r = eventLogListToString(true, repair)
+		}
 	}
 	return notifyData{
 		failureSubject: fs,
@@ -332,9 +385,34 @@ func formatCount(i interface{}) string {
 	return humanize.Comma(c)
 }
 
+func formatBps(f float64) string {
+	return humanize.SIWithDigits(f, 2, "bps")
+}
+
+func formatPercent(f float64) string {
+	return fmt.Sprintf("%.1f%%", f)
+}
+
+func formatDays(f float64) string {
+	if f < 0 {
+		return "-"
+	}
+	if f < 1 {
+		return "到達済み"
+	}
+	return fmt.Sprintf("%.0f日", f)
+}
+
 func SendNotifyChat(l *datastore.EventLogEnt) {
+	rules, def := datastore.GetNotifyRoutes(l)
+	for _, r := range rules {
+		sendNotifyDiscord(l, r.Level, r.ChatWebhookURL)
+	}
+	if !def {
+		return
+	}
 	switch datastore.NotifyConf.ChatType {
 	case "discord":
-		sendNotifyDiscord(l)
+		sendNotifyDiscord(l, datastore.NotifyConf.Level, datastore.NotifyConf.ChatWebhookURL)
 	}
 }
@@ -1,8 +1,16 @@
 package notify
 
 import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
 type scheduleTestEnt struct {
@@ -108,3 +116,127 @@ func TestValidateURL(t *testing.T) {
 		}
 	}
 }
+
+func TestPreviewNotifyTemplate(t *testing.T) {
+	logs := []*datastore.EventLogEnt{{
+		Time:     time.Now().UnixNano(),
+		Type:     "polling",
+		Level:    "high",
+		NodeName: "sw1",
+		Event:    "ポーリング状態変化:PING監視(ping):normal",
+	}}
+	wt := &datastore.NotifyTemplateEnt{
+		Dest: "webhook",
+		Body: `{"count":{{.Count}},"summary":{{json (printf "%s %s" .Log.NodeName .Log.Level)}}}`,
+	}
+	_, body, err := PreviewNotifyTemplate(wt, logs)
+	if err != nil || body != `{"count":1,"summary":"sw1 high"}` {
+		t.Errorf("webhook template body=%s err=%v", body, err)
+	}
+	wt.Body = `{"count":{{.Count}}`
+	if _, _, err := PreviewNotifyTemplate(wt, logs); err == nil {
+		t.Error("invalid json webhook template")
+	}
+	ct := &datastore.NotifyTemplateEnt{
+		Dest:    "chat",
+		Subject: "[{{upper .Log.Level}}] {{.Log.NodeName}}",
+		Body:    "{{.Log.Event}}",
+	}
+	subject, body, err := PreviewNotifyTemplate(ct, logs)
+	if err != nil || subject != "[HIGH] sw1" || body != logs[0].Event {
+		t.Errorf("chat template subject=%s body=%s err=%v", subject, body, err)
+	}
+	if err := CheckNotifyTemplate(&datastore.NotifyTemplateEnt{Body: "{{.Log"}); err == nil {
+		t.Error("invalid template")
+	}
+}
+
+func TestTicket(t *testing.T) {
+	reqs := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		reqs = append(reqs, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(b))
+		if r.URL.Path == "/issues" {
+			w.Write([]byte(`{"issue":{"key":"OPS-1","id":10001}}`))
+		}
+	}))
+	defer ts.Close()
+	conf := &datastore.TicketConfEnt{
+		Token:       "secret",
+		CreateURL:   ts.URL + "/issues",
+		CreateBody:  `{"title":{{json .Title}},"level":"{{.Level}}"}`,
+		IDPath:      "issue.key",
+		CommentURL:  ts.URL + "/issues/{{.TicketID}}/comments",
+		CommentBody: `{"body":{{json .Comment}}}`,
+		CloseURL:    ts.URL + "/issues/{{.TicketID}}",
+		CloseMethod: "put",
+		CloseBody:   `{"state":"closed"}`,
+	}
+	id, err := TicketTest(conf)
+	if err != nil || id != "OPS-1" {
+		t.Fatalf("ticket id=%s err=%v", id, err)
+	}
+	if len(reqs) != 3 ||
+		!strings.HasPrefix(reqs[0], "POST /issues Bearer secret {\"title\":") ||
+		reqs[1] != `POST /issues/OPS-1/comments Bearer secret {"body":"test"}` ||
+		reqs[2] != `PUT /issues/OPS-1 Bearer secret {"state":"closed"}` {
+		t.Errorf("ticket requests=%v", reqs)
+	}
+	conf.IDPath = "issue.id"
+	if id, _ := TicketTest(conf); id != "10001" {
+		t.Errorf("ticket numeric id=%s", id)
+	}
+	conf.IDPath = "id"
+	if _, err := TicketTest(conf); err == nil {
+		t.Error("ticket id not found")
+	}
+	// 処理待ちの状態変化は最新の状態にまとめて順番の入れ替わりを防ぐ
+	for _, s := range [][2]string{{"high", "normal"}, {"normal", "high"}, {"high", "normal"}} {
+		queueTicketStateChange(&ticketStateChange{pe: &datastore.PollingEnt{ID: "p1", State: s[0]}, oldState: s[1]})
+	}
+	if c, old := takeTicketStateChange("p1"); c == nil || c.pe.State != "high" || old != "normal" {
+		t.Errorf("ticket state change=%+v old=%s", c, old)
+	}
+	if c, _ := takeTicketStateChange("p1"); c != nil {
+		t.Error("ticket state change taken twice")
+	}
+	setTicketLastState("p1", "high")
+	queueTicketStateChange(&ticketStateChange{pe: &datastore.PollingEnt{ID: "p1", State: "normal"}, oldState: "low"})
+	if c, old := takeTicketStateChange("p1"); c == nil || old != "high" {
+		t.Errorf("ticket last state old=%s", old)
+	}
+}
+
+func TestExportReport(t *testing.T) {
+	datastore.AddDevice(&datastore.DeviceEnt{ID: "00:11:22:33:44:55", Name: "pc1", IP: "192.168.1.10", Score: 50.0})
+	md := datastore.MonitorDataes
+	t.Cleanup(func() {
+		datastore.MonitorDataes = md
+	})
+	datastore.MonitorDataes = []*datastore.MonitorDataEnt{
+		{CPU: 10, Mem: 20, Disk: 30, Load: 0.5, At: time.Now().Add(-time.Minute).Unix()},
+		{CPU: 15, Mem: 22, Disk: 30, Load: 0.7, At: time.Now().Unix()},
+	}
+	name, ct, b, err := ExportReport("devices")
+	if err != nil || ct != "text/csv" || !strings.HasSuffix(name, ".csv") {
+		t.Fatalf("export csv name=%s ct=%s err=%v", name, ct, err)
+	}
+	if !strings.Contains(string(b), "00:11:22:33:44:55,pc1,192.168.1.10") {
+		t.Errorf("devices csv=%s", string(b))
+	}
+	_, ct, b, err = ExportReport("pdf")
+	if err != nil || ct != "application/pdf" || !bytes.HasPrefix(b, []byte("%PDF-1.4")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Errorf("export pdf ct=%s err=%v", ct, err)
+	}
+	_, _, b, err = ExportReport("zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil || len(z.File) != 5 {
+		t.Errorf("export zip err=%v", err)
+	}
+	if _, _, _, err := ExportReport("xls"); err == nil {
+		t.Error("export unknown type")
+	}
+}
@@ -0,0 +1,364 @@
+package notify
+
+// レポートのPDFを作成する簡易的なPDFライター
+// 日本語はPDFビューアが持つ標準のCJKフォント(HeiseiKakuGo-W5)で表示する
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4縦(pt)
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 40.0
+)
+
+type pdfDoc struct {
+	pages [][]byte
+	cur   *bytes.Buffer
+	y     float64 // 上からの位置
+}
+
+func newPDF() *pdfDoc {
+	p := &pdfDoc{}
+	p.addPage()
+	return p
+}
+
+func (p *pdfDoc) addPage() {
+	p.flushPage()
+	p.cur = new(bytes.Buffer)
+	p.y = pdfMargin
+}
+
+func (p *pdfDoc) flushPage() {
+	if p.cur != nil {
+		p.pages = append(p.pages, p.cur.Bytes())
+		p.cur = nil
+	}
+}
+
+// ensure : 残りの高さが足りなければ改ページする
+func (p *pdfDoc) ensure(h float64) {
+	if p.y+h > pdfPageHeight-pdfMargin {
+		p.addPage()
+	}
+}
+
+// pdfTextWidth : 文字列の幅(pt)
+func pdfTextWidth(s string, size float64) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r < 0x80 || (r >= 0xff61 && r <= 0xff9f) {
+			w += 0.5
+		} else {
+			w += 1.0
+		}
+	}
+	return w * size
+}
+
+// pdfHexString : UTF-16BEの16進文字列に変換する
+func pdfHexString(s string) string {
+	var b strings.Builder
+	b.WriteString("<")
+	for _, r := range s {
+		if r > 0xffff || r < 0x20 {
+			r = '?'
+		}
+		for _, c := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, "%04X", c)
+		}
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// text : 左上を原点とする位置に文字列を描画する
+func (p *pdfDoc) text(x, y, size float64, s string) {
+	fmt.Fprintf(p.cur, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", size, x, pdfPageHeight-y-size, pdfHexString(s))
+}
+
+// setColor : 塗りと線の色を設定する(0-1)
+func (p *pdfDoc) setColor(r, g, b float64) {
+	fmt.Fprintf(p.cur, "%.3f %.3f %.3f rg %.3f %.3f %.3f RG\n", r, g, b, r, g, b)
+}
+
+func (p *pdfDoc) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(p.cur, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+// rect : 矩形を描画する fillがfalseなら枠線だけ
+func (p *pdfDoc) rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(p.cur, "0.5 w %.2f %.2f %.2f %.2f re %s\n", x, pdfPageHeight-y-h, w, h, op)
+}
+
+// title : 表題
+func (p *pdfDoc) title(s string) {
+	p.ensure(30)
+	p.text(pdfMargin, p.y, 16, s)
+	p.y += 30
+}
+
+// heading : 見出し
+func (p *pdfDoc) heading(s string) {
+	p.ensure(40)
+	p.y += 6
+	p.text(pdfMargin, p.y, 12, s)
+	p.y += 18
+}
+
+// paragraph : 幅に合わせて折り返して文字列を描画する
+func (p *pdfDoc) paragraph(s string, size float64) {
+	for _, l := range strings.Split(s, "\n") {
+		for _, w := range pdfWrap(l, pdfPageWidth-pdfMargin*2, size) {
+			p.ensure(size + 4)
+			p.text(pdfMargin, p.y, size, w)
+			p.y += size + 4
+		}
+	}
+}
+
+func pdfWrap(s string, width, size float64) []string {
+	ret := []string{}
+	line := []rune{}
+	for _, r := range s {
+		line = append(line, r)
+		if pdfTextWidth(string(line), size) > width {
+			ret = append(ret, string(line[:len(line)-1]))
+			line = []rune{r}
+		}
+	}
+	return append(ret, string(line))
+}
+
+// pdfFit : 幅に収まるように文字列を切り詰める
+func pdfFit(s string, width, size float64) string {
+	if pdfTextWidth(s, size) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdfTextWidth(string(r)+"..", size) > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + ".."
+}
+
+// table : 表を描画する widthsは列の幅の比率
+func (p *pdfDoc) table(header []string, rows [][]string, widths []float64) {
+	const size = 8.0
+	const h = 14.0
+	total := 0.0
+	for _, w := range widths {
+		total += w
+	}
+	cw := make([]float64, len(widths))
+	for i, w := range widths {
+		cw[i] = w * (pdfPageWidth - pdfMargin*2) / total
+	}
+	drawRow := func(row []string, head bool) {
+		x := pdfMargin
+		if head {
+			p.setColor(0.8, 0.8, 0.8)
+			p.rect(x, p.y, pdfPageWidth-pdfMargin*2, h, true)
+		}
+		p.setColor(0.3, 0.3, 0.3)
+		for i := range cw {
+			p.rect(x, p.y, cw[i], h, false)
+			if i < len(row) {
+				p.text(x+2, p.y+3, size, pdfFit(row[i], cw[i]-4, size))
+			}
+			x += cw[i]
+		}
+		p.setColor(0, 0, 0)
+		p.y += h
+	}
+	p.ensure(h * 2)
+	drawRow(header, true)
+	for _, r := range rows {
+		if p.y+h > pdfPageHeight-pdfMargin {
+			p.addPage()
+			drawRow(header, true)
+		}
+		drawRow(r, false)
+	}
+	p.y += 6
+}
+
+// pdfSeries : グラフのデータ系列
+type pdfSeries struct {
+	Name   string
+	Color  [3]float64
+	Values []float64
+}
+
+// グラフの高さ
+const pdfChartHeight = 150.0
+
+// chartFrame : グラフの枠と目盛りを描画して描画領域を返す
+func (p *pdfDoc) chartFrame(title string, max float64) (float64, float64, float64, float64) {
+	p.ensure(pdfChartHeight + 50)
+	p.text(pdfMargin, p.y, 10, title)
+	p.y += 16
+	x := pdfMargin + 40
+	y := p.y
+	w := pdfPageWidth - pdfMargin*2 - 40
+	h := pdfChartHeight
+	p.setColor(0.85, 0.85, 0.85)
+	for i := 0; i <= 4; i++ {
+		gy := y + h - h*float64(i)/4
+		p.line(x, gy, x+w, gy, 0.3)
+	}
+	p.setColor(0, 0, 0)
+	for i := 0; i <= 4; i++ {
+		v := max * float64(i) / 4
+		l := fmt.Sprintf("%.4g", v)
+		p.text(x-4-pdfTextWidth(l, 7), y+h-h*float64(i)/4-4, 7, l)
+	}
+	p.line(x, y, x, y+h, 0.5)
+	p.line(x, y+h, x+w, y+h, 0.5)
+	return x, y, w, h
+}
+
+func pdfChartMax(max float64, values ...[]float64) float64 {
+	if max > 0 {
+		return max
+	}
+	for _, l := range values {
+		for _, v := range l {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	if max <= 0 {
+		return 1
+	}
+	return max * 1.1
+}
+
+// lineChart : 折れ線グラフを描画する maxが0なら最大値から決める
+// labelsはX軸の先頭と末尾に表示する
+func (p *pdfDoc) lineChart(title string, labels []string, series []pdfSeries, max float64) {
+	vl := [][]float64{}
+	for _, s := range series {
+		vl = append(vl, s.Values)
+	}
+	max = pdfChartMax(max, vl...)
+	x, y, w, h := p.chartFrame(title, max)
+	for _, s := range series {
+		n := len(s.Values)
+		if n < 2 {
+			continue
+		}
+		p.setColor(s.Color[0], s.Color[1], s.Color[2])
+		p.cur.WriteString("1 w")
+		for i, v := range s.Values {
+			if v > max {
+				v = max
+			}
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(p.cur, " %.2f %.2f %s", x+w*float64(i)/float64(n-1), pdfPageHeight-(y+h-h*v/max), op)
+		}
+		p.cur.WriteString(" S\n")
+	}
+	p.setColor(0, 0, 0)
+	if len(labels) > 0 {
+		p.text(x, y+h+3, 7, labels[0])
+		l := labels[len(labels)-1]
+		p.text(x+w-pdfTextWidth(l, 7), y+h+3, 7, l)
+	}
+	// 凡例
+	lx := x
+	for _, s := range series {
+		p.setColor(s.Color[0], s.Color[1], s.Color[2])
+		p.rect(lx, y+h+16, 8, 8, true)
+		p.setColor(0, 0, 0)
+		p.text(lx+10, y+h+16, 8, s.Name)
+		lx += pdfTextWidth(s.Name, 8) + 24
+	}
+	p.y = y + h + 34
+}
+
+// barChart : 棒グラフを描画する
+func (p *pdfDoc) barChart(title string, labels []string, values []float64, colors [][3]float64) {
+	max := pdfChartMax(0, values)
+	x, y, w, h := p.chartFrame(title, max)
+	n := len(values)
+	if n > 0 {
+		bw := w / float64(n)
+		for i, v := range values {
+			c := [3]float64{0.2, 0.4, 0.8}
+			if i < len(colors) {
+				c = colors[i]
+			}
+			bh := h * v / max
+			p.setColor(c[0], c[1], c[2])
+			p.rect(x+bw*float64(i)+bw*0.15, y+h-bh, bw*0.7, bh, true)
+			p.setColor(0, 0, 0)
+			if i < len(labels) {
+				l := pdfFit(labels[i], bw, 7)
+				p.text(x+bw*float64(i)+(bw-pdfTextWidth(l, 7))/2, y+h+3, 7, l)
+			}
+			vl := fmt.Sprintf("%.4g", v)
+			p.text(x+bw*float64(i)+(bw-pdfTextWidth(vl, 7))/2, y+h-bh-10, 7, vl)
+		}
+	}
+	p.y = y + h + 20
+}
+
+// bytes : PDFファイルの内容を作成する
+func (p *pdfDoc) bytes() []byte {
+	p.flushPage()
+	out := new(bytes.Buffer)
+	offsets := []int{}
+	obj := func(s string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), s)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	n := len(p.pages)
+	kids := []string{}
+	for i := 0; i < n; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+i*2))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), n))
+	obj("<< /Type /Font /Subtype /Type0 /BaseFont /HeiseiKakuGo-W5 /Encoding /UniJIS-UCS2-HW-H /DescendantFonts [4 0 R] >>")
+	obj("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /HeiseiKakuGo-W5" +
+		" /CIDSystemInfo << /Registry (Adobe) /Ordering (Japan1) /Supplement 2 >>" +
+		" /FontDescriptor 5 0 R /DW 1000 /W [1 95 500 231 632 500] >>")
+	obj("<< /Type /FontDescriptor /FontName /HeiseiKakuGo-W5 /Flags 4 /FontBBox [-92 -250 1010 922]" +
+		" /ItalicAngle 0 /Ascent 752 /Descent -221 /CapHeight 737 /StemV 114 >>")
+	for i, c := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+i*2))
+		z := new(bytes.Buffer)
+		w := zlib.NewWriter(z)
+		w.Write(c)
+		w.Close()
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), z.Len())
+		out.Write(z.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tmc/langchaingo/llms"
@@ -20,89 +21,146 @@ import (
 )
 
 func sendReport() {
+	sendReportWith(defaultReportParams())
+}
+
+// sendReportMu : レポートの作成で使う状態を共有するので同時に作成しない
+var sendReportMu sync.Mutex
+
+func sendReportWith(rp *reportParams) error {
+	sendReportMu.Lock()
+	defer sendReportMu.Unlock()
 	if datastore.NotifyConf.HTMLMail {
-		sendReportHTML()
-	} else {
-		sendReportPlain()
+		return sendReportHTML(rp)
 	}
+	return sendReportPlain(rp)
 }
 
-func sendReportPlain() {
+func sendReportPlain(rp *reportParams) error {
 	body := []string{}
-	if datastore.NotifyConf.ReportLLMSummary {
+	if rp.has("llm") {
 		body = append(body, "【AIの要約】")
-		body = append(body, getLLMSummary())
-	}
-	body = append(body, "【現在のマップ情報】")
-	body = append(body, getMapInfo(false)...)
-	body = append(body, "")
-	body = append(body, "【データストア情報】")
-	body = append(body, getDBInfo(false)...)
-	body = append(body, "")
-	body = append(body, "【システムリソース情報】(Min/Mean/Max)")
-	body = append(body, getResInfo(false)...)
-	body = append(body, "")
-	logSum, logs, _ := getLastEventLog()
-	body = append(body, "【最新24時間のログ集計】")
-	body = append(body, logSum)
-	body = append(body, "")
-	body = append(body, "【センサー情報】")
-	body = append(body, getSensorInfo()...)
-	body = append(body, "")
-	body = append(body, "【AI分析情報】")
-	body = append(body, getAIInfo()...)
-	body = append(body, "")
-	nd, bd := getDeviceReport()
-	nu, bu := getUserReport()
-	nip, bip := getIPReport()
-	if datastore.NotifyConf.NotifyNewInfo {
-		body = append(body, "【48時間以内に新しく発見したデバイス】")
-		body = append(body, nd...)
+		body = append(body, getLLMSummary(rp))
+	}
+	if rp.has("map") {
+		body = append(body, "【現在のマップ情報】")
+		body = append(body, getMapInfo(false, rp)...)
 		body = append(body, "")
-		body = append(body, "【48時間以内に新しく発見したユーザーID】")
-		body = append(body, nu...)
+	}
+	if rp.has("db") {
+		body = append(body, "【データストア情報】")
+		body = append(body, getDBInfo(false)...)
 		body = append(body, "")
-		body = append(body, "【24時間以内に新しく発見したIPアドレス】")
-		body = append(body, nip...)
+	}
+	if rp.has("resource") {
+		body = append(body, "【システムリソース情報】(Min/Mean/Max)")
+		body = append(body, getResInfo(false)...)
 		body = append(body, "")
-		body = append(body, "【24時間以内に新しく発見したWifi AP】")
-		body = append(body, getWifiAPReport()...)
+	}
+	logSum, logs, _ := getLastEventLog(rp)
+	if rp.has("logs") {
+		body = append(body, fmt.Sprintf("【最新%sのログ集計】", rp.period(24*time.Hour)))
+		body = append(body, logSum)
 		body = append(body, "")
-		body = append(body, "【24時間以内に新しく発見したBluetooth デバイス】")
-		body = append(body, getBlueDevcieReport()...)
+	}
+	if rp.has("sensor") {
+		body = append(body, "【センサー情報】")
+		body = append(body, getSensorInfo()...)
 		body = append(body, "")
-		body = append(body, "【最新24時間の障害ログ】")
-		body = append(body, logs...)
 	}
-	if datastore.NotifyConf.NotifyLowScore {
+	if rp.has("ai") {
+		body = append(body, "【AI分析情報】")
+		body = append(body, getAIInfo(rp)...)
 		body = append(body, "")
-		body = append(body, "【信用スコアが下位10%のデバイス】")
-		body = append(body, bd...)
+	}
+	if rp.has("compliance") && len(datastore.GetComplianceRules()) > 0 {
+		body = append(body, "【コンプライアンス違反】")
+		body = append(body, getComplianceInfo(rp)...)
+		body = append(body, "")
+	}
+	if rp.has("capacity") {
+		body = append(body, "【容量計画(90日以内に使用率80%到達予測)】")
+		body = append(body, getCapacityInfo(rp)...)
 		body = append(body, "")
-		body = append(body, "【信用スコアが下位10%のユーザーID】")
-		body = append(body, bu...)
+	}
+	if rp.has("sla") {
+		body = append(body, "【SLA(今月)】")
+		body = append(body, slaInfoLines(getReportSLAList(rp))...)
 		body = append(body, "")
-		body = append(body, "【信用スコアが下位1%のIPアドレス】")
-		body = append(body, bip...)
 	}
-	subject := fmt.Sprintf("%s(定期レポート) at %s", datastore.NotifyConf.Subject, time.Now().Format(time.RFC3339))
-	if err := sendMail(subject, strings.Join(body, "\r\n")); err != nil {
+	nd, bd := getDeviceReport(rp)
+	nu, bu := getUserReport(rp)
+	nip, bip := getIPReport(rp)
+	long := rp.period(48 * time.Hour)
+	short := rp.period(24 * time.Hour)
+	if rp.newInfo {
+		if rp.has("devices") {
+			body = append(body, fmt.Sprintf("【%s以内に新しく発見したデバイス】", long))
+			body = append(body, nd...)
+			body = append(body, "")
+		}
+		if rp.has("users") {
+			body = append(body, fmt.Sprintf("【%s以内に新しく発見したユーザーID】", long))
+			body = append(body, nu...)
+			body = append(body, "")
+		}
+		if rp.has("ips") {
+			body = append(body, fmt.Sprintf("【%s以内に新しく発見したIPアドレス】", short))
+			body = append(body, nip...)
+			body = append(body, "")
+		}
+		if rp.has("wifi") {
+			body = append(body, fmt.Sprintf("【%s以内に新しく発見したWifi AP】", short))
+			body = append(body, getWifiAPReport(rp)...)
+			body = append(body, "")
+		}
+		if rp.has("bluetooth") {
+			body = append(body, fmt.Sprintf("【%s以内に新しく発見したBluetooth デバイス】", short))
+			body = append(body, getBlueDevcieReport(rp)...)
+			body = append(body, "")
+		}
+		if rp.has("logs") {
+			body = append(body, fmt.Sprintf("【最新%sの障害ログ】", short))
+			body = append(body, logs...)
+		}
+	}
+	if rp.lowScore {
+		if rp.has("devices") {
+			body = append(body, "")
+			body = append(body, "【信用スコアが下位10%のデバイス】")
+			body = append(body, bd...)
+		}
+		if rp.has("users") {
+			body = append(body, "")
+			body = append(body, "【信用スコアが下位10%のユーザーID】")
+			body = append(body, bu...)
+		}
+		if rp.has("ips") {
+			body = append(body, "")
+			body = append(body, "【信用スコアが下位1%のIPアドレス】")
+			body = append(body, bip...)
+		}
+	}
+	subject := fmt.Sprintf("%s(%s) at %s", datastore.NotifyConf.Subject, rp.title, time.Now().Format(time.RFC3339))
+	attachments := getReportAttachments(rp)
+	if err := sendMailTo(rp.mailTo, subject, strings.Join(body, "\r\n"), attachments...); err != nil {
 		log.Printf("send report mail err=%v", err)
 		datastore.AddEventLog(&datastore.EventLogEnt{
 			Type:  "system",
 			Level: "high",
-			Event: "定期レポートメールの送信に失敗しました",
-		})
-	} else {
-		datastore.AddEventLog(&datastore.EventLogEnt{
-			Type:  "system",
-			Level: "info",
-			Event: "定期レポートメール送信",
+			Event: rp.title + "メールの送信に失敗しました",
 		})
+		return err
 	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "system",
+		Level: "info",
+		Event: rp.title + "メール送信",
+	})
+	return nil
 }
 
-func getLastEventLog() (string, []string, []*datastore.EventLogEnt) {
+func getLastEventLog(rp *reportParams) (string, []string, []*datastore.EventLogEnt) {
 	slogs := []string{}
 	logs := []*datastore.EventLogEnt{}
 	high := 0
@@ -110,11 +168,14 @@ func getLastEventLog() (string, []string, []*datastore.EventLogEnt) {
 	warn := 0
 	normal := 0
 	other := 0
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+	st := rp.since(24 * time.Hour)
 	datastore.ForEachLastEventLog(0, func(l *datastore.EventLogEnt) bool {
 		if l.Time < st {
 			return false
 		}
+		if rp.filter != "" && (l.NodeID == "" || !rp.matchNode(l.NodeID)) {
+			return true
+		}
 		switch l.Level {
 		case "high":
 			high++
@@ -139,7 +200,7 @@ func getLastEventLog() (string, []string, []*datastore.EventLogEnt) {
 	return sum, slogs, logs
 }
 
-func getMapInfo(htmlMode bool) []string {
+func getMapInfo(htmlMode bool, rp *reportParams) []string {
 	high := 0
 	low := 0
 	warn := 0
@@ -147,6 +208,9 @@ func getMapInfo(htmlMode bool) []string {
 	repair := 0
 	unknown := 0
 	datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
+		if rp.filter != "" && !datastore.NodeMatchTagSelector(n, rp.filter) {
+			return true
+		}
 		switch n.State {
 		case "high":
 			high++
@@ -193,8 +257,8 @@ func getMapInfo(htmlMode bool) []string {
 	}
 }
 
-func getDeviceReport() ([]string, []string) {
-	st := time.Now().Add(time.Duration(-48) * time.Hour).UnixNano()
+func getDeviceReport(rp *reportParams) ([]string, []string) {
+	st := rp.since(48 * time.Hour)
 	retNew := []string{}
 	retBad := []string{}
 	retNew = append(retNew, "Name,Score,IP,MAC,Vendor,Time")
@@ -213,8 +277,8 @@ func getDeviceReport() ([]string, []string) {
 	return retNew, retBad
 }
 
-func getDeviceList() ([]*datastore.DeviceEnt, []*datastore.DeviceEnt) {
-	st := time.Now().Add(time.Duration(-48) * time.Hour).UnixNano()
+func getDeviceList(rp *reportParams) ([]*datastore.DeviceEnt, []*datastore.DeviceEnt) {
+	st := rp.since(48 * time.Hour)
 	retNew := []*datastore.DeviceEnt{}
 	retBad := []*datastore.DeviceEnt{}
 	datastore.ForEachDevices(func(d *datastore.DeviceEnt) bool {
@@ -229,8 +293,8 @@ func getDeviceList() ([]*datastore.DeviceEnt, []*datastore.DeviceEnt) {
 	return retNew, retBad
 }
 
-func getUserReport() ([]string, []string) {
-	st := time.Now().Add(time.Duration(-48) * time.Hour).UnixNano()
+func getUserReport(rp *reportParams) ([]string, []string) {
+	st := rp.since(48 * time.Hour)
 	retNew := []string{}
 	retBad := []string{}
 	retNew = append(retNew, "User,Server,Score,Server IP,Clients,Time")
@@ -263,8 +327,8 @@ func getUserReport() ([]string, []string) {
 	return retNew, retBad
 }
 
-func getUserList() ([]*datastore.UserEnt, []*datastore.UserEnt) {
-	st := time.Now().Add(time.Duration(-48) * time.Hour).UnixNano()
+func getUserList(rp *reportParams) ([]*datastore.UserEnt, []*datastore.UserEnt) {
+	st := rp.since(48 * time.Hour)
 	retNew := []*datastore.UserEnt{}
 	retBad := []*datastore.UserEnt{}
 	datastore.ForEachUsers(func(u *datastore.UserEnt) bool {
@@ -279,8 +343,8 @@ func getUserList() ([]*datastore.UserEnt, []*datastore.UserEnt) {
 	return retNew, retBad
 }
 
-func getIPReport() ([]string, []string) {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getIPReport(rp *reportParams) ([]string, []string) {
+	st := rp.since(24 * time.Hour)
 	retNew := []string{}
 	retBad := []string{}
 	retNew = append(retNew, "IP,Name,Score,MAC,Loc,Time")
@@ -298,8 +362,8 @@ func getIPReport() ([]string, []string) {
 	return retNew, retBad
 }
 
-func getIPList() ([]*datastore.IPReportEnt, []*datastore.IPReportEnt) {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getIPList(rp *reportParams) ([]*datastore.IPReportEnt, []*datastore.IPReportEnt) {
+	st := rp.since(24 * time.Hour)
 	retNew := []*datastore.IPReportEnt{}
 	retBad := []*datastore.IPReportEnt{}
 	datastore.ForEachIPReport(func(i *datastore.IPReportEnt) bool {
@@ -493,10 +557,10 @@ func getResInfo(htmlMode bool) []string {
 	}
 }
 
-func getAIInfo() []string {
+func getAIInfo(rp *reportParams) []string {
 	ret := []string{"Score,Node,Polling,Count"}
 	datastore.ForEachPollings(func(p *datastore.PollingEnt) bool {
-		if p.LogMode != datastore.LogModeAI {
+		if p.LogMode != datastore.LogModeAI || !rp.matchNode(p.NodeID) {
 			return true
 		}
 		n := datastore.GetNode(p.NodeID)
@@ -527,10 +591,10 @@ type aiResultEnt struct {
 	LastTime    int64
 }
 
-func getAIList() []aiResultEnt {
+func getAIList(rp *reportParams) []aiResultEnt {
 	ret := []aiResultEnt{}
 	datastore.ForEachPollings(func(p *datastore.PollingEnt) bool {
-		if p.LogMode != datastore.LogModeAI {
+		if p.LogMode != datastore.LogModeAI || !rp.matchNode(p.NodeID) {
 			return true
 		}
 		n := datastore.GetNode(p.NodeID)
@@ -556,6 +620,48 @@ func getAIList() []aiResultEnt {
 	return ret
 }
 
+func getComplianceInfo(rp *reportParams) []string {
+	ret := []string{"Node,IP,Violation"}
+	for _, r := range getComplianceList(rp) {
+		ret = append(ret, fmt.Sprintf("%s,%s,%s", r.NodeName, r.IP, strings.Join(r.Violation, " ")))
+	}
+	return ret
+}
+
+// getComplianceList : コンプライアンスルールに違反しているノードのリスト
+func getComplianceList(rp *reportParams) []*datastore.ComplianceReportEnt {
+	ret := []*datastore.ComplianceReportEnt{}
+	for _, r := range datastore.GetComplianceReport() {
+		if !r.Compliant && rp.matchNode(r.NodeID) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// 容量計画で報告する80%到達までの日数
+const capacityReportDays = 90
+
+func getCapacityInfo(rp *reportParams) []string {
+	ret := []string{"Node,Polling,P95 Util,Peak Util,Days to 80%"}
+	for _, e := range getCapacityList(rp) {
+		ret = append(ret, fmt.Sprintf("%s,%s,%s,%s,%s", e.NodeName, e.PollingName,
+			formatPercent(e.P95Util), formatPercent(e.PeakUtil), formatDays(e.DaysTo80)))
+	}
+	return ret
+}
+
+// getCapacityList : 90日以内に使用率が80%に達すると予測したインターフェースのリスト
+func getCapacityList(rp *reportParams) []*datastore.CapacityEnt {
+	ret := []*datastore.CapacityEnt{}
+	for _, e := range datastore.GetCapacityReport(30) {
+		if e.DaysTo80 >= 0 && e.DaysTo80 <= capacityReportDays && rp.matchNode(e.NodeID) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
 func getSensorInfo() []string {
 	ret := []string{}
 	ret = append(ret, "State,Host,Type,Params,total,Last Time")
@@ -597,8 +703,8 @@ func getRSSIStats(rssi []datastore.RSSIEnt) (min, mean, max float64) {
 	return
 }
 
-func getWifiAPReport() []string {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getWifiAPReport(rp *reportParams) []string {
+	st := rp.since(24 * time.Hour)
 	m := make(map[string]bool)
 	ret := []string{}
 	ret = append(ret, "RSSI(min/avg/max),BSSID,SSID,Host,Channel,Count,First Time")
@@ -619,8 +725,8 @@ func getWifiAPReport() []string {
 	return ret
 }
 
-func getWifiAPList() []*datastore.WifiAPEnt {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getWifiAPList(rp *reportParams) []*datastore.WifiAPEnt {
+	st := rp.since(24 * time.Hour)
 	m := make(map[string]bool)
 	ret := []*datastore.WifiAPEnt{}
 	datastore.ForEachWifiAP(func(a *datastore.WifiAPEnt) bool {
@@ -637,8 +743,8 @@ func getWifiAPList() []*datastore.WifiAPEnt {
 	return ret
 }
 
-func getBlueDevcieReport() []string {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getBlueDevcieReport(rp *reportParams) []string {
+	st := rp.since(24 * time.Hour)
 	m := make(map[string]bool)
 	ret := []string{}
 	ret = append(ret, "RSSI(min/avg/max),Address,Name,Host,Address Type,Vendor,Count,Time")
@@ -659,8 +765,8 @@ func getBlueDevcieReport() []string {
 	return ret
 }
 
-func getBlueDevcieList() []*datastore.BlueDeviceEnt {
-	st := time.Now().Add(time.Duration(-24) * time.Hour).UnixNano()
+func getBlueDevcieList(rp *reportParams) []*datastore.BlueDeviceEnt {
+	st := rp.since(24 * time.Hour)
 	ret := []*datastore.BlueDeviceEnt{}
 	m := make(map[string]bool)
 	datastore.ForEachBlueDevice(func(b *datastore.BlueDeviceEnt) bool {
@@ -683,10 +789,13 @@ type reportInfoEnt struct {
 	Value string
 }
 
-// HTML版レポートの送信
-func sendReportHTML() {
+// getReportInfo : マップ、データストア、リソース、ログの状態
+func getReportInfo(rp *reportParams) ([]reportInfoEnt, []*datastore.EventLogEnt) {
 	info := []reportInfoEnt{}
-	a := getMapInfo(true)
+	a := []string{}
+	if rp.has("map") {
+		a = getMapInfo(true, rp)
+	}
 	if len(a) > 3 {
 		info = append(info, reportInfoEnt{
 			Name:  "マップ名",
@@ -704,7 +813,10 @@ func sendReportHTML() {
 			Class: "none",
 		})
 	}
-	a = getDBInfo(true)
+	a = []string{}
+	if rp.has("db") {
+		a = getDBInfo(true)
+	}
 	if len(a) > 2 {
 		info = append(info, reportInfoEnt{
 			Name:  "データストアサイズ",
@@ -722,7 +834,10 @@ func sendReportHTML() {
 			Class: "none",
 		})
 	}
-	a = getResInfo(true)
+	a = []string{}
+	if rp.has("resource") {
+		a = getResInfo(true)
+	}
 	if len(a) > 3 {
 		info = append(info, reportInfoEnt{
 			Name:  "CPU使用率",
@@ -755,40 +870,120 @@ func sendReportHTML() {
 			Class: loadClass,
 		})
 	}
-	logSum, _, logs := getLastEventLog()
-	if len(logSum) > 0 {
+	logSum, _, logs := getLastEventLog(rp)
+	if rp.has("logs") && len(logSum) > 0 {
 		info = append(info, reportInfoEnt{
 			Name:  "状態別のログ数",
 			Value: logSum,
 			Class: "none",
 		})
 	}
-	nd, bd := getDeviceList()
-	nu, bu := getUserList()
-	nip, bip := getIPList()
-	title := fmt.Sprintf("%s(定期レポート) at %s", datastore.NotifyConf.Subject, time.Now().Format("2006/01/02 15:04:05"))
-	aiList := getAIList()
-	sensorList := getSensorList()
-	webhookReport(title, info, sensorList, aiList)
+	return info, logs
+}
+
+// getReportSLAList : レポートに含めるSLAの今月の集計
+func getReportSLAList(rp *reportParams) []*datastore.SLAReportEnt {
+	ret := []*datastore.SLAReportEnt{}
+	for _, r := range getSLAReports(time.Now()) {
+		if rp.filter != "" && r.Scope == "node" {
+			if s := datastore.GetSLA(r.SLAID); s == nil || !rp.matchNode(s.TargetID) {
+				continue
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// HTML版レポートの送信
+func sendReportHTML(rp *reportParams) error {
+	info, logs := getReportInfo(rp)
+	nd, bd := getDeviceList(rp)
+	nu, bu := getUserList(rp)
+	nip, bip := getIPList(rp)
+	title := fmt.Sprintf("%s(%s) at %s", datastore.NotifyConf.Subject, rp.title, time.Now().Format("2006/01/02 15:04:05"))
+	aiList := []aiResultEnt{}
+	if rp.has("ai") {
+		aiList = getAIList(rp)
+	}
+	sensorList := []*datastore.SensorEnt{}
+	if rp.has("sensor") {
+		sensorList = getSensorList()
+	}
+	var complianceList []*datastore.ComplianceReportEnt
+	if rp.has("compliance") && len(datastore.GetComplianceRules()) > 0 {
+		complianceList = getComplianceList(rp)
+		class := "normal"
+		if len(complianceList) > 0 {
+			class = "warn"
+		}
+		info = append(info, reportInfoEnt{
+			Name:  "コンプライアンス違反ノード数",
+			Value: fmt.Sprintf("%d", len(complianceList)),
+			Class: class,
+		})
+	}
+	var capacityList []*datastore.CapacityEnt
+	if rp.has("capacity") {
+		capacityList = getCapacityList(rp)
+	}
+	if len(capacityList) > 0 {
+		info = append(info, reportInfoEnt{
+			Name:  "容量不足予測インターフェース数",
+			Value: fmt.Sprintf("%d", len(capacityList)),
+			Class: "warn",
+		})
+	}
+	var slaList []*datastore.SLAReportEnt
+	if rp.has("sla") {
+		slaList = getReportSLAList(rp)
+	}
+	if len(slaList) > 0 {
+		ng := 0
+		for _, r := range slaList {
+			if r.Availability >= 0 && !r.Met {
+				ng++
+			}
+		}
+		class := "normal"
+		if ng > 0 {
+			class = "high"
+		}
+		info = append(info, reportInfoEnt{
+			Name:  "SLA未達成数",
+			Value: fmt.Sprintf("%d/%d", ng, len(slaList)),
+			Class: class,
+		})
+	}
+	if rp.defaultReport {
+		webhookReport(title, info, sensorList, aiList)
+	}
 	f := template.FuncMap{
-		"levelName":     levelName,
-		"formatLogTime": formatLogTime,
-		"formatScore":   formatScore,
-		"formatRSSI":    formatRSSI,
-		"scoreClass":    scoreClass,
-		"aiScoreClass":  aiScoreClass,
-		"formatAITime":  formatAITime,
-		"rssiClass":     rssiClass,
-		"formatCount":   formatCount,
+		"levelName":          levelName,
+		"formatLogTime":      formatLogTime,
+		"formatScore":        formatScore,
+		"formatRSSI":         formatRSSI,
+		"scoreClass":         scoreClass,
+		"aiScoreClass":       aiScoreClass,
+		"formatAITime":       formatAITime,
+		"rssiClass":          rssiClass,
+		"formatCount":        formatCount,
+		"formatBps":          formatBps,
+		"formatPercent":      formatPercent,
+		"formatDays":         formatDays,
+		"formatAvailability": formatAvailability,
+		"formatMinutes":      formatMinutes,
+		"slaClass":           slaClass,
+		"slaResult":          slaResult,
 	}
 	t, err := template.New("report").Funcs(f).Parse(datastore.LoadMailTemplate("report"))
 	if err != nil {
 		log.Printf("send report mail err=%v", err)
-		return
+		return err
 	}
 	llmSummary := ""
-	if datastore.NotifyConf.ReportLLMSummary {
-		llmSummary = getLLMSummary()
+	if rp.has("llm") {
+		llmSummary = getLLMSummary(rp)
 	}
 	body := new(bytes.Buffer)
 	if err = t.Execute(body, map[string]interface{}{
@@ -803,38 +998,46 @@ func sendReportHTML() {
 		"BadUsers":       bu,
 		"NewIPs":         nip,
 		"BadIPs":         bip,
-		"NewWifiAPs":     getWifiAPList(),
-		"NewBlueDevcies": getBlueDevcieList(),
+		"NewWifiAPs":     getWifiAPList(rp),
+		"NewBlueDevcies": getBlueDevcieList(rp),
 		"AIList":         aiList,
-		"NotifyLowScore": datastore.NotifyConf.NotifyLowScore,
-		"NotifyNewInfo":  datastore.NotifyConf.NotifyNewInfo,
+		"Compliance":     complianceList,
+		"Capacity":       capacityList,
+		"SLA":            slaList,
+		"NotifyLowScore": rp.lowScore,
+		"NotifyNewInfo":  rp.newInfo,
 		"LLMSummary":     llmSummary,
+		"Sections":       rp.sections,
+		"LongPeriod":     rp.period(48 * time.Hour),
+		"ShortPeriod":    rp.period(24 * time.Hour),
 	}); err != nil {
 		log.Printf("send report mail err=%v", err)
 		datastore.AddEventLog(&datastore.EventLogEnt{
 			Type:  "system",
 			Level: "low",
-			Event: fmt.Sprintf("定期レポートメール送信失敗 err=%v", err),
+			Event: fmt.Sprintf("%sメール送信失敗 err=%v", rp.title, err),
 		})
-		return
+		return err
 	}
-	if err := sendMail(title, body.String()); err != nil {
+	attachments := getReportAttachments(rp)
+	if err := sendMailTo(rp.mailTo, title, body.String(), attachments...); err != nil {
 		log.Printf("send report mail err=%v", err)
 		datastore.AddEventLog(&datastore.EventLogEnt{
 			Type:  "system",
 			Level: "high",
-			Event: fmt.Sprintf("定期レポートメール送信失敗 err=%v", err),
-		})
-	} else {
-		datastore.AddEventLog(&datastore.EventLogEnt{
-			Type:  "system",
-			Level: "info",
-			Event: "定期レポートメール送信",
+			Event: fmt.Sprintf("%sメール送信失敗 err=%v", rp.title, err),
 		})
+		return err
 	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "system",
+		Level: "info",
+		Event: rp.title + "メール送信",
+	})
+	return nil
 }
 
-func getLLMSummary() string {
+func getLLMSummary(rp *reportParams) string {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
 	defer cancel()
 	llm, err := datastore.GetLLM(ctx)
@@ -860,7 +1063,7 @@ func getLLMSummary() string {
 `
 	prompts := []string{}
 	prompts = append(prompts, "【現在のマップ情報】")
-	prompts = append(prompts, getMapInfo(false)...)
+	prompts = append(prompts, getMapInfo(false, rp)...)
 	prompts = append(prompts, "")
 	prompts = append(prompts, "【データストア情報】")
 	prompts = append(prompts, getDBInfo(false)...)
@@ -868,35 +1071,37 @@ func getLLMSummary() string {
 	prompts = append(prompts, "【システムリソース情報】(Min/Mean/Max)")
 	prompts = append(prompts, getResInfo(false)...)
 	prompts = append(prompts, "")
-	logSum, logs, _ := getLastEventLog()
-	prompts = append(prompts, "【最新24時間のログ集計】")
+	logSum, logs, _ := getLastEventLog(rp)
+	prompts = append(prompts, fmt.Sprintf("【最新%sのログ集計】", rp.period(24*time.Hour)))
 	prompts = append(prompts, logSum)
 	prompts = append(prompts, "")
 	prompts = append(prompts, "【センサー情報】")
 	prompts = append(prompts, getSensorInfo()...)
 	prompts = append(prompts, "")
 	prompts = append(prompts, "【AI分析情報】")
-	prompts = append(prompts, getAIInfo()...)
+	prompts = append(prompts, getAIInfo(rp)...)
 	prompts = append(prompts, "")
-	nd, bd := getDeviceReport()
-	nu, bu := getUserReport()
-	nip, bip := getIPReport()
-	prompts = append(prompts, "【48時間以内に新しく発見したデバイス】")
+	nd, bd := getDeviceReport(rp)
+	nu, bu := getUserReport(rp)
+	nip, bip := getIPReport(rp)
+	long := rp.period(48 * time.Hour)
+	short := rp.period(24 * time.Hour)
+	prompts = append(prompts, fmt.Sprintf("【%s以内に新しく発見したデバイス】", long))
 	prompts = append(prompts, nd...)
 	prompts = append(prompts, "")
-	prompts = append(prompts, "【48時間以内に新しく発見したユーザーID】")
+	prompts = append(prompts, fmt.Sprintf("【%s以内に新しく発見したユーザーID】", long))
 	prompts = append(prompts, nu...)
 	prompts = append(prompts, "")
-	prompts = append(prompts, "【24時間以内に新しく発見したIPアドレス】")
+	prompts = append(prompts, fmt.Sprintf("【%s以内に新しく発見したIPアドレス】", short))
 	prompts = append(prompts, nip...)
 	prompts = append(prompts, "")
-	prompts = append(prompts, "【24時間以内に新しく発見したWifi AP】")
-	prompts = append(prompts, getWifiAPReport()...)
+	prompts = append(prompts, fmt.Sprintf("【%s以内に新しく発見したWifi AP】", short))
+	prompts = append(prompts, getWifiAPReport(rp)...)
 	prompts = append(prompts, "")
-	prompts = append(prompts, "【24時間以内に新しく発見したBluetooth デバイス】")
-	prompts = append(prompts, getBlueDevcieReport()...)
+	prompts = append(prompts, fmt.Sprintf("【%s以内に新しく発見したBluetooth デバイス】", short))
+	prompts = append(prompts, getBlueDevcieReport(rp)...)
 	prompts = append(prompts, "")
-	prompts = append(prompts, "【最新24時間の障害ログ】")
+	prompts = append(prompts, fmt.Sprintf("【最新%sの障害ログ】", short))
 	prompts = append(prompts, logs...)
 	prompts = append(prompts, "")
 	prompts = append(prompts, "【信用スコアが下位10%のデバイス】")
@@ -0,0 +1,152 @@
+package notify
+
+// レポートの定義に従ったレポートの送信
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// reportParams : レポートの内容と宛先
+type reportParams struct {
+	title         string // 件名に付ける名前
+	mailTo        string
+	sections      map[string]bool
+	filter        string        // ノードのタグセレクタ
+	window        time.Duration // 新しく発見した情報とログの期間 0は既定値
+	newInfo       bool
+	lowScore      bool
+	pdf           bool
+	csv           bool
+	defaultReport bool
+}
+
+// defaultReportParams : 通知設定の定期レポート
+func defaultReportParams() *reportParams {
+	rp := &reportParams{
+		title:         "定期レポート",
+		mailTo:        datastore.NotifyConf.MailTo,
+		sections:      make(map[string]bool),
+		newInfo:       datastore.NotifyConf.NotifyNewInfo,
+		lowScore:      datastore.NotifyConf.NotifyLowScore,
+		pdf:           datastore.NotifyConf.ReportPDF,
+		csv:           datastore.NotifyConf.ReportCSV,
+		defaultReport: true,
+	}
+	for _, s := range datastore.ReportSections {
+		rp.sections[s] = true
+	}
+	rp.sections["llm"] = datastore.NotifyConf.ReportLLMSummary
+	return rp
+}
+
+// newReportParams : レポートの定義から内容を決める
+func newReportParams(d *datastore.ReportDefEnt) *reportParams {
+	rp := &reportParams{
+		title:    d.Name,
+		mailTo:   d.MailTo,
+		sections: make(map[string]bool),
+		filter:   d.NodeFilter,
+		window:   datastore.GetReportDefWindow(d, time.Now()),
+		newInfo:  true,
+		lowScore: true,
+		pdf:      d.PDF,
+		csv:      d.CSV,
+	}
+	if rp.mailTo == "" {
+		rp.mailTo = datastore.NotifyConf.MailTo
+	}
+	sections := d.Sections
+	if len(sections) < 1 {
+		sections = datastore.ReportSections
+	}
+	for _, s := range sections {
+		rp.sections[s] = true
+	}
+	return rp
+}
+
+func (rp *reportParams) has(s string) bool {
+	return rp.sections[s]
+}
+
+// since : 集計を開始する時刻 定期レポートは項目毎の既定の期間
+func (rp *reportParams) since(def time.Duration) int64 {
+	if rp.window > 0 {
+		def = rp.window
+	}
+	return time.Now().Add(-def).UnixNano()
+}
+
+// period : 集計期間の表示名
+func (rp *reportParams) period(def time.Duration) string {
+	if rp.window > 0 {
+		def = rp.window
+	}
+	if def%(24*time.Hour) == 0 && def > 24*time.Hour {
+		return fmt.Sprintf("%d日", def/(24*time.Hour))
+	}
+	return fmt.Sprintf("%.0f時間", def.Hours())
+}
+
+// matchNode : ノードがフィルターに一致するか
+func (rp *reportParams) matchNode(id string) bool {
+	if rp.filter == "" {
+		return true
+	}
+	n := datastore.GetNode(id)
+	return n != nil && datastore.NodeMatchTagSelector(n, rp.filter)
+}
+
+// 送信に失敗したレポートを再送するまでの時間
+const reportDefRetry = time.Hour
+
+var reportDefFailed = make(map[string]time.Time)
+
+// checkReportDefs : 送信する日時になったレポートを送信する
+func checkReportDefs() {
+	now := time.Now()
+	for _, d := range datastore.GetReportDefs() {
+		if !datastore.IsReportDefDue(d, now) {
+			continue
+		}
+		if t, ok := reportDefFailed[d.ID]; ok && now.Sub(t) < reportDefRetry {
+			continue
+		}
+		rp := newReportParams(d)
+		if !canSendMailTo(rp.mailTo) {
+			continue
+		}
+		if err := sendReportWith(rp); err != nil {
+			reportDefFailed[d.ID] = now
+			continue
+		}
+		delete(reportDefFailed, d.ID)
+		// 送信できた場合だけ送信済みにする
+		if err := datastore.SetReportDefLastSend(d.ID, now); err != nil {
+			log.Printf("set report def last send err=%v", err)
+		}
+	}
+}
+
+// SendReportDef : レポートの定義に従ってすぐにレポートを送信する
+func SendReportDef(id string) error {
+	d := datastore.GetReportDef(id)
+	if d == nil {
+		return datastore.ErrInvalidID
+	}
+	rp := newReportParams(d)
+	if !canSendMailTo(rp.mailTo) {
+		return fmt.Errorf("mail not configured")
+	}
+	log.Printf("send report def name=%s", d.Name)
+	go func() {
+		if err := sendReportWith(rp); err != nil {
+			log.Printf("send report def name=%s err=%v", d.Name, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// sendRuleNotify : 振り分けルールの通知先へ通知する
+func sendRuleNotify(r *datastore.NotifyRuleEnt, list []*datastore.EventLogEnt) {
+	sendNotifyMail(list, r.Level, r.MailTo)
+	webhookNotify(list, r.Level, r.WebHookURL)
+	if r.ExecCmd == "" && r.MqttBroker == "" {
+		return
+	}
+	payload := getWebhookNotifyPayload(list, r.Level)
+	if payload.Count < 1 {
+		return
+	}
+	if r.ExecCmd != "" {
+		level := 3
+		for _, l := range payload.Log {
+			if nl := getLevelNum(l.Level); nl < level {
+				level = nl
+			}
+		}
+		if err := ExecNotifyCmd(r.ExecCmd, level); err != nil {
+			log.Printf("notify rule exec cmd err=%v", err)
+			datastore.AddEventLog(&datastore.EventLogEnt{
+				Type:  "system",
+				Level: "warn",
+				Event: fmt.Sprintf("通知ルール'%s'の外部コマンド実行エラー=%v", r.Name, err),
+			})
+		}
+	}
+	if r.MqttBroker != "" {
+		j, err := json.Marshal(payload)
+		if err == nil {
+			err = PublishMqtt(r, j)
+		}
+		if err != nil {
+			log.Printf("notify rule mqtt err=%v", err)
+			datastore.AddEventLog(&datastore.EventLogEnt{
+				Type:  "system",
+				Level: "warn",
+				Event: fmt.Sprintf("通知ルール'%s'のMQTT送信エラー=%v", r.Name, err),
+			})
+		}
+	}
+}
+
+// PublishMqtt : MQTTブローカーへ通知を送信する
+func PublishMqtt(r *datastore.NotifyRuleEnt, payload []byte) error {
+	broker := r.MqttBroker
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	topic := r.MqttTopic
+	if topic == "" {
+		topic = "twsnmp/notify"
+	}
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(broker)
+	opts.SetClientID(fmt.Sprintf("TWSNMP_FC_NOTIFY_%d", time.Now().UnixNano()))
+	opts.SetConnectTimeout(time.Second * 10)
+	if r.MqttUser != "" {
+		opts.SetUsername(r.MqttUser)
+		opts.SetPassword(r.MqttPassword)
+	}
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(time.Second*10) || token.Error() != nil {
+		if token.Error() != nil {
+			return token.Error()
+		}
+		return fmt.Errorf("mqtt connect timeout")
+	}
+	defer client.Disconnect(250)
+	token = client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(time.Second * 10) {
+		return fmt.Errorf("mqtt publish timeout")
+	}
+	return token.Error()
+}
@@ -0,0 +1,255 @@
+package notify
+
+// SLAの月次レポート
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func formatAvailability(f float64) string {
+	if f < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f%%", f)
+}
+
+func formatMinutes(i interface{}) string {
+	var m float64
+	switch v := i.(type) {
+	case int:
+		m = float64(v)
+	case float64:
+		m = v
+	}
+	if m < 60 {
+		return fmt.Sprintf("%.0f分", m)
+	}
+	d := time.Duration(m * float64(time.Minute))
+	h := int(d.Hours())
+	return fmt.Sprintf("%d時間%02d分", h, int(d.Minutes())-h*60)
+}
+
+func slaClass(r *datastore.SLAReportEnt) string {
+	switch {
+	case r.Availability < 0:
+		return "unknown"
+	case r.Met:
+		return "normal"
+	}
+	return "high"
+}
+
+func slaResult(r *datastore.SLAReportEnt) string {
+	switch {
+	case r.Availability < 0:
+		return "データなし"
+	case r.Met:
+		return "達成"
+	}
+	return "未達成"
+}
+
+// getSLAReports : 有効なSLAの指定した月のレポート
+func getSLAReports(month time.Time) []*datastore.SLAReportEnt {
+	ret := []*datastore.SLAReportEnt{}
+	for _, s := range datastore.GetSLAs() {
+		if s.Disabled {
+			continue
+		}
+		if r, err := datastore.GetSLAReport(s.ID, month); err == nil {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func getSLAInfo() []string {
+	return slaInfoLines(getSLAReports(time.Now()))
+}
+
+func slaInfoLines(list []*datastore.SLAReportEnt) []string {
+	ret := []string{"SLA,Target,Goal,Availability,Down,Failures,MTTR,Result"}
+	for _, r := range list {
+		ret = append(ret, fmt.Sprintf("%s,%s,%.3f%%,%s,%s,%d,%s,%s", r.Name, r.TargetName, r.Target,
+			formatAvailability(r.Availability), formatMinutes(r.DownMin), r.Failures, formatMinutes(r.MTTR), slaResult(r)))
+	}
+	return ret
+}
+
+// SLAReportCSV : SLAレポートのCSV
+func SLAReportCSV(list []*datastore.SLAReportEnt) []byte {
+	b := new(bytes.Buffer)
+	// Excelで開けるようにBOMを付ける
+	b.WriteString("\xef\xbb\xbf")
+	w := csv.NewWriter(b)
+	w.Write([]string{"Month", "SLA", "Target", "Polling", "Goal(%)", "Availability(%)", "Result",
+		"Service(min)", "Up(min)", "Down(min)", "Maintenance(min)", "Failures", "MTTR(min)", "MTBF(min)"})
+	for _, r := range list {
+		a := ""
+		if r.Availability >= 0 {
+			a = fmt.Sprintf("%.3f", r.Availability)
+		}
+		w.Write([]string{r.Month, r.Name, r.TargetName, "", fmt.Sprintf("%.3f", r.Target), a, slaResult(r),
+			fmt.Sprint(r.ServiceMin), fmt.Sprint(r.UpMin), fmt.Sprint(r.DownMin), fmt.Sprint(r.MaintenanceMin),
+			fmt.Sprint(r.Failures), fmt.Sprintf("%.1f", r.MTTR), fmt.Sprintf("%.1f", r.MTBF)})
+		for _, p := range r.Pollings {
+			a = ""
+			if p.Availability >= 0 {
+				a = fmt.Sprintf("%.3f", p.Availability)
+			}
+			w.Write([]string{r.Month, r.Name, r.TargetName, p.NodeName + ":" + p.PollingName, "", a, "",
+				"", fmt.Sprint(p.UpMin), fmt.Sprint(p.DownMin), "", fmt.Sprint(p.Failures), "", ""})
+		}
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// SLAReportHTML : SLAレポートのHTML
+func SLAReportHTML(title string, list []*datastore.SLAReportEnt) (string, error) {
+	f := template.FuncMap{
+		"formatLogTime":      formatLogTime,
+		"formatAvailability": formatAvailability,
+		"formatMinutes":      formatMinutes,
+		"slaClass":           slaClass,
+		"slaResult":          slaResult,
+	}
+	t, err := template.New("sla").Funcs(f).Parse(datastore.LoadMailTemplate("sla"))
+	if err != nil {
+		return "", err
+	}
+	body := new(bytes.Buffer)
+	if err := t.Execute(body, map[string]interface{}{
+		"Title":   title,
+		"URL":     datastore.NotifyConf.URL,
+		"Reports": list,
+	}); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+// SLAReportPDF : SLAレポートのPDF
+func SLAReportPDF(title string, list []*datastore.SLAReportEnt) []byte {
+	p := newPDF()
+	p.title(title)
+	rows := [][]string{}
+	for _, r := range list {
+		rows = append(rows, []string{r.Name, r.TargetName, fmt.Sprintf("%.3f%%", r.Target),
+			formatAvailability(r.Availability), formatMinutes(r.DownMin), fmt.Sprint(r.Failures),
+			formatMinutes(r.MTTR), formatMinutes(r.MTBF), slaResult(r)})
+	}
+	p.heading("【SLAの集計】")
+	p.table([]string{"SLA", "対象", "目標", "稼働率", "停止時間", "停止回数", "MTTR", "MTBF", "結果"},
+		rows, []float64{3, 3, 1.5, 1.5, 2, 1.2, 1.8, 2, 1.2})
+	for _, r := range list {
+		p.heading(fmt.Sprintf("【%s】%s", r.Name, r.TargetName))
+		p.paragraph(fmt.Sprintf("期間:%s〜%s 対象時間:%s 計画停止:%s 不明:%s",
+			formatLogTime(r.Start), formatLogTime(r.End), formatMinutes(r.ServiceMin),
+			formatMinutes(r.MaintenanceMin), formatMinutes(r.UnknownMin)), 9)
+		if len(r.Pollings) > 0 {
+			rows = [][]string{}
+			for _, e := range r.Pollings {
+				rows = append(rows, []string{e.NodeName, e.PollingName, formatAvailability(e.Availability),
+					formatMinutes(e.DownMin), fmt.Sprint(e.Failures)})
+			}
+			p.table([]string{"ノード", "ポーリング", "稼働率", "停止時間", "停止回数"}, rows, []float64{3, 4, 1.5, 2, 1.5})
+		}
+		if len(r.Outages) > 0 {
+			rows = [][]string{}
+			for _, o := range r.Outages {
+				rows = append(rows, []string{formatLogTime(o.Start), formatLogTime(o.End), formatMinutes(o.Duration)})
+			}
+			p.table([]string{"停止開始", "復旧", "停止時間"}, rows, []float64{2, 2, 1})
+		}
+	}
+	return p.bytes()
+}
+
+// checkSLAReport : 月が変わったら前月のSLAレポートをメールで送信する
+// 送信に失敗したSLAレポートを再送信するまでの時間
+const slaReportRetry = time.Hour
+
+var slaReportFailed = make(map[string]time.Time)
+
+func checkSLAReport() {
+	now := time.Now()
+	last := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local)
+	month := last.Format("2006-01")
+	mailMap := make(map[string][]*datastore.SLAReportEnt)
+	for _, s := range datastore.GetSLAs() {
+		if s.Disabled || s.LastReport == month {
+			continue
+		}
+		mailTo := s.MailTo
+		if mailTo == "" {
+			mailTo = datastore.NotifyConf.MailTo
+		}
+		if !canSendMailTo(mailTo) {
+			continue
+		}
+		if t, ok := slaReportFailed[mailTo]; ok && now.Sub(t) < slaReportRetry {
+			continue
+		}
+		r, err := datastore.GetSLAReport(s.ID, last)
+		if err != nil {
+			log.Printf("sla report err=%v", err)
+			continue
+		}
+		mailMap[mailTo] = append(mailMap[mailTo], r)
+	}
+	for mailTo, list := range mailMap {
+		if err := sendSLAReport(mailTo, month, list); err != nil {
+			slaReportFailed[mailTo] = now
+			continue
+		}
+		delete(slaReportFailed, mailTo)
+		// 送信できた場合だけ送信済みにする
+		for _, r := range list {
+			if err := datastore.SetSLALastReport(r.SLAID, month); err != nil {
+				log.Printf("set sla last report err=%v", err)
+			}
+		}
+	}
+}
+
+func sendSLAReport(mailTo, month string, list []*datastore.SLAReportEnt) error {
+	title := fmt.Sprintf("%s(SLAレポート %s)", datastore.NotifyConf.Subject, month)
+	body := ""
+	if datastore.NotifyConf.HTMLMail {
+		var err error
+		if body, err = SLAReportHTML(title, list); err != nil {
+			log.Printf("send sla report err=%v", err)
+			return err
+		}
+	} else {
+		body = title + "\r\n\r\n" + strings.Join(slaInfoLines(list), "\r\n") + "\r\n"
+	}
+	err := sendMailTo(mailTo, title, body,
+		mailAttachment{Name: "sla_" + month + ".csv", Data: SLAReportCSV(list)},
+		mailAttachment{Name: "sla_" + month + ".pdf", Data: SLAReportPDF(title, list)},
+	)
+	if err != nil {
+		log.Printf("send sla report err=%v", err)
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:  "system",
+			Level: "high",
+			Event: fmt.Sprintf("SLAレポートメール送信失敗 err=%v", err),
+		})
+		return err
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "system",
+		Level: "info",
+		Event: fmt.Sprintf("SLAレポートメール送信(%s)", month),
+	})
+	return nil
+}
@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htemplate "html/template"
+	"log"
+	"regexp"
+	"strings"
+	ttemplate "text/template"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// notifyTemplateData : 通知テンプレートに渡すデータ
+type notifyTemplateData struct {
+	Title  string
+	URL    string
+	Repair bool
+	Count  int
+	Log    *notifyTemplateLog // チャットの場合の対象のログ
+	Logs   []*notifyTemplateLog
+}
+
+type notifyTemplateLog struct {
+	Time      string
+	UnixTime  int64
+	Level     string
+	LevelName string
+	Type      string
+	NodeID    string
+	NodeName  string
+	Event     string
+	Node      *notifyTemplateNode
+	Polling   *notifyTemplatePolling
+}
+
+type notifyTemplateNode struct {
+	ID    string
+	Name  string
+	IP    string
+	MAC   string
+	Icon  string
+	Descr string
+	State string
+	Tags  []string
+	Group string
+}
+
+type notifyTemplatePolling struct {
+	ID     string
+	Name   string
+	Type   string
+	Level  string
+	State  string
+	Result map[string]any
+}
+
+var notifyTemplateFuncs = map[string]any{
+	"levelName":     levelName,
+	"formatLogTime": formatLogTime,
+	"upper":         strings.ToUpper,
+	"lower":         strings.ToLower,
+	"join":          strings.Join,
+	"json": func(v any) string {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(j)
+	},
+}
+
+var pollingEventPat = regexp.MustCompile(`^ポーリング状態変化:(.+)\(([-a-zA-Z0-9]+)\):[a-z]+$`)
+
+func newNotifyTemplateLog(l *datastore.EventLogEnt) *notifyTemplateLog {
+	r := &notifyTemplateLog{
+		Time:      time.Unix(0, l.Time).Format(time.RFC3339),
+		UnixTime:  l.Time,
+		Level:     l.Level,
+		LevelName: levelName(l.Level),
+		Type:      l.Type,
+		NodeID:    l.NodeID,
+		NodeName:  l.NodeName,
+		Event:     l.Event,
+	}
+	if n := datastore.GetNode(l.NodeID); n != nil {
+		r.Node = &notifyTemplateNode{
+			ID:    n.ID,
+			Name:  n.Name,
+			IP:    n.IP,
+			MAC:   n.MAC,
+			Icon:  n.Icon,
+			Descr: n.Descr,
+			State: n.State,
+			Tags:  n.Tags,
+			Group: n.Group,
+		}
+	}
+	if l.Type == "polling" {
+		if a := pollingEventPat.FindStringSubmatch(l.Event); len(a) == 3 {
+			datastore.ForEachPollings(func(p *datastore.PollingEnt) bool {
+				if p.NodeID == l.NodeID && p.Name == a[1] && p.Type == a[2] {
+					r.Polling = &notifyTemplatePolling{
+						ID:     p.ID,
+						Name:   p.Name,
+						Type:   p.Type,
+						Level:  p.Level,
+						State:  p.State,
+						Result: p.Result,
+					}
+					return false
+				}
+				return true
+			})
+		}
+	}
+	return r
+}
+
+func newNotifyTemplateData(title string, repair bool, list []*datastore.EventLogEnt) *notifyTemplateData {
+	d := &notifyTemplateData{
+		Title:  title,
+		URL:    datastore.NotifyConf.URL,
+		Repair: repair,
+		Count:  len(list),
+		Logs:   []*notifyTemplateLog{},
+	}
+	for _, l := range list {
+		d.Logs = append(d.Logs, newNotifyTemplateLog(l))
+	}
+	if len(d.Logs) > 0 {
+		d.Log = d.Logs[0]
+	}
+	return d
+}
+
+// execNotifyTemplate : テンプレートから通知メッセージを作成する
+func execNotifyTemplate(src string, html bool, d *notifyTemplateData) (string, error) {
+	if src == "" {
+		return "", nil
+	}
+	buf := new(bytes.Buffer)
+	if html {
+		t, err := htemplate.New("notify").Funcs(notifyTemplateFuncs).Parse(src)
+		if err != nil {
+			return "", err
+		}
+		if err := t.Execute(buf, d); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	t, err := ttemplate.New("notify").Funcs(notifyTemplateFuncs).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func isHTMLNotifyTemplate(t *datastore.NotifyTemplateEnt) bool {
+	return t.Dest == "mail" && datastore.NotifyConf.HTMLMail
+}
+
+// CheckNotifyTemplate : テンプレートの文法をチェックする
+func CheckNotifyTemplate(t *datastore.NotifyTemplateEnt) error {
+	for _, src := range []string{t.Subject, t.Body} {
+		if _, err := ttemplate.New("notify").Funcs(notifyTemplateFuncs).Parse(src); err != nil {
+			return err
+		}
+		if isHTMLNotifyTemplate(t) {
+			if _, err := htemplate.New("notify").Funcs(notifyTemplateFuncs).Parse(src); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PreviewNotifyTemplate : テンプレートの表示を確認する
+// ログを指定しない場合は最近のイベントログかサンプルを使う
+func PreviewNotifyTemplate(t *datastore.NotifyTemplateEnt, list []*datastore.EventLogEnt) (string, string, error) {
+	if len(list) < 1 {
+		list = getPreviewEventLogs(t)
+	}
+	repair := len(list) > 0 && list[0].Level == "repair"
+	title := datastore.NotifyConf.Subject + "(障害)"
+	if repair {
+		title = datastore.NotifyConf.Subject + "(復帰)"
+	}
+	if t.Dest == "chat" && len(list) > 1 {
+		list = list[:1]
+	}
+	d := newNotifyTemplateData(title, repair, list)
+	subject, err := execNotifyTemplate(t.Subject, false, d)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := execNotifyTemplate(t.Body, isHTMLNotifyTemplate(t), d)
+	if err != nil {
+		return subject, "", err
+	}
+	if t.Dest == "webhook" && !json.Valid([]byte(body)) {
+		return subject, body, fmt.Errorf("webhook body is not valid json")
+	}
+	return subject, body, nil
+}
+
+func getPreviewEventLogs(t *datastore.NotifyTemplateEnt) []*datastore.EventLogEnt {
+	list := []*datastore.EventLogEnt{}
+	st := time.Now().Add(-time.Hour * 24).UnixNano()
+	datastore.ForEachLastEventLog(st, func(l *datastore.EventLogEnt) bool {
+		if l.Level == "info" || l.Level == "normal" {
+			return true
+		}
+		if t.EventType != "" && !strings.Contains(","+t.EventType+",", ","+l.Type+",") {
+			return true
+		}
+		list = append(list, l)
+		return len(list) < 5
+	})
+	if len(list) > 0 {
+		return list
+	}
+	et := "polling"
+	if t.EventType != "" {
+		et = strings.TrimSpace(strings.Split(t.EventType, ",")[0])
+	}
+	return []*datastore.EventLogEnt{{
+		Time:     time.Now().UnixNano(),
+		Type:     et,
+		Level:    "high",
+		NodeID:   "sample",
+		NodeName: "sample node",
+		Event:    "ポーリング状態変化:PING監視(ping):normal",
+	}}
+}
+
+// applyNotifyTemplate : 通知先とイベントの種別に合うテンプレートがあればメッセージを作成する
+// 件名のテンプレートが空欄の場合は件名を空で返す
+func applyNotifyTemplate(dest, title string, repair bool, list []*datastore.EventLogEnt) (string, string, bool) {
+	t := datastore.FindNotifyTemplate(dest, datastore.GetCommonEventType(list))
+	if t == nil {
+		return "", "", false
+	}
+	d := newNotifyTemplateData(title, repair, list)
+	body, err := execNotifyTemplate(t.Body, isHTMLNotifyTemplate(t), d)
+	if err != nil {
+		log.Printf("notify template name=%s err=%v", t.Name, err)
+		return "", "", false
+	}
+	subject, err := execNotifyTemplate(t.Subject, false, d)
+	if err != nil {
+		log.Printf("notify template name=%s err=%v", t.Name, err)
+		return "", "", false
+	}
+	return strings.TrimSpace(subject), body, true
+}
@@ -0,0 +1,478 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	ttemplate "text/template"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// ticketTemplateData : チケット連携のテンプレートに渡すデータ
+type ticketTemplateData struct {
+	*notifyTemplateLog
+	TicketID string
+	Title    string
+	OldState string
+	Comment  string
+	URL      string
+}
+
+// ポーリング毎にチケットの操作を順番に実行するためのロック
+var ticketMu sync.Mutex
+var ticketPollingMu = make(map[string]*sync.Mutex)
+
+// ticketStateChange : 処理待ちのポーリングの状態変化
+type ticketStateChange struct {
+	conf     datastore.TicketConfEnt
+	pe       *datastore.PollingEnt
+	oldState string
+}
+
+// 処理待ちの最新の状態変化と最後に処理した状態
+var ticketPending = make(map[string]*ticketStateChange)
+var ticketLastState = make(map[string]string)
+
+// クローズに失敗した場合に再試行するまでの時間
+const ticketCloseRetry = time.Minute * 5
+
+// lockTicketPolling : ポーリングのチケットの操作を開始する
+// HTTPの送信中も他のポーリングのチケットは操作できる
+func lockTicketPolling(id string) func() {
+	for {
+		ticketMu.Lock()
+		m, ok := ticketPollingMu[id]
+		if !ok {
+			m = &sync.Mutex{}
+			ticketPollingMu[id] = m
+		}
+		ticketMu.Unlock()
+		m.Lock()
+		ticketMu.Lock()
+		cur := ticketPollingMu[id]
+		ticketMu.Unlock()
+		if cur == m {
+			return m.Unlock
+		}
+		// 待つ間に削除された
+		m.Unlock()
+	}
+}
+
+// getTicketCopy : 保存してあるチケットを変更しないようにコピーを返す
+func getTicketCopy(pollingID string) *datastore.TicketEnt {
+	if t := datastore.GetTicket(pollingID); t != nil {
+		c := *t
+		return &c
+	}
+	return nil
+}
+
+// TicketPollingStateChanged : ポーリングの状態変化に合わせてチケットを作成、更新、クローズする
+func TicketPollingStateChanged(pe *datastore.PollingEnt, oldState string) {
+	if !datastore.TicketConf.Enable || datastore.TicketConf.CreateURL == "" {
+		return
+	}
+	p := *pe
+	p.Result = make(map[string]any)
+	for k, v := range pe.Result {
+		p.Result[k] = v
+	}
+	queueTicketStateChange(&ticketStateChange{conf: datastore.TicketConf, pe: &p, oldState: oldState})
+	go func() {
+		unlock := lockTicketPolling(p.ID)
+		defer unlock()
+		// 起動した順番に実行されるとは限らないので、最新の状態と最後に処理した状態を比較する
+		c, old := takeTicketStateChange(p.ID)
+		if c == nil || c.pe.State == old {
+			return
+		}
+		updateTicketByState(&c.conf, c.pe, old)
+		setTicketLastState(p.ID, c.pe.State)
+	}()
+}
+
+// queueTicketStateChange : 処理していない状態変化は最新の状態にまとめる
+func queueTicketStateChange(c *ticketStateChange) {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	if q, ok := ticketPending[c.pe.ID]; ok {
+		c.oldState = q.oldState
+	}
+	ticketPending[c.pe.ID] = c
+}
+
+// takeTicketStateChange : 処理待ちの状態変化と変化前の状態を取り出す
+func takeTicketStateChange(id string) (*ticketStateChange, string) {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	c, ok := ticketPending[id]
+	if !ok {
+		return nil, ""
+	}
+	delete(ticketPending, id)
+	if last, ok := ticketLastState[id]; ok {
+		return c, last
+	}
+	return c, c.oldState
+}
+
+func setTicketLastState(id, state string) {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	ticketLastState[id] = state
+}
+
+func updateTicketByState(conf *datastore.TicketConfEnt, pe *datastore.PollingEnt, oldState string) {
+	t := getTicketCopy(pe.ID)
+	d := newTicketTemplateData(pe, oldState)
+	now := time.Now().UnixNano()
+	nl := getLevelNum(conf.Level)
+	if nl > 2 {
+		nl = 0
+	}
+	switch {
+	case getLevelNum(pe.State) <= nl:
+		if t == nil {
+			id, err := createTicket(conf, d)
+			if err != nil {
+				ticketErrorLog(pe, "作成", err)
+				return
+			}
+			t = &datastore.TicketEnt{
+				PollingID: pe.ID,
+				NodeID:    pe.NodeID,
+				TicketID:  id,
+				State:     "open",
+				Level:     pe.State,
+				OpenTime:  now,
+			}
+			datastore.AddEventLog(&datastore.EventLogEnt{
+				Type:     "system",
+				Level:    "info",
+				NodeID:   pe.NodeID,
+				NodeName: d.NodeName,
+				Event:    fmt.Sprintf("チケットを作成しました ID=%s ポーリング=%s", id, pe.Name),
+			})
+		} else {
+			if t.State == "closing" {
+				// 復帰後すぐに再発生した(フラッピング)
+				d.Comment = fmt.Sprintf("再発生 %s→%s", oldState, pe.State)
+				t.State = "open"
+				t.CloseAt = 0
+			} else {
+				d.Comment = fmt.Sprintf("状態変化 %s→%s", oldState, pe.State)
+			}
+			t.Level = pe.State
+			commentTicket(conf, t, d)
+		}
+	case pe.State == "repair" || pe.State == "normal":
+		if t == nil || t.State != "open" {
+			return
+		}
+		if conf.CloseDelay > 0 {
+			d.Comment = fmt.Sprintf("復帰 %s→%s %d分後にクローズします", oldState, pe.State, conf.CloseDelay)
+			commentTicket(conf, t, d)
+			t.State = "closing"
+			t.CloseAt = now + int64(time.Duration(conf.CloseDelay)*time.Minute)
+		} else {
+			closeTicket(conf, t, pe)
+			return
+		}
+	default:
+		if t == nil {
+			return
+		}
+		d.Comment = fmt.Sprintf("状態変化 %s→%s", oldState, pe.State)
+		commentTicket(conf, t, d)
+	}
+	if err := datastore.SaveTicket(t); err != nil {
+		log.Printf("save ticket err=%v", err)
+	}
+}
+
+// checkTickets : 復帰後の待ち時間が過ぎたチケットと削除したポーリングのチケットをクローズする
+func checkTickets() {
+	if !datastore.TicketConf.Enable {
+		return
+	}
+	conf := datastore.TicketConf
+	now := time.Now().UnixNano()
+	ids := []string{}
+	datastore.ForEachTickets(func(t *datastore.TicketEnt) bool {
+		if (t.State == "closing" && t.CloseAt <= now) || datastore.GetPolling(t.PollingID) == nil {
+			ids = append(ids, t.PollingID)
+		}
+		return true
+	})
+	for _, id := range ids {
+		unlock := lockTicketPolling(id)
+		// ロックを待つ間に状態が変わっている場合がある
+		if t := getTicketCopy(id); t != nil {
+			if pe := datastore.GetPolling(id); pe == nil {
+				closeDeletedPollingTicket(&conf, t)
+			} else if t.State == "closing" && t.CloseAt <= now {
+				closeTicket(&conf, t, pe)
+			}
+		}
+		unlock()
+	}
+	cleanupTicketPollingMu()
+}
+
+// closeDeletedPollingTicket : 削除したポーリングのチケットはクローズできなくても削除する
+func closeDeletedPollingTicket(conf *datastore.TicketConfEnt, t *datastore.TicketEnt) {
+	pe := &datastore.PollingEnt{ID: t.PollingID, NodeID: t.NodeID, State: "unknown"}
+	if closeTicket(conf, t, pe) {
+		return
+	}
+	if err := datastore.DeleteTicket(t.PollingID); err != nil {
+		log.Printf("delete ticket err=%v", err)
+	}
+}
+
+// cleanupTicketPollingMu : チケットがないポーリングのロックを削除する
+func cleanupTicketPollingMu() {
+	ticketMu.Lock()
+	defer ticketMu.Unlock()
+	for id, m := range ticketPollingMu {
+		if _, ok := ticketPending[id]; ok || datastore.GetTicket(id) != nil || !m.TryLock() {
+			continue
+		}
+		delete(ticketPollingMu, id)
+		delete(ticketLastState, id)
+		m.Unlock()
+	}
+}
+
+// closeTicket : チケットをクローズして削除する
+// 失敗した場合は時間をおいて再試行する
+func closeTicket(conf *datastore.TicketConfEnt, t *datastore.TicketEnt, pe *datastore.PollingEnt) bool {
+	d := newTicketTemplateData(pe, t.Level)
+	d.TicketID = t.TicketID
+	d.Comment = "復帰したためクローズします"
+	if conf.CloseURL != "" {
+		if _, err := doTicketRequest(conf, conf.CloseMethod, conf.CloseURL, conf.CloseBody, d); err != nil {
+			ticketErrorLog(pe, "クローズ", err)
+			t.Error = err.Error()
+			t.State = "closing"
+			t.CloseAt = time.Now().Add(ticketCloseRetry).UnixNano()
+			if err := datastore.SaveTicket(t); err != nil {
+				log.Printf("save ticket err=%v", err)
+			}
+			return false
+		}
+	}
+	if err := datastore.DeleteTicket(t.PollingID); err != nil {
+		log.Printf("delete ticket err=%v", err)
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:     "system",
+		Level:    "info",
+		NodeID:   pe.NodeID,
+		NodeName: d.NodeName,
+		Event:    fmt.Sprintf("チケットをクローズしました ID=%s ポーリング=%s", t.TicketID, pe.Name),
+	})
+	return true
+}
+
+func commentTicket(conf *datastore.TicketConfEnt, t *datastore.TicketEnt, d *ticketTemplateData) {
+	if conf.CommentURL == "" {
+		return
+	}
+	d.TicketID = t.TicketID
+	if _, err := doTicketRequest(conf, conf.CommentMethod, conf.CommentURL, conf.CommentBody, d); err != nil {
+		t.Error = err.Error()
+		log.Printf("comment ticket id=%s err=%v", t.TicketID, err)
+		return
+	}
+	t.Error = ""
+	t.Comments++
+}
+
+// createTicket : チケットを作成してIDを返す
+func createTicket(conf *datastore.TicketConfEnt, d *ticketTemplateData) (string, error) {
+	body, err := doTicketRequest(conf, conf.CreateMethod, conf.CreateURL, conf.CreateBody, d)
+	if err != nil {
+		return "", err
+	}
+	id := getJSONPathValue(body, conf.IDPath)
+	if id == "" {
+		return "", fmt.Errorf("ticket id not found in response")
+	}
+	return id, nil
+}
+
+// チケット連携で使うHTTPクライアント(接続を再利用する)
+var ticketHTTPClient = newTicketHTTPClient(false)
+var ticketInsecureHTTPClient = newTicketHTTPClient(true)
+
+func newTicketHTTPClient(insecure bool) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	return &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: tr,
+	}
+}
+
+func doTicketRequest(conf *datastore.TicketConfEnt, method, urlTmpl, bodyTmpl string, d *ticketTemplateData) ([]byte, error) {
+	url, err := execTicketTemplate(urlTmpl, d)
+	if err != nil {
+		return nil, err
+	}
+	if url, err = ValidateURL(strings.TrimSpace(url)); err != nil {
+		return nil, err
+	}
+	body, err := execTicketTemplate(bodyTmpl, d)
+	if err != nil {
+		return nil, err
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), url, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for _, h := range strings.Split(conf.Headers, "\n") {
+		if k, v, ok := strings.Cut(h, ":"); ok && strings.TrimSpace(k) != "" {
+			req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	if conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	} else if conf.User != "" {
+		req.SetBasicAuth(conf.User, conf.Password)
+	}
+	client := ticketHTTPClient
+	if conf.InsecureSkipVerify {
+		client = ticketInsecureHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status=%s", resp.Status)
+	}
+	return b, nil
+}
+
+func execTicketTemplate(src string, d *ticketTemplateData) (string, error) {
+	t, err := ttemplate.New("ticket").Funcs(notifyTemplateFuncs).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// getJSONPathValue : JSONのドット区切りのパスの値を文字列で返す
+func getJSONPathValue(j []byte, path string) string {
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return ""
+	}
+	for _, k := range strings.Split(path, ".") {
+		if k == "" {
+			continue
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	switch r := v.(type) {
+	case string:
+		return r
+	case json.Number:
+		return r.String()
+	}
+	return ""
+}
+
+func newTicketTemplateData(pe *datastore.PollingEnt, oldState string) *ticketTemplateData {
+	nodeName := ""
+	if n := datastore.GetNode(pe.NodeID); n != nil {
+		nodeName = n.Name
+	}
+	l := newNotifyTemplateLog(&datastore.EventLogEnt{
+		Time:     time.Now().UnixNano(),
+		Type:     "polling",
+		Level:    pe.State,
+		NodeID:   pe.NodeID,
+		NodeName: nodeName,
+		Event:    fmt.Sprintf("ポーリング状態変化:%s(%s):%s", pe.Name, pe.Type, oldState),
+	})
+	if l.Polling == nil {
+		l.Polling = &notifyTemplatePolling{
+			ID:     pe.ID,
+			Name:   pe.Name,
+			Type:   pe.Type,
+			Level:  pe.Level,
+			State:  pe.State,
+			Result: pe.Result,
+		}
+	}
+	return &ticketTemplateData{
+		notifyTemplateLog: l,
+		Title:             fmt.Sprintf("%s %s %s", datastore.NotifyConf.Subject, nodeName, pe.Name),
+		OldState:          oldState,
+		URL:               datastore.NotifyConf.URL,
+	}
+}
+
+func ticketErrorLog(pe *datastore.PollingEnt, op string, err error) {
+	log.Printf("ticket %s err=%v", op, err)
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:   "system",
+		Level:  "warn",
+		NodeID: pe.NodeID,
+		Event:  fmt.Sprintf("チケットの%sに失敗しました ポーリング=%s err=%v", op, pe.Name, err),
+	})
+}
+
+// TicketTest : 試験用のチケットを作成してクローズする
+func TicketTest(conf *datastore.TicketConfEnt) (string, error) {
+	pe := &datastore.PollingEnt{ID: "test", Name: "test polling", Type: "ping", Level: "high", State: "high"}
+	d := newTicketTemplateData(pe, "normal")
+	id, err := createTicket(conf, d)
+	if err != nil {
+		return "", err
+	}
+	d.TicketID = id
+	d.Comment = "test"
+	if conf.CommentURL != "" {
+		if _, err := doTicketRequest(conf, conf.CommentMethod, conf.CommentURL, conf.CommentBody, d); err != nil {
+			return id, err
+		}
+	}
+	if conf.CloseURL != "" {
+		if _, err := doTicketRequest(conf, conf.CloseMethod, conf.CloseURL, conf.CloseBody, d); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
@@ -81,24 +81,63 @@ type webhookNotifyLog struct {
 	Event    string `json:"Event"`
 }
 
-func webhookNotify(list []*datastore.EventLogEnt) {
-	if datastore.NotifyConf.WebHookNotify == "" {
+func webhookNotify(list []*datastore.EventLogEnt, level, url string) {
+	if url == "" {
 		return
 	}
-	nl := getLevelNum(datastore.NotifyConf.Level)
-	if nl == 3 {
+	logs := filterNotifyLogs(list, level)
+	if len(logs) < 1 {
 		return
 	}
-	payload := webhookNotifyPayload{}
+	j, err := getWebhookNotifyBody(logs, level)
+	if err != nil {
+		log.Printf("webhookNotify err=%v", err)
+		return
+	}
+	if err := PostWebhook(url, j); err != nil {
+		log.Printf("webhookNotify err=%v", err)
+	}
+}
+
+// getWebhookNotifyBody : テンプレートがあれば使い、JSONにならない場合は既定の形式で送信する
+func getWebhookNotifyBody(logs []*datastore.EventLogEnt, level string) ([]byte, error) {
+	repair := true
+	for _, l := range logs {
+		if l.Level != "repair" {
+			repair = false
+			break
+		}
+	}
+	if _, tb, ok := applyNotifyTemplate("webhook", datastore.NotifyConf.Subject, repair, logs); ok {
+		if json.Valid([]byte(tb)) {
+			return []byte(tb), nil
+		}
+		log.Printf("webhook notify template is not valid json")
+	}
+	return json.Marshal(getWebhookNotifyPayload(logs, level))
+}
+
+// filterNotifyLogs : 通知間隔内で通知するレベルのイベントログ
+func filterNotifyLogs(list []*datastore.EventLogEnt, level string) []*datastore.EventLogEnt {
+	ret := []*datastore.EventLogEnt{}
+	nl := getLevelNum(level)
+	if nl == 3 {
+		return ret
+	}
 	ti := time.Now().Add(time.Duration(-datastore.NotifyConf.Interval) * time.Minute).UnixNano()
 	for _, l := range list {
-		if ti > l.Time {
-			continue
-		}
-		np := getLevelNum(l.Level)
-		if np > nl {
+		if ti > l.Time || getLevelNum(l.Level) > nl {
 			continue
 		}
+		ret = append(ret, l)
+	}
+	return ret
+}
+
+// getWebhookNotifyPayload : 通知するレベルのイベントログからWebhookの送信データを作成する
+func getWebhookNotifyPayload(list []*datastore.EventLogEnt, level string) webhookNotifyPayload {
+	payload := webhookNotifyPayload{}
+	for _, l := range filterNotifyLogs(list, level) {
 		payload.Log = append(payload.Log, webhookNotifyLog{
 			Time:     time.Unix(0, l.Time).Format(time.RFC3339),
 			Type:     l.Type,
@@ -109,18 +148,7 @@ func webhookNotify(list []*datastore.EventLogEnt) {
 		})
 	}
 	payload.Count = len(payload.Log)
-	if payload.Count < 1 {
-		return
-	}
-	j, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("webhookNotify err=%v", err)
-		return
-	}
-	err = PostWebhook(datastore.NotifyConf.WebHookNotify, j)
-	if err != nil {
-		log.Printf("webhookNotify err=%v", err)
-	}
+	return payload
 }
 
 type webhookReportPayload struct {
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 )
@@ -58,7 +57,7 @@ func doPollingArpLogCount(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("interval", pe.PollInt)
@@ -67,7 +66,7 @@ func doPollingArpLogCount(pe *datastore.PollingEnt) {
 		setPollingError("arplog", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -113,7 +112,7 @@ func doPollingArpLogCheck(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	var lastError error
 	failed := false
@@ -133,7 +132,7 @@ func doPollingArpLogCheck(pe *datastore.PollingEnt) {
 		if script != "" {
 			value, err := vm.Run(script)
 			if err == nil {
-				if ok, _ := value.ToBoolean(); !ok {
+				if !value.ToBoolean() {
 					failed = true
 					return false
 				}
@@ -195,7 +194,7 @@ func doPollingArpLogStats(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -206,7 +205,7 @@ func doPollingArpLogStats(pe *datastore.PollingEnt) {
 		setPollingError("arplog", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
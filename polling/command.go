@@ -13,7 +13,7 @@ import (
 
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/Songmu/timeout"
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 )
@@ -22,7 +22,7 @@ func doPollingCmd(pe *datastore.PollingEnt) {
 	cmd := getReplacedCmd(pe)
 	extractor := pe.Extractor
 	script := pe.Script
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = make(map[string]interface{})
 	cl := strings.Split(cmd, " ")
@@ -65,11 +65,8 @@ func doPollingCmd(pe *datastore.PollingEnt) {
 		setPollingError("cmd", pe, fmt.Errorf("goquery not supported"))
 		return
 	} else if extractor == "getBody" {
-		vm.Set("getBody", func(call otto.FunctionCall) otto.Value {
-			if r, err := otto.ToValue(stdout); err == nil {
-				return r
-			}
-			return otto.UndefinedValue()
+		vm.Set("getBody", func() string {
+			return stdout
 		})
 	} else if extractor == "jsonpath" {
 		var res map[string]interface{}
@@ -77,16 +74,14 @@ func doPollingCmd(pe *datastore.PollingEnt) {
 			setPollingError("cmd", pe, err)
 			return
 		}
-		vm.Set("jsonpath", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("jsonpath", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
 				if v, err := jsonpath.Get(sel, res); err == nil {
-					if ov, err := otto.ToValue(v); err == nil {
-						return ov
-					}
+					return vm.rt.ToValue(v)
 				}
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 	} else if extractor != "" {
 		grokEnt := datastore.GetGrokEnt(extractor)
@@ -120,7 +115,7 @@ func doPollingCmd(pe *datastore.PollingEnt) {
 		setPollingError("cmd", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 		return
 	}
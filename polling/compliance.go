@@ -0,0 +1,127 @@
+package polling
+
+// 保存した機器の設定をコンプライアンスルールでチェックする。
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// CheckComplianceAll : 設定を保存した全てのノードをチェックする
+func CheckComplianceAll() {
+	st := time.Now()
+	ids := []string{}
+	datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
+		ids = append(ids, n.ID)
+		return true
+	})
+	for _, id := range ids {
+		CheckCompliance(id)
+	}
+	log.Printf("CheckComplianceAll nodes=%d dur=%v", len(ids), time.Since(st))
+}
+
+// CheckCompliance : ノードの最新の設定をコンプライアンスルールでチェックする
+// 準拠から違反になった時にイベントログを記録する
+func CheckCompliance(nodeID string) {
+	n := datastore.GetNode(nodeID)
+	if n == nil {
+		return
+	}
+	c := datastore.GetLastConfigArchive(nodeID)
+	if c == nil {
+		return
+	}
+	prevCompliant := true
+	checked := false
+	violation := []string{}
+	level := ""
+	for _, r := range datastore.GetComplianceRules() {
+		if !datastore.IsComplianceRuleTarget(r, n) {
+			continue
+		}
+		if prev := datastore.GetComplianceResult(n.ID, r.ID); prev != nil && !prev.Compliant {
+			prevCompliant = false
+		}
+		ok, err := checkComplianceRule(r, n, c.Config)
+		res := &datastore.ComplianceResultEnt{
+			NodeID:     n.ID,
+			RuleID:     r.ID,
+			Compliant:  ok,
+			ConfigTime: c.Time,
+			CheckTime:  time.Now().UnixNano(),
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		datastore.SetComplianceResult(res)
+		checked = true
+		if !ok {
+			violation = append(violation, r.Name)
+			level = getComplianceLevel(level, r.Level)
+		}
+	}
+	if !checked {
+		return
+	}
+	if prevCompliant && len(violation) > 0 {
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:     "compliance",
+			Level:    level,
+			NodeID:   n.ID,
+			NodeName: n.Name,
+			Event:    fmt.Sprintf("設定がコンプライアンスルールに違反しました(%s)", strings.Join(violation, ",")),
+		})
+	} else if !prevCompliant && len(violation) == 0 {
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:     "compliance",
+			Level:    "repair",
+			NodeID:   n.ID,
+			NodeName: n.Name,
+			Event:    "設定がコンプライアンスルールに準拠しました",
+		})
+	}
+}
+
+// checkComplianceRule : 設定がルールに準拠しているか判断する
+func checkComplianceRule(r *datastore.ComplianceRuleEnt, n *datastore.NodeEnt, config string) (bool, error) {
+	switch r.Mode {
+	case "match", "notmatch":
+		re, err := regexp.Compile("(?m)" + r.Pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(config) == (r.Mode == "match"), nil
+	case "script":
+		vm := newScriptVM("compliance:" + r.ID)
+		vm.Set("config", config)
+		vm.Set("lines", strings.Split(config, "\n"))
+		vm.Set("nodeName", n.Name)
+		vm.Set("ip", n.IP)
+		vm.Set("sysObjectID", n.SysObjectID)
+		value, err := vm.Run(r.Script)
+		if err != nil {
+			return false, err
+		}
+		ok := value.ToBoolean()
+		return ok, nil
+	}
+	return false, fmt.Errorf("invalid mode=%s", r.Mode)
+}
+
+// getComplianceLevel : 重い方のレベルを返す
+func getComplianceLevel(cur, l string) string {
+	order := map[string]int{"high": 3, "low": 2, "warn": 1}
+	if order[l] > order[cur] {
+		return l
+	}
+	if cur == "" {
+		return "warn"
+	}
+	return cur
+}
@@ -0,0 +1,33 @@
+package polling
+
+import (
+	"testing"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func TestCheckComplianceRule(t *testing.T) {
+	n := &datastore.NodeEnt{Name: "router1", IP: "192.168.1.1"}
+	conf := "hostname router1\nservice password-encryption\nip http server\n"
+	tests := []struct {
+		rule *datastore.ComplianceRuleEnt
+		ok   bool
+	}{
+		{&datastore.ComplianceRuleEnt{Mode: "match", Pattern: `^service password-encryption$`}, true},
+		{&datastore.ComplianceRuleEnt{Mode: "notmatch", Pattern: `^ip http server$`}, false},
+		{&datastore.ComplianceRuleEnt{Mode: "match", Pattern: `^ntp server`}, false},
+		{&datastore.ComplianceRuleEnt{Mode: "script", Script: `lines.length > 2 && config.indexOf(nodeName) >= 0`}, true},
+	}
+	for i, tc := range tests {
+		ok, err := checkComplianceRule(tc.rule, n, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tc.ok {
+			t.Errorf("rule %d compliant=%v", i, ok)
+		}
+	}
+	if _, err := checkComplianceRule(&datastore.ComplianceRuleEnt{Mode: "match", Pattern: `(`}, n, conf); err == nil {
+		t.Error("invalid pattern no error")
+	}
+}
@@ -0,0 +1,140 @@
+package polling
+
+// SSHで機器の設定を取得してバックアップする。
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"golang.org/x/crypto/ssh"
+)
+
+type configVendorEnt struct {
+	Cmd    string
+	Ignore *regexp.Regexp // 変更の検知から除外する行(時刻など)
+}
+
+// configVendorMap : 機種毎の設定取得コマンド
+var configVendorMap = map[string]configVendorEnt{
+	"ios": {
+		Cmd:    "show running-config",
+		Ignore: regexp.MustCompile(`^(Building configuration|Current configuration :|! Last configuration change|! NVRAM config last updated|ntp clock-period)`),
+	},
+	"nxos": {
+		Cmd:    "show running-config",
+		Ignore: regexp.MustCompile(`^(!Command: show running-config|!Running configuration last done at|!Time:)`),
+	},
+	"eos": {
+		Cmd:    "show running-config",
+		Ignore: regexp.MustCompile(`^! (Command:|device:|boot system)`),
+	},
+	"junos": {
+		Cmd:    "show configuration | display set",
+		Ignore: regexp.MustCompile(`^## Last (commit|changed)`),
+	},
+	"routeros": {
+		Cmd:    "/export",
+		Ignore: regexp.MustCompile(`^# .* by RouterOS`),
+	},
+	"fortios": {
+		Cmd:    "show full-configuration",
+		Ignore: regexp.MustCompile(`^#conf_file_ver=`),
+	},
+	"vyos": {
+		Cmd: "show configuration commands",
+	},
+}
+
+func doPollingConfig(pe *datastore.PollingEnt) {
+	port := "22"
+	if pe.Filter != "" {
+		port = pe.Filter
+	}
+	cmd := pe.Params
+	v, ok := configVendorMap[pe.Mode]
+	if cmd == "" {
+		if !ok {
+			setPollingError("config", pe, fmt.Errorf("no command for mode=%s", pe.Mode))
+			return
+		}
+		cmd = v.Cmd
+	}
+	client, session, err := sshConnectToHost(pe, port)
+	if err != nil {
+		setPollingError("config", pe, err)
+		return
+	}
+	defer func() {
+		session.Close()
+		client.Close()
+	}()
+	conf, err := fetchConfig(session, cmd, v.Ignore)
+	if err != nil {
+		setPollingError("config", pe, err)
+		return
+	}
+	c := &datastore.ConfigArchiveEnt{
+		NodeID:    pe.NodeID,
+		PollingID: pe.ID,
+		Config:    conf,
+	}
+	changed, last, err := datastore.AddConfigArchive(c)
+	if err != nil {
+		setPollingError("config", pe, err)
+		return
+	}
+	delete(pe.Result, "error")
+	pe.Result["lastTime"] = time.Now().Format("2006-01-02T15:04")
+	pe.Result["size"] = float64(c.Size)
+	pe.Result["hash"] = c.Hash
+	if changed && last != nil {
+		pe.Result["lastChange"] = time.Unix(0, c.Time).Format("2006-01-02T15:04")
+		diff, _ := datastore.MakeConfigDiff(last, c)
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:   "config",
+			Level:  "warn",
+			NodeID: pe.NodeID,
+			Event:  fmt.Sprintf("機器の設定の変更を検知しました(%s) 変更行数=%d", pe.Name, countConfigDiffLines(diff)),
+		})
+	}
+	if changed {
+		CheckCompliance(pe.NodeID)
+	}
+	setPollingState(pe, "normal")
+}
+
+// fetchConfig : SSHのセッションでコマンドを実行して設定を取得する
+func fetchConfig(session *ssh.Session, cmd string, ignore *regexp.Regexp) (string, error) {
+	out, err := session.Output(cmd)
+	if err != nil {
+		return "", err
+	}
+	if len(out) < 1 {
+		return "", fmt.Errorf("empty config")
+	}
+	conf := datastore.NormalizeConfig(string(out))
+	if ignore == nil {
+		return conf, nil
+	}
+	lines := []string{}
+	for _, l := range strings.Split(conf, "\n") {
+		if !ignore.MatchString(l) {
+			lines = append(lines, l)
+		}
+	}
+	return datastore.NormalizeConfig(strings.Join(lines, "\n")), nil
+}
+
+func countConfigDiffLines(diff string) int {
+	n := 0
+	for _, l := range strings.Split(diff, "\n") {
+		if (strings.HasPrefix(l, "+") && !strings.HasPrefix(l, "+++")) ||
+			(strings.HasPrefix(l, "-") && !strings.HasPrefix(l, "---")) {
+			n++
+		}
+	}
+	return n
+}
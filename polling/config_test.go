@@ -0,0 +1,68 @@
+package polling
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gssh "github.com/gliderlabs/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHの代替サーバーで設定の取得を試験する
+func TestFetchConfig(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &gssh.Server{
+		Handler: func(s gssh.Session) {
+			if s.RawCommand() != configVendorMap["ios"].Cmd {
+				io.WriteString(s.Stderr(), "invalid command\n")
+				s.Exit(1)
+				return
+			}
+			io.WriteString(s, "Building configuration...\r\n\r\nCurrent configuration : 100 bytes\r\n! Last configuration change at 10:00:00 JST\r\nhostname router1  \r\ninterface Gi0/1\r\n ip address 192.168.1.1 255.255.255.0\r\n")
+		},
+		PasswordHandler: func(ctx gssh.Context, password string) bool {
+			return ctx.User() == "admin" && password == "secret"
+		},
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	v := configVendorMap["ios"]
+	conf, err := fetchConfig(session, v.Cmd, v.Ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf != "hostname router1\ninterface Gi0/1\n ip address 192.168.1.1 255.255.255.0\n" {
+		t.Errorf("fetchConfig=%q", conf)
+	}
+	if strings.Contains(conf, "Last configuration change") {
+		t.Error("ignore line not removed")
+	}
+}
+
+func TestCountConfigDiffLines(t *testing.T) {
+	diff := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n hostname r1\n-ip 1\n+ip 2\n"
+	if n := countConfigDiffLines(diff); n != 2 {
+		t.Errorf("countConfigDiffLines=%d", n)
+	}
+}
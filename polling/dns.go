@@ -7,7 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
@@ -45,7 +44,7 @@ func doPollingDNS(pe *datastore.PollingEnt) {
 		setPollingState(pe, pe.Level)
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	_ = vm.Set("rtt", rTime)
 	_ = vm.Set("count", len(out))
@@ -90,7 +89,7 @@ func doPollingDNS(pe *datastore.PollingEnt) {
 		setPollingError("dns", pe, fmt.Errorf("%v", err))
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 		return
 	}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 
 	"github.com/emersion/go-imap/v2"
@@ -68,14 +67,14 @@ func doPollingEMail(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
 	}
 	value, err := vm.Run(pe.Script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
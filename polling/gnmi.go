@@ -10,7 +10,6 @@ import (
 
 	"github.com/openconfig/gnmic/pkg/api"
 	"github.com/openconfig/gnmic/pkg/api/target"
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
@@ -44,11 +43,12 @@ func doPollingGNMI(pe *datastore.PollingEnt) bool {
 }
 
 func doPollingGNMIGet(pe *datastore.PollingEnt, n *datastore.NodeEnt, target string) bool {
+	cred := datastore.GetNodeCredential(n, "gnmi")
 	tg, err := api.NewTarget(
 		api.Name(n.Name),
 		api.Address(target),
-		api.Username(n.GNMIUser),
-		api.Password(n.GNMIPassword),
+		api.Username(cred.User),
+		api.Password(cred.Password),
 		api.SkipVerify(true),
 	)
 	if err != nil {
@@ -63,7 +63,7 @@ func doPollingGNMIGet(pe *datastore.PollingEnt, n *datastore.NodeEnt, target str
 		return false
 	}
 	defer tg.Close()
-	enc := n.GNMIEncoding
+	enc := cred.Encoding
 	if enc == "" {
 		enc = "json_ietf"
 	}
@@ -99,7 +99,7 @@ func doPollingGNMIGet(pe *datastore.PollingEnt, n *datastore.NodeEnt, target str
 		setPollingError("gnmi", pe, fmt.Errorf("json data not found"))
 		return false
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("data", string(data))
 	vm.Set("now", time.Now().UnixMilli())
@@ -121,7 +121,7 @@ func doPollingGNMIGet(pe *datastore.PollingEnt, n *datastore.NodeEnt, target str
 		setPollingError("gnmi", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); !ok {
+	if !value.ToBoolean() {
 		setPollingState(pe, pe.Level)
 		return true
 	}
@@ -135,11 +135,12 @@ func doPollingGNMISubscribe(pe *datastore.PollingEnt, n *datastore.NodeEnt, targ
 	if _, ok := gNMISubscribeMap.Load(pe.ID); ok {
 		return
 	}
+	cred := datastore.GetNodeCredential(n, "gnmi")
 	tg, err := api.NewTarget(
 		api.Name(n.Name),
 		api.Address(target),
-		api.Username(n.GNMIUser),
-		api.Password(n.GNMIPassword),
+		api.Username(cred.User),
+		api.Password(cred.Password),
 		api.SkipVerify(true),
 	)
 	if err != nil {
@@ -154,7 +155,7 @@ func doPollingGNMISubscribe(pe *datastore.PollingEnt, n *datastore.NodeEnt, targ
 		return
 	}
 	defer tg.Close()
-	enc := n.GNMIEncoding
+	enc := cred.Encoding
 	if enc == "" {
 		enc = "json_ietf"
 	}
@@ -215,7 +216,7 @@ func gNMISetSubscribeResp(pe *datastore.PollingEnt, rsp *target.SubscribeRespons
 		setPollingError("gnmi", pe, fmt.Errorf("json data not found"))
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("data", string(data))
 	vm.Set("now", time.Now().UnixMilli())
@@ -238,7 +239,7 @@ func gNMISetSubscribeResp(pe *datastore.PollingEnt, rsp *target.SubscribeRespons
 		setPollingError("gnmi", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); !ok {
+	if !value.ToBoolean() {
 		setPollingState(pe, pe.Level)
 		return
 	}
@@ -18,7 +18,7 @@ import (
 
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/PuerkitoBio/goquery"
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/twsnmp/twsnmpfc/notify"
 	"github.com/vjeantet/grok"
@@ -69,7 +69,7 @@ func doPollingHTTP(pe *datastore.PollingEnt) {
 }
 
 func checkHTTPResp(pe *datastore.PollingEnt, status, body string, code int, rTime int64) (bool, error) {
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("status", status)
 	vm.Set("code", code)
@@ -123,37 +123,30 @@ func checkHTTPResp(pe *datastore.PollingEnt, status, body string, code int, rTim
 		if err != nil {
 			return false, err
 		}
-		vm.Set("goquery", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("goquery", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
-				if ov, err := otto.ToValue(doc.Find(sel).Text()); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(doc.Find(sel).Text())
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 	} else if extractor == "getBody" {
-		vm.Set("getBody", func(call otto.FunctionCall) otto.Value {
-			if r, err := otto.ToValue(body); err == nil {
-				return r
-			}
-			return otto.UndefinedValue()
+		vm.Set("getBody", func() string {
+			return body
 		})
 	} else if extractor == "jsonpath" {
 		var res map[string]interface{}
 		if err := json.Unmarshal([]byte(body), &res); err != nil {
 			return false, err
 		}
-		vm.Set("jsonpath", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("jsonpath", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
 				if v, err := jsonpath.Get(sel, res); err == nil {
-					if ov, err := otto.ToValue(v); err == nil {
-						return ov
-					}
+					return vm.rt.ToValue(v)
 				}
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 	} else if extractor != "" {
 		grokEnt := datastore.GetGrokEnt(extractor)
@@ -178,7 +171,7 @@ func checkHTTPResp(pe *datastore.PollingEnt, status, body string, code int, rTim
 	if err != nil {
 		return false, err
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		return true, nil
 	}
 	return false, nil
@@ -286,6 +279,15 @@ var insecureTransport = &http.Transport{
 
 var insecureClient = &http.Client{Transport: insecureTransport}
 
+// setHTTPCredential : 認証情報プロファイルのBearerトークンまたはBasic認証を設定する
+func setHTTPCredential(req *http.Request, c *datastore.CredentialEnt) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
 func doHTTPGet(pe *datastore.PollingEnt, url string) (string, string, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(pe.Timeout)*time.Second)
 	defer cancel()
@@ -296,6 +298,11 @@ func doHTTPGet(pe *datastore.PollingEnt, url string) (string, string, int, error
 	if pe.Mode == "metrics/json" {
 		req.Header.Set("Accept", "application/json")
 	}
+	if n := datastore.GetNode(pe.NodeID); n != nil {
+		if c := datastore.GetCredential(n.Credentials["http"]); c != nil {
+			setHTTPCredential(req, c)
+		}
+	}
 	if pe.Mode == "https" {
 		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 		if err != nil {
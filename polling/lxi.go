@@ -5,7 +5,7 @@ import (
 	"log"
 	"strconv"
 
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 	"github.com/twsnmp/lxi"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
@@ -31,58 +31,50 @@ func doPollingLxi(pe *datastore.PollingEnt) {
 		return
 	}
 	defer d.Close()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = make(map[string]interface{})
-	vm.Set("lxiCommand", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
+	vm.Set("lxiCommand", func(call goja.FunctionCall) goja.Value {
+		if isScriptString(call.Argument(0)) {
 			f := call.Argument(0).String()
 			args := []interface{}{}
-			for i := 1; i < len(call.ArgumentList); i++ {
-				if call.Argument(i).IsNumber() {
-					if v, err := call.Argument(1).ToFloat(); err == nil {
-						args = append(args, v)
-					}
-				} else if call.Argument(i).IsString() {
-					args = append(args, call.Argument(i).String())
+			for i := 1; i < len(call.Arguments); i++ {
+				switch v := call.Argument(i).Export().(type) {
+				case int64:
+					args = append(args, float64(v))
+				case float64:
+					args = append(args, v)
+				case string:
+					args = append(args, v)
 				}
 			}
 			if err := d.Command(f, args...); err != nil {
 				log.Printf("lxi command err=%v", err)
-				if ov, err := otto.ToValue(false); err == nil {
-					return ov
-				}
-			} else {
-				if ov, err := otto.ToValue(true); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(false)
 			}
+			return vm.rt.ToValue(true)
 		}
-		return otto.Value{}
+		return goja.Undefined()
 	})
-	vm.Set("lxiQuery", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
+	vm.Set("lxiQuery", func(call goja.FunctionCall) goja.Value {
+		if isScriptString(call.Argument(0)) {
 			q := call.Argument(0).String()
 			to := pe.Timeout * 1000
-			if call.Argument(1).IsNumber() {
-				if i, err := call.Argument(1).ToInteger(); err == nil && i > 0 && i < 10*1000 {
-					to = int(i)
-				}
+			if i, ok := call.Argument(1).Export().(int64); ok && i > 0 && i < 10*1000 {
+				to = int(i)
 			}
 			d.SetTimeout(to)
 			if v, err := d.Query(q); err == nil {
-				if ov, err := otto.ToValue(v); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(v)
 			} else {
 				log.Printf("lxi query err=%v", err)
 			}
 		}
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 	value, err := vm.Run(pe.Script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -5,7 +5,6 @@ package polling
 import (
 	"fmt"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
@@ -42,7 +41,7 @@ func doPollingMonitor(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -53,7 +52,7 @@ func doPollingMonitor(pe *datastore.PollingEnt) bool {
 		setPollingError("monitor", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -13,8 +13,8 @@ import (
 
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/dop251/goja"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 )
@@ -45,7 +45,7 @@ func doPollingMqttConnect(pe *datastore.PollingEnt) bool {
 		return true
 	}
 	if pe.Script != "" {
-		vm := otto.New()
+		vm := newScriptVM(pe.ID)
 		setVMFuncAndValues(pe, vm)
 		vm.Set("rtt", pe.Result["rtt"])
 		value, err := vm.Run(pe.Script)
@@ -53,7 +53,7 @@ func doPollingMqttConnect(pe *datastore.PollingEnt) bool {
 			setPollingError("mqtt", pe, err)
 			return false
 		}
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return true
 		}
@@ -116,7 +116,7 @@ func doPollingMqttSubscribe(pe *datastore.PollingEnt) {
 func checkMqttMessage(pe *datastore.PollingEnt, topic, payload string) (bool, error) {
 	pe.Result["topic"] = topic
 	pe.Result["payload"] = payload
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("topic", topic)
 	vm.Set("payload", payload)
@@ -127,37 +127,30 @@ func checkMqttMessage(pe *datastore.PollingEnt, topic, payload string) (bool, er
 		if err != nil {
 			return false, err
 		}
-		vm.Set("goquery", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("goquery", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
-				if ov, err := otto.ToValue(doc.Find(sel).Text()); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(doc.Find(sel).Text())
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 	} else if extractor == "getBody" {
-		vm.Set("getBody", func(call otto.FunctionCall) otto.Value {
-			if r, err := otto.ToValue(payload); err == nil {
-				return r
-			}
-			return otto.UndefinedValue()
+		vm.Set("getBody", func() string {
+			return payload
 		})
 	} else if extractor == "jsonpath" {
 		var res map[string]interface{}
 		if err := json.Unmarshal([]byte(payload), &res); err != nil {
 			return false, err
 		}
-		vm.Set("jsonpath", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("jsonpath", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
 				if v, err := jsonpath.Get(sel, res); err == nil {
-					if ov, err := otto.ToValue(v); err == nil {
-						return ov
-					}
+					return vm.rt.ToValue(v)
 				}
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 	} else if extractor != "" {
 		grokEnt := datastore.GetGrokEnt(extractor)
@@ -185,7 +178,7 @@ func checkMqttMessage(pe *datastore.PollingEnt, topic, payload string) (bool, er
 	if err != nil {
 		return false, err
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		return true, nil
 	}
 	return false, nil
@@ -9,7 +9,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 )
@@ -77,7 +76,7 @@ func doPollingNetflowCount(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("interval", pe.PollInt)
@@ -86,7 +85,7 @@ func doPollingNetflowCount(pe *datastore.PollingEnt) {
 		setPollingError("netflow", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -132,7 +131,7 @@ func doPollingNetflowCheck(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	var lastError error
 	failed := false
@@ -168,7 +167,7 @@ func doPollingNetflowCheck(pe *datastore.PollingEnt) {
 		if script != "" {
 			value, err := vm.Run(script)
 			if err == nil {
-				if ok, _ := value.ToBoolean(); !ok {
+				if !value.ToBoolean() {
 					failed = true
 					return false
 				}
@@ -366,7 +365,7 @@ func doPollingNetFlowTraffic(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("bps", bps)
 	vm.Set("pps", pps)
@@ -377,7 +376,7 @@ func doPollingNetFlowTraffic(pe *datastore.PollingEnt) {
 		setPollingError("netflow", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -528,7 +527,7 @@ func doPollingNetflowStats(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("interval", pe.PollInt)
 	for k, v := range pe.Result {
@@ -539,7 +538,7 @@ func doPollingNetflowStats(pe *datastore.PollingEnt) {
 		setPollingError("netflow", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
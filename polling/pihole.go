@@ -11,7 +11,7 @@ import (
 
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/davidebianchi/go-jsonclient"
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/twsnmp/twsnmpfc/notify"
 )
@@ -31,7 +31,7 @@ func doPollingPiHole(pe *datastore.PollingEnt) {
 		setPollingError("pihole", pe, fmt.Errorf("invalid url: %w", err))
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	var sid string
 	var rTime int64
@@ -56,16 +56,14 @@ func doPollingPiHole(pe *datastore.PollingEnt) {
 	}
 	pe.Result["rtt"] = float64(rTime)
 	vm.Set("rtt", rTime)
-	vm.Set("jsonpath", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
+	vm.Set("jsonpath", func(call goja.FunctionCall) goja.Value {
+		if isScriptString(call.Argument(0)) {
 			sel := call.Argument(0).String()
 			if v, err := jsonpath.Get(sel, res); err == nil {
-				if ov, err := otto.ToValue(v); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(v)
 			}
 		}
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 
 	value, err := vm.Run(pe.Script)
@@ -73,7 +71,7 @@ func doPollingPiHole(pe *datastore.PollingEnt) {
 		setPollingError("pihole", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		delete(pe.Result, "error")
 		setPollingState(pe, "normal")
 	} else {
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,8 +18,8 @@ import (
 	"time"
 
 	"github.com/Songmu/timeout"
+	"github.com/dop251/goja"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/twsnmp/twsnmpfc/notify"
 	"github.com/twsnmp/twsnmpfc/report"
@@ -47,6 +48,8 @@ func AutoAddPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt) {
 		autoAddVMwarePolling(n, pt)
 	case "tcp", "http", "tls":
 		autoAddTCPPolling(n, pt)
+	case "sflow":
+		autoAddSFlowPolling(n, pt)
 	default:
 		log.Printf("polling not supported type=%s", pt.Type)
 	}
@@ -133,6 +136,7 @@ func pollingBackend(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 	time.Sleep(time.Millisecond * 100)
 	timer := time.NewTicker(time.Second * 5)
+	timer1Min := time.NewTicker(time.Minute)
 	stopPolling = false
 	for {
 		select {
@@ -146,6 +150,9 @@ func pollingBackend(ctx context.Context, wg *sync.WaitGroup) {
 			if !checkingPolling {
 				go checkPolling()
 			}
+		case <-timer1Min.C:
+			checkSFlowAutoPolling()
+			cleanupSnmpNodes()
 		case id := <-doPollingCh:
 			pe := datastore.GetPolling(id)
 			if pe != nil && pe.NextTime <= time.Now().UnixNano() {
@@ -232,6 +239,8 @@ func doPolling(pe *datastore.PollingEnt) {
 		doPollingCmd(pe)
 	case "ssh":
 		doPollingSSH(pe)
+	case "config":
+		doPollingConfig(pe)
 	case "vmware":
 		doPollingVMWare(pe)
 	case "twsnmp":
@@ -260,6 +269,8 @@ func doPolling(pe *datastore.PollingEnt) {
 		}
 	case "email":
 		doPollingEMail(pe)
+	case "sflow":
+		doPollingSFlow(pe)
 	}
 	datastore.UpdatePolling(pe)
 	if pe.LogMode == datastore.LogModeAlways || pe.LogMode == datastore.LogModeAI || (pe.LogMode == datastore.LogModeOnChange && oldState != pe.State) {
@@ -327,6 +338,7 @@ func setPollingState(pe *datastore.PollingEnt, newState string) {
 		}
 		datastore.AddEventLog(l)
 		notify.SendNotifyChat(l)
+		notify.TicketPollingStateChanged(pe, oldState)
 		go doAction(pe, nodeName)
 	}
 }
@@ -478,58 +490,58 @@ func hasSameNamePolling(nodeID, name string) bool {
 	return r
 }
 
-func setVMFuncAndValues(pe *datastore.PollingEnt, vm *otto.Otto) {
-	vm.Set("setResult", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
-			n := call.Argument(0).String()
-			if call.Argument(1).IsNumber() && !call.Argument(1).IsNaN() {
-				if v, err := call.Argument(1).ToFloat(); err == nil {
-					pe.Result[n] = v
-				}
-			} else if call.Argument(1).IsString() {
-				pe.Result[n] = call.Argument(1).String()
-			} else if call.Argument(1).IsBoolean() {
-				if v, err := call.Argument(1).ToBoolean(); err == nil && v {
-					pe.Result[n] = float64(1)
-				} else {
-					pe.Result[n] = float64(0)
-				}
+func setVMFuncAndValues(pe *datastore.PollingEnt, vm *scriptVM) {
+	vm.Set("setResult", func(call goja.FunctionCall) goja.Value {
+		n, ok := call.Argument(0).Export().(string)
+		if !ok {
+			return goja.Undefined()
+		}
+		switch v := call.Argument(1).Export().(type) {
+		case int64:
+			pe.Result[n] = float64(v)
+		case float64:
+			if !math.IsNaN(v) {
+				pe.Result[n] = v
+			}
+		case string:
+			pe.Result[n] = v
+		case bool:
+			if v {
+				pe.Result[n] = float64(1)
+			} else {
+				pe.Result[n] = float64(0)
 			}
 		}
-		return otto.Value{}
+		return goja.Undefined()
 	})
-	vm.Set("getResult", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
-			k := call.Argument(0).String()
+	vm.Set("getResult", func(call goja.FunctionCall) goja.Value {
+		if k, ok := call.Argument(0).Export().(string); ok {
 			if v, ok := pe.Result[k]; ok {
-				if ov, err := otto.ToValue(v); err == nil {
-					return ov
-				}
+				return vm.rt.ToValue(v)
 			}
 		}
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
-	vm.Set("setLevel", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
-			level := call.Argument(0).String()
+	vm.Set("setLevel", func(call goja.FunctionCall) goja.Value {
+		if level, ok := call.Argument(0).Export().(string); ok {
 			pe.Result["_level"] = level
 		}
-		return otto.Value{}
+		return goja.Undefined()
 	})
-	vm.Set("saveReport", func(call otto.FunctionCall) otto.Value {
-		if len(call.ArgumentList) != 2 ||
-			!call.Argument(0).IsString() ||
-			!call.Argument(1).IsObject() {
-			return otto.FalseValue()
-		}
-		if o, err := call.Argument(1).Export(); err == nil {
-			if m, ok := o.(map[string]interface{}); ok {
-				if saveReportFromJS(pe.ID, call.Argument(0).String(), m) {
-					return otto.TrueValue()
-				}
+	vm.Set("saveReport", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 2 {
+			return vm.rt.ToValue(false)
+		}
+		t, ok := call.Argument(0).Export().(string)
+		if !ok {
+			return vm.rt.ToValue(false)
+		}
+		if m, ok := call.Argument(1).Export().(map[string]interface{}); ok {
+			if saveReportFromJS(pe.ID, t, m) {
+				return vm.rt.ToValue(true)
 			}
 		}
-		return otto.FalseValue()
+		return vm.rt.ToValue(false)
 	})
 	if len(pe.Result) > 0 {
 		for k, v := range pe.Result {
@@ -7,7 +7,6 @@ import (
 	"math"
 
 	"github.com/montanaflynn/stats"
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
@@ -50,7 +49,7 @@ func doPollingReport(pe *datastore.PollingEnt) {
 		setPollingError("report", pe, fmt.Errorf("no report data"))
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = make(map[string]interface{})
 	pe.Result["count"] = float64(len(scores))
@@ -82,7 +81,7 @@ func doPollingReport(pe *datastore.PollingEnt) {
 		setPollingError("report", pe, fmt.Errorf("invalid script"))
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -0,0 +1,255 @@
+package polling
+
+// ポーリングのスクリプトを実行する(goja)。
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/montanaflynn/stats"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// ScriptTimeout : スクリプトの実行時間の上限
+var ScriptTimeout = time.Second * 10
+
+// コンパイル済みのスクリプトのキャッシュ(キーはポーリングのID、LRUで削除)
+type scriptCacheEnt struct {
+	key    string
+	script string
+	prog   *goja.Program
+}
+
+var scriptCache = make(map[string]*list.Element)
+var scriptCacheList = list.New()
+var scriptCacheSize int
+var scriptCacheMu sync.Mutex
+
+// キャッシュする数とスクリプトの合計サイズの上限
+const scriptCacheMax = 1000
+const scriptCacheMaxSize = 16 * 1024 * 1024
+
+// スクリプトのサイズの上限
+const scriptMaxSize = 1024 * 1024
+
+// scriptVM : ポーリングのスクリプトを実行するVM
+type scriptVM struct {
+	rt  *goja.Runtime
+	key string
+}
+
+// newScriptVM : keyはコンパイル済みのスクリプトをキャッシュするキー、空はキャッシュしない
+func newScriptVM(key string) *scriptVM {
+	vm := &scriptVM{rt: goja.New(), key: key}
+	vm.rt.SetMaxCallStackSize(1024)
+	setVMHelpers(vm)
+	return vm
+}
+
+// Set : スクリプトの変数または関数を設定する
+func (vm *scriptVM) Set(name string, v any) error {
+	return vm.rt.Set(name, v)
+}
+
+// Run : 時間制限付きでスクリプトを実行する
+func (vm *scriptVM) Run(script string) (goja.Value, error) {
+	p, err := getScriptProgram(vm.key, script)
+	if err != nil {
+		return nil, err
+	}
+	vm.rt.ClearInterrupt()
+	timer := time.AfterFunc(ScriptTimeout, func() {
+		vm.rt.Interrupt(fmt.Errorf("script timeout"))
+	})
+	defer timer.Stop()
+	return vm.rt.RunProgram(p)
+}
+
+// isScriptString : スクリプトから渡された値が文字列か判断する
+func isScriptString(v goja.Value) bool {
+	_, ok := v.Export().(string)
+	return ok
+}
+
+func getScriptProgram(key, script string) (*goja.Program, error) {
+	if len(script) > scriptMaxSize {
+		return nil, fmt.Errorf("script too large size=%d", len(script))
+	}
+	if key != "" {
+		scriptCacheMu.Lock()
+		if e, ok := scriptCache[key]; ok {
+			if c := e.Value.(*scriptCacheEnt); c.script == script {
+				scriptCacheList.MoveToFront(e)
+				scriptCacheMu.Unlock()
+				return c.prog, nil
+			}
+		}
+		scriptCacheMu.Unlock()
+	}
+	p, err := goja.Compile("", script, false)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		setScriptCache(key, script, p)
+	}
+	return p, nil
+}
+
+// setScriptCache : キャッシュに追加して上限を超えたら古いものから削除する
+func setScriptCache(key, script string, p *goja.Program) {
+	scriptCacheMu.Lock()
+	defer scriptCacheMu.Unlock()
+	if e, ok := scriptCache[key]; ok {
+		c := e.Value.(*scriptCacheEnt)
+		scriptCacheSize += len(script) - len(c.script)
+		c.script = script
+		c.prog = p
+		scriptCacheList.MoveToFront(e)
+	} else {
+		scriptCache[key] = scriptCacheList.PushFront(&scriptCacheEnt{key: key, script: script, prog: p})
+		scriptCacheSize += len(script)
+	}
+	for scriptCacheList.Len() > 1 && (scriptCacheList.Len() > scriptCacheMax || scriptCacheSize > scriptCacheMaxSize) {
+		e := scriptCacheList.Back()
+		c := e.Value.(*scriptCacheEnt)
+		scriptCacheList.Remove(e)
+		delete(scriptCache, c.key)
+		scriptCacheSize -= len(c.script)
+	}
+}
+
+// setVMHelpers : スクリプトで使える共通の関数を設定する
+func setVMHelpers(vm *scriptVM) {
+	vm.Set("httpFetch", func(call goja.FunctionCall) goja.Value {
+		url := call.Argument(0).String()
+		method := "GET"
+		body := ""
+		headers := map[string]string{}
+		if o, ok := call.Argument(1).Export().(map[string]any); ok {
+			if v, ok := o["method"].(string); ok {
+				method = strings.ToUpper(v)
+			}
+			if v, ok := o["body"].(string); ok {
+				body = v
+			}
+			if h, ok := o["headers"].(map[string]any); ok {
+				for k, v := range h {
+					headers[k] = fmt.Sprintf("%v", v)
+				}
+			}
+		}
+		return vm.rt.ToValue(scriptHTTPFetch(url, method, body, headers))
+	})
+	st := vm.rt.NewObject()
+	st.Set("sum", func(a []float64) float64 {
+		r, _ := stats.Sum(a)
+		return r
+	})
+	st.Set("mean", func(a []float64) float64 {
+		r, _ := stats.Mean(a)
+		return r
+	})
+	st.Set("median", func(a []float64) float64 {
+		r, _ := stats.Median(a)
+		return r
+	})
+	st.Set("min", func(a []float64) float64 {
+		r, _ := stats.Min(a)
+		return r
+	})
+	st.Set("max", func(a []float64) float64 {
+		r, _ := stats.Max(a)
+		return r
+	})
+	st.Set("stddev", func(a []float64) float64 {
+		r, _ := stats.StandardDeviation(a)
+		return r
+	})
+	st.Set("percentile", func(a []float64, p float64) float64 {
+		r, _ := stats.Percentile(a, p)
+		return r
+	})
+	vm.Set("stats", st)
+}
+
+// scriptHTTPFetch : スクリプトからのHTTPリクエスト、結果は{status,headers,body}
+func scriptHTTPFetch(url, method, body string, headers map[string]string) map[string]any {
+	ret := map[string]any{"status": 0, "headers": map[string]string{}, "body": "", "error": ""}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		ret["error"] = err.Error()
+		return ret
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: ScriptTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		ret["error"] = err.Error()
+		return ret
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		ret["error"] = err.Error()
+	}
+	h := map[string]string{}
+	for k := range resp.Header {
+		h[k] = resp.Header.Get(k)
+	}
+	ret["status"] = resp.StatusCode
+	ret["headers"] = h
+	ret["body"] = string(b)
+	return ret
+}
+
+// ScriptTestResultEnt : スクリプトのテスト結果
+type ScriptTestResultEnt struct {
+	OK     bool
+	Value  any
+	Level  string
+	Result map[string]any
+	Error  string
+	Dur    int64
+}
+
+// RunTestScript : サンプルの結果に対してスクリプトを実行する
+func RunTestScript(script string, result map[string]any, interval int) *ScriptTestResultEnt {
+	st := time.Now()
+	pe := &datastore.PollingEnt{
+		PollInt: interval,
+		Result:  make(map[string]any),
+	}
+	for k, v := range result {
+		pe.Result[k] = v
+	}
+	vm := newScriptVM("")
+	setVMFuncAndValues(pe, vm)
+	for k, v := range result {
+		vm.Set(k, v)
+	}
+	vm.Set("interval", interval)
+	ret := &ScriptTestResultEnt{}
+	value, err := vm.Run(script)
+	ret.Dur = time.Since(st).Nanoseconds()
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.OK = value.ToBoolean()
+	ret.Value = value.Export()
+	if l, ok := pe.Result["_level"].(string); ok {
+		ret.Level = l
+		delete(pe.Result, "_level")
+	}
+	ret.Result = pe.Result
+	return ret
+}
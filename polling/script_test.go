@@ -0,0 +1,76 @@
+package polling
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTestScript(t *testing.T) {
+	r := RunTestScript(`
+const a = [1, 2, 3, 4, 100];
+const o = { v: { x: 10 } };
+setResult("p50", stats.median(a));
+setResult("x", o?.v?.x ?? 0);
+setLevel("low");
+let last = getResult("count_last");
+count > 10 && a.map((v) => v * 2).length === 5 && last === undefined;
+`, map[string]any{"count": 20}, 60)
+	if r.Error != "" {
+		t.Fatal(r.Error)
+	}
+	if !r.OK || r.Level != "low" {
+		t.Errorf("script test=%+v", r)
+	}
+	if r.Result["p50"] != float64(3) || r.Result["x"] != float64(10) {
+		t.Errorf("script result=%+v", r.Result)
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	to := ScriptTimeout
+	ScriptTimeout = time.Millisecond * 100
+	defer func() { ScriptTimeout = to }()
+	st := time.Now()
+	r := RunTestScript(`while(true){}`, nil, 60)
+	if !strings.Contains(r.Error, "timeout") || time.Since(st) > time.Second*5 {
+		t.Errorf("script timeout err=%s dur=%v", r.Error, time.Since(st))
+	}
+	// 中断後も同じVMで実行できること
+	vm := newScriptVM("")
+	if _, err := vm.Run(`while(true){}`); err == nil {
+		t.Fatal("no timeout")
+	}
+	if v, err := vm.Run(`1 + 1 === 2`); err != nil || !v.ToBoolean() {
+		t.Errorf("run after timeout err=%v", err)
+	}
+}
+
+func TestScriptCache(t *testing.T) {
+	for i := 0; i < scriptCacheMax+10; i++ {
+		if _, err := getScriptProgram(fmt.Sprintf("p%d", i), "1 + 1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 最近使ったものは残る
+	getScriptProgram("p10", "1 + 1")
+	getScriptProgram("new", "2 + 2")
+	scriptCacheMu.Lock()
+	_, p10 := scriptCache["p10"]
+	_, p11 := scriptCache["p11"]
+	n := scriptCacheList.Len()
+	scriptCacheMu.Unlock()
+	if n != scriptCacheMax || !p10 || p11 {
+		t.Errorf("lru len=%d p10=%v p11=%v", n, p10, p11)
+	}
+	// スクリプトを変更した場合は再コンパイルする
+	p1, _ := getScriptProgram("p10", "1 + 1")
+	p2, _ := getScriptProgram("p10", "1 + 2")
+	if p1 == p2 {
+		t.Error("cache not updated")
+	}
+	if _, err := getScriptProgram("big", strings.Repeat(" ", scriptMaxSize+1)); err == nil {
+		t.Error("no error for large script")
+	}
+}
@@ -0,0 +1,189 @@
+package polling
+
+// sFlowのカウンターサンプルからインターフェースの通信量を監視する
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func doPollingSFlow(pe *datastore.PollingEnt) {
+	n := datastore.GetNode(pe.NodeID)
+	if n == nil {
+		setPollingError("sflow", pe, fmt.Errorf("node not found"))
+		return
+	}
+	agent, index, err := parseSFlowParams(n.IP, pe.Params)
+	if err != nil {
+		setPollingError("sflow", pe, err)
+		return
+	}
+	prev, last := datastore.GetSFlowIfCounter(agent, index)
+	if last == nil {
+		setPollingError("sflow", pe, fmt.Errorf("no counter sample"))
+		return
+	}
+	timeout := int64(pe.PollInt) * 3
+	if timeout < 180 {
+		timeout = 180
+	}
+	if time.Now().UnixNano()-last.Time > timeout*1000*1000*1000 {
+		setPollingError("sflow", pe, fmt.Errorf("counter sample timeout"))
+		return
+	}
+	r := getSFlowIfStats(prev, last)
+	if r == nil {
+		setPollingState(pe, "unknown")
+		return
+	}
+	for k, v := range r {
+		pe.Result[k] = v
+	}
+	delete(pe.Result, "error")
+	if pe.Script == "" {
+		setPollingState(pe, "normal")
+		return
+	}
+	vm := newScriptVM(pe.ID)
+	setVMFuncAndValues(pe, vm)
+	for k, v := range r {
+		if k != "interval" {
+			// スクリプトのintervalはポーリング間隔
+			vm.Set(k, v)
+		}
+	}
+	value, err := vm.Run(pe.Script)
+	if err != nil {
+		setPollingError("sflow", pe, err)
+		return
+	}
+	if value.ToBoolean() {
+		setPollingState(pe, "normal")
+	} else {
+		setPollingState(pe, pe.Level)
+	}
+}
+
+// parseSFlowParams : Paramsは"インデックス"または"エージェント:インデックス"
+func parseSFlowParams(ip, params string) (string, int, error) {
+	agent := ip
+	idx := params
+	if i := strings.LastIndex(idx, ":"); i > 0 {
+		agent = idx[:i]
+		idx = idx[i+1:]
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(idx))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid index %s", params)
+	}
+	return agent, index, nil
+}
+
+// getSFlowIfStats : 直前と最新のカウンターサンプルから通信量などを計算する
+// 計算できない場合はnil
+func getSFlowIfStats(prev, last *datastore.SFlowIfCounterEnt) map[string]float64 {
+	if prev == nil || last == nil || last.Time <= prev.Time {
+		return nil
+	}
+	dt := float64(last.Time-prev.Time) / (1000 * 1000 * 1000)
+	delta := func(o, n uint64) float64 {
+		if n < o {
+			// リセットまたは32ビットカウンターの折り返し
+			return 0.0
+		}
+		return float64(n - o)
+	}
+	r := map[string]float64{
+		"inBps":       delta(prev.InOctets, last.InOctets) * 8 / dt,
+		"outBps":      delta(prev.OutOctets, last.OutOctets) * 8 / dt,
+		"inPps":       delta(prev.InPackets, last.InPackets) / dt,
+		"outPps":      delta(prev.OutPackets, last.OutPackets) / dt,
+		"inErrors":    delta(prev.InErrors, last.InErrors),
+		"outErrors":   delta(prev.OutErrors, last.OutErrors),
+		"inDiscards":  delta(prev.InDiscards, last.InDiscards),
+		"outDiscards": delta(prev.OutDiscards, last.OutDiscards),
+		"inUtil":      0.0,
+		"outUtil":     0.0,
+		"ifSpeed":     float64(last.Speed),
+		"interval":    dt,
+	}
+	if last.Speed > 0 {
+		r["inUtil"] = r["inBps"] * 100.0 / float64(last.Speed)
+		r["outUtil"] = r["outBps"] * 100.0 / float64(last.Speed)
+	}
+	// ifStatusのbit0:admin,bit1:oper(1:up 2:down)
+	r["ifOperStatus"] = 2.0
+	if last.Status&0x02 != 0 {
+		r["ifOperStatus"] = 1.0
+	}
+	return r
+}
+
+// autoAddSFlowPolling : ノードのsFlowエージェントのインターフェース毎にポーリングを作成する
+func autoAddSFlowPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt) {
+	for _, index := range datastore.GetSFlowIfIndexes(n.IP) {
+		addSFlowPolling(n, pt, index)
+	}
+}
+
+func addSFlowPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt, index int) {
+	p := new(datastore.PollingEnt)
+	p.Name = fmt.Sprintf("%s : %d", pt.Name, index)
+	if hasSameNamePolling(n.ID, p.Name) {
+		return
+	}
+	p.NodeID = n.ID
+	p.Type = pt.Type
+	p.Params = strings.ReplaceAll(pt.Params, "$i", strconv.Itoa(index))
+	p.Mode = pt.Mode
+	p.Script = pt.Script
+	p.Extractor = pt.Extractor
+	p.Filter = pt.Filter
+	p.Level = pt.Level
+	p.PollInt = datastore.MapConf.PollInt
+	p.Timeout = datastore.MapConf.Timeout
+	p.Retry = datastore.MapConf.Retry
+	p.LogMode = 0
+	p.NextTime = 0
+	p.State = "unknown"
+	if err := datastore.AddPollingWithDupCheck(p); err != nil {
+		log.Printf("add sflow polling err=%v", err)
+		return
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:     "polling",
+		Level:    "info",
+		NodeID:   n.ID,
+		NodeName: n.Name,
+		Event:    "sFlowのポーリングを自動登録しました:" + p.Name,
+	})
+}
+
+// checkSFlowAutoPolling : 新しく受信したsFlowエージェントのインターフェースのポーリングを作成する
+func checkSFlowAutoPolling() {
+	var pt *datastore.PollingTemplateEnt
+	datastore.ForEachPollingTemplate(func(t *datastore.PollingTemplateEnt) bool {
+		if t.Type == "sflow" && t.AutoMode == "sflow" {
+			pt = t
+			return false
+		}
+		return true
+	})
+	if pt == nil {
+		return
+	}
+	datastore.ForEachUncheckedSFlowIf(func(agent string, index int) bool {
+		n := datastore.FindNodeFromIP(agent)
+		if n == nil {
+			// ノードが発見されるまで待つ
+			return false
+		}
+		addSFlowPolling(n, pt, index)
+		return true
+	})
+}
@@ -0,0 +1,37 @@
+package polling
+
+import (
+	"testing"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func TestSFlowIfStats(t *testing.T) {
+	if a, i, err := parseSFlowParams("192.168.1.1", "3"); err != nil || a != "192.168.1.1" || i != 3 {
+		t.Errorf("params=%s %d %v", a, i, err)
+	}
+	if a, i, err := parseSFlowParams("192.168.1.1", "10.0.0.1:12"); err != nil || a != "10.0.0.1" || i != 12 {
+		t.Errorf("params with agent=%s %d %v", a, i, err)
+	}
+	if _, _, err := parseSFlowParams("192.168.1.1", "eth0"); err == nil {
+		t.Error("no error for invalid index")
+	}
+	prev := &datastore.SFlowIfCounterEnt{Time: 0, InOctets: 1000, OutOctets: 5000, InPackets: 10, InErrors: 1}
+	last := &datastore.SFlowIfCounterEnt{Time: 10 * 1000 * 1000 * 1000, Speed: 1000, Status: 3,
+		InOctets: 2000, OutOctets: 4000, InPackets: 30, InErrors: 4}
+	r := getSFlowIfStats(prev, last)
+	if r == nil || r["inBps"] != 800 || r["inUtil"] != 80 || r["inPps"] != 2 || r["inErrors"] != 3 || r["interval"] != 10 {
+		t.Errorf("sflow stats=%v", r)
+	}
+	// カウンターが戻った場合は0にする
+	if r["outBps"] != 0 || r["ifOperStatus"] != 1 {
+		t.Errorf("sflow stats reset=%v", r)
+	}
+	last.Status = 1
+	if r := getSFlowIfStats(prev, last); r["ifOperStatus"] != 2 {
+		t.Errorf("sflow oper status=%v", r["ifOperStatus"])
+	}
+	if getSFlowIfStats(last, last) != nil || getSFlowIfStats(nil, last) != nil {
+		t.Error("sflow stats without previous sample")
+	}
+}
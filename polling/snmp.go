@@ -10,8 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dop251/goja"
 	gosnmp "github.com/gosnmp/gosnmp"
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 )
 
@@ -20,87 +20,33 @@ func doPollingSnmp(pe *datastore.PollingEnt) {
 	if n == nil {
 		return
 	}
-	port := uint16(161)
-	if n.SnmpPort > 0 {
-		port = uint16(n.SnmpPort)
-	}
-	agent := &gosnmp.GoSNMP{
-		Target:    n.IP,
-		Port:      port,
-		Transport: "udp",
-		Community: n.Community,
-		Version:   gosnmp.Version2c,
-		Timeout:   time.Duration(pe.Timeout) * time.Second,
-		Retries:   pe.Retry,
-		MaxOids:   gosnmp.MaxOids,
+	mode := pe.Mode
+	if mode == "" {
+		setPollingError("snmp", pe, fmt.Errorf("invalid snmp polling"))
+		return
 	}
-	switch n.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
+	if !datastore.MapConf.DisableSnmpBatch {
+		// 同じノードと間隔のポーリングをまとめて取得する
+		if oids := getSnmpBatchOIDs(pe); len(oids) > 0 {
+			doPollingSnmpMode(pe, snmpBatchGet(n, pe, oids))
+			return
 		}
 	}
+	sn := getSnmpNode(n.ID)
+	sem := sn.acquire()
+	defer sn.release(sem)
+	agent := newSnmpAgent(n, pe.Timeout, pe.Retry)
 	err := agent.Connect()
 	if err != nil {
 		log.Printf("polling snnmp err=%v", err)
 		return
 	}
 	defer agent.Conn.Close()
-	mode := pe.Mode
-	if mode == "" {
-		setPollingError("snmp", pe, fmt.Errorf("invalid snmp polling"))
-		return
-	}
-	switch mode {
+	doPollingSnmpMode(pe, &snmpLimitedClient{agent: agent, node: sn, bulk: !datastore.MapConf.DisableSnmpBatch})
+}
+
+func doPollingSnmpMode(pe *datastore.PollingEnt, agent snmpClient) {
+	switch pe.Mode {
 	case "sysUpTime":
 		doPollingSnmpSysUpTime(pe, agent)
 	case "ifOperStatus":
@@ -122,7 +68,28 @@ func doPollingSnmp(pe *datastore.PollingEnt) {
 	}
 }
 
-func doPollingSnmpSysUpTime(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+// newSnmpAgent : ノードの認証情報でSNMPのエージェントを作成する
+func newSnmpAgent(n *datastore.NodeEnt, timeout, retry int) *gosnmp.GoSNMP {
+	cred := datastore.GetNodeCredential(n, "snmp")
+	port := uint16(161)
+	if n.SnmpPort > 0 {
+		port = uint16(n.SnmpPort)
+	}
+	agent := &gosnmp.GoSNMP{
+		Target:    n.IP,
+		Port:      port,
+		Transport: "udp",
+		Community: cred.Community,
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Duration(timeout) * time.Second,
+		Retries:   retry,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	cred.SetSnmpAgent(agent)
+	return agent
+}
+
+func doPollingSnmpSysUpTime(pe *datastore.PollingEnt, agent snmpClient) {
 	oids := []string{datastore.MIBDB.NameToOID("sysUpTime.0")}
 	result, err := agent.Get(oids)
 	if err != nil {
@@ -165,7 +132,7 @@ func doPollingSnmpSysUpTime(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingState(pe, "unknown")
 }
 
-func doPollingSnmpIF(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpIF(pe *datastore.PollingEnt, agent snmpClient) {
 	if pe.Params == "" {
 		setPollingError("snmpif", pe, fmt.Errorf("invalid format"))
 		return
@@ -201,12 +168,10 @@ func doPollingSnmpIF(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingState(pe, "unknown")
 }
 
-func doPollingSnmpGet(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
-	names := strings.Split(pe.Params, ",")
-	script := pe.Script
-	mode := pe.Mode
+// getSnmpGetOIDs : パラメータで指定したMIBのOID
+func getSnmpGetOIDs(pe *datastore.PollingEnt) []string {
 	oids := []string{}
-	for _, n := range names {
+	for _, n := range strings.Split(pe.Params, ",") {
 		if n == "" {
 			continue
 		}
@@ -214,19 +179,26 @@ func doPollingSnmpGet(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 			oids = append(oids, strings.TrimSpace(oid))
 		}
 	}
+	if len(oids) > 0 && pe.Mode == "ps" {
+		oids = append(oids, datastore.MIBDB.NameToOID("sysUpTime.0"))
+	}
+	return oids
+}
+
+func doPollingSnmpGet(pe *datastore.PollingEnt, agent snmpClient) {
+	script := pe.Script
+	mode := pe.Mode
+	oids := getSnmpGetOIDs(pe)
 	if len(oids) < 1 {
 		setPollingError("snmp", pe, fmt.Errorf("invalid format"))
 		return
 	}
-	if mode == "ps" {
-		oids = append(oids, datastore.MIBDB.NameToOID("sysUpTime.0"))
-	}
 	result, err := agent.Get(oids)
 	if err != nil {
 		setPollingError("snmp", pe, err)
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	lr := make(map[string]interface{})
 	for _, variable := range result.Variables {
@@ -308,7 +280,7 @@ func doPollingSnmpGet(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	pe.Result = lr
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -325,7 +297,7 @@ func getValueName(n string) string {
 	return (a[0])
 }
 
-func doPollingSnmpCount(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpCount(pe *datastore.PollingEnt, agent snmpClient) {
 	oid := datastore.MIBDB.NameToOID(pe.Params)
 	filter := pe.Filter
 	script := pe.Script
@@ -349,13 +321,13 @@ func doPollingSnmpCount(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 		setPollingError("snmp", pe, err)
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	pe.Result["count"] = float64(count)
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -365,7 +337,7 @@ func doPollingSnmpCount(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingError("snmp", pe, err)
 }
 
-func doPollingSnmpProcess(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpProcess(pe *datastore.PollingEnt, agent snmpClient) {
 	oid := datastore.MIBDB.NameToOID("hrSWRunName")
 	filter := pe.Filter
 	script := pe.Script
@@ -412,7 +384,7 @@ func doPollingSnmpProcess(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	if lastPidSum != 0 && pidSum != lastPidSum {
 		changed = 1
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("changed", changed)
@@ -421,7 +393,7 @@ func doPollingSnmpProcess(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	pe.Result["changed"] = float64(changed)
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -431,7 +403,7 @@ func doPollingSnmpProcess(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingError("snmp", pe, err)
 }
 
-func doPollingSnmpStats(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpStats(pe *datastore.PollingEnt, agent snmpClient) {
 	oid := datastore.MIBDB.NameToOID(pe.Params)
 	script := pe.Script
 	count := uint64(0)
@@ -456,7 +428,7 @@ func doPollingSnmpStats(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 		return
 	}
 	avg := float64(sum) / float64(count)
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("sum", sum)
@@ -466,7 +438,7 @@ func doPollingSnmpStats(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	pe.Result["avg"] = float64(avg)
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -504,7 +476,7 @@ func autoAddSnmpPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt)
 		p.Level = pt.Level
 		p.PollInt = datastore.MapConf.PollInt
 		p.Timeout = datastore.MapConf.Timeout
-		p.Retry = datastore.MapConf.Timeout
+		p.Retry = datastore.MapConf.Retry
 		p.LogMode = 0
 		p.NextTime = 0
 		p.State = "unknown"
@@ -516,76 +488,7 @@ func autoAddSnmpPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt)
 
 func getSnmpIndex(n *datastore.NodeEnt, name string) map[string]string {
 	ret := make(map[string]string)
-	port := uint16(161)
-	if n.SnmpPort > 0 {
-		port = uint16(n.SnmpPort)
-	}
-	agent := &gosnmp.GoSNMP{
-		Target:    n.IP,
-		Port:      port,
-		Transport: "udp",
-		Community: n.Community,
-		Version:   gosnmp.Version2c,
-		Timeout:   time.Duration(datastore.MapConf.Timeout) * time.Second,
-		Retries:   datastore.MapConf.Retry,
-		MaxOids:   gosnmp.MaxOids,
-	}
-	switch n.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-
-	}
+	agent := newSnmpAgent(n, datastore.MapConf.Timeout, datastore.MapConf.Retry)
 	err := agent.Connect()
 	if err != nil {
 		log.Printf("polling snmp err=%v", err)
@@ -606,7 +509,8 @@ func getSnmpIndex(n *datastore.NodeEnt, name string) map[string]string {
 	return ret
 }
 
-func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+// getSnmpTrafficOIDs : ifTableとifXTableのトラフィックのOID
+func getSnmpTrafficOIDs(pe *datastore.PollingEnt) ([]string, []string) {
 	oids := []string{}
 	oids = append(oids, datastore.MIBDB.NameToOID("ifInOctets."+pe.Params))
 	oids = append(oids, datastore.MIBDB.NameToOID("ifInUcastPkts."+pe.Params))
@@ -618,6 +522,20 @@ func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	oids = append(oids, datastore.MIBDB.NameToOID("ifOutUcastPkts."+pe.Params))
 	oids = append(oids, datastore.MIBDB.NameToOID("ifOutNUcastPkts."+pe.Params))
 	oids = append(oids, datastore.MIBDB.NameToOID("sysUpTime.0"))
+	xoids := []string{}
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCInOctets."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCInUcastPkts."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCInMulticastPkts."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCInBroadcastPkts."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCOutOctets."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCOutUcastPkts."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCOutMulticastPkts."+pe.Params))
+	xoids = append(xoids, datastore.MIBDB.NameToOID("ifHCOutBroadcastPkts."+pe.Params))
+	return oids, xoids
+}
+
+func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent snmpClient) {
+	oids, xoids := getSnmpTrafficOIDs(pe)
 	result, err := agent.Get(oids)
 	if err != nil {
 		setPollingError("snmp", pe, err)
@@ -644,16 +562,7 @@ func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 		}
 	}
 	// ifXTableからも取得すると
-	oids = []string{}
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCInOctets."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCInUcastPkts."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCInMulticastPkts."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCInBroadcastPkts."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCOutOctets."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCOutUcastPkts."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCOutMulticastPkts."+pe.Params))
-	oids = append(oids, datastore.MIBDB.NameToOID("ifHCOutBroadcastPkts."+pe.Params))
-	result, err = agent.Get(oids)
+	result, err = agent.Get(xoids)
 	if err == nil && len(result.Variables) > 0 {
 		ifInNUcastPkts := float64(0.0)
 		ifOutNUcastPkts := float64(0.0)
@@ -772,7 +681,7 @@ func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 			continue
 		}
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = lr
 	pe.Result["bytes"] = bytes
@@ -801,8 +710,9 @@ func doPollingSnmpTraffic(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	value, err := vm.Run(pe.Script)
 	if err != nil {
 		setPollingError("snmp", pe, err)
+		return
 	}
-	if ok, _ := value.ToBoolean(); !ok {
+	if !value.ToBoolean() {
 		setPollingState(pe, pe.Level)
 		return
 	}
@@ -821,7 +731,7 @@ func getMIBStringVal(i interface{}) string {
 	return ""
 }
 
-func doPollingSnmpSystemDate(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpSystemDate(pe *datastore.PollingEnt, agent snmpClient) {
 	script := pe.Script
 	oids := []string{datastore.MIBDB.NameToOID("hrSystemDate.0")}
 	result, err := agent.Get(oids)
@@ -829,7 +739,7 @@ func doPollingSnmpSystemDate(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 		setPollingError("snmp", pe, err)
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = make(map[string]interface{})
 	for _, variable := range result.Variables {
@@ -855,7 +765,7 @@ func doPollingSnmpSystemDate(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	}
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -865,31 +775,29 @@ func doPollingSnmpSystemDate(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingError("snmp", pe, err)
 }
 
-func doPollingSnmpScript(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
+func doPollingSnmpScript(pe *datastore.PollingEnt, agent snmpClient) {
 	script := pe.Script
 	if script == "" {
 		setPollingError("snmp", pe, fmt.Errorf("no script"))
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	pe.Result = make(map[string]interface{})
-	vm.Set("snmpGet", func(call otto.FunctionCall) otto.Value {
-		if call.Argument(0).IsString() {
+	vm.Set("snmpGet", func(call goja.FunctionCall) goja.Value {
+		if isScriptString(call.Argument(0)) {
 			name := call.Argument(0).String()
 			if v, err := snmpGet(agent, name); err == nil {
-				if r, err := otto.ToValue(v); err == nil {
-					return r
-				}
+				return vm.rt.ToValue(v)
 			} else {
 				log.Printf("snmp get err=%v", err)
 			}
 		}
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 	value, err := vm.Run(script)
 	if err == nil {
-		if ok, _ := value.ToBoolean(); !ok {
+		if !value.ToBoolean() {
 			setPollingState(pe, pe.Level)
 			return
 		}
@@ -899,7 +807,7 @@ func doPollingSnmpScript(pe *datastore.PollingEnt, agent *gosnmp.GoSNMP) {
 	setPollingError("snmp", pe, err)
 }
 
-func snmpGet(agent *gosnmp.GoSNMP, name string) (string, error) {
+func snmpGet(agent snmpClient, name string) (string, error) {
 	oids := []string{datastore.MIBDB.NameToOID(name)}
 	result, err := agent.Get(oids)
 	if err != nil {
@@ -0,0 +1,339 @@
+package polling
+
+// SNMPポーリングのまとめ取得とノード毎の同時実行数、送信レートの制限
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gosnmp "github.com/gosnmp/gosnmp"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// snmpClient : ポーリングで使用するSNMPの操作
+type snmpClient interface {
+	Get(oids []string) (*gosnmp.SnmpPacket, error)
+	Walk(rootOid string, walkFn gosnmp.WalkFunc) error
+}
+
+// まとめて取得するポーリングを待つ時間
+const snmpBatchWait = time.Millisecond * 200
+
+// ノード毎の同時実行数の既定値
+const defaultSnmpMaxConcurrent = 2
+
+// GetBulkで1回に取得する数(gosnmpの既定値)
+const snmpBulkRepetitions = 50
+
+// snmpNode : ノード毎のSNMPの実行状態
+type snmpNode struct {
+	mu      sync.Mutex
+	sem     chan struct{}
+	next    time.Time          // 次にリクエストを送信できる時刻
+	batches map[int]*snmpBatch // ポーリング間隔毎のまとめ取得
+}
+
+var snmpNodes sync.Map
+
+func getSnmpNode(id string) *snmpNode {
+	v, _ := snmpNodes.LoadOrStore(id, &snmpNode{batches: make(map[int]*snmpBatch)})
+	return v.(*snmpNode)
+}
+
+// cleanupSnmpNodes : 削除したノードの実行状態を削除する
+func cleanupSnmpNodes() {
+	snmpNodes.Range(func(k, _ any) bool {
+		if id, ok := k.(string); ok && datastore.GetNode(id) == nil {
+			snmpNodes.Delete(k)
+		}
+		return true
+	})
+}
+
+// acquire : ノード毎の同時実行数の制限内で実行を開始する
+func (sn *snmpNode) acquire() chan struct{} {
+	limit := datastore.MapConf.SnmpMaxConcurrent
+	if limit < 1 {
+		limit = defaultSnmpMaxConcurrent
+	}
+	sn.mu.Lock()
+	if sn.sem == nil || cap(sn.sem) != limit {
+		// 設定を変更した場合、実行中のものは元のチャネルに戻す
+		sn.sem = make(chan struct{}, limit)
+	}
+	sem := sn.sem
+	sn.mu.Unlock()
+	sem <- struct{}{}
+	return sem
+}
+
+func (sn *snmpNode) release(sem chan struct{}) {
+	<-sem
+}
+
+// wait : ノード毎の送信レートの制限まで待つ
+func (sn *snmpNode) wait() {
+	rate := datastore.MapConf.SnmpRateLimit
+	if rate < 1 {
+		return
+	}
+	now := time.Now()
+	sn.mu.Lock()
+	if sn.next.Before(now) {
+		sn.next = now
+	}
+	d := sn.next.Sub(now)
+	sn.next = sn.next.Add(time.Second / time.Duration(rate))
+	sn.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// snmpLimitedClient : 送信レートを制限したSNMPの操作
+type snmpLimitedClient struct {
+	agent *gosnmp.GoSNMP
+	node  *snmpNode
+	bulk  bool // WalkでGetBulkを使う
+}
+
+func (c *snmpLimitedClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	c.node.wait()
+	return c.agent.Get(oids)
+}
+
+func (c *snmpLimitedClient) Walk(rootOid string, walkFn gosnmp.WalkFunc) error {
+	// 次のリクエストを送信する前に待つ
+	per := 1
+	if c.bulk {
+		per = snmpBulkRepetitions
+		if c.agent.MaxRepetitions > 0 {
+			per = int(c.agent.MaxRepetitions)
+		}
+	}
+	count := 0
+	f := func(v gosnmp.SnmpPDU) error {
+		count++
+		if count%per == 0 {
+			c.node.wait()
+		}
+		return walkFn(v)
+	}
+	c.node.wait()
+	if c.bulk {
+		return c.agent.BulkWalk(rootOid, f)
+	}
+	return c.agent.Walk(rootOid, f)
+}
+
+// getSnmpBatchOIDs : まとめて取得できるポーリングのOID 空はまとめて取得できない
+func getSnmpBatchOIDs(pe *datastore.PollingEnt) []string {
+	oids := []string{}
+	switch pe.Mode {
+	case "sysUpTime":
+		oids = append(oids, datastore.MIBDB.NameToOID("sysUpTime.0"))
+	case "hrSystemDate":
+		oids = append(oids, datastore.MIBDB.NameToOID("hrSystemDate.0"))
+	case "ifOperStatus":
+		if pe.Params == "" {
+			return nil
+		}
+		oids = append(oids, datastore.MIBDB.NameToOID("ifOperStatus."+pe.Params), datastore.MIBDB.NameToOID("ifAdminStatus."+pe.Params))
+	case "traffic":
+		o, x := getSnmpTrafficOIDs(pe)
+		oids = append(o, x...)
+	case "count", "process", "stats", "script":
+		// Walkやスクリプトは個別に実行する
+		return nil
+	default:
+		oids = getSnmpGetOIDs(pe)
+	}
+	ret := []string{}
+	for _, oid := range oids {
+		if oid != "" {
+			ret = append(ret, oid)
+		}
+	}
+	return ret
+}
+
+// snmpBatch : 同じノードと間隔のポーリングでまとめて取得するOIDと結果
+type snmpBatch struct {
+	oids    []string
+	timeout int
+	retry   int
+	done    chan struct{}
+	vars    map[string]gosnmp.SnmpPDU
+	errs    map[string]error
+}
+
+// snmpBatchGet : 同じノードと間隔のポーリングのOIDをまとめて取得する
+func snmpBatchGet(n *datastore.NodeEnt, pe *datastore.PollingEnt, oids []string) snmpClient {
+	sn := getSnmpNode(n.ID)
+	b := sn.join(pe, oids, func(b *snmpBatch) {
+		b.run(n, sn)
+	})
+	return &snmpBatchResult{batch: b}
+}
+
+// join : 最初のポーリングが待つ間に来た他のポーリングのOIDも一緒に取得する
+func (sn *snmpNode) join(pe *datastore.PollingEnt, oids []string, run func(b *snmpBatch)) *snmpBatch {
+	sn.mu.Lock()
+	b, joined := sn.batches[pe.PollInt]
+	if !joined {
+		b = &snmpBatch{done: make(chan struct{})}
+		sn.batches[pe.PollInt] = b
+	}
+	b.oids = append(b.oids, oids...)
+	b.timeout = max(b.timeout, pe.Timeout)
+	b.retry = max(b.retry, pe.Retry)
+	sn.mu.Unlock()
+	if joined {
+		<-b.done
+		return b
+	}
+	defer close(b.done)
+	time.Sleep(snmpBatchWait)
+	sn.mu.Lock()
+	delete(sn.batches, pe.PollInt)
+	sn.mu.Unlock()
+	run(b)
+	return b
+}
+
+func (b *snmpBatch) run(n *datastore.NodeEnt, sn *snmpNode) {
+	b.vars = make(map[string]gosnmp.SnmpPDU)
+	b.errs = make(map[string]error)
+	oids := uniqSnmpOIDs(b.oids)
+	sem := sn.acquire()
+	defer sn.release(sem)
+	agent := newSnmpAgent(n, b.timeout, b.retry)
+	if err := agent.Connect(); err != nil {
+		b.setError(oids, err)
+		return
+	}
+	defer agent.Conn.Close()
+	c := &snmpLimitedClient{agent: agent, node: sn}
+	chunks := splitSnmpOIDs(oids, gosnmp.MaxOids)
+	for i, chunk := range chunks {
+		if err := b.get(c, chunk); err != nil {
+			// タイムアウトなどは残りも同じ結果になるので送信しない
+			for _, rest := range chunks[i+1:] {
+				b.setError(rest, err)
+			}
+			return
+		}
+	}
+}
+
+// get : 応答が大きすぎる場合は分割して取得する
+func (b *snmpBatch) get(c snmpClient, oids []string) error {
+	r, err := c.Get(oids)
+	if err != nil {
+		b.setError(oids, err)
+		return err
+	}
+	if r.Error == gosnmp.TooBig && len(oids) > 1 {
+		h := len(oids) / 2
+		if err := b.get(c, oids[:h]); err != nil {
+			b.setError(oids[h:], err)
+			return err
+		}
+		return b.get(c, oids[h:])
+	}
+	if r.Error != gosnmp.NoError {
+		return b.getWithoutError(c, oids, r)
+	}
+	for _, v := range r.Variables {
+		b.vars[normSnmpOID(v.Name)] = v
+	}
+	return nil
+}
+
+// getWithoutError : エラーになったOIDを除いて取得し直す
+// エラーの位置が不明な場合は1つずつ取得する
+func (b *snmpBatch) getWithoutError(c snmpClient, oids []string, r *gosnmp.SnmpPacket) error {
+	err := fmt.Errorf("snmp error=%v", r.Error)
+	if len(oids) < 2 {
+		b.setError(oids, err)
+		return nil
+	}
+	i := int(r.ErrorIndex)
+	if i < 1 || i > len(oids) {
+		for j, oid := range oids {
+			if err := b.get(c, []string{oid}); err != nil {
+				b.setError(oids[j+1:], err)
+				return err
+			}
+		}
+		return nil
+	}
+	b.setError(oids[i-1:i], err)
+	rest := append(append([]string{}, oids[:i-1]...), oids[i:]...)
+	return b.get(c, rest)
+}
+
+func (b *snmpBatch) setError(oids []string, err error) {
+	for _, oid := range oids {
+		b.errs[normSnmpOID(oid)] = err
+	}
+}
+
+// snmpBatchResult : まとめて取得した結果からポーリングのOIDの値を返す
+type snmpBatchResult struct {
+	batch *snmpBatch
+}
+
+func (r *snmpBatchResult) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	p := &gosnmp.SnmpPacket{}
+	for _, oid := range oids {
+		k := normSnmpOID(oid)
+		if err, ok := r.batch.errs[k]; ok {
+			return nil, err
+		}
+		v, ok := r.batch.vars[k]
+		if !ok {
+			return nil, fmt.Errorf("no response oid=%s", oid)
+		}
+		p.Variables = append(p.Variables, v)
+	}
+	return p, nil
+}
+
+func (r *snmpBatchResult) Walk(rootOid string, walkFn gosnmp.WalkFunc) error {
+	return fmt.Errorf("walk not supported in batch")
+}
+
+// normSnmpOID : 応答のOIDと比較できる形式にする
+func normSnmpOID(oid string) string {
+	return "." + strings.TrimPrefix(strings.TrimSpace(oid), ".")
+}
+
+func uniqSnmpOIDs(oids []string) []string {
+	m := make(map[string]bool)
+	ret := []string{}
+	for _, oid := range oids {
+		k := normSnmpOID(oid)
+		if m[k] {
+			continue
+		}
+		m[k] = true
+		ret = append(ret, k)
+	}
+	return ret
+}
+
+// splitSnmpOIDs : 1回のリクエストで取得できる数に分割する
+func splitSnmpOIDs(oids []string, size int) [][]string {
+	ret := [][]string{}
+	for len(oids) > size {
+		ret = append(ret, oids[:size])
+		oids = oids[size:]
+	}
+	if len(oids) > 0 {
+		ret = append(ret, oids)
+	}
+	return ret
+}
@@ -0,0 +1,173 @@
+package polling
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	gosnmp "github.com/gosnmp/gosnmp"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// testSnmpClient : 指定した数より多いOIDはtooBigを返す
+// .1.3.6.1.9.8はエラーの位置付きのnoSuchName、.1.3.6.1.9.7は位置なしのgenErrを返す
+type testSnmpClient struct {
+	maxOids  int
+	requests int
+}
+
+func (c *testSnmpClient) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	c.requests++
+	p := &gosnmp.SnmpPacket{}
+	if len(oids) > c.maxOids {
+		p.Error = gosnmp.TooBig
+		return p, nil
+	}
+	for i, oid := range oids {
+		switch oid {
+		case ".1.3.6.1.9.9":
+			return nil, fmt.Errorf("request timeout")
+		case ".1.3.6.1.9.8":
+			return &gosnmp.SnmpPacket{Error: gosnmp.NoSuchName, ErrorIndex: uint8(i + 1)}, nil
+		case ".1.3.6.1.9.7":
+			return &gosnmp.SnmpPacket{Error: gosnmp.GenErr}, nil
+		}
+		p.Variables = append(p.Variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.Counter32, Value: uint(len(oid))})
+	}
+	return p, nil
+}
+
+func (c *testSnmpClient) Walk(rootOid string, walkFn gosnmp.WalkFunc) error {
+	return nil
+}
+
+func TestSnmpBatch(t *testing.T) {
+	oids := []string{}
+	for i := 0; i < 130; i++ {
+		oids = append(oids, fmt.Sprintf("1.3.6.1.2.1.2.2.1.10.%d", i))
+	}
+	// 重複と先頭のドットの有無をまとめる
+	u := uniqSnmpOIDs(append(oids, ".1.3.6.1.2.1.2.2.1.10.0", " 1.3.6.1.2.1.2.2.1.10.1"))
+	if len(u) != 130 || u[0] != ".1.3.6.1.2.1.2.2.1.10.0" {
+		t.Fatalf("uniq len=%d %v", len(u), u[0])
+	}
+	chunks := splitSnmpOIDs(u, gosnmp.MaxOids)
+	if len(chunks) != 3 || len(chunks[2]) != 10 {
+		t.Fatalf("split=%d", len(chunks))
+	}
+	b := &snmpBatch{vars: make(map[string]gosnmp.SnmpPDU), errs: make(map[string]error)}
+	c := &testSnmpClient{maxOids: 16}
+	for _, chunk := range chunks {
+		if err := b.get(c, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(b.vars) != 130 || c.requests < 10 {
+		t.Errorf("tooBig split vars=%d requests=%d", len(b.vars), c.requests)
+	}
+	r := &snmpBatchResult{batch: b}
+	p, err := r.Get([]string{"1.3.6.1.2.1.2.2.1.10.5", ".1.3.6.1.2.1.2.2.1.10.129"})
+	if err != nil || len(p.Variables) != 2 || p.Variables[1].Name != ".1.3.6.1.2.1.2.2.1.10.129" {
+		t.Errorf("batch result err=%v %+v", err, p)
+	}
+	if _, err := r.Get([]string{"1.3.6.1.2.1.1.3.0"}); err == nil {
+		t.Error("no error for missing oid")
+	}
+	if err := b.get(c, []string{".1.3.6.1.9.9"}); err == nil {
+		t.Error("no error for timeout")
+	}
+	if _, err := r.Get([]string{"1.3.6.1.9.9"}); err == nil {
+		t.Error("timeout not returned to polling")
+	}
+	// エラーになったOID以外は取得できる
+	b = &snmpBatch{vars: make(map[string]gosnmp.SnmpPDU), errs: make(map[string]error)}
+	if err := b.get(c, []string{".1.3.6.1.2.1.1.3.0", ".1.3.6.1.9.8", ".1.3.6.1.2.1.1.5.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.get(c, []string{".1.3.6.1.2.1.1.1.0", ".1.3.6.1.9.7"}); err != nil {
+		t.Fatal(err)
+	}
+	r = &snmpBatchResult{batch: b}
+	if _, err := r.Get([]string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.1.1.0"}); err != nil {
+		t.Errorf("error index not removed err=%v", err)
+	}
+	if _, err := r.Get([]string{"1.3.6.1.9.8"}); err == nil {
+		t.Error("no error for noSuchName")
+	}
+	if _, err := r.Get([]string{"1.3.6.1.9.7"}); err == nil {
+		t.Error("no error for genErr")
+	}
+}
+
+func TestSnmpBatchJoin(t *testing.T) {
+	sn := &snmpNode{batches: make(map[int]*snmpBatch)}
+	c := &testSnmpClient{maxOids: gosnmp.MaxOids}
+	runs := 0
+	run := func(b *snmpBatch) {
+		runs++
+		b.vars = make(map[string]gosnmp.SnmpPDU)
+		b.errs = make(map[string]error)
+		if err := b.get(c, uniqSnmpOIDs(b.oids)); err != nil {
+			t.Error(err)
+		}
+	}
+	// 同じノードと間隔の2つのポーリングを1回で取得する
+	var wg sync.WaitGroup
+	res := make([]*snmpBatch, 2)
+	for i, oid := range []string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.5.0"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i > 0 {
+				time.Sleep(snmpBatchWait / 4)
+			}
+			res[i] = sn.join(&datastore.PollingEnt{PollInt: 60, Timeout: i + 1}, []string{oid}, run)
+		}()
+	}
+	wg.Wait()
+	if runs != 1 || c.requests != 1 || res[0] != res[1] || res[0].timeout != 2 {
+		t.Fatalf("batch not joined runs=%d requests=%d", runs, c.requests)
+	}
+	if _, err := (&snmpBatchResult{batch: res[1]}).Get([]string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.5.0"}); err != nil {
+		t.Error(err)
+	}
+	if len(sn.batches) != 0 {
+		t.Error("batch not removed")
+	}
+}
+
+func TestSnmpNodeLimit(t *testing.T) {
+	conc, rate := datastore.MapConf.SnmpMaxConcurrent, datastore.MapConf.SnmpRateLimit
+	t.Cleanup(func() {
+		datastore.MapConf.SnmpMaxConcurrent, datastore.MapConf.SnmpRateLimit = conc, rate
+	})
+	datastore.MapConf.SnmpMaxConcurrent = 1
+	datastore.MapConf.SnmpRateLimit = 20
+	sn := &snmpNode{batches: make(map[int]*snmpBatch)}
+	sem := sn.acquire()
+	acquired := make(chan struct{})
+	go func() {
+		sn.release(sn.acquire())
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("concurrent limit exceeded")
+	case <-time.After(time.Millisecond * 100):
+	}
+	sn.release(sem)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after release")
+	}
+	// 1秒間に20回なので4回目は150ms以上待つ
+	st := time.Now()
+	for range 4 {
+		sn.wait()
+	}
+	if d := time.Since(st); d < time.Millisecond*140 {
+		t.Errorf("rate limit not applied %v", d)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 )
@@ -79,7 +78,7 @@ func doPollingSnmpTrapCount(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("interval", pe.PollInt)
@@ -88,7 +87,7 @@ func doPollingSnmpTrapCount(pe *datastore.PollingEnt) {
 		setPollingError("trap", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -138,7 +137,7 @@ func doPollingSnmpTrapCheck(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	failed := false
 	var lastError error
@@ -174,7 +173,7 @@ func doPollingSnmpTrapCheck(pe *datastore.PollingEnt) {
 		if script != "" {
 			value, err := vm.Run(script)
 			if err == nil {
-				if ok, _ := value.ToBoolean(); !ok {
+				if !value.ToBoolean() {
 					failed = true
 					return false
 				}
@@ -254,7 +253,7 @@ func doPollingSnmpTrapStats(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -265,7 +264,7 @@ func doPollingSnmpTrapStats(pe *datastore.PollingEnt) {
 		setPollingError("trap", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -10,7 +10,7 @@ import (
 	"time"
 
 	"github.com/PaesslerAG/jsonpath"
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vjeantet/grok"
 	"golang.org/x/crypto/ssh"
@@ -24,7 +24,7 @@ func doPollingSSH(pe *datastore.PollingEnt) {
 	if pe.Mode != "" {
 		port = pe.Mode
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	cl := strings.Split(cmd, " ")
 	if len(cl) < 1 {
@@ -59,11 +59,8 @@ func doPollingSSH(pe *datastore.PollingEnt) {
 		setPollingError("ssh", pe, fmt.Errorf("goquery not supported"))
 		return
 	} else if extractor == "getBody" {
-		vm.Set("getBody", func(call otto.FunctionCall) otto.Value {
-			if r, err := otto.ToValue(string(out)); err == nil {
-				return r
-			}
-			return otto.UndefinedValue()
+		vm.Set("getBody", func() string {
+			return string(out)
 		})
 	} else if extractor == "jsonpath" {
 		var res map[string]interface{}
@@ -71,16 +68,14 @@ func doPollingSSH(pe *datastore.PollingEnt) {
 			setPollingError("ssh", pe, err)
 			return
 		}
-		vm.Set("jsonpath", func(call otto.FunctionCall) otto.Value {
-			if call.Argument(0).IsString() {
+		vm.Set("jsonpath", func(call goja.FunctionCall) goja.Value {
+			if isScriptString(call.Argument(0)) {
 				sel := call.Argument(0).String()
 				if v, err := jsonpath.Get(sel, res); err == nil {
-					if ov, err := otto.ToValue(v); err == nil {
-						return ov
-					}
+					return vm.rt.ToValue(v)
 				}
 			}
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		})
 
 	} else if extractor != "" {
@@ -107,7 +102,7 @@ func doPollingSSH(pe *datastore.PollingEnt) {
 		setPollingError("ssh", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 		return
 	}
@@ -119,18 +114,48 @@ func sshConnectToHost(pe *datastore.PollingEnt, port string) (*ssh.Client, *ssh.
 	if n == nil {
 		return nil, nil, fmt.Errorf("node not found nodeID=%s", pe.NodeID)
 	}
-	signer, err := ssh.ParsePrivateKey([]byte(datastore.GetPrivateKey()))
+	return sshConnectToNode(n, port, time.Duration(pe.Timeout)*time.Second, time.Second*time.Duration(pe.PollInt-5))
+}
+
+// RunSSHCommand : ノードにSSHで接続してコマンドを実行する
+func RunSSHCommand(n *datastore.NodeEnt, port, cmd string, timeout time.Duration) (string, int, error) {
+	client, session, err := sshConnectToNode(n, port, timeout, timeout*4)
+	if err != nil {
+		return "", -1, err
+	}
+	defer func() {
+		session.Close()
+		client.Close()
+	}()
+	out, err := session.CombinedOutput(cmd)
+	if err != nil {
+		if e, ok := err.(*ssh.ExitError); ok {
+			return string(out), e.Waitmsg.ExitStatus(), nil
+		}
+		return string(out), -1, err
+	}
+	return string(out), 0, nil
+}
+
+func sshConnectToNode(n *datastore.NodeEnt, port string, timeout, deadline time.Duration) (*ssh.Client, *ssh.Session, error) {
+	cred := datastore.GetNodeCredential(n, "ssh")
+	// プロファイルに鍵がある場合はその鍵、なければTWSNMPの鍵を使う
+	key := cred.PrivateKey
+	if key == "" {
+		key = datastore.GetPrivateKey()
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(key))
 	if err != nil {
 		return nil, nil, fmt.Errorf("no private key for ssh")
 	}
 	sshConfig := &ssh.ClientConfig{
-		User:    n.User,
+		User:    cred.User,
 		Auth:    []ssh.AuthMethod{},
-		Timeout: time.Duration(pe.Timeout) * time.Second,
+		Timeout: timeout,
 	}
 	sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeys(signer))
-	if n.Password != "" {
-		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(n.Password))
+	if cred.Password != "" {
+		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(cred.Password))
 	}
 	if n.PublicKey != "" {
 		pubkey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(n.PublicKey))
@@ -146,11 +171,11 @@ func sshConnectToHost(pe *datastore.PollingEnt, port string) (*ssh.Client, *ssh.
 			}
 		//ssh.InsecureIgnoreHostKey()
 	}
-	conn, err := net.DialTimeout("tcp", n.IP+":"+port, time.Duration(pe.Timeout)*time.Second)
+	conn, err := net.DialTimeout("tcp", n.IP+":"+port, timeout)
 	if err != nil {
 		return nil, nil, err
 	}
-	if err := conn.SetDeadline(time.Now().Add(time.Second * time.Duration(pe.PollInt-5))); err != nil {
+	if err := conn.SetDeadline(time.Now().Add(deadline)); err != nil {
 		return nil, nil, err
 	}
 	c, ch, req, err := ssh.NewClientConn(conn, n.IP+":"+port, sshConfig)
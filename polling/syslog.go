@@ -9,7 +9,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/twsnmp/twsnmpfc/report"
 	"github.com/vjeantet/grok"
@@ -89,7 +88,7 @@ func doPollingSyslogCount(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("interval", pe.PollInt)
@@ -98,7 +97,7 @@ func doPollingSyslogCount(pe *datastore.PollingEnt) {
 		setPollingError("syslog", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -154,7 +153,7 @@ func doPollingSyslogUser(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	count := 0
 	okCount := 0
@@ -221,7 +220,7 @@ func doPollingSyslogUser(pe *datastore.PollingEnt) {
 		setPollingError("log", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -272,7 +271,7 @@ func doPollingSyslogDevice(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	count := 0
 	keys := []string{}
@@ -325,7 +324,7 @@ func doPollingSyslogDevice(pe *datastore.PollingEnt) {
 		setPollingError("log", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -373,7 +372,7 @@ func doPollingSyslogFlow(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	count := 0
 	keys := []string{}
@@ -457,7 +456,7 @@ func doPollingSyslogFlow(pe *datastore.PollingEnt) {
 		setPollingError("syslog", pe, fmt.Errorf("invalid script err=%v", err))
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -504,7 +503,7 @@ func doPollingSyslogCheck(pe *datastore.PollingEnt) {
 		}
 	}
 	et := time.Now().UnixNano()
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	failed := false
 	var lastError error
@@ -540,7 +539,7 @@ func doPollingSyslogCheck(pe *datastore.PollingEnt) {
 		if script != "" {
 			value, err := vm.Run(script)
 			if err == nil {
-				if ok, _ := value.ToBoolean(); !ok {
+				if !value.ToBoolean() {
 					failed = true
 					return false
 				}
@@ -763,7 +762,7 @@ func doPollingSyslogStats(pe *datastore.PollingEnt) {
 		setPollingState(pe, "normal")
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -774,7 +773,7 @@ func doPollingSyslogStats(pe *datastore.PollingEnt) {
 		setPollingError("syslog", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
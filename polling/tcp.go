@@ -223,7 +223,7 @@ func autoAddTCPPolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt) {
 		p.Level = pt.Level
 		p.PollInt = datastore.MapConf.PollInt
 		p.Timeout = datastore.MapConf.Timeout
-		p.Retry = datastore.MapConf.Timeout
+		p.Retry = datastore.MapConf.Retry
 		p.LogMode = 0
 		p.NextTime = 0
 		p.State = "unknown"
@@ -13,7 +13,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/robertkrimen/otto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
@@ -99,7 +98,7 @@ func doPollingTwLogEyeNotify(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	vm.Set("count", count)
 	vm.Set("interval", pe.PollInt)
@@ -108,7 +107,7 @@ func doPollingTwLogEyeNotify(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -155,7 +154,7 @@ func doPollingTwLogEyeSyslogReport(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -166,7 +165,7 @@ func doPollingTwLogEyeSyslogReport(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -210,7 +209,7 @@ func doPollingTwLogEyeSnmpTrapReport(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -221,7 +220,7 @@ func doPollingTwLogEyeSnmpTrapReport(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -270,7 +269,7 @@ func doPollingTwLogEyeNetflowReport(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -281,7 +280,7 @@ func doPollingTwLogEyeNetflowReport(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -328,7 +327,7 @@ func doPollingTwLogEyeWindowsEventReport(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -339,7 +338,7 @@ func doPollingTwLogEyeWindowsEventReport(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -384,7 +383,7 @@ func doPollingTwLogEyeAnomalyReport(pe *datastore.PollingEnt) bool {
 		setPollingState(pe, "normal")
 		return true
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range pe.Result {
 		vm.Set(k, v)
@@ -395,7 +394,7 @@ func doPollingTwLogEyeAnomalyReport(pe *datastore.PollingEnt) bool {
 		setPollingError("twlogeye", pe, err)
 		return false
 	}
-	if ok, _ := value.ToBoolean(); ok {
+	if value.ToBoolean() {
 		setPollingState(pe, "normal")
 	} else {
 		setPollingState(pe, pe.Level)
@@ -89,7 +89,7 @@ func doTWSNMPGet(n *datastore.NodeEnt, pe *datastore.PollingEnt) (string, error)
 	if err != nil {
 		return "", err
 	}
-	req.SetBasicAuth(n.User, n.Password)
+	setHTTPCredential(req, datastore.GetNodeCredential(n, "http"))
 	resp, err := insecureClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return "", err
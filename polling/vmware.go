@@ -10,8 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robertkrimen/otto"
-
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/view"
@@ -31,9 +29,10 @@ func doPollingVMWare(pe *datastore.PollingEnt) {
 		target = pe.Params
 	}
 	script := pe.Script
+	cred := datastore.GetNodeCredential(n, "vmware")
 	us := n.URL
 	if us == "" {
-		us = fmt.Sprintf("https://%s:%s@%s/sdk", n.User, n.Password, n.IP)
+		us = fmt.Sprintf("https://%s:%s@%s/sdk", cred.User, cred.Password, n.IP)
 	}
 	if !strings.Contains(us, "/sdk") {
 		us += "/sdk"
@@ -44,7 +43,7 @@ func doPollingVMWare(pe *datastore.PollingEnt) {
 		return
 	}
 	if u.User == nil || u.User.String() == ":" {
-		u.User = url.UserPassword(n.User, n.Password)
+		u.User = url.UserPassword(cred.User, cred.Password)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(pe.Timeout)*time.Second)
 	defer cancel()
@@ -66,7 +65,7 @@ func doPollingVMWare(pe *datastore.PollingEnt) {
 		setPollingError("vmware", pe, err)
 		return
 	}
-	vm := otto.New()
+	vm := newScriptVM(pe.ID)
 	setVMFuncAndValues(pe, vm)
 	for k, v := range rMap {
 		vm.Set(k, v)
@@ -77,7 +76,7 @@ func doPollingVMWare(pe *datastore.PollingEnt) {
 		setPollingError("vmware", pe, err)
 		return
 	}
-	if ok, _ := value.ToBoolean(); !ok {
+	if !value.ToBoolean() {
 		setPollingState(pe, pe.Level)
 		return
 	}
@@ -227,7 +226,7 @@ func autoAddVMwarePolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt
 		p.Level = pt.Level
 		p.PollInt = datastore.MapConf.PollInt
 		p.Timeout = datastore.MapConf.Timeout
-		p.Retry = datastore.MapConf.Timeout
+		p.Retry = datastore.MapConf.Retry
 		p.LogMode = 0
 		p.NextTime = 0
 		p.State = "unknown"
@@ -239,9 +238,10 @@ func autoAddVMwarePolling(n *datastore.NodeEnt, pt *datastore.PollingTemplateEnt
 
 func getVMWareIndex(n *datastore.NodeEnt, mode string) []vmwareIndexEnt {
 	ret := []vmwareIndexEnt{}
+	cred := datastore.GetNodeCredential(n, "vmware")
 	us := n.URL
 	if us == "" {
-		us = fmt.Sprintf("https://%s:%s@%s/sdk", n.User, n.Password, n.IP)
+		us = fmt.Sprintf("https://%s:%s@%s/sdk", cred.User, cred.Password, n.IP)
 	}
 	if !strings.Contains(us, "/sdk") {
 		us += "/sdk"
@@ -252,7 +252,7 @@ func getVMWareIndex(n *datastore.NodeEnt, mode string) []vmwareIndexEnt {
 		return ret
 	}
 	if u.User == nil || u.User.String() == ":" {
-		u.User = url.UserPassword(n.User, n.Password)
+		u.User = url.UserPassword(cred.User, cred.Password)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(datastore.MapConf.Timeout)*time.Second)
 	defer cancel()
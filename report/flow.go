@@ -235,6 +235,7 @@ func cleanupUDPPending() {
 }
 
 func checkFlowReport(fr *flowReportEnt) {
+	checkThreatFlow(fr.SrcIP, fr.DstIP)
 	if checkFumble(fr) {
 		return
 	}
@@ -277,6 +278,12 @@ func checkFlowReport(fr *flowReportEnt) {
 		if f.ClientLoc == "" {
 			f.ClientLoc = datastore.GetLoc(f.Client)
 		}
+		if f.ServerASN == 0 {
+			f.ServerASN, f.ServerASOrg = datastore.GetASN(f.Server)
+		}
+		if f.ClientASN == 0 {
+			f.ClientASN, f.ClientASOrg = datastore.GetASN(f.Client)
+		}
 		f.Bytes += fr.Bytes
 		f.Count++
 		f.LastTime = fr.Time
@@ -296,6 +303,8 @@ func checkFlowReport(fr *flowReportEnt) {
 		LastTime:   fr.Time,
 		UpdateTime: now,
 	}
+	f.ClientASN, f.ClientASOrg = datastore.GetASN(client)
+	f.ServerASN, f.ServerASOrg = datastore.GetASN(server)
 	f.ClientName, f.ClientNodeID = findNodeInfoFromIP(client)
 	f.ServerName, f.ServerNodeID = findNodeInfoFromIP(server)
 	f.Services[service] = 1
@@ -370,6 +379,9 @@ func checkServerReport(server, service string, bytes, t int64) {
 		s.LastTime = t
 		s.UpdateTime = now
 		s.ServerName, s.ServerNodeID = findNodeInfoFromIP(server)
+		if s.ASN == 0 {
+			s.ASN, s.ASOrg = datastore.GetASN(server)
+		}
 		return
 	}
 	s = &datastore.ServerEnt{
@@ -383,6 +395,7 @@ func checkServerReport(server, service string, bytes, t int64) {
 		LastTime:   t,
 		UpdateTime: now,
 	}
+	s.ASN, s.ASOrg = datastore.GetASN(server)
 	s.ServerName, s.ServerNodeID = findNodeInfoFromIP(server)
 	s.Services[service] = 1
 	setServerPenalty(s)
@@ -394,6 +407,10 @@ func setFlowPenalty(f *datastore.FlowEnt) {
 	if !isSafeCountry(f.ServerLoc) {
 		f.Penalty++
 	}
+	// 禁止のAS
+	if !isSafeASN(f.ServerASN) {
+		f.Penalty++
+	}
 	for sv := range f.Services {
 		if !isSafeService(sv, f.Server) {
 			f.Penalty++
@@ -410,6 +427,10 @@ func setServerPenalty(s *datastore.ServerEnt) {
 	if !isSafeCountry(s.Loc) {
 		s.Penalty++
 	}
+	// 禁止のAS
+	if !isSafeASN(s.ASN) {
+		s.Penalty++
+	}
 	for sv := range s.Services {
 		if !isSafeService(sv, s.Server) {
 			s.Penalty++
@@ -0,0 +1,328 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// FlowStatsEnt : 上位N件の集計に使うフローの情報
+type FlowStatsEnt struct {
+	Exporter string
+	SrcIP    string
+	SrcPort  int
+	DstIP    string
+	DstPort  int
+	Prot     int
+	SrcAS    int
+	DstAS    int
+	InIf     int
+	OutIf    int
+	Packets  int64
+	Bytes    int64
+}
+
+type flowTopNCounter struct {
+	bytes   int64
+	packets int64
+	flows   int64
+}
+
+type flowTopNAcc struct {
+	total   flowTopNCounter
+	in      int64
+	out     int64
+	src     map[string]*flowTopNCounter
+	dst     map[string]*flowTopNCounter
+	service map[string]*flowTopNCounter
+	as      map[string]*flowTopNCounter
+	ifs     map[string]*flowTopNCounter
+}
+
+type flowTopNSlot struct {
+	time  int64
+	hour  bool
+	stats map[string]*flowTopNAcc
+}
+
+var flowTopNMu sync.Mutex
+var flowTopNMinute *flowTopNSlot
+var flowTopNHour *flowTopNSlot
+
+// 集計中に保持する項目の数の上限、超えたら上位の項目だけ残す
+const flowTopNMaxKeys = 2000
+const flowTopNKeepKeys = 500
+
+// ReportFlowStats : フローを1分と1時間ごとの集計に加える
+func ReportFlowStats(f *FlowStatsEnt) {
+	now := time.Now()
+	if f.SrcAS == 0 {
+		asn, _ := datastore.GetASN(f.SrcIP)
+		f.SrcAS = int(asn)
+	}
+	if f.DstAS == 0 {
+		asn, _ := datastore.GetASN(f.DstIP)
+		f.DstAS = int(asn)
+	}
+	flowTopNMu.Lock()
+	done := rotateFlowTopN(now)
+	flowTopNMinute.add(f)
+	flowTopNHour.add(f)
+	flowTopNMu.Unlock()
+	saveFlowTopNSlots(done)
+}
+
+// checkFlowTopN : 期間が終わった集計を保存する
+func checkFlowTopN() {
+	flowTopNMu.Lock()
+	done := rotateFlowTopN(time.Now())
+	flowTopNMu.Unlock()
+	saveFlowTopNSlots(done)
+}
+
+// rotateFlowTopN : 期間が終わった集計を新しい集計に入れ替えて返す
+// 保存はロックの外で行う
+func rotateFlowTopN(now time.Time) []*flowTopNSlot {
+	done := []*flowTopNSlot{}
+	mt := now.Truncate(time.Minute).UnixNano()
+	ht := now.Truncate(time.Hour).UnixNano()
+	if flowTopNMinute == nil || flowTopNMinute.time != mt {
+		if flowTopNMinute != nil {
+			done = append(done, flowTopNMinute)
+		}
+		flowTopNMinute = newFlowTopNSlot(mt, false)
+	}
+	if flowTopNHour == nil || flowTopNHour.time != ht {
+		if flowTopNHour != nil {
+			done = append(done, flowTopNHour)
+		}
+		flowTopNHour = newFlowTopNSlot(ht, true)
+	}
+	return done
+}
+
+func saveFlowTopNSlots(list []*flowTopNSlot) {
+	for _, s := range list {
+		s.save()
+		if s.hour {
+			go datastore.DeleteOldFlowTopN()
+		}
+	}
+}
+
+func newFlowTopNSlot(t int64, hour bool) *flowTopNSlot {
+	return &flowTopNSlot{
+		time:  t,
+		hour:  hour,
+		stats: make(map[string]*flowTopNAcc),
+	}
+}
+
+func newFlowTopNAcc() *flowTopNAcc {
+	return &flowTopNAcc{
+		src:     make(map[string]*flowTopNCounter),
+		dst:     make(map[string]*flowTopNCounter),
+		service: make(map[string]*flowTopNCounter),
+		as:      make(map[string]*flowTopNCounter),
+		ifs:     make(map[string]*flowTopNCounter),
+	}
+}
+
+func (s *flowTopNSlot) add(f *FlowStatsEnt) {
+	ifs := []string{}
+	if f.Exporter != "" {
+		if f.InIf > 0 {
+			ifs = append(ifs, fmt.Sprintf("%s:%d", f.Exporter, f.InIf))
+		}
+		if f.OutIf > 0 && f.OutIf != f.InIf {
+			ifs = append(ifs, fmt.Sprintf("%s:%d", f.Exporter, f.OutIf))
+		}
+	}
+	all := s.get("")
+	all.add(f)
+	for j, i := range ifs {
+		countFlowTopN(all.ifs, i, f)
+		a := s.get(i)
+		a.add(f)
+		if j == 0 && f.InIf > 0 {
+			a.in += f.Bytes
+		} else {
+			a.out += f.Bytes
+		}
+	}
+}
+
+func (s *flowTopNSlot) get(iface string) *flowTopNAcc {
+	a, ok := s.stats[iface]
+	if !ok {
+		a = newFlowTopNAcc()
+		s.stats[iface] = a
+	}
+	return a
+}
+
+func (a *flowTopNAcc) add(f *FlowStatsEnt) {
+	a.total.bytes += f.Bytes
+	a.total.packets += f.Packets
+	a.total.flows++
+	countFlowTopN(a.src, f.SrcIP, f)
+	countFlowTopN(a.dst, f.DstIP, f)
+	countFlowTopN(a.service, getFlowTopNService(f), f)
+	if f.SrcAS > 0 {
+		countFlowTopN(a.as, fmt.Sprintf("AS%d", f.SrcAS), f)
+	}
+	if f.DstAS > 0 && f.DstAS != f.SrcAS {
+		countFlowTopN(a.as, fmt.Sprintf("AS%d", f.DstAS), f)
+	}
+}
+
+func countFlowTopN(m map[string]*flowTopNCounter, k string, f *FlowStatsEnt) {
+	if k == "" {
+		return
+	}
+	c, ok := m[k]
+	if !ok {
+		c = &flowTopNCounter{}
+		m[k] = c
+	}
+	c.bytes += f.Bytes
+	c.packets += f.Packets
+	c.flows++
+	if len(m) > flowTopNMaxKeys {
+		trimFlowTopN(m, flowTopNKeepKeys)
+	}
+}
+
+// trimFlowTopN : 通信量の多い項目だけ残す
+func trimFlowTopN(m map[string]*flowTopNCounter, keep int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return m[keys[i]].bytes > m[keys[j]].bytes
+	})
+	for _, k := range keys[keep:] {
+		delete(m, k)
+	}
+}
+
+// getFlowTopNService : サービスはプロトコルとポート番号の小さい方(ウェルノウンポート)
+func getFlowTopNService(f *FlowStatsEnt) string {
+	switch f.Prot {
+	case 1:
+		return "icmp"
+	case 6, 17:
+		p := "tcp"
+		if f.Prot == 17 {
+			p = "udp"
+		}
+		port := f.DstPort
+		if f.SrcPort > 0 && f.SrcPort < port {
+			port = f.SrcPort
+		}
+		return fmt.Sprintf("%s/%d", p, port)
+	}
+	return fmt.Sprintf("prot/%d", f.Prot)
+}
+
+func flowTopNItems(m map[string]*flowTopNCounter) []*datastore.FlowTopNItem {
+	r := make([]*datastore.FlowTopNItem, 0, len(m))
+	for k, c := range m {
+		r = append(r, &datastore.FlowTopNItem{Key: k, Bytes: c.bytes, Packets: c.packets, Flows: c.flows})
+	}
+	datastore.SortFlowTopNItems(r)
+	if len(r) > datastore.FlowTopNSize {
+		r = r[:datastore.FlowTopNSize]
+	}
+	return r
+}
+
+func (s *flowTopNSlot) toEnt() *datastore.FlowTopNEnt {
+	e := &datastore.FlowTopNEnt{
+		Time:  s.time,
+		Hour:  s.hour,
+		Stats: make(map[string]*datastore.FlowTopNStats),
+	}
+	for k, a := range s.stats {
+		st := &datastore.FlowTopNStats{
+			Bytes:    a.total.bytes,
+			Packets:  a.total.packets,
+			Flows:    a.total.flows,
+			InBytes:  a.in,
+			OutBytes: a.out,
+			Src:      flowTopNItems(a.src),
+			Dst:      flowTopNItems(a.dst),
+			Service:  flowTopNItems(a.service),
+			AS:       flowTopNItems(a.as),
+		}
+		if k == "" {
+			st.If = flowTopNItems(a.ifs)
+		}
+		e.Stats[k] = st
+	}
+	return e
+}
+
+func (s *flowTopNSlot) save() {
+	if len(s.stats) < 1 {
+		return
+	}
+	if s.hour {
+		// 再起動前に保存した同じ時間の集計を加える
+		datastore.ForEachFlowTopN(true, s.time, s.time+1, func(e *datastore.FlowTopNEnt) bool {
+			s.merge(e)
+			return false
+		})
+	}
+	if err := datastore.SaveFlowTopN(s.toEnt()); err != nil {
+		log.Printf("save flow topN err=%v", err)
+	}
+}
+
+func (s *flowTopNSlot) merge(e *datastore.FlowTopNEnt) {
+	for k, st := range e.Stats {
+		a := s.get(k)
+		a.total.bytes += st.Bytes
+		a.total.packets += st.Packets
+		a.total.flows += st.Flows
+		a.in += st.InBytes
+		a.out += st.OutBytes
+		for _, l := range []struct {
+			m     map[string]*flowTopNCounter
+			items []*datastore.FlowTopNItem
+		}{{a.src, st.Src}, {a.dst, st.Dst}, {a.service, st.Service}, {a.as, st.AS}, {a.ifs, st.If}} {
+			for _, i := range l.items {
+				c, ok := l.m[i.Key]
+				if !ok {
+					c = &flowTopNCounter{}
+					l.m[i.Key] = c
+				}
+				c.bytes += i.Bytes
+				c.packets += i.Packets
+				c.flows += i.Flows
+			}
+		}
+	}
+}
+
+// saveFlowTopN : 停止時に集計途中のデータを保存する
+func saveFlowTopN() {
+	flowTopNMu.Lock()
+	list := []*flowTopNSlot{}
+	for _, s := range []*flowTopNSlot{flowTopNMinute, flowTopNHour} {
+		if s != nil {
+			list = append(list, s)
+		}
+	}
+	flowTopNMinute = nil
+	flowTopNHour = nil
+	flowTopNMu.Unlock()
+	for _, s := range list {
+		s.save()
+	}
+}
@@ -54,6 +54,9 @@ func checkIPReport(ip, mac string, t int64) {
 			}
 			setIPReportPenalty(i)
 		}
+		if i.ASN == 0 {
+			i.ASN, i.ASOrg = datastore.GetASN(ip)
+		}
 		i.Count++
 		i.LastTime = t
 		i.UpdateTime = time.Now().UnixNano()
@@ -70,6 +73,7 @@ func checkIPReport(ip, mac string, t int64) {
 		LastTime:   t,
 		UpdateTime: time.Now().UnixNano(),
 	}
+	i.ASN, i.ASOrg = datastore.GetASN(ip)
 	i.Name, i.NodeID = findNodeInfoFromIP(ip)
 	if i.Name == i.IP {
 		if n := datastore.FindNodeFromMAC(mac); n != nil {
@@ -95,6 +99,10 @@ func setIPReportPenalty(i *datastore.IPReportEnt) {
 	if !isSafeCountry(i.Loc) {
 		i.Penalty++
 	}
+	// 禁止のAS
+	if !isSafeASN(i.ASN) {
+		i.Penalty++
+	}
 	if i.MAC == "" {
 		return
 	}
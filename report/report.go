@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -33,6 +34,7 @@ var (
 	allowLDAP      map[string]bool
 	allowLocalIP   *regexp.Regexp
 	dennyCountries map[string]int64
+	dennyASNs      map[uint]int64
 	dennyServices  map[string]int64
 	japanOnly      bool
 )
@@ -64,6 +66,16 @@ func UpdateReportConf() {
 			dennyCountries[c] = 0
 		}
 	}
+	dennyASNs = nil
+	for _, a := range datastore.ReportConf.DenyASNs {
+		a = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(a)), "AS")
+		if n, err := strconv.ParseUint(a, 10, 32); err == nil {
+			if dennyASNs == nil {
+				dennyASNs = make(map[uint]int64)
+			}
+			dennyASNs[uint(n)] = 0
+		}
+	}
 	if len(datastore.ReportConf.DenyServices) < 1 {
 		dennyServices = nil
 	} else {
@@ -152,6 +164,7 @@ func reportBackend(ctx context.Context, wg *sync.WaitGroup) {
 				timer5Min.Stop()
 				timer1Min.Stop()
 				datastore.SaveReport(last)
+				saveFlowTopN()
 				log.Printf("stop report")
 				return
 			}
@@ -173,6 +186,8 @@ func reportBackend(ctx context.Context, wg *sync.WaitGroup) {
 			}
 		case <-timer1Min.C:
 			saveSdrPowerReport()
+			checkFlowTopN()
+			checkThreatFeeds()
 		case dr := <-deviceReportCh:
 			checkDeviceReport(dr)
 		case ur := <-userReportCh:
@@ -362,6 +377,17 @@ func isSafeCountry(loc string) bool {
 	return true
 }
 
+func isSafeASN(asn uint) bool {
+	if asn == 0 || dennyASNs == nil {
+		return true
+	}
+	if _, ok := dennyASNs[asn]; ok {
+		dennyASNs[asn]++
+		return false
+	}
+	return true
+}
+
 func isSafeService(s, ip string) bool {
 	if s == "" {
 		return true
@@ -508,6 +534,17 @@ func getIPInfo(ip, dnsbl, noCache string) *[]AddrInfoEnt {
 	} else {
 		ret = append(ret, AddrInfoEnt{Level: "info", Title: "位置", Value: loc})
 	}
+	if asn, org := datastore.GetASN(ip); asn > 0 {
+		v := fmt.Sprintf("AS%d %s", asn, org)
+		if !isSafeASN(asn) {
+			ret = append(ret, AddrInfoEnt{Level: "high", Title: "AS", Value: v})
+		} else {
+			ret = append(ret, AddrInfoEnt{Level: "info", Title: "AS", Value: v})
+		}
+	}
+	if feeds := datastore.MatchThreatIP(ip); len(feeds) > 0 {
+		ret = append(ret, AddrInfoEnt{Level: "high", Title: "脅威情報", Value: strings.Join(feeds, ",")})
+	}
 	if strings.Contains(loc, "LOCAL,") {
 		ipInfoCacheMap[ip] = &ipInfoCache{
 			Time:   time.Now().Unix(),
@@ -637,6 +674,9 @@ func getDomainInfo(domain, noCache string) *[]AddrInfoEnt {
 	}
 	ret := []AddrInfoEnt{}
 	ret = append(ret, AddrInfoEnt{Level: "info", Title: "ドメイン", Value: domain})
+	if feeds := datastore.MatchThreatDomain(domain); len(feeds) > 0 {
+		ret = append(ret, AddrInfoEnt{Level: "high", Title: "脅威情報", Value: strings.Join(feeds, ",")})
+	}
 	r := &net.Resolver{}
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*3000)
 	defer cancel()
@@ -0,0 +1,145 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+// 同じ指標のイベントを抑止する時間
+const threatEventInterval = time.Hour
+
+var threatEventMap sync.Map
+var threatLoading sync.Map
+
+// checkThreatFeeds : 更新時刻になった脅威情報フィードを読み込む
+func checkThreatFeeds() {
+	now := time.Now()
+	for _, f := range datastore.GetThreatFeeds() {
+		if f.Disabled {
+			continue
+		}
+		if f.LastUpdate > 0 && now.Sub(time.Unix(0, f.LastUpdate)) < time.Duration(f.Interval)*time.Minute {
+			continue
+		}
+		go LoadThreatFeed(f.ID)
+	}
+	threatEventMap.Range(func(k, v any) bool {
+		if now.Sub(v.(time.Time)) > threatEventInterval {
+			threatEventMap.Delete(k)
+		}
+		return true
+	})
+}
+
+// LoadThreatFeed : 脅威情報フィードをURLまたはファイルから読み込む
+func LoadThreatFeed(id string) error {
+	f := datastore.GetThreatFeed(id)
+	if f == nil {
+		return datastore.ErrInvalidID
+	}
+	if _, loading := threatLoading.LoadOrStore(id, true); loading {
+		return nil
+	}
+	defer threatLoading.Delete(id)
+	data, err := readThreatFeed(f.Source)
+	if err != nil {
+		log.Printf("load threat feed name=%s err=%v", f.Name, err)
+		datastore.SetThreatFeedError(id, err)
+		return err
+	}
+	_, err = datastore.SetThreatFeedData(id, data)
+	return err
+}
+
+// readThreatFeed : URLまたはThreatFeedDirのファイルから読み込む
+func readThreatFeed(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		dir := datastore.ThreatFeedDir()
+		p := filepath.Join(dir, filepath.Base(src))
+		if !filepath.IsLocal(src) || filepath.Clean(src) != filepath.Base(src) {
+			return nil, fmt.Errorf("threat feed file must be in %s", dir)
+		}
+		return os.ReadFile(p)
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status=%s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1024*1024*100))
+}
+
+// reportThreatMatch : 脅威情報に一致した時にイベントを記録する
+func reportThreatMatch(kind, value, host string, feeds []string) {
+	if len(feeds) < 1 {
+		return
+	}
+	k := kind + ":" + value + ":" + host
+	if _, ok := threatEventMap.LoadOrStore(k, time.Now()); ok {
+		return
+	}
+	l := &datastore.EventLogEnt{
+		Type:  "threat",
+		Level: "high",
+		Event: fmt.Sprintf("脅威情報(%s)に一致しました %s=%s", strings.Join(feeds, ","), kind, value),
+	}
+	if host != "" {
+		l.Event += " ホスト=" + host
+		if n := datastore.FindNodeFromIP(host); n != nil {
+			l.NodeID = n.ID
+			l.NodeName = n.Name
+		}
+	}
+	datastore.AddEventLog(l)
+	notify.SendNotifyChat(l)
+}
+
+// checkThreatFlow : フローの送信元、宛先を脅威情報と照合する
+func checkThreatFlow(src, dst string) {
+	if !datastore.HasThreatIndicators() {
+		return
+	}
+	if datastore.IsGlobalUnicast(dst) {
+		reportThreatMatch("IP", dst, src, datastore.MatchThreatIP(dst))
+	}
+	if datastore.IsGlobalUnicast(src) {
+		reportThreatMatch("IP", src, dst, datastore.MatchThreatIP(src))
+	}
+}
+
+// checkThreatDomain : DNSの問い合わせやTLSのSNIを脅威情報と照合する
+func checkThreatDomain(kind, domain, client string) {
+	if domain == "" || !datastore.HasThreatIndicators() {
+		return
+	}
+	reportThreatMatch(kind, domain, client, datastore.MatchThreatDomain(domain))
+}
+
+// CheckThreatSyslog : syslogの内容を脅威情報と照合する
+func CheckThreatSyslog(sl map[string]interface{}) {
+	if !datastore.HasThreatIndicators() {
+		return
+	}
+	c, ok := sl["content"].(string)
+	if !ok {
+		return
+	}
+	if v, feeds := datastore.FindThreatIndicator(c); len(feeds) > 0 {
+		h, _ := sl["hostname"].(string)
+		reportThreatMatch("syslog", v, h, feeds)
+	}
+}
@@ -0,0 +1,39 @@
+package report
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func TestThreatSNI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	td, err := os.MkdirTemp("", "twsnmpfc_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	datastore.Init(ctx, td, http.Dir("../"), &sync.WaitGroup{})
+	defer datastore.CloseDB()
+	f := &datastore.ThreatFeedEnt{Name: "test", Source: "test.txt"}
+	if err := datastore.UpdateThreatFeed(f); err != nil {
+		t.Fatal(err)
+	}
+	defer datastore.DeleteThreatFeed(f.ID)
+	if _, err := datastore.SetThreatFeedData(f.ID, []byte("evil.example.com\n")); err != nil {
+		t.Fatal(err)
+	}
+	checkTLSFlowReport(map[string]string{"sv": "203.0.113.1", "cl": "192.168.1.10", "serv": "HTTPS", "sni": "www.evil.example.com"})
+	if _, ok := threatEventMap.Load("SNI:www.evil.example.com:192.168.1.10"); !ok {
+		t.Error("tls sni not matched")
+	}
+	checkTLSFlowReport(map[string]string{"sv": "203.0.113.2", "cl": "192.168.1.10", "serv": "HTTPS", "sni": "www.example.com"})
+	if _, ok := threatEventMap.Load("SNI:www.example.com:192.168.1.10"); ok {
+		t.Error("tls sni matched safe domain")
+	}
+}
@@ -153,6 +153,7 @@ func checkDNSReport(h string, twpcap map[string]string) {
 	if !ok {
 		return
 	}
+	checkThreatDomain("DNS", n, twpcap["lcl"])
 	id := makeID(h + ":" + sv + ":" + t + ":" + n)
 	e := datastore.GetDNSQ(id)
 	if e != nil {
@@ -274,6 +275,8 @@ func checkTLSFlowReport(twpcap map[string]string) {
 	if service == "HTTPS" {
 		checkHTTPSServer(sv, twpcap)
 	}
+	// twpcapがClient HelloのSNIをsni=で送信した場合に照合する
+	checkThreatDomain("SNI", twpcap["sni"], cl)
 	id := cl + ":" + sv + ":" + service
 	f := datastore.GetTLSFlow(id)
 	if f != nil {
@@ -0,0 +1,73 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// SecretPrefix : 暗号化した秘密情報の接頭辞
+const SecretPrefix = "enc:v1:"
+
+// DeriveSecretKey : マスターパスワードから秘密情報の暗号化キーを生成する
+func DeriveSecretKey(password string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, password, salt, 100000, 32)
+}
+
+// IsEncryptedSecret : 暗号化済みの文字列か判定する
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, SecretPrefix)
+}
+
+// EncryptSecret : AES-GCMで秘密情報を暗号化する
+func EncryptSecret(key []byte, s string) (string, error) {
+	if s == "" || IsEncryptedSecret(s) {
+		return s, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	b := gcm.Seal(nonce, nonce, []byte(s), nil)
+	return SecretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// DecryptSecret : EncryptSecretで暗号化した秘密情報を復号する
+func DecryptSecret(key []byte, s string) (string, error) {
+	if !IsEncryptedSecret(s) {
+		return s, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, SecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid secret")
+	}
+	p, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(p), nil
+}
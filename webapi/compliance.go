@@ -0,0 +1,63 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/polling"
+)
+
+func getComplianceRules(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetComplianceRules())
+}
+
+func postComplianceRule(c echo.Context) error {
+	r := new(datastore.ComplianceRuleEnt)
+	if err := c.Bind(r); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := datastore.UpdateComplianceRule(r); err != nil {
+		if err == datastore.ErrInvalidID {
+			return echo.ErrNotFound
+		}
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("コンプライアンスルールを更新しました(%s)", r.Name),
+	})
+	go polling.CheckComplianceAll()
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteComplianceRule(c echo.Context) error {
+	id := c.Param("id")
+	r := datastore.GetComplianceRule(id)
+	if r == nil {
+		return echo.ErrNotFound
+	}
+	name := r.Name
+	if err := datastore.DeleteComplianceRule(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("コンプライアンスルールを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// getComplianceReport : ノード毎のコンプライアンスの状態
+func getComplianceReport(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetComplianceReport())
+}
+
+// postComplianceCheck : 全てのノードを再チェックする
+func postComplianceCheck(c echo.Context) error {
+	go polling.CheckComplianceAll()
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
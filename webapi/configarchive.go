@@ -0,0 +1,56 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// getConfigArchiveList : ノードの設定の履歴
+func getConfigArchiveList(c echo.Context) error {
+	id := c.Param("id")
+	if datastore.GetNode(id) == nil {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, datastore.GetConfigArchiveList(id))
+}
+
+// getConfigArchive : ノードの指定した時刻の設定
+func getConfigArchive(c echo.Context) error {
+	id := c.Param("id")
+	t, err := strconv.ParseInt(c.Param("time"), 10, 64)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	ca := datastore.GetConfigArchive(id, t)
+	if ca == nil {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, ca)
+}
+
+// getConfigDiff : ノードの2つの世代の設定の差分(unified diff)
+// toを省略した場合は最新の設定と比較する
+func getConfigDiff(c echo.Context) error {
+	id := c.Param("id")
+	from, err := strconv.ParseInt(c.QueryParam("from"), 10, 64)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	to := int64(0)
+	if s := c.QueryParam("to"); s != "" {
+		if to, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return echo.ErrBadRequest
+		}
+	}
+	diff, err := datastore.DiffConfigArchive(id, from, to)
+	if err != nil {
+		if err == datastore.ErrInvalidID {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+	return c.String(http.StatusOK, diff)
+}
@@ -0,0 +1,67 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+func getCredentials(c echo.Context) error {
+	r := []*datastore.CredentialEnt{}
+	for _, cr := range datastore.GetCredentials() {
+		r = append(r, maskCredential(cr))
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+func postCredential(c echo.Context) error {
+	cr := new(datastore.CredentialEnt)
+	if err := c.Bind(cr); err != nil {
+		return echo.ErrBadRequest
+	}
+	op := "追加"
+	if cr.ID == "" {
+		if err := datastore.AddCredential(cr); err != nil {
+			return echo.ErrBadRequest
+		}
+	} else {
+		old := datastore.GetCredential(cr.ID)
+		if old == nil {
+			return echo.ErrNotFound
+		}
+		cr.Community = unmaskSecret(cr.Community, old.Community)
+		cr.Password = unmaskSecret(cr.Password, old.Password)
+		cr.PrivateKey = unmaskSecret(cr.PrivateKey, old.PrivateKey)
+		cr.Token = unmaskSecret(cr.Token, old.Token)
+		if err := datastore.UpdateCredential(cr); err != nil {
+			return echo.ErrBadRequest
+		}
+		op = "更新"
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("認証情報プロファイルを%sしました(%s)", op, cr.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteCredential(c echo.Context) error {
+	id := c.Param("id")
+	cr := datastore.GetCredential(id)
+	if cr == nil {
+		return echo.ErrNotFound
+	}
+	name := cr.Name
+	if err := datastore.DeleteCredential(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("認証情報プロファイルを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
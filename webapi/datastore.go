@@ -17,7 +17,10 @@ type dataStoreWebAPI struct {
 
 func getDataStore(c echo.Context) error {
 	r := new(dataStoreWebAPI)
-	r.Backup = &datastore.Backup
+	backup := datastore.Backup
+	backup.S3.SecretKey = ""
+	backup.S3.SSEKey = ""
+	r.Backup = &backup
 	r.DBStats = &datastore.DBStats
 	r.DBStatsLog = &datastore.DBStatsLog
 	return c.JSON(http.StatusOK, r)
@@ -31,6 +34,18 @@ func postBackup(c echo.Context) error {
 	datastore.Backup.Mode = bc.Mode
 	datastore.Backup.ConfigOnly = bc.ConfigOnly
 	datastore.Backup.Generation = bc.Generation
+	datastore.Backup.Incremental = bc.Incremental
+	datastore.Backup.FullInterval = bc.FullInterval
+	datastore.Backup.Destination = bc.Destination
+	secretKey := datastore.Backup.S3.SecretKey
+	sseKey := datastore.Backup.S3.SSEKey
+	datastore.Backup.S3 = bc.S3
+	if bc.S3.SecretKey == "" {
+		datastore.Backup.S3.SecretKey = secretKey
+	}
+	if bc.S3.SSEKey == "" {
+		datastore.Backup.S3.SSEKey = sseKey
+	}
 	if err := datastore.SaveBackup(); err != nil {
 		return echo.ErrInternalServerError
 	}
@@ -38,6 +53,25 @@ func postBackup(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
 
+func getBackupSets(c echo.Context) error {
+	list, err := datastore.GetBackupSets()
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func postVerifyBackupSet(c echo.Context) error {
+	id := c.Param("id")
+	if err := datastore.VerifyBackupSet(id); err != nil {
+		if err == datastore.ErrInvalidID {
+			return echo.ErrNotFound
+		}
+		return c.JSON(http.StatusOK, map[string]string{"resp": "ng", "error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
 func postStopBackup(c echo.Context) error {
 	datastore.StopBackup()
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
@@ -24,6 +24,7 @@ type eventLogFilter struct {
 	EndTime   string
 	Type      string
 	NodeID    string
+	Tag       string // ノードのタグのセレクタ
 	Event     string
 }
 
@@ -60,6 +61,11 @@ func postEventLogs(c echo.Context) error {
 		if filter.NodeID != "" && filter.NodeID != l.NodeID {
 			return true
 		}
+		if filter.Tag != "" {
+			if n := datastore.GetNode(l.NodeID); n == nil || !datastore.NodeMatchTagSelector(n, filter.Tag) {
+				return true
+			}
+		}
 		r.EventLogs = append(r.EventLogs, l)
 		i++
 		return i <= datastore.MapConf.LogDispSize
@@ -0,0 +1,126 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/backend"
+	"github.com/twsnmp/twsnmpfc/client"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+type federationSiteWebAPI struct {
+	Site *datastore.FederationSiteEnt
+	Map  *datastore.FederationMapEnt
+}
+
+// getFederationSites : 配下のTWSNMP FCとサブマップの状態のリスト(ノード等の詳細は含まない)
+func getFederationSites(c echo.Context) error {
+	r := []*federationSiteWebAPI{}
+	for _, s := range datastore.GetFederationSites() {
+		site := *s
+		site.Password = maskSecret(s.Password)
+		e := &federationSiteWebAPI{Site: &site}
+		if m := datastore.GetFederationMap(s.ID); m != nil {
+			sm := *m
+			sm.Nodes = nil
+			sm.Pollings = nil
+			sm.AIList = nil
+			e.Map = &sm
+		}
+		r = append(r, e)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+func postFederationSite(c echo.Context) error {
+	s := new(datastore.FederationSiteEnt)
+	if err := c.Bind(s); err != nil {
+		return echo.ErrBadRequest
+	}
+	if s.ID != "" {
+		old := datastore.GetFederationSite(s.ID)
+		if old == nil {
+			return echo.ErrNotFound
+		}
+		s.Password = unmaskSecret(s.Password, old.Password)
+	}
+	if err := datastore.UpdateFederationSite(s); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("配下のTWSNMP FCの設定を更新しました(%s)", s.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteFederationSite(c echo.Context) error {
+	id := c.Param("id")
+	s := datastore.GetFederationSite(id)
+	if s == nil {
+		return echo.ErrNotFound
+	}
+	name := s.Name
+	if err := datastore.DeleteFederationSite(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("配下のTWSNMP FCを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// getFederationMap : 配下のTWSNMP FCのサブマップ(読み取り専用)
+func getFederationMap(c echo.Context) error {
+	m := datastore.GetFederationMap(c.Param("id"))
+	if m == nil {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+type federationNodeWebAPI struct {
+	Node     *datastore.FederationNodeEnt
+	Pollings []*datastore.FederationPollingEnt
+	Logs     []*client.EventLogEnt
+	Error    string
+}
+
+// getFederationNode : 配下のTWSNMP FCのノードの詳細(ドリルダウン)
+func getFederationNode(c echo.Context) error {
+	id := c.Param("id")
+	nodeID := c.Param("node")
+	m := datastore.GetFederationMap(id)
+	if m == nil {
+		return echo.ErrNotFound
+	}
+	r := &federationNodeWebAPI{
+		Pollings: []*datastore.FederationPollingEnt{},
+		Logs:     []*client.EventLogEnt{},
+	}
+	for _, n := range m.Nodes {
+		if n.ID == nodeID {
+			r.Node = n
+			break
+		}
+	}
+	if r.Node == nil {
+		return echo.ErrNotFound
+	}
+	for _, p := range m.Pollings {
+		if p.NodeID == nodeID {
+			r.Pollings = append(r.Pollings, p)
+		}
+	}
+	if logs, err := backend.GetFederationNodeLogs(id, nodeID); err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Logs = logs
+	}
+	return c.JSON(http.StatusOK, r)
+}
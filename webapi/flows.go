@@ -2,7 +2,11 @@ package webapi
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/twsnmp/twsnmpfc/datastore"
@@ -81,3 +85,119 @@ func deleteFumbleFlow(c echo.Context) error {
 	})
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
+
+// getFlowTopN : 期間内のフローの上位N件
+// start,endは日時または現在からの時間(-30m等)、ifaceはエクスポーターのIPまたはノード名:ifIndex
+func getFlowTopN(c echo.Context) error {
+	start := c.QueryParam("start")
+	if start == "" {
+		start = "-1h"
+	}
+	st, et, err := getTimeRange(start, c.QueryParam("end"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	dim := c.QueryParam("dim")
+	if dim == "" {
+		dim = "src"
+	}
+	n, _ := strconv.Atoi(c.QueryParam("n"))
+	r, err := datastore.GetFlowTopN(st, et, resolveFlowTopNIf(c.QueryParam("iface")), dim, n)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// resolveFlowTopNIf : ノード名:ifIndexをエクスポーターのIP:ifIndexに変換する
+func resolveFlowTopNIf(iface string) string {
+	i := strings.LastIndex(iface, ":")
+	if i < 1 {
+		return iface
+	}
+	host := iface[:i]
+	if net.ParseIP(host) != nil {
+		return iface
+	}
+	if n := datastore.FindNodeFromName(host); n != nil {
+		return n.IP + iface[i:]
+	}
+	return iface
+}
+
+type flowInterfaceWebAPI struct {
+	*datastore.FlowInterfaceEnt
+	Bytes int64
+}
+
+// getFlowInterfaces : フローを受信したインタフェースとノードのポートの対応
+func getFlowInterfaces(c echo.Context) error {
+	start := c.QueryParam("start")
+	if start == "" {
+		start = "-1h"
+	}
+	st, et, err := getTimeRange(start, c.QueryParam("end"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	r := []*flowInterfaceWebAPI{}
+	for k, b := range datastore.GetFlowInterfaceBytes(st, et) {
+		r = append(r, &flowInterfaceWebAPI{FlowInterfaceEnt: datastore.GetFlowInterface(k), Bytes: b})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Bytes > r[j].Bytes
+	})
+	return c.JSON(http.StatusOK, r)
+}
+
+type nodeFlowWebAPI struct {
+	Interface *datastore.FlowInterfaceEnt
+	Start     int64
+	End       int64
+	Hour      bool
+	Bytes     int64
+	InBytes   int64
+	OutBytes  int64
+	Services  []*datastore.FlowTopNItem
+	Src       []*datastore.FlowTopNItem
+	Dst       []*datastore.FlowTopNItem
+}
+
+// getNodeFlow : パネルのポートのフローの内訳(上位のアプリケーションとホスト)
+func getNodeFlow(c echo.Context) error {
+	n := datastore.GetNode(c.Param("id"))
+	if n == nil {
+		return echo.ErrBadRequest
+	}
+	key := c.QueryParam("key")
+	if key == "" {
+		key = fmt.Sprintf("%s:%s", n.IP, c.Param("index"))
+	}
+	start := c.QueryParam("start")
+	if start == "" {
+		start = "-1h"
+	}
+	st, et, err := getTimeRange(start, c.QueryParam("end"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("n"))
+	r := nodeFlowWebAPI{Interface: datastore.GetFlowInterface(key)}
+	for _, dim := range []string{"service", "src", "dst"} {
+		t, err := datastore.GetFlowTopN(st, et, key, dim, limit)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+		r.Start, r.End, r.Hour = t.Start, t.End, t.Hour
+		r.Bytes, r.InBytes, r.OutBytes = t.Bytes, t.InBytes, t.OutBytes
+		switch dim {
+		case "service":
+			r.Services = t.Items
+		case "src":
+			r.Src = t.Items
+		case "dst":
+			r.Dst = t.Items
+		}
+	}
+	return c.JSON(http.StatusOK, r)
+}
@@ -97,11 +97,12 @@ func gnmiGet(p *gnmiGetReqWebAPI) ([]*gnmiGetEnt, error) {
 	if n == nil {
 		return ret, fmt.Errorf("node not found")
 	}
+	cred := datastore.GetNodeCredential(n, "gnmi")
 	tg, err := api.NewTarget(
 		api.Name(n.Name),
 		api.Address(p.Target),
-		api.Username(n.GNMIUser),
-		api.Password(n.GNMIPassword),
+		api.Username(cred.User),
+		api.Password(cred.Password),
 		api.SkipVerify(true),
 	)
 	if err != nil {
@@ -206,11 +207,12 @@ func gnmiCap(p *gnmiGetReqWebAPI) (*gnmiCapEnt, error) {
 	if n == nil {
 		return ret, fmt.Errorf("node not found")
 	}
+	cred := datastore.GetNodeCredential(n, "gnmi")
 	tg, err := api.NewTarget(
 		api.Name(n.Name),
 		api.Address(p.Target),
-		api.Username(n.GNMIUser),
-		api.Password(n.GNMIPassword),
+		api.Username(cred.User),
+		api.Password(cred.Password),
 		api.SkipVerify(true),
 	)
 	if err != nil {
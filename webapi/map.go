@@ -24,7 +24,7 @@ type mapWebAPI struct {
 
 func getMap(c echo.Context) error {
 	r := &mapWebAPI{
-		MapConf:  &datastore.MapConf,
+		MapConf:  maskMapConf(),
 		Nodes:    make(map[string]*datastore.NodeEnt),
 		Items:    make(map[string]*datastore.DrawItemEnt),
 		Networks: make(map[string]*datastore.NetworkEnt),
@@ -33,7 +33,7 @@ func getMap(c echo.Context) error {
 		Images:   datastore.GetImageList(),
 	}
 	datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
-		r.Nodes[n.ID] = n
+		r.Nodes[n.ID] = maskNode(n)
 		return true
 	})
 	datastore.ForEachItems(func(di *datastore.DrawItemEnt) bool {
@@ -45,7 +45,7 @@ func getMap(c echo.Context) error {
 		if n.Ports == nil {
 			n.Ports = []datastore.PortEnt{}
 		}
-		r.Networks[n.ID] = n
+		r.Networks[n.ID] = maskNetwork(n)
 		return true
 	})
 	datastore.ForEachLines(func(l *datastore.LineEnt) bool {
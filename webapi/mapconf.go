@@ -25,8 +25,9 @@ func getMapConf(c echo.Context) error {
 	r.LogDispSize = datastore.MapConf.LogDispSize
 	r.LogTimeout = datastore.MapConf.LogTimeout
 	r.SnmpMode = datastore.MapConf.SnmpMode
-	r.Community = datastore.MapConf.Community
+	r.Community = maskSecret(datastore.MapConf.Community)
 	r.SnmpUser = datastore.MapConf.SnmpUser
+	r.CredentialID = datastore.MapConf.CredentialID
 	r.EnableSyslogd = datastore.MapConf.EnableSyslogd
 	r.EnableTrapd = datastore.MapConf.EnableTrapd
 	r.EnableNetflowd = datastore.MapConf.EnableNetflowd
@@ -42,6 +43,7 @@ func getMapConf(c echo.Context) error {
 	r.AIMode = datastore.MapConf.AIMode
 	r.BackImage = datastore.MapConf.BackImage
 	r.GeoIPInfo = datastore.MapConf.GeoIPInfo
+	r.ASNInfo = datastore.MapConf.ASNInfo
 	r.EnableMobileAPI = datastore.MapConf.EnableMobileAPI
 	r.PublicKey = datastore.MapConf.PublicKey
 	r.FontSize = datastore.MapConf.FontSize
@@ -54,9 +56,14 @@ func getMapConf(c echo.Context) error {
 	r.OTelRetention = datastore.MapConf.OTelRetention
 	r.LLMProvider = datastore.MapConf.LLMProvider
 	r.LLMBaseURL = datastore.MapConf.LLMBaseURL
-	r.LLMAPIKey = datastore.MapConf.LLMAPIKey
+	r.LLMAPIKey = maskSecret(datastore.MapConf.LLMAPIKey)
 	r.LLMModel = datastore.MapConf.LLMModel
 	r.NodeLock = datastore.MapConf.NodeLock
+	r.DisableSnmpBatch = datastore.MapConf.DisableSnmpBatch
+	r.SnmpMaxConcurrent = datastore.MapConf.SnmpMaxConcurrent
+	r.SnmpRateLimit = datastore.MapConf.SnmpRateLimit
+	r.EnableMCPRemoteExec = datastore.MapConf.EnableMCPRemoteExec
+	r.MCPRemoteExecCommands = datastore.MapConf.MCPRemoteExecCommands
 	if r.IconSize == 0 {
 		r.IconSize = 32
 	}
@@ -71,6 +78,9 @@ func postMapConf(c echo.Context) error {
 	if err := c.Bind(mc); err != nil {
 		return echo.ErrBadRequest
 	}
+	mc.Community = unmaskSecret(mc.Community, datastore.MapConf.Community)
+	mc.SnmpPassword = unmaskSecret(mc.SnmpPassword, datastore.MapConf.SnmpPassword)
+	mc.LLMAPIKey = unmaskSecret(mc.LLMAPIKey, datastore.MapConf.LLMAPIKey)
 	datastore.MapConf.MapName = mc.MapName
 	datastore.MapConf.UserID = mc.UserID
 	if mc.Password != "" {
@@ -84,10 +94,12 @@ func postMapConf(c echo.Context) error {
 	datastore.MapConf.LogTimeout = mc.LogTimeout
 	datastore.RestartSnmpTrapd = datastore.MapConf.SnmpMode != mc.SnmpMode ||
 		datastore.MapConf.Community != mc.Community ||
-		datastore.MapConf.SnmpUser != mc.SnmpUser
+		datastore.MapConf.SnmpUser != mc.SnmpUser ||
+		datastore.MapConf.CredentialID != mc.CredentialID
 	datastore.MapConf.SnmpMode = mc.SnmpMode
 	datastore.MapConf.Community = mc.Community
 	datastore.MapConf.SnmpUser = mc.SnmpUser
+	datastore.MapConf.CredentialID = mc.CredentialID
 	if mc.SnmpPassword != "" {
 		datastore.RestartSnmpTrapd = datastore.RestartSnmpTrapd || datastore.MapConf.SnmpPassword != mc.SnmpPassword
 		datastore.MapConf.SnmpPassword = mc.SnmpPassword
@@ -119,6 +131,11 @@ func postMapConf(c echo.Context) error {
 	datastore.MapConf.LLMAPIKey = mc.LLMAPIKey
 	datastore.MapConf.LLMModel = mc.LLMModel
 	datastore.MapConf.NodeLock = mc.NodeLock
+	datastore.MapConf.DisableSnmpBatch = mc.DisableSnmpBatch
+	datastore.MapConf.SnmpMaxConcurrent = mc.SnmpMaxConcurrent
+	datastore.MapConf.SnmpRateLimit = mc.SnmpRateLimit
+	datastore.MapConf.EnableMCPRemoteExec = mc.EnableMCPRemoteExec
+	datastore.MapConf.MCPRemoteExecCommands = mc.MCPRemoteExecCommands
 	if err := datastore.SaveMapConf(); err != nil {
 		return echo.ErrBadRequest
 	}
@@ -272,6 +289,52 @@ func deleteGeoIP(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
 
+func postASN(c echo.Context) error {
+	f, err := c.FormFile("file")
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	if f.Size > 1024*1024*500 {
+		return echo.ErrBadRequest
+	}
+	api := c.Get("api").(*WebAPI)
+	dp := filepath.Join(api.DataStorePath, "asn.upload")
+	src, err := f.Open()
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	defer src.Close()
+	dst, err := os.Create(dp)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return echo.ErrInternalServerError
+	}
+	dst.Close()
+	if err := datastore.UpdateASNDB(dp); err != nil {
+		os.Remove(dp)
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: "AS番号DBを更新しました",
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteASN(c echo.Context) error {
+	datastore.DeleteASNDB()
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: "AS番号DBを削除しました",
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
 func postReGenarateSSHKey(c echo.Context) error {
 	datastore.InitSecurityKey()
 	datastore.AddEventLog(&datastore.EventLogEnt{
@@ -213,6 +213,26 @@ func addMCPTools(s *mcp.Server) {
 		Name:        "get_mac_address_info",
 		Description: "get mac address info.(IP,Managed node,Vendor)",
 	}, mcpGetMACInfo)
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_compliance_report",
+		Description: "get device configuration compliance report from TWSNMP",
+	}, mcpGetComplianceReport)
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "run_remote_command",
+		Description: "start ssh command or snmp set on multiple nodes managed by TWSNMP. Only allowed commands can be run. Returns job_id to get results",
+	}, mcpRunRemoteCommand)
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_remote_command_result",
+		Description: "get state and results of remote command job started by run_remote_command",
+	}, mcpGetRemoteCommandResult)
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_flow_top_talkers",
+		Description: "get top talkers (source,destination,service,AS,interface) of NetFlow/IPFIX in a time range from TWSNMP",
+	}, mcpGetFlowTopTalkers)
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_capacity_report",
+		Description: "get interface capacity planning report (95th percentile,peak utilization and forecast of reaching 80%) from TWSNMP",
+	}, mcpGetCapacityReport)
 }
 
 // Add prompts
@@ -36,6 +36,7 @@ type mcpSearchEventLogParams struct {
 	StartTime   string `json:"start_time" jsonschema:"start date and time of logs to search or duration from now. If blank, defaults to the last 1 hour."`
 	EndTime     string `json:"end_time" jsonschema:"end date and time of logs to search.empty or now is current time."`
 	Limit       int    `json:"limit" jsonschema:"Limit on number of logs retrieved. min 100,max 10000"`
+	TagFilter   string `json:"tag_filter" jsonschema:"tag_filter specifies a tag selector for nodes of logs. Comma separated terms are ANDed. A term is tag, !tag or group:path. If blank, no filter."`
 }
 
 func mcpSearchEventLog(ctx context.Context, req *mcp.CallToolRequest, args mcpSearchEventLogParams) (*mcp.CallToolResult, any, error) {
@@ -73,6 +74,11 @@ func mcpSearchEventLog(ctx context.Context, req *mcp.CallToolRequest, args mcpSe
 		if node != nil && !node.MatchString(l.NodeName) {
 			return true
 		}
+		if args.TagFilter != "" {
+			if n := datastore.GetNode(l.NodeID); n == nil || !datastore.NodeMatchTagSelector(n, args.TagFilter) {
+				return true
+			}
+		}
 		list = append(list, mcpEventLogEnt{
 			Time:  time.Unix(0, l.Time).Format(time.RFC3339Nano),
 			Type:  l.Type,
@@ -529,6 +535,8 @@ type mcpIPInfoEnt struct {
 	Node            string
 	DNSNames        []string
 	Location        string
+	ASN             uint
+	ASOrg           string
 	RDAPIPVersion   string
 	RDAPType        string
 	RDAPHandle      string
@@ -551,6 +559,7 @@ func mcpGetIPInfo(ctx context.Context, req *mcp.CallToolRequest, args mcpGetIPIn
 		info.DNSNames = names
 	}
 	info.Location = datastore.GetLoc(ip)
+	info.ASN, info.ASOrg = datastore.GetASN(ip)
 	if !strings.HasPrefix(info.Location, "LOCAL") {
 		client := &rdap.Client{}
 		if ri, err := client.QueryIP(ip); err == nil {
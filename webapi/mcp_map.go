@@ -19,21 +19,24 @@ import (
 
 // get_node_list tool
 type mcpNodeEnt struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	IP          string `json:"ip"`
-	MAC         string `json:"mac"`
-	State       string `json:"state"`
-	X           int    `json:"x"`
-	Y           int    `json:"y"`
-	Icon        string `json:"icon"`
-	Description string `json:"description"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	IP          string   `json:"ip"`
+	MAC         string   `json:"mac"`
+	State       string   `json:"state"`
+	X           int      `json:"x"`
+	Y           int      `json:"y"`
+	Icon        string   `json:"icon"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Group       string   `json:"group"`
 }
 
 type mcpGetNodeListParams struct {
 	NameFilter  string `json:"name_filter" jsonschema:"name_filter specifies the search criteria for node names using regular expressions.If blank, all nodes are searched."`
 	IPFilter    string `json:"ip_filter" jsonschema:"ip_filter specifies the search criteria for node IP address using regular expressions.If blank, all nodes are searched."`
 	StateFilter string `json:"state_filter" jsonschema:"state_filter uses a regular expression to specify search criteria for node state names(normal,warn,low,high,repair,unknown) If blank, all nodes are searched."`
+	TagFilter   string `json:"tag_filter" jsonschema:"tag_filter specifies a tag selector. Comma separated terms are ANDed. A term is tag, !tag (without tag) or group:path (the group or its subgroups). If blank, all nodes are searched."`
 }
 
 func mcpGetNodeList(ctx context.Context, req *mcp.CallToolRequest, args mcpGetNodeListParams) (*mcp.CallToolResult, any, error) {
@@ -52,6 +55,9 @@ func mcpGetNodeList(ctx context.Context, req *mcp.CallToolRequest, args mcpGetNo
 		if state != nil && !state.MatchString(n.State) {
 			return true
 		}
+		if !datastore.NodeMatchTagSelector(n, args.TagFilter) {
+			return true
+		}
 		list = append(list, mcpNodeEnt{
 			ID:          n.ID,
 			Name:        n.Name,
@@ -62,6 +68,8 @@ func mcpGetNodeList(ctx context.Context, req *mcp.CallToolRequest, args mcpGetNo
 			Icon:        n.Icon,
 			Description: n.Descr,
 			State:       n.State,
+			Tags:        n.Tags,
+			Group:       n.Group,
 		})
 		return true
 	})
@@ -147,12 +155,15 @@ type mcpPollingEnt struct {
 	State    string         `json:"state"`
 	LastTime string         `json:"last_time"`
 	Result   map[string]any `json:"result"`
+	Tags     []string       `json:"tags"`
+	Group    string         `json:"group"`
 }
 type mcpGetPollingListParams struct {
 	TypeFilter     string `json:"type_filter" jsonschema:"type_filter uses a regular expression to specify search criteria for polling type names.If blank, all pollings are searched.Type names can be ping,tcp,http,dns,twsnmp,syslog"`
 	NameFilter     string `json:"name_filter" jsonschema:"name_filter specifies the search criteria for polling names using regular expressions.If blank, all pollings are searched."`
 	NodeNameFilter string `json:"node_name_filter" jsonschema:"node_name_filter specifies the search criteria for node names of polling using regular expressions.If blank, all pollings are searched."`
 	StateFilter    string `json:"state_filter" jsonschema:"state_filter uses a regular expression to specify search criteria for polling state names.If blank, all pollings are searched.State names can be normal,warn,low,high,repair,unknown"`
+	TagFilter      string `json:"tag_filter" jsonschema:"tag_filter specifies a tag selector for pollings. Tags of the node are included. Comma separated terms are ANDed. A term is tag, !tag or group:path. If blank, all pollings are searched."`
 }
 
 func mcpGetPollingList(ctx context.Context, req *mcp.CallToolRequest, args mcpGetPollingListParams) (*mcp.CallToolResult, any, error) {
@@ -179,6 +190,9 @@ func mcpGetPollingList(ctx context.Context, req *mcp.CallToolRequest, args mcpGe
 		if state != nil && !state.MatchString(p.State) {
 			return true
 		}
+		if !datastore.PollingMatchTagSelector(p, args.TagFilter) {
+			return true
+		}
 		list = append(list, mcpPollingEnt{
 			ID:       p.ID,
 			Name:     p.Name,
@@ -189,6 +203,8 @@ func mcpGetPollingList(ctx context.Context, req *mcp.CallToolRequest, args mcpGe
 			LastTime: time.Unix(0, p.LastTime).Format(time.RFC3339Nano),
 			State:    p.State,
 			Result:   p.Result,
+			Tags:     p.Tags,
+			Group:    p.Group,
 		})
 		return true
 	})
@@ -428,17 +444,18 @@ func mcpSnmpWalk(ctx context.Context, req *mcp.CallToolRequest, args mcpSnmpWalk
 	}
 	port := uint16(161)
 	if n := datastore.FindNodeFromName(target); n != nil {
+		cred := datastore.GetNodeCredential(n, "snmp")
 		if community == "" {
-			community = n.Community
+			community = cred.Community
 		}
 		if user == "" {
-			user = n.User
+			user = cred.User
 		}
 		if password == "" {
-			password = n.Password
+			password = cred.Password
 		}
 		if snmpMode == "" {
-			snmpMode = n.SnmpMode
+			snmpMode = cred.SnmpMode
 		}
 		if n.SnmpPort > 0 {
 			port = uint16(n.SnmpPort)
@@ -460,61 +477,7 @@ func mcpSnmpWalk(ctx context.Context, req *mcp.CallToolRequest, args mcpSnmpWalk
 		Retries:   datastore.MapConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch snmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        password,
-		}
-	}
+	datastore.SetSnmpAgentAuth(agent, snmpMode, community, user, password)
 	res := []mcpMIBEnt{}
 	err := agent.Connect()
 	if err != nil {
@@ -570,17 +533,18 @@ func mcpSnmpSet(ctx context.Context, req *mcp.CallToolRequest, args mcpSnmpSetPa
 	}
 	port := uint16(161)
 	if n := datastore.FindNodeFromName(target); n != nil {
+		cred := datastore.GetNodeCredential(n, "snmp")
 		if community == "" {
-			community = n.Community
+			community = cred.Community
 		}
 		if user == "" {
-			user = n.User
+			user = cred.User
 		}
 		if password == "" {
-			password = n.Password
+			password = cred.Password
 		}
 		if snmpMode == "" {
-			snmpMode = n.SnmpMode
+			snmpMode = cred.SnmpMode
 		}
 		if n.SnmpPort > 0 {
 			port = uint16(n.SnmpPort)
@@ -602,39 +566,7 @@ func mcpSnmpSet(ctx context.Context, req *mcp.CallToolRequest, args mcpSnmpSetPa
 		Retries:   datastore.MapConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch snmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 user,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        password,
-		}
-	}
+	datastore.SetSnmpAgentAuth(agent, snmpMode, community, user, password)
 	res := []mcpMIBEnt{}
 	err := agent.Connect()
 	if err != nil {
@@ -830,3 +762,115 @@ func mcpUpdateNode(ctx context.Context, req *mcp.CallToolRequest, args mcpUpdate
 		},
 	}, nil, nil
 }
+
+// run_remote_command tool
+type mcpRunRemoteCommandParams struct {
+	Type       string `json:"type" jsonschema:"type of command. ssh or snmpset"`
+	NodeFilter string `json:"node_filter" jsonschema:"node_filter uses a regular expression to specify target node names or IP addresses."`
+	Command    string `json:"command" jsonschema:"command to run by ssh"`
+	Name       string `json:"name" jsonschema:"MIB object name for snmpset"`
+	ValueType  string `json:"value_type" jsonschema:"value type for snmpset. integer or string"`
+	Value      string `json:"value" jsonschema:"value for snmpset"`
+}
+
+type mcpRemoteExecResultEnt struct {
+	Node     string `json:"node"`
+	IP       string `json:"ip"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"`
+	Error    string `json:"error"`
+}
+
+type mcpRemoteExecJobEnt struct {
+	JobID   string                   `json:"job_id"`
+	State   string                   `json:"state"`
+	Results []mcpRemoteExecResultEnt `json:"results,omitempty"`
+}
+
+func mcpRunRemoteCommand(ctx context.Context, req *mcp.CallToolRequest, args mcpRunRemoteCommandParams) (*mcp.CallToolResult, any, error) {
+	if !datastore.MapConf.EnableMCPRemoteExec {
+		return nil, nil, fmt.Errorf("remote command from MCP is disabled")
+	}
+	if args.NodeFilter == "" {
+		return nil, nil, fmt.Errorf("node_filter is required")
+	}
+	target := args.Command
+	if args.Type == "snmpset" {
+		target = args.Name
+	}
+	if !isMCPRemoteExecAllowed(target, datastore.MapConf.MCPRemoteExecCommands) {
+		return nil, nil, fmt.Errorf("command not allowed")
+	}
+	j, err := newRemoteExecJob(&remoteExecReqWebAPI{
+		Type:       args.Type,
+		Command:    args.Command,
+		Name:       args.Name,
+		ValueType:  args.ValueType,
+		Value:      args.Value,
+		NodeFilter: args.NodeFilter,
+	}, "mcp")
+	if err != nil {
+		return nil, nil, err
+	}
+	// 結果はget_remote_command_resultで取得する
+	go runRemoteExecJob(j)
+	return mcpRemoteExecJobResult(j)
+}
+
+// isMCPRemoteExecAllowed : 許可リストに一致するか確認する 末尾の*は前方一致
+func isMCPRemoteExecAllowed(cmd, allow string) bool {
+	if cmd == "" || strings.ContainsAny(cmd, ";|&`$<>\n\r") {
+		return false
+	}
+	for _, a := range strings.Split(allow, "\n") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if p, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(cmd, p) {
+				return true
+			}
+		} else if cmd == a {
+			return true
+		}
+	}
+	return false
+}
+
+// get_remote_command_result tool
+type mcpGetRemoteCommandResultParams struct {
+	JobID string `json:"job_id" jsonschema:"job_id returned by run_remote_command"`
+}
+
+func mcpGetRemoteCommandResult(ctx context.Context, req *mcp.CallToolRequest, args mcpGetRemoteCommandResultParams) (*mcp.CallToolResult, any, error) {
+	j := datastore.GetRemoteExecJob(args.JobID)
+	if j == nil || j.User != "mcp" {
+		return nil, nil, fmt.Errorf("job not found")
+	}
+	return mcpRemoteExecJobResult(j)
+}
+
+func mcpRemoteExecJobResult(j *datastore.RemoteExecJobEnt) (*mcp.CallToolResult, any, error) {
+	r := mcpRemoteExecJobEnt{JobID: j.ID, State: j.State}
+	if j.State == "done" {
+		for _, e := range j.Results {
+			r.Results = append(r.Results, mcpRemoteExecResultEnt{
+				Node:     e.NodeName,
+				IP:       e.IP,
+				ExitCode: e.ExitCode,
+				Output:   e.Output,
+				Error:    e.Error,
+			})
+		}
+	}
+	js, err := json.Marshal(&r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(js)},
+		},
+	}, nil, nil
+}
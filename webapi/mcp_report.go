@@ -356,3 +356,204 @@ func mcpGetResourceMonitorList(ctx context.Context, req *mcp.CallToolRequest, _
 		},
 	}, nil, nil
 }
+
+// get_compliance_report tool
+
+type mcpComplianceEnt struct {
+	NodeName  string   `json:"node_name"`
+	IP        string   `json:"ip"`
+	Compliant bool     `json:"compliant"`
+	Violation []string `json:"violation"`
+	CheckTime string   `json:"check_time"`
+}
+
+type mcpGetComplianceReportParams struct {
+	NodeFilter    string `json:"node_filter" jsonschema:"node_filter uses a regular expression to specify search criteria for node names.If blank, all nodes are searched."`
+	ViolationOnly bool   `json:"violation_only" jsonschema:"If true, only nodes that violate compliance rules are listed."`
+	TagFilter     string `json:"tag_filter" jsonschema:"tag_filter specifies a tag selector for nodes. Comma separated terms are ANDed. A term is tag, !tag or group:path. If blank, all nodes are searched."`
+}
+
+func mcpGetComplianceReport(ctx context.Context, req *mcp.CallToolRequest, args mcpGetComplianceReportParams) (*mcp.CallToolResult, any, error) {
+	node := makeRegexFilter(args.NodeFilter)
+	list := []mcpComplianceEnt{}
+	for _, r := range datastore.GetComplianceReport() {
+		if node != nil && !node.MatchString(r.NodeName) {
+			continue
+		}
+		if args.ViolationOnly && r.Compliant {
+			continue
+		}
+		if args.TagFilter != "" {
+			if n := datastore.GetNode(r.NodeID); n == nil || !datastore.NodeMatchTagSelector(n, args.TagFilter) {
+				continue
+			}
+		}
+		list = append(list, mcpComplianceEnt{
+			NodeName:  r.NodeName,
+			IP:        r.IP,
+			Compliant: r.Compliant,
+			Violation: r.Violation,
+			CheckTime: time.Unix(0, r.CheckTime).Format(time.RFC3339Nano),
+		})
+	}
+	j, err := json.Marshal(&list)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(j)},
+		},
+	}, nil, nil
+}
+
+// get_flow_top_talkers tool
+type mcpFlowTopTalkerEnt struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name,omitempty"`
+	Bytes   int64   `json:"bytes"`
+	Packets int64   `json:"packets"`
+	Flows   int64   `json:"flows"`
+	Ratio   float64 `json:"ratio"`
+}
+
+type mcpFlowTopTalkersEnt struct {
+	StartTime  string                `json:"start_time"`
+	EndTime    string                `json:"end_time"`
+	Resolution string                `json:"resolution"`
+	Bytes      int64                 `json:"total_bytes"`
+	Packets    int64                 `json:"total_packets"`
+	Flows      int64                 `json:"total_flows"`
+	TopTalkers []mcpFlowTopTalkerEnt `json:"top_talkers"`
+}
+
+type mcpGetFlowTopTalkersParams struct {
+	StartTime string `json:"start_time" jsonschema:"start date and time or duration from now(e.g. -30m). If blank, defaults to the last 1 hour."`
+	EndTime   string `json:"end_time" jsonschema:"end date and time.empty or now is current time."`
+	Interface string `json:"interface" jsonschema:"interface to aggregate as exporter_ip:ifIndex or node_name:ifIndex. If blank, all flows."`
+	GroupBy   string `json:"group_by" jsonschema:"aggregation key. src,dst,service,as or if(interface). default src"`
+	Limit     int    `json:"limit" jsonschema:"number of top talkers. default 10"`
+}
+
+func mcpGetFlowTopTalkers(ctx context.Context, req *mcp.CallToolRequest, args mcpGetFlowTopTalkersParams) (*mcp.CallToolResult, any, error) {
+	start := args.StartTime
+	if start == "" {
+		start = "-1h"
+	}
+	st, et, err := getTimeRange(start, args.EndTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	dim := args.GroupBy
+	if dim == "" {
+		dim = "src"
+	}
+	r, err := datastore.GetFlowTopN(st, et, resolveFlowTopNIf(args.Interface), dim, args.Limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid group_by %s", dim)
+	}
+	ret := mcpFlowTopTalkersEnt{
+		StartTime:  time.Unix(0, st).Format(time.RFC3339),
+		EndTime:    time.Unix(0, et).Format(time.RFC3339),
+		Resolution: "minute",
+		Bytes:      r.Bytes,
+		Packets:    r.Packets,
+		Flows:      r.Flows,
+		TopTalkers: []mcpFlowTopTalkerEnt{},
+	}
+	if r.Hour {
+		ret.Resolution = "hour"
+	}
+	for _, i := range r.Items {
+		e := mcpFlowTopTalkerEnt{Key: i.Key, Bytes: i.Bytes, Packets: i.Packets, Flows: i.Flows}
+		if dim == "if" {
+			// ノード名とポート名
+			if fi := datastore.GetFlowInterface(i.Key); fi.NodeName != "" {
+				e.Name = fi.NodeName + ":" + fi.IfName
+			}
+		}
+		if r.Bytes > 0 {
+			e.Ratio = float64(i.Bytes) * 100.0 / float64(r.Bytes)
+		}
+		ret.TopTalkers = append(ret.TopTalkers, e)
+	}
+	j, err := json.Marshal(&ret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(j)},
+		},
+	}, nil, nil
+}
+
+// get_capacity_report tool
+type mcpCapacityEnt struct {
+	Node        string  `json:"node"`
+	Polling     string  `json:"polling"`
+	Interface   string  `json:"interface"`
+	SpeedBps    float64 `json:"speed_bps"`
+	InP95Bps    float64 `json:"in_p95_bps"`
+	OutP95Bps   float64 `json:"out_p95_bps"`
+	InPeakBps   float64 `json:"in_peak_bps"`
+	OutPeakBps  float64 `json:"out_peak_bps"`
+	P95Util     float64 `json:"p95_utilization"`
+	PeakUtil    float64 `json:"peak_utilization"`
+	TrendPerDay float64 `json:"trend_per_day"`
+	DaysTo80    float64 `json:"days_to_80_percent"`
+	Forecast    string  `json:"forecast_time,omitempty"`
+}
+
+type mcpGetCapacityReportParams struct {
+	Days       int    `json:"days" jsonschema:"number of days of traffic history to analyze. default 30"`
+	NodeFilter string `json:"node_filter" jsonschema:"node name filter by regular expression. If blank, all nodes."`
+	Limit      int    `json:"limit" jsonschema:"max number of interfaces. default 100"`
+}
+
+func mcpGetCapacityReport(ctx context.Context, req *mcp.CallToolRequest, args mcpGetCapacityReportParams) (*mcp.CallToolResult, any, error) {
+	filter := makeRegexFilter(args.NodeFilter)
+	limit := args.Limit
+	if limit < 1 {
+		limit = 100
+	}
+	ret := []mcpCapacityEnt{}
+	for _, e := range datastore.GetCapacityReport(args.Days) {
+		if filter != nil && !filter.MatchString(e.NodeName) {
+			continue
+		}
+		r := mcpCapacityEnt{
+			Node:        e.NodeName,
+			Polling:     e.PollingName,
+			Interface:   fmt.Sprintf("%d", e.IfIndex),
+			SpeedBps:    e.Speed,
+			InP95Bps:    e.InP95,
+			OutP95Bps:   e.OutP95,
+			InPeakBps:   e.InPeak,
+			OutPeakBps:  e.OutPeak,
+			P95Util:     e.P95Util,
+			PeakUtil:    e.PeakUtil,
+			TrendPerDay: e.Trend,
+			DaysTo80:    e.DaysTo80,
+		}
+		if e.IfName != "" {
+			r.Interface += ":" + e.IfName
+		}
+		if e.ForecastTime > 0 {
+			r.Forecast = time.Unix(0, e.ForecastTime).Format(time.RFC3339)
+		}
+		ret = append(ret, r)
+		if len(ret) >= limit {
+			break
+		}
+	}
+	j, err := json.Marshal(&ret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: string(j)},
+		},
+	}, nil, nil
+}
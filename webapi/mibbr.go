@@ -187,15 +187,17 @@ func getSNMPAgent(nodeID string) (*gosnmp.GoSNMP, error) {
 		if nt == nil {
 			return nil, fmt.Errorf("network not found")
 		}
+		nc := datastore.GetNetworkCredential(nt)
 		n = &datastore.NodeEnt{
 			IP:        nt.IP,
-			SnmpMode:  nt.SnmpMode,
-			Community: nt.Community,
-			User:      nt.User,
-			Password:  nt.Password,
+			SnmpMode:  nc.SnmpMode,
+			Community: nc.Community,
+			User:      nc.User,
+			Password:  nc.Password,
 			SnmpPort:  nt.SnmpPort,
 		}
 	}
+	cred := datastore.GetNodeCredential(n, "snmp")
 	port := uint16(161)
 	if n.SnmpPort > 0 {
 		port = uint16(n.SnmpPort)
@@ -204,66 +206,12 @@ func getSNMPAgent(nodeID string) (*gosnmp.GoSNMP, error) {
 		Target:    n.IP,
 		Port:      port,
 		Transport: "udp",
-		Community: n.Community,
+		Community: cred.Community,
 		Version:   gosnmp.Version2c,
 		Timeout:   time.Duration(datastore.MapConf.Timeout) * time.Second,
 		Retries:   datastore.MapConf.Retry,
 		MaxOids:   gosnmp.MaxOids,
 	}
-	switch n.SnmpMode {
-	case "v3auth":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthNoPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-		}
-	case "v3authpriv":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3authprivex":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha256aes128":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA256,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES,
-			PrivacyPassphrase:        n.Password,
-		}
-	case "v3sha512aes256":
-		agent.Version = gosnmp.Version3
-		agent.SecurityModel = gosnmp.UserSecurityModel
-		agent.MsgFlags = gosnmp.AuthPriv
-		agent.SecurityParameters = &gosnmp.UsmSecurityParameters{
-			UserName:                 n.User,
-			AuthenticationProtocol:   gosnmp.SHA512,
-			AuthenticationPassphrase: n.Password,
-			PrivacyProtocol:          gosnmp.AES256,
-			PrivacyPassphrase:        n.Password,
-		}
-	}
+	cred.SetSnmpAgent(agent)
 	return agent, nil
 }
@@ -37,12 +37,22 @@ func postNetwork(c echo.Context) error {
 	}
 	op := "更新"
 	if n := datastore.GetNetwork(nu.ID); n == nil {
+		if hasMaskedSecret(nu.Community, nu.Password) {
+			log.Printf("post network masked secret without source network=%s", nu.Name)
+			return echo.ErrBadRequest
+		}
+		if nu.Community == "" {
+			// 新規の場合、空ならマップ設定の値を使う
+			nu.Community = datastore.MapConf.Community
+		}
 		if err := datastore.AddNetwork(nu); err != nil {
 			log.Printf("post network err=%v", err)
 			return echo.ErrBadRequest
 		}
 		op = "追加"
 	} else {
+		nu.Community = unmaskSecret(nu.Community, n.Community)
+		nu.Password = unmaskSecret(nu.Password, n.Password)
 		if err := datastore.UpdateNetwork(nu); err != nil {
 			log.Printf("post network err=%v", err)
 			return echo.ErrBadRequest
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -41,8 +42,11 @@ func postNodePos(c echo.Context) error {
 
 func getNodes(c echo.Context) error {
 	r := []*datastore.NodeEnt{}
+	tag := c.QueryParam("tag")
 	datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
-		r = append(r, n)
+		if datastore.NodeMatchTagSelector(n, tag) {
+			r = append(r, maskNode(n))
+		}
 		return true
 	})
 	return c.JSON(http.StatusOK, r)
@@ -61,13 +65,90 @@ func deleteNodes(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
 
+type nodeTagsWebAPI struct {
+	IDs      []string
+	Selector string
+	Add      []string
+	Remove   []string
+	Group    string
+	SetGroup bool
+}
+
+// postNodeTags : ノードのタグとグループをまとめて変更する
+func postNodeTags(c echo.Context) error {
+	req := new(nodeTagsWebAPI)
+	if err := c.Bind(req); err != nil {
+		return echo.ErrBadRequest
+	}
+	if len(req.IDs) < 1 && req.Selector == "" {
+		return echo.ErrBadRequest
+	}
+	list := []*datastore.NodeEnt{}
+	if len(req.IDs) > 0 {
+		for _, id := range req.IDs {
+			if n := datastore.GetNode(id); n != nil {
+				list = append(list, n)
+			}
+		}
+	} else {
+		datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
+			if datastore.NodeMatchTagSelector(n, req.Selector) {
+				list = append(list, n)
+			}
+			return true
+		})
+	}
+	remove := datastore.NormalizeTags(req.Remove)
+	for _, n := range list {
+		tags := []string{}
+		for _, t := range n.Tags {
+			if !slices.Contains(remove, t) {
+				tags = append(tags, t)
+			}
+		}
+		n.Tags = datastore.NormalizeTags(append(tags, req.Add...))
+		if req.SetGroup {
+			n.Group = datastore.NormalizeGroup(req.Group)
+		}
+		datastore.UpdateNode(n)
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("%d件のノードのタグを変更しました", len(list)),
+	})
+	return c.JSON(http.StatusOK, map[string]any{"resp": "ok", "count": len(list)})
+}
+
+// getTags : 利用しているタグとグループのリスト
+func getTags(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetTagList())
+}
+
 func postNodeUpdate(c echo.Context) error {
 	nu := new(datastore.NodeEnt)
 	if err := c.Bind(nu); err != nil {
 		log.Printf("update node bind err=%v", err)
 		return echo.ErrBadRequest
 	}
+	if !datastore.ValidNodeCredentials(nu.Credentials) {
+		log.Printf("update node invalid credentials node=%s", nu.Name)
+		return echo.ErrBadRequest
+	}
 	if nu.ID == "" {
+		// 複製の場合はsrcで指定したコピー元の値でマスクを戻す
+		if src := datastore.GetNode(c.QueryParam("src")); src != nil {
+			nu.Community = unmaskSecret(nu.Community, src.Community)
+			nu.Password = unmaskSecret(nu.Password, src.Password)
+			nu.GNMIPassword = unmaskSecret(nu.GNMIPassword, src.GNMIPassword)
+		} else if hasMaskedSecret(nu.Community, nu.Password, nu.GNMIPassword) {
+			log.Printf("add node masked secret without source node=%s", nu.Name)
+			return echo.ErrBadRequest
+		}
+		if nu.Community == "" && nu.Credentials["snmp"] == "" {
+			// 新規の場合、空ならマップ設定の値を使う
+			nu.Community = datastore.MapConf.Community
+		}
 		if err := datastore.AddNode(nu); err != nil {
 			return echo.ErrBadRequest
 		}
@@ -89,11 +170,12 @@ func postNodeUpdate(c echo.Context) error {
 	n.Icon = nu.Icon
 	n.Image = nu.Image
 	n.SnmpMode = nu.SnmpMode
-	n.Community = nu.Community
+	n.Community = unmaskSecret(nu.Community, n.Community)
 	n.User = nu.User
-	n.Password = nu.Password
+	n.Password = unmaskSecret(nu.Password, n.Password)
 	n.GNMIUser = nu.GNMIUser
-	n.GNMIPassword = nu.GNMIPassword
+	n.GNMIPassword = unmaskSecret(nu.GNMIPassword, n.GNMIPassword)
+	n.Credentials = nu.Credentials
 	n.GNMIEncoding = nu.GNMIEncoding
 	n.GNMIPort = nu.GNMIPort
 	n.PublicKey = nu.PublicKey
@@ -102,6 +184,8 @@ func postNodeUpdate(c echo.Context) error {
 	n.AutoAck = nu.AutoAck
 	n.HPorts = nu.HPorts
 	n.SnmpPort = nu.SnmpPort
+	n.Tags = datastore.NormalizeTags(nu.Tags)
+	n.Group = datastore.NormalizeGroup(nu.Group)
 	if n.MAC != nu.MAC {
 		if nu.MAC != "" {
 			mac := logger.NormMACAddr(nu.MAC)
@@ -134,7 +218,7 @@ type nodeWebAPI struct {
 func getNodeLog(c echo.Context) error {
 	id := c.Param("id")
 	r := nodeWebAPI{}
-	r.Node = datastore.GetNode(id)
+	r.Node = maskNode(datastore.GetNode(id))
 	if r.Node == nil {
 		return echo.ErrBadRequest
 	}
@@ -155,7 +239,7 @@ func getNodeLog(c echo.Context) error {
 func getNodePolling(c echo.Context) error {
 	id := c.Param("id")
 	r := nodeWebAPI{}
-	r.Node = datastore.GetNode(id)
+	r.Node = maskNode(datastore.GetNode(id))
 	if r.Node == nil {
 		return echo.ErrBadRequest
 	}
@@ -210,6 +294,7 @@ func getVPanel(c echo.Context) error {
 	}
 	r.Power = backend.GetVPanelPowerInfo(r.Node)
 	r.Ports = backend.GetVPanelPorts(r.Node)
+	r.Node = maskNode(r.Node)
 	return c.JSON(http.StatusOK, r)
 }
 
@@ -228,6 +313,7 @@ func getHostResource(c echo.Context) error {
 		return echo.ErrBadRequest
 	}
 	r.HostResource = backend.GetHostResource(r.Node)
+	r.Node = maskNode(r.Node)
 	return c.JSON(http.StatusOK, r)
 }
 
@@ -26,6 +26,8 @@ func getNotifyConf(c echo.Context) error {
 	r.Level = datastore.NotifyConf.Level
 	r.Report = datastore.NotifyConf.Report
 	r.ReportLLMSummary = datastore.NotifyConf.ReportLLMSummary
+	r.ReportPDF = datastore.NotifyConf.ReportPDF
+	r.ReportCSV = datastore.NotifyConf.ReportCSV
 	r.CheckUpdate = datastore.NotifyConf.CheckUpdate
 	r.NotifyRepair = datastore.NotifyConf.NotifyRepair
 	r.NotifyLowScore = datastore.NotifyConf.NotifyLowScore
@@ -35,11 +37,12 @@ func getNotifyConf(c echo.Context) error {
 	r.ChatType = datastore.NotifyConf.ChatType
 	r.ChatWebhookURL = datastore.NotifyConf.ChatWebhookURL
 	r.ExecCmd = datastore.NotifyConf.ExecCmd
+	r.TagFilter = datastore.NotifyConf.TagFilter
 	r.WebHookNotify = datastore.NotifyConf.WebHookNotify
 	r.WebHookReport = datastore.NotifyConf.WebHookReport
 	r.Provider = datastore.NotifyConf.Provider
 	r.ClientID = datastore.NotifyConf.ClientID
-	r.ClientSecret = datastore.NotifyConf.ClientSecret
+	r.ClientSecret = maskSecret(datastore.NotifyConf.ClientSecret)
 	r.MSTenant = datastore.NotifyConf.MSTenant
 	return c.JSON(http.StatusOK, r)
 }
@@ -49,6 +52,8 @@ func postNotifyConf(c echo.Context) error {
 	if err := c.Bind(nc); err != nil {
 		return echo.ErrBadRequest
 	}
+	nc.Password = unmaskSecret(nc.Password, datastore.NotifyConf.Password)
+	nc.ClientSecret = unmaskSecret(nc.ClientSecret, datastore.NotifyConf.ClientSecret)
 	delOAuth2Token := false
 	if nc.Provider != datastore.NotifyConf.Provider ||
 		nc.ClientID != datastore.NotifyConf.ClientID ||
@@ -68,6 +73,8 @@ func postNotifyConf(c echo.Context) error {
 	datastore.NotifyConf.Level = nc.Level
 	datastore.NotifyConf.Report = nc.Report
 	datastore.NotifyConf.ReportLLMSummary = nc.ReportLLMSummary
+	datastore.NotifyConf.ReportPDF = nc.ReportPDF
+	datastore.NotifyConf.ReportCSV = nc.ReportCSV
 	datastore.NotifyConf.CheckUpdate = nc.CheckUpdate
 	datastore.NotifyConf.NotifyRepair = nc.NotifyRepair
 	datastore.NotifyConf.NotifyLowScore = nc.NotifyLowScore
@@ -77,6 +84,7 @@ func postNotifyConf(c echo.Context) error {
 	datastore.NotifyConf.ChatType = nc.ChatType
 	datastore.NotifyConf.ChatWebhookURL = nc.ChatWebhookURL
 	datastore.NotifyConf.ExecCmd = nc.ExecCmd
+	datastore.NotifyConf.TagFilter = nc.TagFilter
 	datastore.NotifyConf.WebHookNotify = nc.WebHookNotify
 	datastore.NotifyConf.WebHookReport = nc.WebHookReport
 	datastore.NotifyConf.Provider = nc.Provider
@@ -207,9 +215,10 @@ func postNotifySchedule(c echo.Context) error {
 		Schedule string
 	}
 	ns := new(notifyScheduleEnt)
-	if err := c.Bind(ns); err != nil || ns.Schedule == "" {
+	if err := c.Bind(ns); err != nil || ns.Schedule == "" || ns.NodeID == "tag:" {
 		return echo.ErrBadRequest
 	}
+	// NodeIDが"tag:セレクタ"の場合はタグが一致するノードのメンテナンス時間
 	for _, sc := range strings.Split(ns.Schedule, ",") {
 		if !notifySchedulePat.MatchString(sc) {
 			return echo.ErrBadRequest
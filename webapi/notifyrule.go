@@ -0,0 +1,76 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+// getNotifyRules : 通知の振り分けルール(評価する順番)
+func getNotifyRules(c echo.Context) error {
+	r := []*datastore.NotifyRuleEnt{}
+	for _, e := range datastore.GetNotifyRules() {
+		m := *e
+		m.MqttPassword = maskSecret(e.MqttPassword)
+		r = append(r, &m)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// postNotifyRules : 通知の振り分けルールを順番も含めて更新する
+func postNotifyRules(c echo.Context) error {
+	list := []*datastore.NotifyRuleEnt{}
+	if err := c.Bind(&list); err != nil {
+		return echo.ErrBadRequest
+	}
+	old := make(map[string]*datastore.NotifyRuleEnt)
+	for _, e := range datastore.GetNotifyRules() {
+		old[e.ID] = e
+	}
+	for _, e := range list {
+		if o, ok := old[e.ID]; ok {
+			e.MqttPassword = unmaskSecret(e.MqttPassword, o.MqttPassword)
+		}
+	}
+	if err := datastore.SaveNotifyRules(list); err != nil {
+		log.Printf("save notify rules err=%v", err)
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("通知の振り分けルールを更新しました(%d件)", len(list)),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// postNotifyMqttTest : MQTTブローカーへの通知の試験
+func postNotifyMqttTest(c echo.Context) error {
+	r := new(datastore.NotifyRuleEnt)
+	if err := c.Bind(r); err != nil || r.MqttBroker == "" {
+		return echo.ErrBadRequest
+	}
+	for _, e := range datastore.GetNotifyRules() {
+		if e.ID == r.ID {
+			r.MqttPassword = unmaskSecret(r.MqttPassword, e.MqttPassword)
+		}
+	}
+	if err := notify.PublishMqtt(r, []byte(`{"Count":0,"Log":[]}`)); err != nil {
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:  "user",
+			Level: "warn",
+			Event: fmt.Sprintf("MQTTへの通知の試験に失敗しました err=%v", err),
+		})
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: "MQTTへの通知の試験に成功しました",
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
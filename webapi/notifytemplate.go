@@ -0,0 +1,87 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+func getNotifyTemplates(c echo.Context) error {
+	r := []*datastore.NotifyTemplateEnt{}
+	datastore.ForEachNotifyTemplates(func(t *datastore.NotifyTemplateEnt) bool {
+		r = append(r, t)
+		return true
+	})
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Dest != r[j].Dest {
+			return r[i].Dest < r[j].Dest
+		}
+		return r[i].Name < r[j].Name
+	})
+	return c.JSON(http.StatusOK, r)
+}
+
+func postNotifyTemplate(c echo.Context) error {
+	t := new(datastore.NotifyTemplateEnt)
+	if err := c.Bind(t); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := notify.CheckNotifyTemplate(t); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := datastore.UpdateNotifyTemplate(t); err != nil {
+		log.Printf("update notify template err=%v", err)
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("通知テンプレート'%s'を更新しました", t.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteNotifyTemplate(c echo.Context) error {
+	id := c.Param("id")
+	t := datastore.GetNotifyTemplate(id)
+	if t == nil {
+		return echo.ErrBadRequest
+	}
+	if err := datastore.DeleteNotifyTemplate(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("通知テンプレート'%s'を削除しました", t.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+type notifyTemplatePreviewWebAPI struct {
+	Template  datastore.NotifyTemplateEnt
+	EventLogs []*datastore.EventLogEnt
+}
+
+// postNotifyTemplatePreview : 保存前のテンプレートで通知メッセージを作成して返す
+func postNotifyTemplatePreview(c echo.Context) error {
+	req := new(notifyTemplatePreviewWebAPI)
+	if err := c.Bind(req); err != nil {
+		return echo.ErrBadRequest
+	}
+	subject, body, err := notify.PreviewNotifyTemplate(&req.Template, req.EventLogs)
+	r := map[string]string{
+		"Subject": subject,
+		"Body":    body,
+		"Error":   "",
+	}
+	if err != nil {
+		r["Error"] = err.Error()
+	}
+	return c.JSON(http.StatusOK, r)
+}
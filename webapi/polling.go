@@ -2,14 +2,20 @@ package webapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/twsnmp/twsnmpfc/backend"
 	"github.com/twsnmp/twsnmpfc/datastore"
 	"github.com/twsnmp/twsnmpfc/polling"
+	"gopkg.in/yaml.v2"
 )
 
 func copyPolling(to, from string) {
@@ -34,12 +40,15 @@ type pollingsWebAPI struct {
 
 func getPollings(c echo.Context) error {
 	r := pollingsWebAPI{}
+	tag := c.QueryParam("tag")
 	datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
 		r.NodeList = append(r.NodeList, selectEntWebAPI{Text: n.Name, Value: n.ID})
 		return true
 	})
 	datastore.ForEachPollings(func(p *datastore.PollingEnt) bool {
-		r.Pollings = append(r.Pollings, p)
+		if datastore.PollingMatchTagSelector(p, tag) {
+			r.Pollings = append(r.Pollings, p)
+		}
 		return true
 	})
 	return c.JSON(http.StatusOK, r)
@@ -75,14 +84,31 @@ func deletePollings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
 
+// selectPollingIDs : IDの指定がなければタグのセレクタに一致するポーリングを対象にする
+func selectPollingIDs(ids []string, sel string) []string {
+	if len(ids) > 0 || sel == "" {
+		return ids
+	}
+	ret := []string{}
+	datastore.ForEachPollings(func(p *datastore.PollingEnt) bool {
+		if datastore.PollingMatchTagSelector(p, sel) {
+			ret = append(ret, p.ID)
+		}
+		return true
+	})
+	return ret
+}
+
 func setPollingLevel(c echo.Context) error {
 	var params = struct {
-		Level string
-		IDs   []string
+		Level    string
+		IDs      []string
+		Selector string
 	}{}
 	if err := c.Bind(&params); err != nil {
 		return echo.ErrBadRequest
 	}
+	params.IDs = selectPollingIDs(params.IDs, params.Selector)
 	for _, id := range params.IDs {
 		p := datastore.GetPolling(id)
 		if p != nil {
@@ -104,12 +130,14 @@ func setPollingLevel(c echo.Context) error {
 
 func setPollingLogMode(c echo.Context) error {
 	var params = struct {
-		LogMode int
-		IDs     []string
+		LogMode  int
+		IDs      []string
+		Selector string
 	}{}
 	if err := c.Bind(&params); err != nil {
 		return echo.ErrBadRequest
 	}
+	params.IDs = selectPollingIDs(params.IDs, params.Selector)
 	for _, id := range params.IDs {
 		p := datastore.GetPolling(id)
 		if p != nil {
@@ -208,6 +236,8 @@ func postPollingUpdate(c echo.Context) error {
 	p.Retry = pu.Retry
 	p.LogMode = pu.LogMode
 	p.FailAction = pu.FailAction
+	p.Tags = datastore.NormalizeTags(pu.Tags)
+	p.Group = datastore.NormalizeGroup(pu.Group)
 	p.RepairAction = pu.RepairAction
 	p.VectorCols = pu.VectorCols
 	p.MqttURL = pu.MqttURL
@@ -385,3 +415,156 @@ func deletePollingLog(c echo.Context) error {
 	datastore.DeleteAIResult(id)
 	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
 }
+
+type pollingScriptTestWebAPI struct {
+	Script   string
+	Result   map[string]interface{}
+	Interval int
+}
+
+// postPollingScriptTest : サンプルの結果に対してポーリングのスクリプトをテストする
+func postPollingScriptTest(c echo.Context) error {
+	p := new(pollingScriptTestWebAPI)
+	if err := c.Bind(p); err != nil {
+		return echo.ErrBadRequest
+	}
+	if p.Script == "" {
+		return echo.ErrBadRequest
+	}
+	if p.Interval < 1 {
+		p.Interval = 60
+	}
+	return c.JSON(http.StatusOK, polling.RunTestScript(p.Script, p.Result, p.Interval))
+}
+
+func postPollingTemplate(c echo.Context) error {
+	pt := new(datastore.PollingTemplateEnt)
+	if err := c.Bind(pt); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := datastore.UpdatePollingTemplate(pt); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("ポーリングテンプレートを更新しました(%s バージョン=%d)", pt.Name, pt.Version),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deletePollingTemplate(c echo.Context) error {
+	id := c.Param("id")
+	pt := datastore.GetPollingTemplate(id)
+	if pt == nil {
+		return echo.ErrNotFound
+	}
+	name := pt.Name
+	if err := datastore.DeletePollingTemplate(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("ポーリングテンプレートを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// getPollingTemplateHistory : ユーザーのポーリングテンプレートの以前のバージョン
+func getPollingTemplateHistory(c echo.Context) error {
+	id := c.Param("id")
+	if datastore.GetPollingTemplate(id) == nil {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, datastore.GetPollingTemplateHistory(id))
+}
+
+// postRestorePollingTemplate : 以前のバージョンに戻す
+func postRestorePollingTemplate(c echo.Context) error {
+	id := c.Param("id")
+	v, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	pt, err := datastore.RestorePollingTemplate(id, v)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("ポーリングテンプレートをバージョン%dに戻しました(%s バージョン=%d)", v, pt.Name, pt.Version),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// getExportPollingTemplate : ユーザーのポーリングテンプレートをエクスポートする
+// format=jsonの場合はpolling.jsonと同じ形式
+func getExportPollingTemplate(c echo.Context) error {
+	r := []*datastore.PollingTemplateEnt{}
+	datastore.ForEachPollingTemplate(func(pt *datastore.PollingTemplateEnt) bool {
+		if pt.Custom || c.QueryParam("all") == "true" {
+			e := *pt
+			e.ID = ""
+			e.Custom = false
+			r = append(r, &e)
+		}
+		return true
+	})
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Name < r[j].Name
+	})
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: "ポーリングテンプレートをエクスポートしました",
+	})
+	if c.QueryParam("format") == "json" {
+		return c.JSONPretty(http.StatusOK, r, "  ")
+	}
+	y, err := yaml.Marshal(r)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+	return c.Blob(http.StatusOK, "text/yaml", y)
+}
+
+// postImportPollingTemplate : YAMLまたはJSONのポーリングテンプレートを取り込む
+func postImportPollingTemplate(c echo.Context) error {
+	f, err := c.FormFile("file")
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	if f.Size > 1024*1024*20 {
+		return echo.ErrBadRequest
+	}
+	src, err := f.Open()
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	defer src.Close()
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	l := []*datastore.PollingTemplateEnt{}
+	if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "[") {
+		err = json.Unmarshal(b, &l)
+	} else {
+		err = yaml.Unmarshal(b, &l)
+	}
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	n, err := datastore.ImportPollingTemplates(l)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("ポーリングテンプレートをインポートしました(%d件)", n),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
@@ -0,0 +1,228 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/polling"
+)
+
+type remoteExecReqWebAPI struct {
+	Type        string
+	Command     string
+	Port        string
+	Name        string
+	ValueType   string
+	Value       string
+	NodeIDs     []string
+	NodeFilter  string // ノード名またはIPアドレスの正規表現
+	Selector    string // ノードのタグのセレクタ
+	Concurrency int
+}
+
+// 1ノードの出力の最大サイズ
+const remoteExecMaxOutput = 64 * 1024
+
+// postRemoteExec : 複数のノードにコマンドを一括実行するジョブを開始する
+func postRemoteExec(c echo.Context) error {
+	req := new(remoteExecReqWebAPI)
+	if err := c.Bind(req); err != nil {
+		return echo.ErrBadRequest
+	}
+	user := "unknown"
+	if u, ok := c.Get("user").(*jwt.Token); ok {
+		if claims, ok := u.Claims.(jwt.MapClaims); ok {
+			if id, ok := claims["userid"].(string); ok {
+				user = id
+			}
+		}
+	}
+	j, err := newRemoteExecJob(req, user)
+	if err != nil {
+		log.Printf("remote exec err=%v", err)
+		return echo.ErrBadRequest
+	}
+	go runRemoteExecJob(j)
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok", "ID": j.ID})
+}
+
+func getRemoteExecJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetRemoteExecJobs())
+}
+
+func getRemoteExecJob(c echo.Context) error {
+	j := datastore.GetRemoteExecJob(c.Param("id"))
+	if j == nil {
+		return echo.ErrNotFound
+	}
+	return c.JSON(http.StatusOK, j)
+}
+
+func deleteRemoteExecJob(c echo.Context) error {
+	id := c.Param("id")
+	j := datastore.GetRemoteExecJob(id)
+	if j == nil {
+		return echo.ErrNotFound
+	}
+	if j.State == "running" {
+		return echo.ErrBadRequest
+	}
+	if err := datastore.DeleteRemoteExecJob(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// newRemoteExecJob : リクエストをチェックして対象ノードを決定したジョブを作成する
+func newRemoteExecJob(req *remoteExecReqWebAPI, user string) (*datastore.RemoteExecJobEnt, error) {
+	switch req.Type {
+	case "ssh":
+		if req.Command == "" {
+			return nil, fmt.Errorf("no command")
+		}
+		if req.Port == "" {
+			req.Port = "22"
+		}
+	case "snmpset":
+		if req.Name == "" {
+			return nil, fmt.Errorf("no mib name")
+		}
+	default:
+		return nil, fmt.Errorf("invalid type=%s", req.Type)
+	}
+	ids := []string{}
+	if len(req.NodeIDs) > 0 {
+		for _, id := range req.NodeIDs {
+			if datastore.GetNode(id) != nil {
+				ids = append(ids, id)
+			}
+		}
+	} else if req.NodeFilter != "" || req.Selector != "" {
+		var re *regexp.Regexp
+		if req.NodeFilter != "" {
+			var err error
+			if re, err = regexp.Compile(req.NodeFilter); err != nil {
+				return nil, err
+			}
+		}
+		datastore.ForEachNodes(func(n *datastore.NodeEnt) bool {
+			if re != nil && !re.MatchString(n.Name) && !re.MatchString(n.IP) {
+				return true
+			}
+			if datastore.NodeMatchTagSelector(n, req.Selector) {
+				ids = append(ids, n.ID)
+			}
+			return true
+		})
+	}
+	if len(ids) < 1 {
+		return nil, fmt.Errorf("no target node")
+	}
+	if req.Concurrency < 1 || req.Concurrency > 20 {
+		req.Concurrency = 5
+	}
+	j := &datastore.RemoteExecJobEnt{
+		ID:          datastore.NewRemoteExecJobID(),
+		User:        user,
+		Type:        req.Type,
+		Command:     req.Command,
+		Port:        req.Port,
+		Name:        req.Name,
+		ValueType:   req.ValueType,
+		Value:       req.Value,
+		NodeIDs:     ids,
+		Concurrency: req.Concurrency,
+		StartTime:   time.Now().UnixNano(),
+		Results:     []*datastore.RemoteExecResultEnt{},
+	}
+	if err := datastore.StartRemoteExecJob(j); err != nil {
+		return nil, err
+	}
+	target := j.Command
+	if j.Type == "snmpset" {
+		target = fmt.Sprintf("%s=%s", j.Name, j.Value)
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("一括リモート実行を開始しました(%s %s 対象=%d 実行者=%s)", j.Type, target, len(ids), user),
+	})
+	return j, nil
+}
+
+// runRemoteExecJob : 同時実行数を制限してノード毎にコマンドを実行する
+func runRemoteExecJob(j *datastore.RemoteExecJobEnt) {
+	var wg sync.WaitGroup
+	sem := make(chan bool, j.Concurrency)
+	for _, id := range j.NodeIDs {
+		n := datastore.GetNode(id)
+		if n == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- true
+		go func(n *datastore.NodeEnt) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			datastore.AddRemoteExecResult(j, runRemoteExecNode(j, n))
+		}(n)
+	}
+	wg.Wait()
+	ok := 0
+	for _, r := range j.Results {
+		if r.Error == "" && r.ExitCode == 0 {
+			ok++
+		}
+	}
+	if err := datastore.EndRemoteExecJob(j); err != nil {
+		log.Printf("save remote exec job err=%v", err)
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("一括リモート実行が終了しました(%s 成功=%d 失敗=%d 実行者=%s)", j.Type, ok, len(j.Results)-ok, j.User),
+	})
+}
+
+func runRemoteExecNode(j *datastore.RemoteExecJobEnt, n *datastore.NodeEnt) *datastore.RemoteExecResultEnt {
+	r := &datastore.RemoteExecResultEnt{
+		NodeID:   n.ID,
+		NodeName: n.Name,
+		IP:       n.IP,
+	}
+	switch j.Type {
+	case "ssh":
+		timeout := time.Duration(datastore.MapConf.Timeout) * time.Second * 5
+		out, code, err := polling.RunSSHCommand(n, j.Port, j.Command, timeout)
+		if len(out) > remoteExecMaxOutput {
+			out = out[:remoteExecMaxOutput]
+		}
+		r.Output = strings.ToValidUTF8(out, "")
+		r.ExitCode = code
+		if err != nil {
+			r.Error = err.Error()
+		}
+	case "snmpset":
+		if e := snmpset(&mibSetReqWebAPI{
+			NodeID: n.ID,
+			Name:   j.Name,
+			Type:   j.ValueType,
+			Value:  j.Value,
+		}); e != "" {
+			r.Error = e
+			r.ExitCode = -1
+		}
+	}
+	r.Time = time.Now().UnixNano()
+	return r
+}
@@ -0,0 +1,15 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+)
+
+// getCapacityReport : インターフェースの容量計画レポート(95パーセンタイル、ピーク、80%到達予測)
+func getCapacityReport(c echo.Context) error {
+	days, _ := strconv.Atoi(c.QueryParam("days"))
+	return c.JSON(http.StatusOK, datastore.GetCapacityReport(days))
+}
@@ -0,0 +1,35 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+// getReportExport : 定期レポートのPDFやCSVをダウンロードする
+// type=pdf|devices|users|ips|ai|zip id=レポート定義のID(省略時は通知設定の定期レポート)
+func getReportExport(c echo.Context) error {
+	t := c.QueryParam("type")
+	if t == "" {
+		t = "pdf"
+	}
+	var name, ct string
+	var data []byte
+	var err error
+	if id := c.QueryParam("id"); id != "" {
+		if datastore.GetReportDef(id) == nil {
+			return echo.ErrNotFound
+		}
+		name, ct, data, err = notify.ExportReportDef(t, id)
+	} else {
+		name, ct, data, err = notify.ExportReport(t)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+	return c.Blob(http.StatusOK, ct, data)
+}
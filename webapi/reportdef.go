@@ -0,0 +1,73 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+func getReportDefs(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetReportDefs())
+}
+
+func postReportDef(c echo.Context) error {
+	d := new(datastore.ReportDefEnt)
+	if err := c.Bind(d); err != nil {
+		return echo.ErrBadRequest
+	}
+	if d.ID != "" {
+		old := datastore.GetReportDef(d.ID)
+		if old == nil {
+			return echo.ErrNotFound
+		}
+		d.LastSend = old.LastSend
+	}
+	if err := datastore.UpdateReportDef(d); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("レポート定義を更新しました(%s)", d.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteReportDef(c echo.Context) error {
+	id := c.Param("id")
+	d := datastore.GetReportDef(id)
+	if d == nil {
+		return echo.ErrNotFound
+	}
+	name := d.Name
+	if err := datastore.DeleteReportDef(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("レポート定義を削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// postReportDefSend : レポートの定義に従ってすぐにレポートを送信する
+func postReportDefSend(c echo.Context) error {
+	id := c.Param("id")
+	d := datastore.GetReportDef(id)
+	if d == nil {
+		return echo.ErrNotFound
+	}
+	if err := notify.SendReportDef(id); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("レポートを送信しました(%s)", d.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
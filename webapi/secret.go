@@ -0,0 +1,70 @@
+package webapi
+
+import "github.com/twsnmp/twsnmpfc/datastore"
+
+// secretMask : APIで返す秘密情報のマスク
+const secretMask = "********"
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return secretMask
+}
+
+// unmaskSecret : マスクのまま送信された場合は既存の値を使う
+func unmaskSecret(s, old string) string {
+	if s == secretMask {
+		return old
+	}
+	return s
+}
+
+// hasMaskedSecret : 既存の値がないのにマスクのまま送信された秘密情報があるか
+func hasMaskedSecret(list ...string) bool {
+	for _, s := range list {
+		if s == secretMask {
+			return true
+		}
+	}
+	return false
+}
+
+func maskNode(n *datastore.NodeEnt) *datastore.NodeEnt {
+	if n == nil {
+		return nil
+	}
+	r := *n
+	r.Community = maskSecret(n.Community)
+	r.Password = maskSecret(n.Password)
+	r.GNMIPassword = maskSecret(n.GNMIPassword)
+	return &r
+}
+
+func maskNetwork(n *datastore.NetworkEnt) *datastore.NetworkEnt {
+	if n == nil {
+		return nil
+	}
+	r := *n
+	r.Community = maskSecret(n.Community)
+	r.Password = maskSecret(n.Password)
+	return &r
+}
+
+// maskMapConf : 秘密情報をマスクしたマップ設定のコピー
+func maskMapConf() *datastore.MapConfEnt {
+	r := datastore.MapConf
+	r.Community = maskSecret(r.Community)
+	r.SnmpPassword = maskSecret(r.SnmpPassword)
+	r.LLMAPIKey = maskSecret(r.LLMAPIKey)
+	return &r
+}
+
+func maskCredential(c *datastore.CredentialEnt) *datastore.CredentialEnt {
+	r := *c
+	r.Community = maskSecret(c.Community)
+	r.Password = maskSecret(c.Password)
+	r.PrivateKey = maskSecret(c.PrivateKey)
+	r.Token = maskSecret(c.Token)
+	return &r
+}
@@ -0,0 +1,95 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+func getSLAs(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetSLAs())
+}
+
+func postSLA(c echo.Context) error {
+	s := new(datastore.SLAEnt)
+	if err := c.Bind(s); err != nil {
+		return echo.ErrBadRequest
+	}
+	if s.ID != "" {
+		old := datastore.GetSLA(s.ID)
+		if old == nil {
+			return echo.ErrNotFound
+		}
+		s.LastReport = old.LastReport
+	}
+	if err := datastore.UpdateSLA(s); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("SLAを更新しました(%s)", s.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteSLA(c echo.Context) error {
+	id := c.Param("id")
+	s := datastore.GetSLA(id)
+	if s == nil {
+		return echo.ErrNotFound
+	}
+	name := s.Name
+	if err := datastore.DeleteSLA(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("SLAを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// getSLAReport : SLAの月次レポートを取得する
+// month=2006-01(省略時は当月) format=json|csv|html|pdf
+func getSLAReport(c echo.Context) error {
+	month := time.Now()
+	if m := c.QueryParam("month"); m != "" {
+		t, err := time.ParseInLocation("2006-01", m, time.Local)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+		month = t
+	}
+	r, err := datastore.GetSLAReport(c.Param("id"), month)
+	if err == datastore.ErrInvalidID {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	list := []*datastore.SLAReportEnt{r}
+	title := fmt.Sprintf("SLAレポート %s %s", r.Name, r.Month)
+	name := fmt.Sprintf("sla_%s_%s", r.Name, r.Month)
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, r)
+	case "csv":
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+".csv"))
+		return c.Blob(http.StatusOK, "text/csv", notify.SLAReportCSV(list))
+	case "html":
+		h, err := notify.SLAReportHTML(title, list)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.HTML(http.StatusOK, h)
+	case "pdf":
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+".pdf"))
+		return c.Blob(http.StatusOK, "application/pdf", notify.SLAReportPDF(title, list))
+	}
+	return echo.ErrBadRequest
+}
@@ -0,0 +1,82 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/report"
+)
+
+func getThreatFeeds(c echo.Context) error {
+	return c.JSON(http.StatusOK, datastore.GetThreatFeeds())
+}
+
+func postThreatFeed(c echo.Context) error {
+	f := new(datastore.ThreatFeedEnt)
+	if err := c.Bind(f); err != nil {
+		return echo.ErrBadRequest
+	}
+	f.Count = 0
+	f.LastUpdate = 0
+	f.Error = ""
+	if f.ID != "" && datastore.GetThreatFeed(f.ID) == nil {
+		return echo.ErrNotFound
+	}
+	if err := datastore.UpdateThreatFeed(f); err != nil {
+		return echo.ErrBadRequest
+	}
+	if !f.Disabled {
+		go report.LoadThreatFeed(f.ID)
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("脅威情報フィードを更新しました(%s)", f.Name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func deleteThreatFeed(c echo.Context) error {
+	id := c.Param("id")
+	f := datastore.GetThreatFeed(id)
+	if f == nil {
+		return echo.ErrNotFound
+	}
+	name := f.Name
+	if err := datastore.DeleteThreatFeed(id); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("脅威情報フィードを削除しました(%s)", name),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+// postThreatFeedLoad : 脅威情報フィードをすぐに読み込む
+func postThreatFeedLoad(c echo.Context) error {
+	if err := report.LoadThreatFeed(c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+type threatCheckWebAPI struct {
+	Value     string
+	Indicator string
+	Feeds     []string
+}
+
+// getThreatCheck : IPアドレス、ドメイン、ハッシュ値、テキストを脅威情報と照合する
+func getThreatCheck(c echo.Context) error {
+	v := c.QueryParam("value")
+	if v == "" {
+		return echo.ErrBadRequest
+	}
+	r := &threatCheckWebAPI{Value: v}
+	r.Indicator, r.Feeds = datastore.FindThreatIndicator(v)
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,86 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/twsnmp/twsnmpfc/datastore"
+	"github.com/twsnmp/twsnmpfc/notify"
+)
+
+func getTicketConf(c echo.Context) error {
+	r := datastore.TicketConf
+	r.Password = maskSecret(r.Password)
+	r.Token = maskSecret(r.Token)
+	return c.JSON(http.StatusOK, r)
+}
+
+func postTicketConf(c echo.Context) error {
+	tc := new(datastore.TicketConfEnt)
+	if err := c.Bind(tc); err != nil {
+		return echo.ErrBadRequest
+	}
+	tc.Password = unmaskSecret(tc.Password, datastore.TicketConf.Password)
+	tc.Token = unmaskSecret(tc.Token, datastore.TicketConf.Token)
+	if tc.Enable && tc.CreateURL == "" {
+		return echo.ErrBadRequest
+	}
+	datastore.TicketConf = *tc
+	if err := datastore.SaveTicketConf(); err != nil {
+		return echo.ErrBadRequest
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: "チケット連携の設定を更新しました",
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok"})
+}
+
+func postTicketTest(c echo.Context) error {
+	tc := new(datastore.TicketConfEnt)
+	if err := c.Bind(tc); err != nil || tc.CreateURL == "" {
+		return echo.ErrBadRequest
+	}
+	tc.Password = unmaskSecret(tc.Password, datastore.TicketConf.Password)
+	tc.Token = unmaskSecret(tc.Token, datastore.TicketConf.Token)
+	id, err := notify.TicketTest(tc)
+	if err != nil {
+		datastore.AddEventLog(&datastore.EventLogEnt{
+			Type:  "user",
+			Level: "warn",
+			Event: fmt.Sprintf("チケット連携の試験に失敗しました ID=%s err=%v", id, err),
+		})
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	datastore.AddEventLog(&datastore.EventLogEnt{
+		Type:  "user",
+		Level: "info",
+		Event: fmt.Sprintf("チケット連携の試験に成功しました ID=%s", id),
+	})
+	return c.JSON(http.StatusOK, map[string]string{"resp": "ok", "id": id})
+}
+
+type ticketWebAPI struct {
+	*datastore.TicketEnt
+	NodeName    string
+	PollingName string
+}
+
+// getTickets : 作成したチケットのリスト
+func getTickets(c echo.Context) error {
+	r := []ticketWebAPI{}
+	datastore.ForEachTickets(func(t *datastore.TicketEnt) bool {
+		e := ticketWebAPI{TicketEnt: t}
+		if n := datastore.GetNode(t.NodeID); n != nil {
+			e.NodeName = n.Name
+		}
+		if p := datastore.GetPolling(t.PollingID); p != nil {
+			e.PollingName = p.Name
+		}
+		r = append(r, e)
+		return true
+	})
+	return c.JSON(http.StatusOK, r)
+}
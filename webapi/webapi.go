@@ -106,6 +106,8 @@ func setup(p *WebAPI) {
 	r.DELETE("/image/:path", deleteImage)
 	r.POST("/conf/geoip", postGeoIP)
 	r.DELETE("/conf/geoip", deleteGeoIP)
+	r.POST("/conf/asn", postASN)
+	r.DELETE("/conf/asn", deleteASN)
 	r.GET("/conf/notify", getNotifyConf)
 	r.POST("/conf/notify", postNotifyConf)
 	r.GET("/conf/notifySchedule", getNotifySchedule)
@@ -115,6 +117,17 @@ func setup(p *WebAPI) {
 	r.POST("/notify/chat/test", postNotifyChatTest)
 	r.POST("/notify/exec/test", postNotifyExecTest)
 	r.POST("/notify/webhook/test", postNotifyWebhookTest)
+	r.POST("/notify/mqtt/test", postNotifyMqttTest)
+	r.GET("/notify/rules", getNotifyRules)
+	r.POST("/notify/rules", postNotifyRules)
+	r.GET("/notify/templates", getNotifyTemplates)
+	r.POST("/notify/template", postNotifyTemplate)
+	r.DELETE("/notify/template/:id", deleteNotifyTemplate)
+	r.POST("/notify/template/preview", postNotifyTemplatePreview)
+	r.GET("/conf/ticket", getTicketConf)
+	r.POST("/conf/ticket", postTicketConf)
+	r.POST("/ticket/test", postTicketTest)
+	r.GET("/tickets", getTickets)
 	r.POST("/notify/oauth2/hastoken", postNotifyHasValidOAuth2Token)
 	r.GET("/notify/oauth2/gettoken", getNotifyGetOAuth2Token)
 	r.GET("/notify/oauth2/tokenInfo", getNotifyOAuth2TokenInfo)
@@ -132,6 +145,8 @@ func setup(p *WebAPI) {
 	r.GET("/conf/datastore", getDataStore)
 	r.POST("/conf/backup", postBackup)
 	r.POST("/stop/backup", postStopBackup)
+	r.GET("/backupsets", getBackupSets)
+	r.POST("/backupset/verify/:id", postVerifyBackupSet)
 	r.GET("/conf/report", getReportConf)
 	r.POST("/conf/report", postReportConf)
 	r.DELETE("/logs", deleteLogs)
@@ -143,12 +158,15 @@ func setup(p *WebAPI) {
 	r.POST("/discover/stop", postDiscoverStop)
 	r.GET("/nodes", getNodes)
 	r.POST("/nodes/delete", deleteNodes)
+	r.POST("/nodes/tags", postNodeTags)
+	r.GET("/tags", getTags)
 	r.POST("/node/update", postNodeUpdate)
 	r.POST("/nodes/delete_items", deleteDrawItems)
 	r.POST("/item/update", postItemUpdate)
 	r.GET("/node/log/:id", getNodeLog)
 	r.GET("/node/polling/:id", getNodePolling)
 	r.GET("/node/vpanel/:id", getVPanel)
+	r.GET("/node/flow/:id/:index", getNodeFlow)
 	r.GET("/node/hostResource/:id", getHostResource)
 	r.GET("/node/rmon/:id/:type", getRMON)
 	r.GET("/node/port/:id", getPortList)
@@ -170,6 +188,31 @@ func setup(p *WebAPI) {
 	r.DELETE("/line/:id", deleteLineByID)
 	r.POST("/line/add", postLine)
 	r.DELETE("/network/:id", deleteNetwork)
+	r.GET("/credentials", getCredentials)
+	r.POST("/credential", postCredential)
+	r.DELETE("/credential/:id", deleteCredential)
+	r.GET("/federation/sites", getFederationSites)
+	r.POST("/federation/site", postFederationSite)
+	r.DELETE("/federation/site/:id", deleteFederationSite)
+	r.GET("/federation/map/:id", getFederationMap)
+	r.GET("/federation/node/:id/:node", getFederationNode)
+	r.GET("/threat/feeds", getThreatFeeds)
+	r.POST("/threat/feed", postThreatFeed)
+	r.DELETE("/threat/feed/:id", deleteThreatFeed)
+	r.POST("/threat/feed/load/:id", postThreatFeedLoad)
+	r.GET("/threat/check", getThreatCheck)
+	r.GET("/config/archive/:id", getConfigArchiveList)
+	r.GET("/config/archive/:id/:time", getConfigArchive)
+	r.GET("/config/diff/:id", getConfigDiff)
+	r.GET("/compliance/rules", getComplianceRules)
+	r.POST("/compliance/rule", postComplianceRule)
+	r.DELETE("/compliance/rule/:id", deleteComplianceRule)
+	r.GET("/compliance/report", getComplianceReport)
+	r.POST("/compliance/check", postComplianceCheck)
+	r.POST("/remote/exec", postRemoteExec)
+	r.GET("/remote/jobs", getRemoteExecJobs)
+	r.GET("/remote/job/:id", getRemoteExecJob)
+	r.DELETE("/remote/job/:id", deleteRemoteExecJob)
 	r.GET("/findNeighborNetworksAndLines/:id", getFindNeighborNetworksAndLines)
 	r.GET("/checkNetwork/:id", getCheckNetwork)
 	r.POST("/network/update", postNetwork)
@@ -180,6 +223,12 @@ func setup(p *WebAPI) {
 
 	r.GET("/pollings", getPollings)
 	r.GET("/polling/template", getPollingTemplate)
+	r.POST("/polling/template", postPollingTemplate)
+	r.DELETE("/polling/template/:id", deletePollingTemplate)
+	r.GET("/polling/template/:id/history", getPollingTemplateHistory)
+	r.POST("/polling/template/:id/restore/:version", postRestorePollingTemplate)
+	r.GET("/export/pollingTemplate", getExportPollingTemplate)
+	r.POST("/import/pollingTemplate", postImportPollingTemplate)
 	r.POST("/polling/add", postPollingAdd)
 	r.POST("/polling/auto", postPollingAutoAdd)
 	r.GET("/polling/:id", getPolling)
@@ -193,6 +242,7 @@ func setup(p *WebAPI) {
 	r.GET("/polling/check/:id", getPollingCheck)
 	r.GET("/polling/TimeAnalyze/:id", getPollingLogTimeAnalyze)
 	r.DELETE("/polling/clear/:id", deletePollingLog)
+	r.POST("/polling/script/test", postPollingScriptTest)
 	// log
 	r.POST("/log/eventlogs", postEventLogs)
 	r.GET("/log/lastlogs/:st", postLastEventLogs)
@@ -215,6 +265,18 @@ func setup(p *WebAPI) {
 	r.DELETE("/report/server/:id", deleteServer)
 	r.POST("/report/servers/reset", resetServers)
 	r.GET("/report/flows", getFlows)
+	r.GET("/report/flow/topn", getFlowTopN)
+	r.GET("/report/flow/interfaces", getFlowInterfaces)
+	r.GET("/report/capacity", getCapacityReport)
+	r.GET("/report/export", getReportExport)
+	r.GET("/report/defs", getReportDefs)
+	r.POST("/report/def", postReportDef)
+	r.DELETE("/report/def/:id", deleteReportDef)
+	r.POST("/report/def/send/:id", postReportDefSend)
+	r.GET("/slas", getSLAs)
+	r.POST("/sla", postSLA)
+	r.DELETE("/sla/:id", deleteSLA)
+	r.GET("/sla/report/:id", getSLAReport)
 	r.DELETE("/report/flow/:id", deleteFlow)
 	r.GET("/report/fumbleFlows", getFumbleFlows)
 	r.DELETE("/report/fumbleFlow/:id", deleteFumbleFlow)